@@ -0,0 +1,114 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ChannelLog writes chat logs for individual channels. Each channel gets
+// its own directory, holding a log file per day. E.g.:
+//
+//	logs/#channel/20060102.txt
+//
+// Files from previous days are compressed and purged along with the
+// regular logs.
+type ChannelLog struct {
+	m     sync.Mutex
+	dir   string
+	files map[string]*os.File
+}
+
+// NewChannelLog creates a channel log which writes to the given directory.
+func NewChannelLog(dir string) *ChannelLog {
+	return &ChannelLog{
+		dir:   dir,
+		files: make(map[string]*os.File),
+	}
+}
+
+// Printf writes a timestamped line to the log of the given channel.
+func (cl *ChannelLog) Printf(channel, format string, argv ...interface{}) error {
+	cl.m.Lock()
+	defer cl.m.Unlock()
+
+	now := timeNow()
+
+	fd, err := cl.open(channel, now.Format(Format))
+	if err != nil {
+		return err
+	}
+
+	line := fmt.Sprintf(format, argv...)
+	_, err = fmt.Fprintf(fd, "%s %s\n", now.Format("15:04:05"), line)
+	return err
+}
+
+// open returns the log file for the given channel and date stamp. If the
+// channel has a log file open for a different day, that file is closed
+// and compressed. The caller must hold the lock.
+func (cl *ChannelLog) open(channel, stamp string) (*os.File, error) {
+	dir := filepath.Join(cl.dir, ChannelDir(channel))
+	file := filepath.Join(dir, stamp+".txt")
+
+	fd, ok := cl.files[dir]
+	if ok && fd.Name() == file {
+		return fd, nil
+	}
+
+	if ok {
+		fd.Close()
+		delete(cl.files, dir)
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err = os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	cl.files[dir] = fd
+	return fd, compressLogs(dir, file)
+}
+
+// Close closes all open log files.
+func (cl *ChannelLog) Close() {
+	cl.m.Lock()
+	defer cl.m.Unlock()
+
+	for dir, fd := range cl.files {
+		fd.Close()
+		delete(cl.files, dir)
+	}
+}
+
+// ChannelDir returns a directory name for the given channel, which is
+// safe to use on any file system. Channel names are case-insensitive,
+// so the result is lower case.
+func ChannelDir(channel string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("#&+!-_.", r):
+			return r
+		}
+		return '_'
+	}, strings.ToLower(channel))
+
+	// Prevent names like "." and "..".
+	if len(strings.Trim(name, ".")) == 0 {
+		name = strings.Repeat("_", len(name)+1)
+	}
+
+	return name
+}
@@ -7,29 +7,45 @@
 package logger
 
 import (
+	"compress/gzip"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Default log settings.
+const (
+	DefaultPurgeCheck     = time.Hour * 24
+	DefaultRefreshTimeout = time.Minute
+	DefaultExpiration     = time.Hour * 24 * 7 * 2
+)
+
 var (
 	// Format defines the date layout for log file names.
 	Format = "20060102"
 
 	// PurgeCheck defines the timeout after which the bot should
 	// check for stale log files.
-	PurgeCheck = time.Hour * 24
+	PurgeCheck = DefaultPurgeCheck
 
 	// RefreshTimeout determines how often we should check if a new
 	// log file should be opened.
-	RefreshTimeout = time.Minute
+	RefreshTimeout = DefaultRefreshTimeout
 
 	// Expiration defines how old a log file should be, before it
 	// is considered stale.
-	Expiration = time.Hour * 24 * 7 * 2
+	Expiration = DefaultExpiration
+
+	// MaxSize defines the size in bytes, after which a new log file is
+	// started within the same day. These are numbered: 20060102.1.txt,
+	// 20060102.2.txt, etc. A value of zero disables this.
+	MaxSize int64
 )
 
 // These defines some internal state.
@@ -38,14 +54,21 @@ var (
 	startOnce   sync.Once
 	stopOnce    sync.Once
 	logPollQuit = make(chan struct{})
+	timeNow     = time.Now
 )
 
 // Init initializes a new log file, if necessary. It then launches a
 // background service which periodically checks if a new log file should
 // be created. This happens according to a predefined timeout. Additionally,
 // it will periodically purge stale log files from disk.
+//
+// The settings in Expiration, PurgeCheck, RefreshTimeout and MaxSize
+// should be set before calling Init. Durations which are not positive
+// are replaced by their defaults.
 func Init(dir string) {
 	startOnce.Do(func() {
+		validate()
+
 		err := openLog(dir)
 		if err != nil {
 			log.Println("[app] Init log:", err)
@@ -56,6 +79,34 @@ func Init(dir string) {
 	})
 }
 
+// validate replaces invalid settings with their defaults.
+func validate() {
+	if Expiration <= 0 {
+		log.Printf("[log] Invalid log retention %s; using %s", Expiration, DefaultExpiration)
+		Expiration = DefaultExpiration
+	}
+
+	if PurgeCheck <= 0 {
+		PurgeCheck = DefaultPurgeCheck
+	}
+
+	if RefreshTimeout <= 0 {
+		RefreshTimeout = DefaultRefreshTimeout
+	}
+}
+
+// JSON writes the given value to the log as a single line of JSON. The
+// line has no prefix, so each line in the log can be parsed on its own.
+func JSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = log.Writer().Write(append(data, '\n'))
+	return err
+}
+
 // Shutdown shuts down the background log operations.
 func Shutdown() {
 	stopOnce.Do(func() {
@@ -106,9 +157,10 @@ func openLog(dir string) error {
 	}
 
 	// Determine the name of the new log file.
-	timeStamp := time.Now().Format(Format)
-	file := fmt.Sprintf("%s.txt", timeStamp)
-	file = filepath.Join(dir, file)
+	file, err := logName(dir, timeNow())
+	if err != nil {
+		return err
+	}
 
 	// Exit if we're already using this file.
 	if logFile != nil && logFile.Name() == file {
@@ -134,15 +186,135 @@ func openLog(dir string) error {
 	// Set the log prefix to include our process id.
 	// This makes analyzing log data a little easier.
 	log.SetPrefix(fmt.Sprintf("[%d] ", os.Getpid()))
+
+	// Compress the log files which are no longer in use.
+	return compressLogs(dir, file)
+}
+
+// logName returns the name of the log file to use at the given time.
+// If MaxSize is set, this skips files which have already reached it.
+func logName(dir string, now time.Time) (string, error) {
+	timeStamp := now.Format(Format)
+	file := filepath.Join(dir, timeStamp+".txt")
+
+	for n := 1; MaxSize > 0; n++ {
+		fi, err := os.Stat(file)
+		if err == nil && fi.Size() < MaxSize {
+			break
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+
+		// Files which have been cycled out are compressed.
+		if os.IsNotExist(err) {
+			if _, err = os.Stat(file + ".gz"); os.IsNotExist(err) {
+				break
+			}
+		}
+
+		file = filepath.Join(dir, fmt.Sprintf("%s.%d.txt", timeStamp, n))
+	}
+
+	return file, nil
+}
+
+// compressLogs gzips all uncompressed log files in the given directory,
+// except for the current one.
+func compressLogs(dir, current string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file == current {
+			continue
+		}
+
+		err = compressLog(file)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// compressLog writes a gzipped copy of the given file to file.gz and
+// removes the original.
+func compressLog(file string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	// Write to a temporary file first, so an interrupted compression
+	// does not leave a broken archive behind.
+	tmp := file + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(file)
+
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	err = os.Rename(tmp, file+".gz")
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(file)
+}
+
+// logTime returns the date of the given log file. This is taken from the
+// file name, for both plain and compressed logs. For other files, the
+// modification time is used.
+func logTime(file os.FileInfo) time.Time {
+	// Strip extensions and sequence numbers: 20060102.1.txt.gz
+	name := file.Name()
+	if n := strings.IndexByte(name, '.'); n > -1 {
+		name = name[:n]
+	}
+
+	// The file covers the whole day, so it is as old as its end.
+	t, err := time.ParseInLocation(Format, name, time.Local)
+	if err != nil {
+		return file.ModTime()
+	}
+
+	return t.AddDate(0, 0, 1)
+}
+
 // purgeLogs checks the given directory for files which are older than a
 // predefined number of days. If found, the log file in question is deleted.
 // This ensures we do not keep stale logs around unnecessarily.
 func purgeLogs(dir string) error {
 	log.Println("[log] Purging stale log files...")
+	return purgeDir(dir)
+}
 
+// purgeDir deletes stale log files from the given directory. This
+// includes the channel logs in its subdirectories.
+func purgeDir(dir string) error {
 	fd, err := os.Open(dir)
 	if err != nil {
 		return err
@@ -156,11 +328,20 @@ func purgeLogs(dir string) error {
 	}
 
 	for _, file := range files {
-		if time.Since(file.ModTime()) < Expiration {
+		path := filepath.Join(dir, file.Name())
+
+		if file.IsDir() {
+			err = purgeDir(path)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if timeNow().Sub(logTime(file)) < Expiration {
 			continue
 		}
 
-		path := filepath.Join(dir, file.Name())
 		err = os.Remove(path)
 		if err != nil {
 			return err
@@ -0,0 +1,305 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package logger
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setTime makes the logger use the given time as the current time.
+func setTime(t *testing.T, now time.Time) {
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+}
+
+// closeLog restores the default log output.
+func closeLog() {
+	log.SetOutput(os.Stderr)
+	log.SetPrefix("")
+
+	if logFile != nil {
+		logFile.Close()
+		logFile = nil
+	}
+}
+
+func TestCompressCycledLog(t *testing.T) {
+	dir := t.TempDir()
+	defer closeLog()
+
+	day := time.Date(2023, 1, 1, 23, 59, 0, 0, time.Local)
+	setTime(t, day)
+
+	if err := openLog(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("bericht van gisteren")
+
+	setTime(t, day.Add(time.Minute*2))
+
+	if err := openLog(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("bericht van vandaag")
+
+	old := filepath.Join(dir, "20230101.txt")
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatalf("uncompressed log %q still exists", old)
+	}
+
+	fd, err := os.Open(old + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer fd.Close()
+
+	zr, err := gzip.NewReader(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), "bericht van gisteren") {
+		t.Fatalf("compressed log is missing data: %q", data)
+	}
+
+	// The current day's log remains uncompressed.
+	data, err = ioutil.ReadFile(filepath.Join(dir, "20230102.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), "bericht van vandaag") {
+		t.Fatalf("current log is missing data: %q", data)
+	}
+}
+
+func TestPurgeCompressedLogs(t *testing.T) {
+	dir := t.TempDir()
+	defer closeLog()
+
+	now := time.Date(2023, 2, 1, 12, 0, 0, 0, time.Local)
+	setTime(t, now)
+
+	files := map[string]bool{
+		"20230101.txt.gz": false,
+		"20230125.txt.gz": true,
+		"20230201.txt":    true,
+		"20230105.3.txt":  false,
+		"20230130.1.txt":  true,
+	}
+
+	for name := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := purgeLogs(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, keep := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if keep && err != nil {
+			t.Fatalf("log %q should have been kept: %v", name, err)
+		}
+		if !keep && !os.IsNotExist(err) {
+			t.Fatalf("log %q should have been purged", name)
+		}
+	}
+}
+
+func TestCycleBySize(t *testing.T) {
+	dir := t.TempDir()
+	defer closeLog()
+
+	MaxSize = 100
+	defer func() { MaxSize = 0 }()
+
+	setTime(t, time.Date(2023, 1, 1, 12, 0, 0, 0, time.Local))
+
+	want := []string{
+		"20230101.txt",
+		"20230101.txt",
+		"20230101.1.txt",
+		"20230101.1.txt",
+		"20230101.2.txt",
+	}
+
+	for i, name := range want {
+		if err := openLog(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		if have := filepath.Base(logFile.Name()); have != name {
+			t.Fatalf("log file mismatch at %d;\nwant: %q\nhave: %q", i, name, have)
+		}
+
+		log.Print(strings.Repeat("x", 60))
+	}
+
+	// Cycled files are compressed. These must not be reused.
+	for _, name := range []string{"20230101.txt.gz", "20230101.1.txt.gz"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	closeLog()
+
+	if err := openLog(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if have := filepath.Base(logFile.Name()); have != "20230101.2.txt" {
+		t.Fatalf("log file mismatch after restart;\nwant: %q\nhave: %q", "20230101.2.txt", have)
+	}
+}
+
+func TestShortRetention(t *testing.T) {
+	dir := t.TempDir()
+	defer closeLog()
+
+	Expiration = time.Hour * 24 * 2
+	defer func() { Expiration = DefaultExpiration }()
+
+	setTime(t, time.Date(2023, 1, 10, 12, 0, 0, 0, time.Local))
+
+	files := map[string]bool{
+		"20230107.txt.gz": false,
+		"20230108.txt.gz": true,
+		"20230109.1.txt":  true,
+		"20230110.txt":    true,
+	}
+
+	for name := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := purgeLogs(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, keep := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if keep && err != nil {
+			t.Fatalf("log %q should have been kept: %v", name, err)
+		}
+		if !keep && !os.IsNotExist(err) {
+			t.Fatalf("log %q should have been purged", name)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	Expiration, PurgeCheck, RefreshTimeout = -time.Hour, 0, time.Second
+	defer func() {
+		Expiration = DefaultExpiration
+		PurgeCheck = DefaultPurgeCheck
+		RefreshTimeout = DefaultRefreshTimeout
+	}()
+
+	validate()
+
+	if Expiration != DefaultExpiration || PurgeCheck != DefaultPurgeCheck || RefreshTimeout != time.Second {
+		t.Fatalf("settings mismatch;\nhave: %s, %s, %s", Expiration, PurgeCheck, RefreshTimeout)
+	}
+}
+
+func TestPurgeChannelLogs(t *testing.T) {
+	dir := t.TempDir()
+	defer closeLog()
+
+	setTime(t, time.Date(2023, 2, 1, 12, 0, 0, 0, time.Local))
+
+	chdir := filepath.Join(dir, "#test")
+	if err := os.Mkdir(chdir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"20230101.txt.gz", "20230131.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(chdir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := purgeLogs(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(chdir, "20230101.txt.gz")); !os.IsNotExist(err) {
+		t.Fatalf("stale channel log should have been purged")
+	}
+
+	if _, err := os.Stat(filepath.Join(chdir, "20230131.txt")); err != nil {
+		t.Fatalf("channel log should have been kept: %v", err)
+	}
+}
+
+func TestChannelDir(t *testing.T) {
+	for in, want := range map[string]string{
+		"#Test":       "#test",
+		"#a/b\\c":     "#a_b_c",
+		"&local":      "&local",
+		"#kanaal één": "#kanaal___n",
+		"..":          "___",
+		"":            "_",
+	} {
+		if have := ChannelDir(in); want != have {
+			t.Fatalf("dir mismatch for %q;\nwant: %q\nhave: %q", in, want, have)
+		}
+	}
+}
+
+func TestChannelLogCycle(t *testing.T) {
+	dir := t.TempDir()
+
+	cl := NewChannelLog(dir)
+	defer cl.Close()
+
+	day := time.Date(2023, 1, 1, 23, 59, 0, 0, time.Local)
+	setTime(t, day)
+
+	if err := cl.Printf("#Test", "<%s> %s", "steve", "gisteren"); err != nil {
+		t.Fatal(err)
+	}
+
+	setTime(t, day.Add(time.Minute*2))
+
+	if err := cl.Printf("#test", "<%s> %s", "steve", "vandaag"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "#test", "20230101.txt.gz")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "#test", "20230102.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "00:01:00 <steve> vandaag\n"; string(data) != want {
+		t.Fatalf("log mismatch;\nwant: %q\nhave: %q", want, data)
+	}
+}
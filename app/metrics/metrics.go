@@ -0,0 +1,175 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package metrics keeps track of some basic runtime statistics and can
+// serve them over HTTP, for the benefit of external monitoring tools.
+//
+// The following paths are served:
+//
+//	/health   Reports if the bot is connected. This responds with status
+//	          503 while the connection is down.
+//	/metrics  Reports all statistics as a JSON object.
+package metrics
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// timeNow returns the current time. Tests can replace it.
+var timeNow = time.Now
+
+var (
+	m           sync.Mutex
+	started     = timeNow()
+	connected   bool
+	connectedAt time.Time
+	connections uint64
+	messagesIn  uint64
+	messagesOut uint64
+	commands    = make(map[string]uint64)
+)
+
+// Stats defines the statistics reported by the /metrics path. Durations
+// are in seconds.
+type Stats struct {
+	Connected    bool              `json:"connected"`
+	Uptime       int64             `json:"uptime"`
+	ConnectedFor int64             `json:"connected_for"`
+	Reconnects   uint64            `json:"reconnects"`
+	MessagesIn   uint64            `json:"messages_in"`
+	MessagesOut  uint64            `json:"messages_out"`
+	Commands     map[string]uint64 `json:"commands"`
+}
+
+// SetConnected records a change in the connection state. Each new
+// connection after the first one counts as a reconnect.
+func SetConnected(v bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	if v && !connected {
+		connections++
+		connectedAt = timeNow()
+	}
+
+	connected = v
+}
+
+// MessageIn counts a message received from the server.
+func MessageIn() {
+	m.Lock()
+	messagesIn++
+	m.Unlock()
+}
+
+// MessageOut counts a message sent to the server.
+func MessageOut() {
+	m.Lock()
+	messagesOut++
+	m.Unlock()
+}
+
+// Command counts a command call handled by the given plugin.
+func Command(plugin string) {
+	m.Lock()
+	commands[plugin]++
+	m.Unlock()
+}
+
+// Snapshot returns the current statistics.
+func Snapshot() *Stats {
+	m.Lock()
+	defer m.Unlock()
+
+	now := timeNow()
+	s := &Stats{
+		Connected:   connected,
+		Uptime:      int64(now.Sub(started) / time.Second),
+		MessagesIn:  messagesIn,
+		MessagesOut: messagesOut,
+		Commands:    make(map[string]uint64, len(commands)),
+	}
+
+	if connected {
+		s.ConnectedFor = int64(now.Sub(connectedAt) / time.Second)
+	}
+
+	if connections > 1 {
+		s.Reconnects = connections - 1
+	}
+
+	for k, v := range commands {
+		s.Commands[k] = v
+	}
+
+	return s
+}
+
+// Handler returns a handler which serves the /health and /metrics paths.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", serveHealth)
+	mux.HandleFunc("/metrics", serveMetrics)
+	return mux
+}
+
+// Serve starts serving the metrics on the given address, in a separate
+// goroutine. The returned server should be closed when the bot shuts down.
+func Serve(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http.Server{
+		Handler:      Handler(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		err := srv.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			log.Println("[metrics] Serve:", err)
+		}
+	}()
+
+	log.Println("[metrics] Listening on:", ln.Addr())
+	return srv, nil
+}
+
+// serveHealth reports if the bot is connected.
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	status := struct {
+		Status string `json:"status"`
+	}{"ok"}
+
+	code := http.StatusOK
+	if !Snapshot().Connected {
+		status.Status = "disconnected"
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, &status)
+}
+
+// serveMetrics reports all statistics.
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Snapshot())
+}
+
+// writeJSON writes v as the JSON encoded response body.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Println("[metrics] Encode:", err)
+	}
+}
@@ -0,0 +1,135 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// reset clears all statistics and fixes the clock at the given time.
+func reset(t *testing.T, now time.Time) {
+	m.Lock()
+	timeNow = func() time.Time { return now }
+	started = now
+	connected = false
+	connectedAt = time.Time{}
+	connections = 0
+	messagesIn = 0
+	messagesOut = 0
+	commands = make(map[string]uint64)
+	m.Unlock()
+
+	t.Cleanup(func() { timeNow = time.Now })
+}
+
+// get performs a request for the given path and decodes the JSON
+// response into v. It returns the response status code.
+func get(t *testing.T, path string, v interface{}) int {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("content type mismatch;\nwant: %q\nhave: %q", "application/json", ct)
+	}
+
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.String(), err)
+	}
+
+	return w.Code
+}
+
+func TestMetrics(t *testing.T) {
+	start := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	reset(t, start)
+
+	SetConnected(true)
+	SetConnected(false)
+	SetConnected(true)
+	SetConnected(true)
+
+	MessageIn()
+	MessageIn()
+	MessageOut()
+	Command("weather")
+	Command("weather")
+	Command("admin")
+
+	timeNow = func() time.Time { return start.Add(90 * time.Second) }
+
+	var data map[string]interface{}
+	if code := get(t, "/metrics", &data); code != http.StatusOK {
+		t.Fatalf("status mismatch;\nwant: %d\nhave: %d", http.StatusOK, code)
+	}
+
+	want := map[string]interface{}{
+		"connected":     true,
+		"uptime":        90.0,
+		"connected_for": 90.0,
+		"reconnects":    1.0,
+		"messages_in":   2.0,
+		"messages_out":  1.0,
+	}
+
+	for key, value := range want {
+		if data[key] != value {
+			t.Fatalf("%s mismatch;\nwant: %v\nhave: %v", key, value, data[key])
+		}
+	}
+
+	cmds, ok := data["commands"].(map[string]interface{})
+	if !ok || cmds["weather"] != 2.0 || cmds["admin"] != 1.0 {
+		t.Fatalf("commands mismatch; have: %v", data["commands"])
+	}
+}
+
+func TestCountersIncrement(t *testing.T) {
+	reset(t, time.Now())
+
+	var before, after Stats
+	get(t, "/metrics", &before)
+
+	MessageIn()
+	MessageOut()
+	MessageOut()
+	Command("url")
+
+	get(t, "/metrics", &after)
+
+	if after.MessagesIn != before.MessagesIn+1 {
+		t.Fatalf("messages in mismatch;\nwant: %d\nhave: %d",
+			before.MessagesIn+1, after.MessagesIn)
+	}
+
+	if after.MessagesOut != before.MessagesOut+2 {
+		t.Fatalf("messages out mismatch;\nwant: %d\nhave: %d",
+			before.MessagesOut+2, after.MessagesOut)
+	}
+
+	if after.Commands["url"] != 1 {
+		t.Fatalf("command count mismatch;\nwant: 1\nhave: %d", after.Commands["url"])
+	}
+}
+
+func TestHealth(t *testing.T) {
+	reset(t, time.Now())
+
+	var status struct{ Status string }
+
+	if code := get(t, "/health", &status); code != http.StatusServiceUnavailable || status.Status != "disconnected" {
+		t.Fatalf("health mismatch;\nwant: %d disconnected\nhave: %d %s",
+			http.StatusServiceUnavailable, code, status.Status)
+	}
+
+	SetConnected(true)
+
+	if code := get(t, "/health", &status); code != http.StatusOK || status.Status != "ok" {
+		t.Fatalf("health mismatch;\nwant: %d ok\nhave: %d %s",
+			http.StatusOK, code, status.Status)
+	}
+}
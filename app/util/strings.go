@@ -0,0 +1,15 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package util
+
+const (
+	TextDurationDay     = "dag"
+	TextDurationDays    = "dagen"
+	TextDurationHour    = "uur"
+	TextDurationHours   = "uur"
+	TextDurationMinute  = "minuut"
+	TextDurationMinutes = "minuten"
+	TextDurationNone    = "minder dan een minuut"
+	TextDurationAnd     = "en"
+)
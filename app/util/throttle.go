@@ -0,0 +1,58 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// NotConfiguredError is returned when a feature can not be used, because
+// it requires settings which have not been provided. E.g.: an API key.
+type NotConfiguredError struct {
+	Feature string // Name of the unconfigured feature. E.g.: "YouTube".
+}
+
+func (e *NotConfiguredError) Error() string {
+	return e.Feature + ": not configured"
+}
+
+// Throttle limits how often an action may be performed for a given key.
+// E.g.: sending a notice to a specific channel.
+type Throttle struct {
+	m        sync.Mutex
+	interval time.Duration
+	last     map[string]time.Time
+}
+
+// NewThrottle creates a throttle which allows an action once per the
+// given interval, for each key.
+func NewThrottle(interval time.Duration) *Throttle {
+	return &Throttle{
+		interval: interval,
+		last:     make(map[string]time.Time),
+	}
+}
+
+// Allow returns true if the action may be performed for the given key.
+// If so, the key is blocked until the interval has passed.
+func (t *Throttle) Allow(key string) bool {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	now := time.Now()
+	if last, ok := t.last[key]; ok && now.Sub(last) < t.interval {
+		return false
+	}
+
+	// Forget keys which have expired, so the map does not keep growing.
+	for k, v := range t.last {
+		if now.Sub(v) >= t.interval {
+			delete(t.last, k)
+		}
+	}
+
+	t.last[key] = now
+	return true
+}
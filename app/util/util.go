@@ -11,6 +11,9 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Action returns the given, formatted message as a user action.
@@ -29,6 +32,63 @@ func Italic(f string, argv ...interface{}) string {
 	return fmt.Sprintf("\x1d%s\x1d", fmt.Sprintf(f, argv...))
 }
 
+// FormatDuration returns a human readable version of the given duration.
+// E.g.: "2 dagen, 3 uur en 12 minuten". It is rounded to the nearest
+// minute. Components which are zero are omitted.
+func FormatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Minute {
+		return TextDurationNone
+	}
+
+	days := int(d / (24 * time.Hour))
+	hours := int(d/time.Hour) % 24
+	minutes := int(d/time.Minute) % 60
+
+	var parts []string
+	add := func(n int, one, many string) {
+		switch {
+		case n == 1:
+			parts = append(parts, "1 "+one)
+		case n > 1:
+			parts = append(parts, strconv.Itoa(n)+" "+many)
+		}
+	}
+
+	add(days, TextDurationDay, TextDurationDays)
+	add(hours, TextDurationHour, TextDurationHours)
+	add(minutes, TextDurationMinute, TextDurationMinutes)
+
+	if len(parts) == 1 {
+		return parts[0]
+	}
+
+	return strings.Join(parts[:len(parts)-1], ", ") + " " +
+		TextDurationAnd + " " + parts[len(parts)-1]
+}
+
+// ExpandEnv replaces ${VAR} and $VAR references in v with the values of
+// the corresponding environment variables. Undefined variables are replaced
+// with an empty string. Use $$ for a literal $. This allows secrets, like
+// passwords and API keys, to be kept out of configuration files.
+func ExpandEnv(v string) string {
+	if strings.IndexByte(v, '$') == -1 {
+		return v
+	}
+
+	return os.Expand(v, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		return os.Getenv(name)
+	})
+}
+
+// EscapeEnv escapes v, so ExpandEnv returns it unchanged.
+func EscapeEnv(v string) string {
+	return strings.Replace(v, "$", "$$", -1)
+}
+
 // Underline returns the given value as underlined text.
 func Underline(f string, argv ...interface{}) string {
 	return fmt.Sprintf("\x1f%s\x1f", fmt.Sprintf(f, argv...))
@@ -0,0 +1,69 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package util
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("AUTIMAAT_TEST_PASS", "hunter2")
+	os.Setenv("AUTIMAAT_TEST_KEY", "abc123")
+	os.Unsetenv("AUTIMAAT_TEST_UNSET")
+
+	defer os.Unsetenv("AUTIMAAT_TEST_PASS")
+	defer os.Unsetenv("AUTIMAAT_TEST_KEY")
+
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"plain", "plain"},
+		{"$AUTIMAAT_TEST_PASS", "hunter2"},
+		{"${AUTIMAAT_TEST_PASS}", "hunter2"},
+		{"key-${AUTIMAAT_TEST_KEY}-x", "key-abc123-x"},
+		{"$AUTIMAAT_TEST_PASS/$AUTIMAAT_TEST_KEY", "hunter2/abc123"},
+		{"$AUTIMAAT_TEST_UNSET", ""},
+		{"$$AUTIMAAT_TEST_PASS", "$AUTIMAAT_TEST_PASS"},
+		{"price: 5$$", "price: 5$"},
+	} {
+		have := ExpandEnv(tt.in)
+		if have != tt.want {
+			t.Fatalf("ExpandEnv mismatch for %q;\nwant: %q\nhave: %q", tt.in, tt.want, have)
+		}
+
+		if have := ExpandEnv(EscapeEnv(tt.in)); have != tt.in {
+			t.Fatalf("EscapeEnv mismatch for %q;\nwant: %q\nhave: %q", tt.in, tt.in, have)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for _, tt := range []struct {
+		in   time.Duration
+		want string
+	}{
+		{-time.Hour, "minder dan een minuut"},
+		{0, "minder dan een minuut"},
+		{29 * time.Second, "minder dan een minuut"},
+		{30 * time.Second, "1 minuut"},
+		{time.Minute, "1 minuut"},
+		{89 * time.Second, "1 minuut"},
+		{90 * time.Second, "2 minuten"},
+		{59*time.Minute + 45*time.Second, "1 uur"},
+		{time.Hour + time.Minute, "1 uur en 1 minuut"},
+		{3*time.Hour + 12*time.Minute, "3 uur en 12 minuten"},
+		{24 * time.Hour, "1 dag"},
+		{24*time.Hour + 5*time.Minute, "1 dag en 5 minuten"},
+		{50*time.Hour + 12*time.Minute, "2 dagen, 2 uur en 12 minuten"},
+		{400 * 24 * time.Hour, "400 dagen"},
+	} {
+		have := FormatDuration(tt.in)
+		if have != tt.want {
+			t.Fatalf("FormatDuration mismatch for %s;\nwant: %q\nhave: %q", tt.in, tt.want, have)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff returns the delay before the given reconnect attempt. The first
+// attempt has index 0. The delay doubles with each attempt, starting at min
+// and capped at max. Some random jitter is applied, so the result lies
+// between half of the computed delay and the full delay. This keeps
+// multiple clients from reconnecting in lockstep.
+func backoff(attempt int, min, max time.Duration, rng *rand.Rand) time.Duration {
+	if min <= 0 {
+		min = time.Second
+	}
+
+	if max < min {
+		max = min
+	}
+
+	delay := min
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		delay = max
+	}
+
+	half := int64(delay / 2)
+	return time.Duration(half + rng.Int63n(half+1))
+}
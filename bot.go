@@ -10,15 +10,20 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net"
 	"os"
 	"os/exec"
 	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/monkeybird/autimaat/app"
 	"github.com/monkeybird/autimaat/app/logger"
+	"github.com/monkeybird/autimaat/app/metrics"
 	"github.com/monkeybird/autimaat/irc"
 	"github.com/monkeybird/autimaat/irc/proto"
 	"github.com/monkeybird/autimaat/plugins"
@@ -27,6 +32,7 @@ import (
 	_ "github.com/monkeybird/autimaat/plugins/admin"
 	_ "github.com/monkeybird/autimaat/plugins/alarm"
 	_ "github.com/monkeybird/autimaat/plugins/dictionary"
+	_ "github.com/monkeybird/autimaat/plugins/stats"
 	_ "github.com/monkeybird/autimaat/plugins/url"
 	_ "github.com/monkeybird/autimaat/plugins/weather"
 )
@@ -40,14 +46,28 @@ var connectionCount uint
 // gracefully closing down
 var shuttingDown bool = false
 
+// fatalf is called when the bot can not continue. It logs the message
+// and exits the process. Tests can replace it.
+var fatalf = log.Fatalf
+
 func init() {
 	flag.UintVar(&connectionCount, "fork", 0, "Number of inherited file descriptors")
 }
 
 // Bot defines state for a single IRC bot.
 type Bot struct {
-	profile irc.Profile
-	client  *Client
+	profile   irc.Profile
+	client    *Client
+	queue     *SendQueue
+	keepalive *keepalive
+	forked    bool
+	config    *tls.Config
+	quit      chan struct{}
+
+	// fatal is set when the server refuses us in a way which reconnecting
+	// will not fix. E.g.: a wrong connection password.
+	m     sync.Mutex
+	fatal error
 }
 
 // Run creates a new connection to the server and begins processing
@@ -55,6 +75,10 @@ type Bot struct {
 // as the connection is active.
 func Run(p irc.Profile) error {
 	// Initialize the log and ensure it is properly stopped when we are done.
+	logger.Expiration = p.LogRetention()
+	logger.PurgeCheck = p.LogPurgeInterval()
+	logger.RefreshTimeout = p.LogRefreshInterval()
+	logger.MaxSize = p.LogMaxSize()
 	logger.Init("logs")
 	defer logger.Shutdown()
 
@@ -62,6 +86,22 @@ func Run(p irc.Profile) error {
 		app.Name, app.VersionMajor, app.VersionMinor, app.VersionRevision)
 	defer log.Println("[bot] Shutting down")
 
+	// Serve health and metrics data, if applicable.
+	if addr := p.MetricsAddr(); len(addr) > 0 {
+		srv, err := metrics.Serve(addr)
+		if err != nil {
+			log.Println("[bot] Metrics:", err)
+		} else {
+			defer srv.Close()
+		}
+	}
+
+	// Older profiles have no owners. Everyone on the whitelist is one.
+	if len(p.Owners()) == 0 {
+		log.Println("[bot] WARNING: No owners defined in the profile." +
+			" All whitelisted users can manage the whitelist and the bot.")
+	}
+
 	// Initialize plugins.
 	plugins.Load(p)
 	defer plugins.Unload(p)
@@ -71,6 +111,9 @@ func Run(p irc.Profile) error {
 	var bot Bot
 	bot.profile = p
 	bot.client = NewClient(bot.payloadHandler)
+	bot.queue = NewSendQueue(bot.client, p.FloodBurst(), p.FloodInterval())
+	bot.keepalive = newKeepalive(bot.queue, p.PingInterval(), p.PingTimeout(), bot.pingTimeout)
+	bot.quit = make(chan struct{})
 	return bot.run()
 }
 
@@ -83,14 +126,57 @@ func (b *Bot) run() error {
 		return err
 	}
 
-	// Make connection available to plugins
-	irc.Connection = b.client
+	// Make connection available to plugins. All output goes through
+	// the send queue, so we do not flood the server.
+	irc.Connection = b.queue
 
 	// Spin up the connection's read loop.
-	go func() {
+	go b.readLoop()
+
+	// Wait for external signals. Either to cleanly shut the bot down,
+	// or to initiate the forking process.
+	wait(b)
+	return b.shutdown()
+}
+
+// shutdown closes the connection. If the connection is not being passed
+// on to a forked child process, the server is sent a QUIT message first.
+// This happens with a short deadline, so a stalled connection can not
+// keep the bot from shutting down.
+func (b *Bot) shutdown() error {
+	shuttingDown = true
+	close(b.quit)
+
+	if !b.forked {
+		msg := b.profile.QuitMessage()
+		if len(msg) == 0 {
+			msg = fmt.Sprintf("%s %d.%d", app.Name, app.VersionMajor, app.VersionMinor)
+		}
+
+		b.client.SetWriteDeadline(time.Now().Add(QuitTimeout))
+		proto.Quit(b.client, msg)
+	}
+
+	return b.queue.Close()
+}
+
+// readLoop runs the client's read loop. If the connection is lost, it
+// attempts to re-establish it. This is done with an exponential backoff
+// between attempts. Plugins are left as they are. Channels are rejoined
+// once the server accepts the new login. This includes connections closed
+// by the server, after an ERROR message. Only if the server refused us
+// for good, does the process exit.
+//
+// While the connection is open, the keepalive checks if the server is
+// still responding. If not, it closes the connection, so it can be
+// re-established.
+func (b *Bot) readLoop() {
+	for {
 		log.Println("[bot] Entering data loop...")
 
+		b.keepalive.Start()
 		err := b.client.Run()
+		b.keepalive.Stop()
 
 		// err will always be non-nil here
 		if e, ok := err.(*net.OpError); ok {
@@ -107,17 +193,75 @@ func (b *Bot) run() error {
 			}
 		}
 
-		// Any other error is fatal, so a supervisor like systemd can
-		// try to restart the bot.
-		log.Fatal("[bot] exit 1: ", err)
+		log.Println("[bot] Connection lost:", err)
+		metrics.SetConnected(false)
+		b.client.Close()
 
-	}()
+		if err := b.fatalError(); err != nil {
+			fatalf("[bot] exit 1: %v", err)
+			return
+		}
 
-	// Wait for external signals. Either to cleanly shut the bot down,
-	// or to initiate the forking process.
-	wait(b)
-	shuttingDown = true
-	return b.client.Close()
+		if !b.reconnect() {
+			return
+		}
+	}
+}
+
+// reconnect attempts to re-establish the connection to the server.
+// Returns false if the bot is shutting down. If the maximum number of
+// attempts is exceeded, the process exits, so a supervisor like systemd
+// can try to restart the bot.
+func (b *Bot) reconnect() bool {
+	p := b.profile
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for attempt := 0; ; attempt++ {
+		if p.ReconnectRetries() > 0 && attempt >= p.ReconnectRetries() {
+			fatalf("[bot] exit 1: giving up after %d reconnect attempts", attempt)
+			return false
+		}
+
+		delay := backoff(attempt, p.ReconnectMinDelay(), p.ReconnectMaxDelay(), rng)
+		log.Printf("[bot] Reconnecting in %s...", delay)
+
+		select {
+		case <-b.quit:
+			return false
+		case <-time.After(delay):
+		}
+
+		err := b.connect()
+		if err == nil {
+			return true
+		}
+
+		log.Println("[bot] Reconnect failed:", err)
+	}
+}
+
+// setFatal records a reason for the server refusing us, which reconnecting
+// will not fix, and closes the connection. The read loop then exits the
+// process.
+func (b *Bot) setFatal(err error) {
+	b.m.Lock()
+	b.fatal = err
+	b.m.Unlock()
+
+	b.client.Close()
+}
+
+// fatalError returns the error recorded by setFatal, if any.
+func (b *Bot) fatalError() error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.fatal
+}
+
+// pingTimeout is called when the server failed to answer a keepalive PING.
+// It closes the connection, which makes the read loop reconnect.
+func (b *Bot) pingTimeout() {
+	b.client.Close()
 }
 
 // payloadHandler handles incoming server messages.
@@ -129,106 +273,261 @@ func (b *Bot) payloadHandler(payload []byte) {
 		return
 	}
 
-	// If Target points to the bot's own name, then this message came from
+	metrics.MessageIn()
+
+	// Drop messages from ignored users, whether or not the server
+	// supports SILENCE.
+	if b.isIgnored(&r) {
+		return
+	}
+
+	// If a message or invite targets the bot's own name, then it came from
 	// a user as a PM. Change the Target to the sender's name, so any replies
 	// we create, end up at the right destination. In any other case, the
 	// target is set to the channel name from whence the message came.
-	if b.profile.IsNick(r.Target) {
+	// Other messages keep their target. E.g.: a NICK message for our own
+	// nick change names the new nick, which is already in the profile.
+	if isDirected(&r) && b.profile.IsNick(r.Target) {
 		r.Target = r.SenderName
 	}
 
 	// Run the appropriate handler for housekeeping.
 	switch r.Type {
 	case "ERROR":
+		// The server is about to close the connection. Don't wait for
+		// it, so the read loop can reconnect right away.
 		log.Println("[bot] Network error:", r.Data)
+		b.client.Close()
+		return
+
+	case "464": // received PASSWDMISMATCH
+		b.setFatal(fmt.Errorf("connection password rejected: %s", r.Data))
+		return
+
+	case "465": // received YOUREBANNEDCREEP
+		b.setFatal(fmt.Errorf("banned from server: %s", r.Data))
 		return
 
 	case "PING":
-		proto.Pong(b.client, r.Data)
+		proto.Pong(b.queue, r.Data)
+		return
+
+	case "PONG":
+		b.keepalive.Pong(r.Data)
+		return
+	}
+
+	// Answer CTCP queries.
+	if handleCtcp(b.queue, &r, b.profile.CtcpVersion()) {
 		return
 	}
 
 	// Notify plugins of message.
-	plugins.Dispatch(b.client, &r)
+	plugins.Dispatch(b.queue, &r)
 
 	// Log request if applicable.
 	if b.profile.Logging() {
+		b.logRequest(&r)
+	}
+}
+
+// isDirected returns true if the given request is a message or invite,
+// which a user may send to the bot directly.
+func isDirected(r *irc.Request) bool {
+	switch r.Type {
+	case "PRIVMSG", "NOTICE", "INVITE":
+		return true
+	}
+	return false
+}
+
+// isIgnored returns true if the given request is a message or invite from
+// a user in the profile's ignore list. Other requests, like JOIN, NICK or
+// QUIT, are still needed for housekeeping and are never ignored. Neither
+// are messages from the server itself or from owners of the bot.
+func (b *Bot) isIgnored(r *irc.Request) bool {
+	switch r.Type {
+	case "PRIVMSG", "NOTICE", "INVITE":
+	default:
+		return false
+	}
+
+	if len(r.SenderName) == 0 || r.SenderName == r.SenderMask {
+		return false
+	}
+
+	if b.profile.IsOwner(r.SenderMask) {
+		return false
+	}
+
+	return b.profile.IsIgnored(r.SenderName + "!" + r.SenderMask)
+}
+
+// logEntry defines the fields of a request, as written to the log in
+// JSON format.
+type logEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Sender    string    `json:"sender"`
+	Mask      string    `json:"mask"`
+	Type      string    `json:"type"`
+	Target    string    `json:"target"`
+	Data      string    `json:"data"`
+}
+
+// logRequest writes the given request to the log, either as plain text
+// or as JSON, depending on the profile.
+func (b *Bot) logRequest(r *irc.Request) {
+	if !b.profile.JSONLogging() {
 		log.Println("[>]", r.String())
+		return
+	}
+
+	err := logger.JSON(&logEntry{
+		Timestamp: time.Now().UTC(),
+		Sender:    r.SenderName,
+		Mask:      r.SenderMask,
+		Type:      r.Type,
+		Target:    r.Target,
+		Data:      r.Data,
+	})
+
+	if err != nil {
+		log.Println("[bot] Log request:", err)
 	}
 }
 
 // open either establishes a new connection or inherits an existing one
 // from a parent process.
 func (b *Bot) open() error {
-	var config *tls.Config
-
 	p := b.profile
 
 	// Create TLS configuration, if applicable.
-	if len(p.TLSCert()) > 0 && len(p.TLSKey()) > 0 {
-		cert, err := tls.LoadX509KeyPair(p.TLSCert(), p.TLSKey())
-		if err != nil {
-			return err
-		}
-
-		config = &tls.Config{
-			Certificates:             []tls.Certificate{cert},
-			PreferServerCipherSuites: true,
-			InsecureSkipVerify:       false,
-		}
-
-		// Should we replace the client's root CA pool?
-		if len(p.CAPemData()) > 0 {
-			config.RootCAs = x509.NewCertPool()
-
-			data, err := ioutil.ReadFile(p.CAPemData())
-			if err != nil {
-				return err
-			}
-
-			if !config.RootCAs.AppendCertsFromPEM(data) {
-				return fmt.Errorf("AppendCertsFromPEM: failed to add certificates in %s",
-					p.CAPemData())
-			}
-		}
+	config, err := tlsConfig(p)
+	if err != nil {
+		return err
 	}
 
+	b.config = config
 	files := inheritedFiles()
 
 	// Are we a fork? Then we should inherit an existing connection.
 	if len(files) > 0 {
 		log.Println("[bot] Inherit connection to:", p.Address())
 
-		err := b.client.OpenFd(files[0], config)
+		err = b.client.OpenFd(files[0], b.config)
 		if err != nil {
 			return err
 		}
 
+		metrics.SetConnected(true)
+
 		// We're done inheriting. Have the parent process break out of
 		// its wait() call by sending SIGINT to it.
 		syscall.Kill(os.Getppid(), syscall.SIGINT)
 		return nil
 	}
 
+	// Fresh session - create a new connection.
+	return b.connect()
+}
+
+// tlsConfig creates the TLS configuration for the connection to the
+// server. This returns nil if the connection should not be encrypted.
+// A client certificate is only presented if both TLSCert and TLSKey are
+// set in the profile.
+func tlsConfig(p irc.Profile) (*tls.Config, error) {
+	hasCert := len(p.TLSCert()) > 0 && len(p.TLSKey()) > 0
+	if !p.UseTLS() && !hasCert {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		PreferServerCipherSuites: true,
+		InsecureSkipVerify:       p.TLSSkipVerify(),
+		ServerName:               serverName(p.Address()),
+	}
+
+	if hasCert {
+		cert, err := tls.LoadX509KeyPair(p.TLSCert(), p.TLSKey())
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if config.InsecureSkipVerify {
+		log.Println("[bot] WARNING: TLS certificate verification is disabled." +
+			" The connection is vulnerable to man-in-the-middle attacks.")
+	}
+
+	// Should we replace the client's root CA pool?
+	if len(p.CAPemData()) > 0 {
+		config.RootCAs = x509.NewCertPool()
+
+		data, err := ioutil.ReadFile(p.CAPemData())
+		if err != nil {
+			return nil, err
+		}
+
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("AppendCertsFromPEM: failed to add certificates in %s",
+				p.CAPemData())
+		}
+	}
+
+	return config, nil
+}
+
+// serverName returns the host portion of the given address. It is used to
+// verify the server's TLS certificate. The address has the format
+// <host>:<port>, where the port is optional. IPv6 hosts are enclosed in
+// square brackets.
+func serverName(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		// There is no port.
+		host = address
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// connect opens a new connection to the server and performs the login
+// handshake.
+func (b *Bot) connect() error {
+	p := b.profile
+
 	log.Println("[bot] Opening new connection to:", p.Address())
 
-	// Fresh session - create a new connection.
-	err := b.client.Open(p.Address(), config)
+	err := b.client.Open(p.Address(), b.config)
 	if err != nil {
 		return err
 	}
 
-	// Perform initial handshake.
-	proto.Pass(b.client, p.ConnectionPassword())
-	proto.User(b.client, p.Nickname(), "8", p.Nickname())
-	proto.Nick(b.client, p.Nickname(), p.NickservPassword())
+	metrics.SetConnected(true)
+
+	// Anything still queued was meant for the old connection.
+	b.queue.Reset()
+
+	// Perform initial handshake. If we want to enable any capabilities,
+	// start negotiating them first. This suspends registration until the
+	// admin plugin concludes the negotiation with CAP END.
+	if len(p.Capabilities()) > 0 || p.UseSasl() {
+		proto.Cap(b.queue, "LS", "302")
+	}
+
+	proto.Pass(b.queue, p.ConnectionPassword())
+	proto.User(b.queue, p.Username(), p.UserModes(), p.Realname())
+	proto.Nick(b.queue, p.Nickname(), p.NickservPassword())
 	return nil
 }
 
 // wait polls for OS signals to either kill or fork this process.
-// The signals it waits for are: SIGINT, SIGTERM and SIGUSR1.
-// The latter one being responsible for forking this process. The others
-// are there so we may cleanly exit this process.
+// The signals it waits for are: SIGINT, SIGTERM, SIGUSR1 and SIGHUP.
+// SIGUSR1 is responsible for forking this process. SIGHUP reloads the
+// profile, without dropping the connection. The others are there so we
+// may cleanly exit this process.
 func wait(b *Bot) {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(
@@ -236,6 +535,7 @@ func wait(b *Bot) {
 		syscall.SIGINT,
 		syscall.SIGTERM,
 		syscall.SIGUSR1,
+		syscall.SIGHUP,
 	)
 
 	// If the bot is run for the first time in a new session,
@@ -248,6 +548,15 @@ func wait(b *Bot) {
 	log.Println("[bot] Waiting for signals...")
 	for sig := range signals {
 		log.Println("[bot] received signal:", sig)
+
+		if sig == syscall.SIGHUP {
+			err := reload(b.profile)
+			if err != nil {
+				log.Println("[bot] Reload profile:", err)
+			}
+			continue
+		}
+
 		if sig != syscall.SIGUSR1 {
 			return
 		}
@@ -256,7 +565,12 @@ func wait(b *Bot) {
 		err := doFork(b)
 		if err != nil {
 			log.Println("[bot]", err)
+			continue
 		}
+
+		// The child takes over the connection. We should leave it
+		// alone when shutting down.
+		b.forked = true
 	}
 }
 
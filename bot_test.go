@@ -0,0 +1,344 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/plugins"
+)
+
+func TestBackoff(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	min := time.Second
+	max := time.Second * 30
+
+	want := []time.Duration{
+		time.Second,
+		time.Second * 2,
+		time.Second * 4,
+		time.Second * 8,
+		time.Second * 16,
+		time.Second * 30,
+		time.Second * 30,
+	}
+
+	for i := 0; i < 100; i++ {
+		for attempt, upper := range want {
+			have := backoff(attempt, min, max, rng)
+			if have < upper/2 || have > upper {
+				t.Fatalf("backoff mismatch for attempt %d;\nwant: %s - %s\nhave: %s",
+					attempt, upper/2, upper, have)
+			}
+		}
+	}
+}
+
+func TestServerName(t *testing.T) {
+	for _, tc := range []struct {
+		address string
+		want    string
+	}{
+		{"irc.example.com:6697", "irc.example.com"},
+		{"irc.example.com", "irc.example.com"},
+		{"127.0.0.1:6697", "127.0.0.1"},
+		{"127.0.0.1", "127.0.0.1"},
+		{"[::1]:6697", "::1"},
+		{"[::1]", "::1"},
+		{"::1", "::1"},
+		{"[2001:db8::1]:6697", "2001:db8::1"},
+	} {
+		have := serverName(tc.address)
+		if have != tc.want {
+			t.Fatalf("serverName mismatch for %q;\nwant: %q\nhave: %q",
+				tc.address, tc.want, have)
+		}
+	}
+}
+
+// testProfile overrides some profile values for testing purposes.
+type testProfile struct {
+	irc.Profile
+	address     string
+	quitMessage string
+}
+
+func (p *testProfile) Address() string                  { return p.address }
+func (p *testProfile) QuitMessage() string              { return p.quitMessage }
+func (p *testProfile) ReconnectMinDelay() time.Duration { return time.Millisecond }
+func (p *testProfile) ReconnectMaxDelay() time.Duration { return time.Millisecond * 10 }
+
+func TestReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ln.Close()
+
+	prof := &testProfile{
+		Profile: irc.NewProfile(t.TempDir()),
+		address: ln.Addr().String(),
+	}
+
+	plugins.Load(prof)
+	defer plugins.Unload(prof)
+
+	fatal := setFatalf(t)
+
+	b := newTestBot(t, prof)
+	go b.readLoop()
+	defer b.shutdown()
+
+	// The first connection logs in and is then dropped by the server.
+	conn := accept(t, ln)
+	expectLine(t, conn, "NICK "+prof.Nickname())
+	conn.Close()
+
+	// The bot should reconnect, log in again and rejoin its channels,
+	// once the server has accepted the login.
+	conn = accept(t, ln)
+	expectLine(t, conn, "NICK "+prof.Nickname())
+	conn.Write([]byte(":irc.example.com 422 " + prof.Nickname() + " :MOTD File is missing\r\n"))
+	expectLine(t, conn, "JOIN "+prof.Channels()[0].Name)
+
+	// An ERROR from the server is followed by a reconnect as well, even
+	// if the server does not close the connection itself.
+	conn.Write([]byte("ERROR :Closing link: (Ping timeout)\r\n"))
+	defer conn.Close()
+
+	conn = accept(t, ln)
+	defer conn.Close()
+	expectLine(t, conn, "NICK "+prof.Nickname())
+
+	select {
+	case msg := <-fatal:
+		t.Fatalf("unexpected exit: %s", msg)
+	default:
+	}
+}
+
+func TestFatal(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ln.Close()
+
+	prof := &testProfile{
+		Profile: irc.NewProfile(t.TempDir()),
+		address: ln.Addr().String(),
+	}
+
+	fatal := setFatalf(t)
+
+	b := newTestBot(t, prof)
+	go b.readLoop()
+	defer b.shutdown()
+
+	// A wrong connection password will not be fixed by reconnecting.
+	conn := accept(t, ln)
+	defer conn.Close()
+
+	expectLine(t, conn, "NICK "+prof.Nickname())
+	conn.Write([]byte(":irc.example.com 464 " + prof.Nickname() + " :Password incorrect\r\n"))
+
+	select {
+	case msg := <-fatal:
+		want := "[bot] exit 1: connection password rejected: Password incorrect"
+		if msg != want {
+			t.Fatalf("exit mismatch;\nwant: %q\nhave: %q", want, msg)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("bot did not exit")
+	}
+}
+
+// setFatalf replaces the function which exits the process. The returned
+// channel receives the messages passed to it.
+func setFatalf(t *testing.T) chan string {
+	ch := make(chan string, 1)
+
+	fatalf = func(f string, argv ...interface{}) {
+		ch <- fmt.Sprintf(f, argv...)
+	}
+
+	t.Cleanup(func() { fatalf = log.Fatalf })
+	return ch
+}
+
+func TestShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ln.Close()
+
+	prof := &testProfile{
+		Profile:     irc.NewProfile(t.TempDir()),
+		address:     ln.Addr().String(),
+		quitMessage: "tot ziens",
+	}
+
+	b := newTestBot(t, prof)
+	go b.readLoop()
+
+	conn := accept(t, ln)
+	defer conn.Close()
+	expectLine(t, conn, "NICK "+prof.Nickname())
+
+	if err := b.shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	// QUIT should be the last thing we receive, before the connection
+	// is closed.
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "QUIT :tot ziens\r\n"
+	if have := string(data); !strings.HasSuffix(have, want) {
+		t.Fatalf("shutdown mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ln.Close()
+
+	root := t.TempDir()
+	err = ioutil.WriteFile(filepath.Join(root, "profile.cfg"), []byte(`{
+		"Nickname": "autimaat",
+		"Username": "ident",
+		"Realname": "Autimaat de Bot",
+		"UserModes": "0"
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	custom := irc.NewProfile(root)
+	if err := custom.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		profile irc.Profile
+		want    string
+	}{
+		{irc.NewProfile(t.TempDir()), "USER bot_name 8 * :bot_name"},
+		{custom, "USER ident 0 * :Autimaat de Bot"},
+	} {
+		prof := &testProfile{
+			Profile: tt.profile,
+			address: ln.Addr().String(),
+		}
+
+		b := newTestBot(t, prof)
+		conn := accept(t, ln)
+		expectLine(t, conn, tt.want)
+
+		b.shutdown()
+		conn.Close()
+	}
+}
+
+func TestReplyTarget(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	plugins.Load(prof)
+	defer plugins.Unload(prof)
+
+	for len(spy.requests) > 0 {
+		<-spy.requests
+	}
+
+	rec := &recorder{clock: &fakeClock{}, lines: make(chan sentLine, 16)}
+	b := &Bot{profile: prof, queue: NewSendQueue(rec, 10, 0)}
+	defer b.queue.Close()
+
+	// A private message is answered to the sender. But when our own nick
+	// change is echoed, the target names our new nick and must be kept.
+	prof.SetNickname("nieuw")
+
+	for _, tt := range []struct {
+		line, target string
+	}{
+		{":bob!~bob@example.com PRIVMSG nieuw :hallo", "bob"},
+		{":oud!~bot@example.com NICK :nieuw", "nieuw"},
+	} {
+		b.payloadHandler([]byte(tt.line))
+
+		select {
+		case r := <-spy.requests:
+			if r.Target != tt.target {
+				t.Fatalf("target mismatch for %q;\nwant: %q\nhave: %q", tt.line, tt.target, r.Target)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("request %q was not dispatched", tt.line)
+		}
+	}
+}
+
+// newTestBot creates a bot for the given profile and connects it.
+func newTestBot(t *testing.T, prof irc.Profile) *Bot {
+	b := &Bot{profile: prof}
+	b.client = NewClient(b.payloadHandler)
+	b.queue = NewSendQueue(b.client, prof.FloodBurst(), 0)
+	b.keepalive = newKeepalive(b.queue, time.Hour, time.Hour, b.pingTimeout)
+	b.quit = make(chan struct{})
+	shuttingDown = false
+
+	if err := b.connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// accept waits for a new connection on the given listener.
+func accept(t *testing.T, ln net.Listener) net.Conn {
+	ln.(*net.TCPListener).SetDeadline(time.Now().Add(time.Second * 5))
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+// expectLine reads lines from the connection until one with the given
+// prefix is found.
+func expectLine(t *testing.T, conn net.Conn, prefix string) {
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	scn := bufio.NewScanner(conn)
+
+	for scn.Scan() {
+		if strings.HasPrefix(scn.Text(), prefix) {
+			return
+		}
+	}
+
+	t.Fatalf("expected line starting with %q; error: %v", prefix, scn.Err())
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 	"net"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -20,9 +21,15 @@ type PayloadHandler func([]byte)
 // ConnectionTimeout defines the deadline for a connection.
 const ConnectionTimeout = time.Minute * 3
 
+// QuitTimeout defines how long we wait for the QUIT message to be sent,
+// when shutting down.
+const QuitTimeout = time.Second * 2
+
 // Client defines an IRC client for a single network connection.
 type Client struct {
+	m       sync.RWMutex
 	handler PayloadHandler
+	raw     net.Conn
 	conn    net.Conn
 	reader  *bufio.Reader
 }
@@ -40,19 +47,12 @@ func NewClient(handler PayloadHandler) *Client {
 // If the tls config is not nil, it will be used to upgrade the connection
 // to a TLS connection.
 func (c *Client) Open(address string, cfg *tls.Config) error {
-	var err error
-
-	c.conn, err = net.Dial("tcp", address)
+	conn, err := net.Dial("tcp", address)
 	if err != nil {
 		return err
 	}
 
-	if cfg != nil {
-		c.reader = bufio.NewReader(tls.Client(c.conn, cfg))
-	} else {
-		c.reader = bufio.NewReader(c.conn)
-	}
-
+	c.setConn(conn, cfg)
 	return nil
 }
 
@@ -60,49 +60,87 @@ func (c *Client) Open(address string, cfg *tls.Config) error {
 // If the tls config is not nil, it will be used to upgrade the connection
 // to a TLS connection.
 func (c *Client) OpenFd(file *os.File, cfg *tls.Config) error {
-	var err error
-
-	c.conn, err = net.FileConn(file)
+	conn, err := net.FileConn(file)
 	if err != nil {
 		return err
 	}
 
+	c.setConn(conn, cfg)
+	return nil
+}
+
+// setConn replaces the client's connection with the given one.
+// If the tls config is not nil, it will be used to upgrade the connection
+// to a TLS connection.
+func (c *Client) setConn(conn net.Conn, cfg *tls.Config) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.raw = conn
+	c.conn = conn
+
 	if cfg != nil {
-		c.reader = bufio.NewReader(tls.Client(c.conn, cfg))
-	} else {
-		c.reader = bufio.NewReader(c.conn)
+		c.conn = tls.Client(conn, cfg)
 	}
 
-	return nil
+	c.reader = bufio.NewReader(c.conn)
 }
 
 // Close closes the connection.
 func (c *Client) Close() error {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if c.conn == nil {
+		return nil
+	}
+
 	return c.conn.Close()
 }
 
 // File returns the network's file descriptor.
 // This call is only valid as long as the connection is actually open.
 func (c *Client) File() (*os.File, error) {
-	return c.conn.(*net.TCPConn).File()
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.raw.(*net.TCPConn).File()
+}
+
+// SetWriteDeadline sets the deadline for pending and future writes.
+func (c *Client) SetWriteDeadline(t time.Time) error {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if c.conn == nil {
+		return io.EOF
+	}
+
+	return c.conn.SetWriteDeadline(t)
 }
 
 // Run starts the message processing loop and does not return for as long
 // as there is an open connection.
+//
+// Messages are handed to the handler one at a time, in the order they
+// were received. Some of them only make sense in that order. E.g.: the
+// NAMES replies which list the members of a channel. The handler is
+// expected to hand off any slow work to other goroutines.
 func (c *Client) Run() error {
-
 	for {
 		line, err := c.read()
 		if err != nil {
 			return err
 		}
 
-		go c.handler(line)
+		c.handler(line)
 	}
 }
 
 // Write writes the given message to the underlying stream.
 func (c *Client) Write(p []byte) (int, error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
 	if c.conn == nil || len(p) == 0 {
 		return 0, io.EOF
 	}
@@ -118,15 +156,19 @@ func (c *Client) Write(p []byte) (int, error) {
 // Read reads the next message from the connection.
 // This call blocks until enough data is available or an error occurs.
 func (c *Client) read() ([]byte, error) {
-	if c.conn == nil {
+	c.m.RLock()
+	conn, reader := c.conn, c.reader
+	c.m.RUnlock()
+
+	if conn == nil {
 		return nil, io.EOF
 	}
 
-	data, err := c.reader.ReadBytes('\n')
+	data, err := reader.ReadBytes('\n')
 	if err != nil {
 		return nil, err
 	}
 
-	c.conn.SetDeadline(time.Now().Add(ConnectionTimeout))
+	conn.SetDeadline(time.Now().Add(ConnectionTimeout))
 	return bytes.TrimSpace(data), nil
 }
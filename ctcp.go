@@ -0,0 +1,55 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"io"
+	"time"
+
+	"github.com/monkeybird/autimaat/app"
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/proto"
+)
+
+// ctcpClientInfo lists the CTCP queries the bot understands.
+const ctcpClientInfo = "ACTION CLIENTINFO PING TIME VERSION"
+
+// handleCtcp answers CTCP queries. It returns true if the request was a
+// CTCP query which has been answered. Other CTCP messages, like ACTION,
+// are left alone, so they can be handled by plugins.
+//
+// The version string is used to answer VERSION queries. If it is empty,
+// the application name and version are used.
+func handleCtcp(w io.Writer, r *irc.Request, version string) bool {
+	if !r.IsPrivMsg() {
+		return false
+	}
+
+	command, args, ok := proto.ParseCtcp(r.Data)
+	if !ok {
+		return false
+	}
+
+	switch command {
+	case "VERSION":
+		if len(version) == 0 {
+			version = app.Version()
+		}
+		proto.CtcpReply(w, r.SenderName, command, version)
+
+	case "PING":
+		proto.CtcpReply(w, r.SenderName, command, args)
+
+	case "TIME":
+		proto.CtcpReply(w, r.SenderName, command, time.Now().Format(time.RFC1123Z))
+
+	case "CLIENTINFO":
+		proto.CtcpReply(w, r.SenderName, command, ctcpClientInfo)
+
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,49 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/monkeybird/autimaat/app"
+	"github.com/monkeybird/autimaat/irc"
+)
+
+func TestCtcp(t *testing.T) {
+	testCtcp(t, ":steve!~steve@example.com PRIVMSG bot :\x01VERSION\x01", "",
+		"NOTICE steve :\x01VERSION "+app.Version()+"\x01\r\n")
+	testCtcp(t, ":steve!~steve@example.com PRIVMSG bot :\x01VERSION\x01", "bot 1.0",
+		"NOTICE steve :\x01VERSION bot 1.0\x01\r\n")
+	testCtcp(t, ":steve!~steve@example.com PRIVMSG bot :\x01PING 1234 5678\x01", "",
+		"NOTICE steve :\x01PING 1234 5678\x01\r\n")
+	testCtcp(t, ":steve!~steve@example.com PRIVMSG #test :\x01CLIENTINFO\x01", "",
+		"NOTICE steve :\x01CLIENTINFO "+ctcpClientInfo+"\x01\r\n")
+	testCtcp(t, ":steve!~steve@example.com PRIVMSG #test :\x01ACTION waves\x01", "", "")
+	testCtcp(t, ":steve!~steve@example.com PRIVMSG #test :VERSION", "", "")
+	testCtcp(t, ":steve!~steve@example.com NOTICE bot :\x01VERSION\x01", "", "")
+
+	var w bytes.Buffer
+	var r irc.Request
+	parseRequest(&r, []byte(":steve!~steve@example.com PRIVMSG bot :\x01TIME\x01"))
+
+	if !handleCtcp(&w, &r, "") || !strings.HasPrefix(w.String(), "NOTICE steve :\x01TIME ") {
+		t.Fatalf("unexpected TIME reply: %q", w.String())
+	}
+}
+
+func testCtcp(t *testing.T, in, version, want string) {
+	var w bytes.Buffer
+	var r irc.Request
+
+	if !parseRequest(&r, []byte(in)) {
+		t.Fatalf("invalid request: %q", in)
+	}
+
+	handled := handleCtcp(&w, &r, version)
+	if have := w.String(); want != have || handled != (len(want) > 0) {
+		t.Fatalf("CTCP reply mismatch for %q;\nwant: %q\nhave: %q", in, want, have)
+	}
+}
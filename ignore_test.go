@@ -0,0 +1,105 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/plugins"
+)
+
+// spyPlugin passes all requests it receives to a channel.
+type spyPlugin struct {
+	requests chan irc.Request
+}
+
+func (p *spyPlugin) Load(irc.Profile) error   { return nil }
+func (p *spyPlugin) Unload(irc.Profile) error { return nil }
+
+func (p *spyPlugin) Dispatch(w irc.ResponseWriter, r *irc.Request) {
+	select {
+	case p.requests <- *r:
+	default:
+	}
+}
+
+var spy = &spyPlugin{requests: make(chan irc.Request, 16)}
+
+func init() { plugins.Register(spy) }
+
+func TestIgnore(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+	prof.IgnoreAdd("*!*@spam.example.com")
+
+	plugins.Load(prof)
+	defer plugins.Unload(prof)
+
+	// Discard anything left over from other tests.
+	for len(spy.requests) > 0 {
+		<-spy.requests
+	}
+
+	rec := &recorder{clock: &fakeClock{}, lines: make(chan sentLine, 16)}
+	b := &Bot{profile: prof, queue: NewSendQueue(rec, 10, 0)}
+	defer b.queue.Close()
+
+	b.payloadHandler([]byte(":troll!~troll@spam.example.com PRIVMSG #test :hallo"))
+	b.payloadHandler([]byte(":bob!~bob@example.com PRIVMSG #test :hallo"))
+
+	select {
+	case r := <-spy.requests:
+		if r.SenderName != "bob" {
+			t.Fatalf("request from ignored user was dispatched: %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("request was not dispatched")
+	}
+
+	select {
+	case r := <-spy.requests:
+		t.Fatalf("unexpected request: %+v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Housekeeping requests from ignored users still get through.
+	b.payloadHandler([]byte(":troll!~troll@spam.example.com JOIN #test"))
+
+	select {
+	case r := <-spy.requests:
+		if r.Type != "JOIN" {
+			t.Fatalf("unexpected request: %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("join from ignored user was not dispatched")
+	}
+
+	// Owners are never ignored, even if their mask matches. Without
+	// explicit owners, all whitelisted users are owners.
+	prof.WhitelistAdd("~boss@spam.example.com")
+	b.payloadHandler([]byte(":boss!~boss@spam.example.com PRIVMSG #test :hallo"))
+
+	select {
+	case r := <-spy.requests:
+		if r.SenderName != "boss" {
+			t.Fatalf("unexpected request: %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("request from owner was not dispatched")
+	}
+
+	// Messages from the server are never ignored.
+	prof.IgnoreAdd("*")
+	b.payloadHandler([]byte(":irc.example.com NOTICE * :hallo"))
+
+	select {
+	case r := <-spy.requests:
+		if r.SenderName != "irc.example.com" {
+			t.Fatalf("unexpected request: %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("server message was not dispatched")
+	}
+}
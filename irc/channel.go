@@ -8,6 +8,7 @@ type Channel struct {
 	Name     string // Channel's name.
 	Key      string // Authentication key for protected channel.
 	Password string // Chanserv password.
+	ChanServ bool   // Ask chanserv for an invite and identify when joining.
 }
 
 // Returns true if the channel is local to the current server.
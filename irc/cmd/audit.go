@@ -0,0 +1,96 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEntry describes a single command call, as reported to an AuditFunc.
+type AuditEntry struct {
+	Time    time.Time // Time of the call.
+	Mask    string    // Hostmask of the caller.
+	Command string    // Full name of the command, including subcommands.
+	Args    []string  // Raw arguments, as given by the caller.
+	Allowed bool      // False if the caller was denied access.
+}
+
+// String returns the entry as a single line of text.
+func (e AuditEntry) String() string {
+	result := "allowed"
+	if !e.Allowed {
+		result = "denied"
+	}
+
+	return fmt.Sprintf("%s %s %s %s %q", e.Time.Format(time.RFC3339),
+		result, e.Mask, e.Command, strings.Join(e.Args, " "))
+}
+
+// AuditFunc is called for command calls which should be audited.
+type AuditFunc func(AuditEntry)
+
+// AuditLog writes audit entries to a file. The file is created when the
+// first entry is written. It is safe for concurrent use.
+type AuditLog struct {
+	m    sync.Mutex
+	file string
+	fd   *os.File
+}
+
+// NewAuditLog creates an audit log which appends to the given file.
+func NewAuditLog(file string) *AuditLog {
+	return &AuditLog{file: file}
+}
+
+// Log writes the given entry to the log. Errors are reported through the
+// standard logger. This does nothing for a nil log, so its Log method can
+// be passed to Set.SetAuditHook before the log is created.
+func (al *AuditLog) Log(e AuditEntry) {
+	if al == nil {
+		return
+	}
+
+	al.m.Lock()
+	defer al.m.Unlock()
+
+	if al.fd == nil {
+		err := os.MkdirAll(filepath.Dir(al.file), 0700)
+		if err == nil {
+			al.fd, err = os.OpenFile(al.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		}
+
+		if err != nil {
+			log.Println("[cmd] audit:", err)
+			return
+		}
+	}
+
+	if _, err := fmt.Fprintln(al.fd, e); err != nil {
+		log.Println("[cmd] audit:", err)
+	}
+}
+
+// Close closes the log file. Entries written after this reopen it.
+func (al *AuditLog) Close() error {
+	if al == nil {
+		return nil
+	}
+
+	al.m.Lock()
+	defer al.m.Unlock()
+
+	if al.fd == nil {
+		return nil
+	}
+
+	err := al.fd.Close()
+	al.fd = nil
+	return err
+}
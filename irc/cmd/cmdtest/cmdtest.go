@@ -0,0 +1,98 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package cmdtest provides utilities for testing command handlers. Calls
+// go through the dispatcher of a command set, so they are split, checked
+// and validated exactly like calls made by real users.
+package cmdtest
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd"
+)
+
+// Default sender of the requests created by Check.
+const (
+	Nick = "steve"
+	Mask = "~steve@example.com"
+)
+
+// Timeout defines how long Run waits for a command handler to finish.
+const Timeout = 5 * time.Second
+
+// Writer records all data written to it. It is safe for concurrent use.
+type Writer struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *Writer) Close() error { return nil }
+
+// String returns all data written so far.
+func (w *Writer) String() string {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.buf.String()
+}
+
+// Reset discards all data written so far.
+func (w *Writer) Reset() {
+	w.m.Lock()
+	w.buf.Reset()
+	w.m.Unlock()
+}
+
+// NewRequest creates a PRIVMSG with the given data, sent by the given user
+// to target.
+func NewRequest(mask, target, data string) *irc.Request {
+	return &irc.Request{
+		SenderName: Nick,
+		SenderMask: mask,
+		Type:       "PRIVMSG",
+		Target:     target,
+		Data:       data,
+	}
+}
+
+// Run passes r to the dispatcher of the given set and waits for the command
+// handler to finish. Returns everything written in response.
+func Run(t testing.TB, set *cmd.Set, r *irc.Request) string {
+	t.Helper()
+
+	var w Writer
+	set.Dispatch(&w, r)
+
+	if !set.Wait(Timeout) {
+		t.Fatalf("command handler for %q did not finish", r.Data)
+	}
+
+	return w.String()
+}
+
+// Check sends data to target as a command call by Nick and ensures it
+// yields the expected output.
+func Check(t testing.TB, set *cmd.Set, target, data, want string) {
+	t.Helper()
+	CheckAs(t, set, Mask, target, data, want)
+}
+
+// CheckAs works like Check, but the call is made by the user with the
+// given hostmask.
+func CheckAs(t testing.TB, set *cmd.Set, mask, target, data, want string) {
+	t.Helper()
+
+	if have := Run(t, set, NewRequest(mask, target, data)); have != want {
+		t.Fatalf("output mismatch for %q;\nwant: %q\nhave: %q", data, want, have)
+	}
+}
@@ -4,8 +4,12 @@
 package cmd
 
 import (
+	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/monkeybird/autimaat/irc"
 )
@@ -15,16 +19,28 @@ type Handler func(irc.ResponseWriter, *irc.Request, ParamList)
 
 // Command defines a single command which can be called by IRC users.
 type Command struct {
-	Name       string  // Name by which the command is called.
-	Handler    Handler // Command handler.
-	Params     []Param // Command parameter list.
-	Restricted bool    // Command may only be run by authorized users.
+	Name       string   // Canonical name by which the command is called.
+	Aliases    []string // Alternative names by which the command is called.
+	Handler    Handler  // Command handler.
+	Params     []Param  // Command parameter list.
+	Restricted bool     // Command may only be run by authorized users.
+	Children   List     // Subcommands, invoked as: <name> <child> [args].
+
+	parent   *Command
+	m        sync.Mutex
+	cooldown time.Duration        // Minimum interval between invocations.
+	perUser  bool                 // Cooldown is tracked per user, not globally.
+	lastCall map[string]time.Time // Time of last invocation, keyed by hostmask.
 }
 
+// now returns the current time. It can be replaced by tests
+// which need a predictable clock.
+var now = time.Now
+
 // newCommand creates a new command.
 func newCommand(name string, restricted bool, handler Handler) *Command {
 	c := new(Command)
-	c.Name = strings.ToLower(name)
+	c.Name = name
 	c.Restricted = restricted
 	c.Handler = handler
 	return c
@@ -47,6 +63,96 @@ func (c *Command) Add(name string, required bool, pattern *regexp.Regexp) *Comma
 	return c
 }
 
+// AddDefault adds a new, optional command parameter with the given default
+// value. The default is used whenever the user omits the parameter. It must
+// match the parameter pattern. If it does not, this function panics.
+func (c *Command) AddDefault(name string, pattern *regexp.Regexp, def string) *Command {
+	c.Add(name, false, pattern)
+
+	p := &c.Params[len(c.Params)-1]
+	if !p.validate(def) {
+		panic(fmt.Sprintf("cmd: default %q for parameter %q of command %q does not match %s",
+			def, p.Name, c.Name, p.Pattern))
+	}
+
+	p.Default = def
+	return c
+}
+
+// Alias adds alternative names by which the command can be called.
+func (c *Command) Alias(names ...string) *Command {
+	for _, name := range names {
+		c.Aliases = append(c.Aliases, name)
+	}
+	return c
+}
+
+// Sub adds a new subcommand with the given name. It is invoked by passing
+// its name as the first argument to the parent command. E.g.:
+//
+//	!auth add <mask>
+//
+// If the first argument does not name a known subcommand, the parent's
+// own handler is called instead. This may be nil, if the parent serves
+// only as a group for its children.
+func (c *Command) Sub(name string, restricted bool, handler Handler) *Command {
+	sub := newCommand(name, restricted, handler)
+	sub.parent = c
+	c.Children = append(c.Children, sub)
+	sort.Sort(c.Children)
+	return sub
+}
+
+// path returns the full name of the command, including the names of
+// its parents, if any. E.g.: "auth add".
+func (c *Command) path() string {
+	if c.parent == nil {
+		return c.Name
+	}
+	return c.parent.path() + " " + c.Name
+}
+
+// restricted returns true if the command, or any of its parents,
+// may only be run by authorized users.
+func (c *Command) restricted() bool {
+	for ; c != nil; c = c.parent {
+		if c.Restricted {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve finds the subcommand targeted by the given arguments. It returns
+// the deepest matching command, along with the remaining arguments.
+func (c *Command) resolve(args []string) (*Command, []string) {
+	for len(args) > 0 && len(c.Children) > 0 {
+		sub := c.Children.Find(args[0])
+		if sub == nil {
+			break
+		}
+
+		c = sub
+		args = args[1:]
+	}
+
+	return c, args
+}
+
+// key returns the name by which the command is looked up and sorted.
+// This is the lower case form of its canonical name.
+func (c *Command) key() string { return strings.ToLower(c.Name) }
+
+// hasAlias returns true if the given name is one of the command's aliases.
+func (c *Command) hasAlias(name string) bool {
+	for _, alias := range c.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
 // RequiredParamCount returns the amunt of required parameters for this command.
 func (c *Command) RequiredParamCount() int {
 	var count int
@@ -59,3 +165,54 @@ func (c *Command) RequiredParamCount() int {
 
 	return count
 }
+
+// Cooldown sets the minimum interval between two invocations of this
+// command. The interval applies to all users combined. Calls made while
+// the command is cooling down are ignored.
+func (c *Command) Cooldown(d time.Duration) *Command {
+	c.m.Lock()
+	c.cooldown = d
+	c.perUser = false
+	c.lastCall = make(map[string]time.Time)
+	c.m.Unlock()
+	return c
+}
+
+// UserCooldown works like Cooldown, except the interval is tracked for
+// each user individually. One user invoking the command does not prevent
+// another user from doing the same.
+func (c *Command) UserCooldown(d time.Duration) *Command {
+	c.m.Lock()
+	c.cooldown = d
+	c.perUser = true
+	c.lastCall = make(map[string]time.Time)
+	c.m.Unlock()
+	return c
+}
+
+// throttle returns the time remaining before the given user may invoke
+// this command again. If this is zero, the call is allowed and it is
+// recorded as the most recent invocation.
+func (c *Command) throttle(mask string) time.Duration {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.cooldown <= 0 {
+		return 0
+	}
+
+	var key string
+	if c.perUser {
+		key = strings.ToLower(mask)
+	}
+
+	t := now()
+	if last, ok := c.lastCall[key]; ok {
+		if delta := c.cooldown - t.Sub(last); delta > 0 {
+			return delta
+		}
+	}
+
+	c.lastCall[key] = t
+	return 0
+}
@@ -6,7 +6,7 @@ Package cmd allows the definition of command handlers to be called
 by users from either a channel or a private message. These are messages
 like the following:
 
-   !join #test
+	!join #test
 
 Beginning with a predefined character (! in this case), followed by the
 command name and an optional set of arguments. This package parses the
@@ -33,9 +33,16 @@ For example:
 	}
 
 The name and description texts for the command and parameters, are there for
-user documentation. You can bind a `!help` command to `cmd.HelpHandler`, which
+user documentation. You can bind a `!help` command to `Set.HelpHandler`, which
 will present the user either with an overview of all registered commands, or
-get detailed help on a specific command.
+get detailed help on a specific command. Restricted commands are marked with
+an asterisk, and are hidden from users who are not allowed to run them.
+
+A command can be known by more than one name. Additional names are added as
+aliases. These are resolved to the same command and show up only once in the
+help overview:
+
+	coffee := cmd.Bind("coffee", false, onCoffee).Alias("cof", "java")
 
 The `cmd.RegXXX` values passed into the parameter definitions are predefined
 regular expressions. You are free to pass in your own patterns. These are used
@@ -56,10 +63,27 @@ of two ways:
 	!join #channel
 	!join #channel somepassword
 
+An optional parameter may be given a default value through `AddDefault`.
+The handler then receives this value whenever the user omits it. Use
+`ParamList.Has` to find out whether the user supplied it explicitly.
+
 A parameter occupying multiple whitespace separated words, is to be supplied
 in double quotes:
 
 	!join #channel "some long password"
 
+Commands taking free-form text, like a message, should use `ParamList.Rest`
+for their last parameter. It returns the remainder of the call as the user
+typed it, starting at the given parameter:
+
+	say := cmd.Bind("say", true, onSay)
+	say.Add("channel", true, cmd.RegChannel)
+	say.Add("message", true, cmd.RegAny)
+
+	...
+
+	func onSay(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+		proto.PrivMsg(w, params.String(0), "%s", params.Rest(1))
+	}
 */
 package cmd
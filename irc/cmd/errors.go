@@ -0,0 +1,31 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// These errors are returned by Set.Dispatch when a command call fails.
+// ErrClosed is returned for calls made after Set.Close.
+var (
+	ErrAccessDenied  = errors.New("access denied")
+	ErrMissingParams = errors.New("missing parameters")
+	ErrCooldown      = errors.New("command is cooling down")
+	ErrClosed        = errors.New("command set is closed")
+)
+
+// InvalidParamError is returned by Set.Dispatch when a parameter value
+// does not match the pattern defined for it.
+type InvalidParamError struct {
+	Command string // Name of the command being called.
+	Name    string // Name of the offending parameter.
+	Value   string // The value supplied by the user.
+}
+
+func (e *InvalidParamError) Error() string {
+	return fmt.Sprintf("command %s: invalid value %q for parameter %q",
+		e.Command, e.Value, e.Name)
+}
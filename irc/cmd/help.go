@@ -0,0 +1,192 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/monkeybird/autimaat/irc"
+)
+
+// DefaultHelpPageSize defines the default number of command names
+// listed on a single page of help output.
+const DefaultHelpPageSize = 20
+
+// HelpHandler is a command handler which presents the user with help on
+// the commands in this set. Without arguments, it lists all known commands.
+// When given a command name, it shows detailed usage for that command.
+// It is bound like any other command:
+//
+//	set.Bind("help", false, set.HelpHandler).
+//		Add("command", false, cmd.RegAny)
+//
+// The command overview is split into pages, each sent as a single message.
+// A specific page is requested by passing its number instead of a command
+// name. E.g.: "!help 2".
+//
+// Restricted commands are marked with an asterisk. They are not shown to
+// callers who are not allowed to run them, unless this is disabled with
+// Set.SetHelpFilter.
+func (s *Set) HelpHandler(w irc.ResponseWriter, r *irc.Request, params ParamList) {
+	if params.Len() == 0 {
+		s.helpOverview(w, r, 1)
+		return
+	}
+
+	name, _ := s.trimPrefix(params.String(0))
+
+	cmd := s.data.Find(name)
+	if cmd != nil && s.helpVisible(r, cmd) {
+		s.helpCommand(w, r, cmd)
+		return
+	}
+
+	if s.helpPaginate && RegUint.MatchString(params.String(0)) {
+		s.helpOverview(w, r, int(params.Uint(0)))
+		return
+	}
+
+	s.reply(w, r, TextHelpUnknown, params.String(0))
+}
+
+// helpOverview sends the names of all known commands to the user.
+// If pagination is enabled, only the given page is sent. Otherwise
+// all pages are sent in succession.
+func (s *Set) helpOverview(w irc.ResponseWriter, r *irc.Request, page int) {
+	pages := s.helpPages(r)
+
+	// There may be no commands at all, or none the caller may see.
+	if len(pages) == 0 {
+		s.reply(w, r, TextHelpEmpty)
+		return
+	}
+
+	if !s.helpPaginate {
+		for i := range pages {
+			s.reply(w, r, TextHelpPage, i+1, len(pages), pages[i])
+		}
+		return
+	}
+
+	if page < 1 || page > len(pages) {
+		s.reply(w, r, TextHelpNoPage, page, len(pages))
+		return
+	}
+
+	if page == len(pages) {
+		s.reply(w, r, TextHelpPage, page, len(pages), pages[page-1])
+		return
+	}
+
+	// Tell the user how to get to the next page. The help command may
+	// be known by any name, so use the one they called it with.
+	data, _ := s.trimPrefix(r.Data)
+	name, _ := split(data)
+	s.reply(w, r, TextHelpPage+TextHelpNextPage, page, len(pages),
+		pages[page-1], s.prefix()+name, page+1)
+}
+
+// helpPages returns the names of all commands visible to the caller,
+// divided into pages. Each page holds a comma separated list of names.
+func (s *Set) helpPages(r *irc.Request) []string {
+	size := s.helpPageSize
+	if size <= 0 {
+		size = DefaultHelpPageSize
+	}
+
+	names := make([]string, 0, len(s.data))
+	for _, cmd := range s.data {
+		if !s.helpVisible(r, cmd) {
+			continue
+		}
+
+		name := s.prefix() + cmd.Name
+		if cmd.restricted() {
+			name += TextHelpRestrictedMark
+		}
+
+		names = append(names, name)
+	}
+
+	var pages []string
+	for len(names) > 0 {
+		n := len(names)
+		if n > size {
+			n = size
+		}
+
+		pages = append(pages, strings.Join(names[:n], ", "))
+		names = names[n:]
+	}
+
+	return pages
+}
+
+// helpVisible returns true if the given command should be included in
+// help output for the caller. Restricted commands are hidden from those
+// who may not run them, if help filtering is enabled.
+func (s *Set) helpVisible(r *irc.Request, cmd *Command) bool {
+	return !s.helpFilter || !cmd.restricted() || s.authenticate(r.SenderMask)
+}
+
+// helpCommand sends detailed usage information for the given command
+// to the user. This includes the usage of all its subcommands.
+func (s *Set) helpCommand(w irc.ResponseWriter, r *irc.Request, cmd *Command) {
+	if cmd.Handler != nil {
+		s.reply(w, r, TextHelpUsage, s.usage(cmd))
+	}
+
+	if len(cmd.Children) > 0 {
+		s.reply(w, r, TextHelpSubcommands)
+		s.helpTree(w, r, cmd.Children, 1)
+	}
+
+	if len(cmd.Aliases) > 0 {
+		names := make([]string, len(cmd.Aliases))
+		for i, alias := range cmd.Aliases {
+			names[i] = s.prefix() + alias
+		}
+
+		s.reply(w, r, TextHelpAliases, strings.Join(names, ", "))
+	}
+
+	if cmd.restricted() {
+		s.reply(w, r, TextHelpRestricted)
+	}
+}
+
+// helpTree sends usage information for the given subcommands and their
+// descendants. Each level of nesting is indented a little further.
+func (s *Set) helpTree(w irc.ResponseWriter, r *irc.Request, list List, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	for _, cmd := range list {
+		if cmd.Handler != nil {
+			s.reply(w, r, "%s%s", indent, s.usage(cmd))
+		}
+
+		s.helpTree(w, r, cmd.Children, depth+1)
+	}
+}
+
+// usage returns a usage string for the given command. Required parameters
+// are listed as <name>, optional ones as [name] or [name=default]. E.g.:
+//
+//	!join <channel> [password]
+func (s *Set) usage(cmd *Command) string {
+	out := []string{s.prefix() + cmd.path()}
+
+	for _, p := range cmd.Params {
+		switch {
+		case p.Required:
+			out = append(out, "<"+p.Name+">")
+		case len(p.Default) > 0:
+			out = append(out, "["+p.Name+"="+p.Default+"]")
+		default:
+			out = append(out, "["+p.Name+"]")
+		}
+	}
+
+	return strings.Join(out, " ")
+}
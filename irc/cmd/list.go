@@ -5,27 +5,36 @@ package cmd
 
 import (
 	"strings"
+	"unicode"
 )
 
 // List defines a list of commands, sortable by name.
 type List []*Command
 
 func (cl List) Len() int           { return len(cl) }
-func (cl List) Less(i, j int) bool { return cl[i].Name < cl[j].Name }
+func (cl List) Less(i, j int) bool { return cl[i].key() < cl[j].key() }
 func (cl List) Swap(i, j int)      { cl[i], cl[j] = cl[j], cl[i] }
 
-// Find finds the command for the given name.
-// Returns nil if it was not found.
+// Find finds the command for the given name or alias. Names are matched
+// case-insensitively. If there is no match, punctuation surrounding the
+// name is stripped and the lookup is tried once more. This allows things
+// like "!weer?" or "!weer,". Returns nil if it was not found.
 func (cl List) Find(name string) *Command {
 	idx := cl.Index(name)
+	if idx == -1 {
+		if trimmed := strings.TrimFunc(name, unicode.IsPunct); trimmed != name {
+			idx = cl.Index(trimmed)
+		}
+	}
+
 	if idx > -1 {
 		return cl[idx]
 	}
 	return nil
 }
 
-// Index returns the index of the command for the given name.
-// Returns -1 if it was not found.
+// Index returns the index of the command for the given name or alias.
+// Names are matched case-insensitively. Returns -1 if it was not found.
 func (cl List) Index(name string) int {
 	var lo int
 	hi := len(cl) - 1
@@ -35,16 +44,23 @@ func (cl List) Index(name string) int {
 	for lo < hi {
 		mid := lo + ((hi - lo) / 2)
 
-		if cl[mid].Name < name {
+		if cl[mid].key() < name {
 			lo = mid + 1
 		} else {
 			hi = mid
 		}
 	}
 
-	if hi == lo && cl[lo].Name == name {
+	if hi == lo && cl[lo].key() == name {
 		return lo
 	}
 
+	// Not a command name. It may still be an alias.
+	for i, c := range cl {
+		if c.hasAlias(name) {
+			return i
+		}
+	}
+
 	return -1
 }
@@ -7,30 +7,80 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ParamList defines a list of command parameters.
 type ParamList []Param
 
-func (p ParamList) Len() int            { return len(p) }
-func (p ParamList) String(n int) string { return p[n].String() }
-func (p ParamList) Int(n int) int64     { return p[n].Int() }
-func (p ParamList) Uint(n int) uint64   { return p[n].Uint() }
-func (p ParamList) Float(n int) float64 { return p[n].Float() }
-func (p ParamList) Bool(n int) bool     { return p[n].Bool() }
+func (p ParamList) String(n int) string          { return p[n].String() }
+func (p ParamList) Int(n int) int64              { return p[n].Int() }
+func (p ParamList) Uint(n int) uint64            { return p[n].Uint() }
+func (p ParamList) Float(n int) float64          { return p[n].Float() }
+func (p ParamList) Bool(n int) bool              { return p[n].Bool() }
+func (p ParamList) Duration(n int) time.Duration { return p[n].Duration() }
 
-// Join returns all parameter values, concatenated into a single string.
-// Each entry is separated by a blank space.
+// Len returns the number of parameters supplied by the user. This does
+// not include omitted parameters which were filled in with their default.
+func (p ParamList) Len() int {
+	var n int
+	for n < len(p) && !p[n].omitted {
+		n++
+	}
+	return n
+}
+
+// Has returns true if the user supplied a value for parameter n.
+func (p ParamList) Has(n int) bool { return n >= 0 && n < p.Len() }
+
+// Join returns all user supplied parameter values, concatenated into a
+// single string. Each entry is separated by a blank space.
 func (p ParamList) Join() string {
-	out := make([]string, len(p))
+	out := make([]string, p.Len())
 
-	for i := range p {
+	for i := range out {
 		out[i] = p[i].Value
 	}
 
 	return strings.Join(out, " ")
 }
 
+// Rest returns the remainder of the command call, starting at word n, as
+// the user typed it. Word n is parameter n, but n may also point past the
+// last defined parameter. Unlike Join, this keeps quotes and whitespace
+// intact. If word n is the last one in the call, this is simply its value.
+// Returns an empty string if the call has no word n.
+func (p ParamList) Rest(n int) string {
+	if tail := p.tail(n); len(tail) > 0 {
+		return tail[0].rest
+	}
+	return ""
+}
+
+// Words returns the words of the command call, starting at word n. Like
+// Rest, n may point past the last defined parameter. Quoted text is a
+// single word, without its quotes. Returns nil if the call has no word n.
+func (p ParamList) Words(n int) []string {
+	tail := p.tail(n)
+	if len(tail) == 0 {
+		return nil
+	}
+
+	out := make([]string, len(tail))
+	for i, t := range tail {
+		out[i] = t.value
+	}
+	return out
+}
+
+// tail returns the words of the call, starting at word n.
+func (p ParamList) tail(n int) []token {
+	if !p.Has(0) || n < 0 || n >= len(p[0].tail) {
+		return nil
+	}
+	return p[0].tail[n:]
+}
+
 // Param defines a parameter for a command.
 type Param struct {
 	Name        string         // Parameter name -- used in help listing.
@@ -38,6 +88,9 @@ type Param struct {
 	Value       string         // Parameter value.
 	Pattern     *regexp.Regexp // Pattern defining the type of accepted value.
 	Required    bool           // Parameter is required or not?
+	Default     string         // Value used if an optional parameter is omitted.
+	omitted     bool           // Value was not supplied by the user.
+	tail        []token        // This and all following words in the call.
 }
 
 // validate returns true if the given value matches the param pattern.
@@ -60,6 +113,14 @@ func (p *Param) Float() float64 {
 	return n
 }
 
+// Duration returns the value as a time.Duration. The value is expected
+// to be in the format accepted by time.ParseDuration. E.g.: "1h30m".
+// Returns 0 if the value is not a valid duration.
+func (p *Param) Duration() time.Duration {
+	d, _ := time.ParseDuration(p.Value)
+	return d
+}
+
 // Bool returns the boolean value represented by the parameter.
 // True is represented by the values: "1", "t", "true", "y", "yes", "on"
 // Any other value returns false.
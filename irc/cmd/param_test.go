@@ -0,0 +1,65 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package cmd
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPatterns(t *testing.T) {
+	testPattern(t, RegFloat, "1", true)
+	testPattern(t, RegFloat, "-1.5", true)
+	testPattern(t, RegFloat, "+0.25e-3", true)
+	testPattern(t, RegFloat, "1.", false)
+	testPattern(t, RegFloat, "abc", false)
+
+	testPattern(t, RegDuration, "10s", true)
+	testPattern(t, RegDuration, "1h30m", true)
+	testPattern(t, RegDuration, "1.5h", true)
+	testPattern(t, RegDuration, "-300ms", true)
+	testPattern(t, RegDuration, "10", false)
+	testPattern(t, RegDuration, "1x", false)
+	testPattern(t, RegDuration, "", false)
+
+	testPattern(t, RegEmail, "steve@example.com", true)
+	testPattern(t, RegEmail, "steve.o+irc@mail.example.co.uk", true)
+	testPattern(t, RegEmail, "steve@localhost", false)
+	testPattern(t, RegEmail, "@example.com", false)
+	testPattern(t, RegEmail, "steve example.com", false)
+}
+
+func testPattern(t *testing.T, reg *regexp.Regexp, in string, want bool) {
+	have := reg.MatchString(in)
+	if want != have {
+		t.Fatalf("pattern %s mismatch for %q;\nwant: %v\nhave: %v",
+			reg, in, want, have)
+	}
+}
+
+func TestAccessors(t *testing.T) {
+	params := ParamList{
+		{Value: "1.5"},
+		{Value: "1h30m"},
+		{Value: "boops"},
+	}
+
+	if have := params.Float(0); have != 1.5 {
+		t.Fatalf("Float mismatch;\nwant: %v\nhave: %v", 1.5, have)
+	}
+
+	if have := params.Float(2); have != 0 {
+		t.Fatalf("Float mismatch;\nwant: %v\nhave: %v", 0, have)
+	}
+
+	want := time.Hour + 30*time.Minute
+	if have := params.Duration(1); have != want {
+		t.Fatalf("Duration mismatch;\nwant: %v\nhave: %v", want, have)
+	}
+
+	if have := params.Duration(2); have != 0 {
+		t.Fatalf("Duration mismatch;\nwant: %v\nhave: %v", 0, have)
+	}
+}
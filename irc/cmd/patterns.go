@@ -8,12 +8,14 @@ import (
 )
 
 var (
-	RegAny     = regexp.MustCompile(`^.*$`)
-	RegInt     = regexp.MustCompile(`^[+-]?\d+$`)
-	RegUint    = regexp.MustCompile(`^[+]?\d+$`)
-	RegFloat   = regexp.MustCompile(`^[+-]?\d+(\.\d+([eE][+-]?\d+)?)?$`)
-	RegBool    = regexp.MustCompile(`^(1|0|t(rue)?|f(alse)?|y(es)?|no?|on|off)$`)
-	RegChannel = regexp.MustCompile(`^[#&+!][^ ,:]{1,50}$`)
-	RegMode    = regexp.MustCompile(`^[+-][obveI]$`)
-	RegUrl     = regexp.MustCompile(`^https?\://[a-zA-Z0-9\-\.]+\.[a-zA-Z]+(\:[0-9]+)?(/\S*)?$`)
+	RegAny      = regexp.MustCompile(`^.*$`)
+	RegInt      = regexp.MustCompile(`^[+-]?\d+$`)
+	RegUint     = regexp.MustCompile(`^[+]?\d+$`)
+	RegFloat    = regexp.MustCompile(`^[+-]?\d+(\.\d+([eE][+-]?\d+)?)?$`)
+	RegBool     = regexp.MustCompile(`^(1|0|t(rue)?|f(alse)?|y(es)?|no?|on|off)$`)
+	RegChannel  = regexp.MustCompile(`^[#&+!][^ ,:]{1,50}$`)
+	RegMode     = regexp.MustCompile(`^[+-][obveI]$`)
+	RegUrl      = regexp.MustCompile(`^https?\://[a-zA-Z0-9\-\.]+\.[a-zA-Z]+(\:[0-9]+)?(/\S*)?$`)
+	RegDuration = regexp.MustCompile(`^[+-]?(\d+(\.\d+)?(ns|us|µs|ms|s|m|h))+$`)
+	RegEmail    = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9\-]+(\.[a-zA-Z0-9\-]+)*\.[a-zA-Z]{2,}$`)
 )
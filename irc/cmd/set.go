@@ -4,71 +4,136 @@
 package cmd
 
 import (
+	"io"
 	"log"
+	"math"
+	"runtime/debug"
 	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/monkeybird/autimaat/irc"
 	"github.com/monkeybird/autimaat/irc/proto"
 )
 
+// ReplyFunc sends a formatted message to the given target. Both
+// proto.PrivMsg and proto.Notice qualify.
+type ReplyFunc func(w io.Writer, target, f string, argv ...interface{}) error
+
 // AuthFunc returns true if the given hostmask defines a whitelisted user.
 // This function is used by the command dispatcher to ensure the user is
 // allowed to execute a given, restricted command.
 type AuthFunc func(string) bool
 
+// CloseTimeout defines how long Set.Close waits for running command
+// handlers to finish.
+const CloseTimeout = 5 * time.Second
+
+// PanicFunc is called when a command handler panics. It receives the
+// request which triggered the panic, the recovered value and the stack
+// trace of the handler goroutine.
+type PanicFunc func(w irc.ResponseWriter, r *irc.Request, v interface{}, stack []byte)
+
 // Set defines a set of bound commands.
 type Set struct {
-	authenticate AuthFunc
-	data         List
-	prefix       string
+	m              sync.Mutex
+	wg             sync.WaitGroup
+	closed         bool
+	authenticate   AuthFunc
+	data           List
+	prefixes       []string
+	replyFunc      ReplyFunc
+	callHook       func(string)
+	panicHook      PanicFunc
+	auditHook      AuditFunc
+	auditAll       bool
+	cooldownNotice bool
+	quiet          bool
+	replyChannel   bool
+	helpPaginate   bool
+	helpPageSize   int
+	helpFilter     bool
+	acceptNotice   bool
 }
 
-// New creates a new, empty set for the given prefix and auth handler.
-// The auth handler is used to ensure a caller is allowed to run a
-// restricted command. This can be nil, which will outright deny access
-// to all commands which have the restricted flag set.
-func New(prefix string, authenticate AuthFunc) *Set {
+// New creates a new, empty set for the given prefixes and auth handler.
+// A command call starts with any of the prefixes. The first one is the
+// primary prefix, which is used in help output. The auth handler is used
+// to ensure a caller is allowed to run a restricted command. This can be
+// nil, which will outright deny access to all commands which have the
+// restricted flag set.
+func New(prefixes []string, authenticate AuthFunc) *Set {
 	if authenticate == nil {
 		authenticate = func(string) bool { return false }
 	}
 
 	return &Set{
-		prefix:       prefix,
+		prefixes:     append([]string(nil), prefixes...),
 		authenticate: authenticate,
+		replyFunc:    proto.PrivMsg,
+		helpPaginate: true,
+		helpPageSize: DefaultHelpPageSize,
+		helpFilter:   true,
 	}
 }
 
 // Dispatch accepts the given message and issues command calls if applicable.
-// Returns false if no command call was issued.
-func (s *Set) Dispatch(w irc.ResponseWriter, r *irc.Request) bool {
+// Returns false if no command call was issued. If this happened because the
+// call was not valid, the returned error describes the reason. It is one of
+// ErrAccessDenied, ErrMissingParams, ErrCooldown or an *InvalidParamError.
+// ErrClosed is returned if the set has been closed. The error is nil if the
+// message simply was not a command call.
+func (s *Set) Dispatch(w irc.ResponseWriter, r *irc.Request) (bool, error) {
 	// We are only interested in requests with the correct prefix.
-	if !r.IsPrivMsg() || !strings.HasPrefix(r.Data, s.prefix) {
-		return false
+	if !r.IsPrivMsg() && !(s.acceptNotice && r.IsNotice()) {
+		return false, nil
+	}
+
+	data, ok := s.trimPrefix(r.Data)
+	if !ok {
+		return false, nil
 	}
 
 	// Split message data into command name and individual arguments.
-	name, args := split(r.Data[len(s.prefix):])
-	if len(name) == 0 {
-		return false
+	words := tokenize(data)
+	if len(words) == 0 {
+		return false, nil
+	}
+
+	name := words[0].value
+	args := make([]string, len(words)-1)
+	for i := range args {
+		args[i] = words[i+1].value
 	}
 
 	// Find the command instance.
 	cmd := s.data.Find(name)
 	if cmd == nil {
-		return false
+		return false, nil
+	}
+
+	// Descend into subcommands, if applicable.
+	cmd, args = cmd.resolve(args)
+	words = words[len(words)-len(args):]
+	if cmd.Handler == nil {
+		s.replyError(w, r, TextMissingParameters, cmd.path())
+		return false, ErrMissingParams
 	}
 
 	// Ensure the caller is authorized to run this command.
-	if cmd.Restricted && !s.authenticate(r.SenderMask) {
-		proto.PrivMsg(w, r.SenderName, TextAccessDenied, cmd.Name)
-		return false
+	if cmd.restricted() && !s.authenticate(r.SenderMask) {
+		s.audit(r, cmd, args, false)
+		s.replyError(w, r, TextAccessDenied, cmd.path())
+		return false, ErrAccessDenied
 	}
 
 	// Ensure we have enough parameters.
 	if cmd.RequiredParamCount() > len(args) {
-		proto.PrivMsg(w, r.SenderName, TextMissingParameters, cmd.Name)
-		return false
+		s.replyError(w, r, TextMissingParameters, cmd.path())
+		return false, ErrMissingParams
 	}
 
 	var params ParamList
@@ -79,31 +144,291 @@ func (s *Set) Dispatch(w irc.ResponseWriter, r *irc.Request) bool {
 
 		for i := 0; i < len(args) && i < len(cmd.Params); i++ {
 			if cmd.Params[i].validate(args[i]) {
-				params = append(params, Param{Value: args[i]})
+				params = append(params, Param{Value: args[i], tail: words[i:]})
 				continue
 			}
 
-			proto.PrivMsg(w, r.SenderName, TextInvalidParameter,
-				cmd.Name, cmd.Params[i].Name)
-			return false
+			s.replyError(w, r, TextInvalidParameter,
+				cmd.path(), cmd.Params[i].Name)
+
+			return false, &InvalidParamError{
+				Command: cmd.path(),
+				Name:    cmd.Params[i].Name,
+				Value:   args[i],
+			}
+		}
+
+		// Fill in omitted parameters with their default values.
+		for i := len(params); i < len(cmd.Params); i++ {
+			params = append(params, Param{
+				Value:   cmd.Params[i].Default,
+				omitted: true,
+			})
 		}
 	}
 
+	// Track the handler, so Close can wait for it to finish. This is done
+	// before the cooldown is started and the hooks are called, so neither
+	// is affected by calls which are not run.
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		return false, ErrClosed
+	}
+	s.wg.Add(1)
+	s.m.Unlock()
+
+	// Ensure the command is not cooling down from a previous call.
+	if wait := cmd.throttle(r.SenderMask); wait > 0 {
+		s.wg.Done()
+
+		if s.cooldownNotice {
+			s.replyError(w, r, TextCooldown, cmd.path(),
+				int(math.Ceil(wait.Seconds())))
+		}
+		return false, ErrCooldown
+	}
+
+	if s.callHook != nil {
+		s.callHook(cmd.path())
+	}
+
+	s.audit(r, cmd, args, true)
+
 	go func() {
+		defer s.wg.Done()
+
 		// Ensure command handlers don't bring the entire bot down
 		// when a panic occurs.
 		defer func() {
 			x := recover()
 			if x != nil {
-				log.Printf("Command error: %v", x)
-				log.Printf("> %#v", r)
+				s.recovered(w, r, x, debug.Stack())
 			}
 		}()
 
 		cmd.Handler(w, r, params)
 	}()
 
-	return true
+	return true, nil
+}
+
+// Wait blocks until all running command handlers have returned, or until
+// the timeout expires. Returns false if the timeout expired first.
+func (s *Set) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Close stops the set from accepting new command calls and waits for
+// running handlers to return, for at most CloseTimeout. This should be
+// called before a plugin releases any state its handlers rely on.
+// Returns false if some handlers were still running after the timeout.
+func (s *Set) Close() bool {
+	s.m.Lock()
+	s.closed = true
+	s.m.Unlock()
+
+	ok := s.Wait(CloseTimeout)
+	if !ok {
+		log.Printf("[cmd] Command handlers still running after %s", CloseTimeout)
+	}
+	return ok
+}
+
+// recovered logs a panic in a command handler, along with its stack trace,
+// and passes it on to the panic hook, if one is set.
+func (s *Set) recovered(w irc.ResponseWriter, r *irc.Request, v interface{}, stack []byte) {
+	log.Printf("Command error: %v", v)
+	log.Printf("> %#v", r)
+	log.Printf("%s", stack)
+
+	if s.panicHook != nil {
+		s.panicHook(w, r, v, stack)
+	}
+}
+
+// getPrefixes returns the set's prefixes. The slice is replaced, never
+// modified, by SetPrefixes, so it is safe to use after the lock is released.
+func (s *Set) getPrefixes() []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.prefixes
+}
+
+// prefix returns the set's primary prefix.
+func (s *Set) prefix() string {
+	prefixes := s.getPrefixes()
+	if len(prefixes) == 0 {
+		return ""
+	}
+	return prefixes[0]
+}
+
+// trimPrefix returns v without its command prefix. Returns false if v does
+// not start with any of the set's prefixes. If multiple prefixes match,
+// the longest one is removed.
+func (s *Set) trimPrefix(v string) (string, bool) {
+	prefixes := s.getPrefixes()
+	match := -1
+
+	for i, prefix := range prefixes {
+		if strings.HasPrefix(v, prefix) && (match == -1 || len(prefix) > len(prefixes[match])) {
+			match = i
+		}
+	}
+
+	if match == -1 {
+		return v, false
+	}
+
+	return v[len(prefixes[match]):], true
+}
+
+// replyError sends the given error message to the caller, unless error
+// messages have been disabled for this set, or the request is a NOTICE.
+func (s *Set) replyError(w irc.ResponseWriter, r *irc.Request, f string, argv ...interface{}) {
+	if !s.quiet && !r.IsNotice() {
+		s.reply(w, r, f, argv...)
+	}
+}
+
+// reply sends the given message through the set's reply function. It goes
+// to the caller, or the channel from whence the request came, depending on
+// the set's configuration. Private calls are always answered privately.
+// Requests sent as a NOTICE are always answered with a NOTICE, regardless
+// of the reply function. Automatic replies to a NOTICE are not allowed, as
+// two bots could otherwise keep answering each other.
+func (s *Set) reply(w irc.ResponseWriter, r *irc.Request, f string, argv ...interface{}) {
+	target := r.SenderName
+	if s.replyChannel {
+		target = r.ReplyTarget()
+	}
+
+	if r.IsNotice() {
+		proto.Notice(w, target, f, argv...)
+		return
+	}
+
+	s.replyFunc(w, target, f, argv...)
+}
+
+// SetCooldownNotice determines if a user should be notified when they call
+// a command which is still cooling down. By default, such calls are
+// silently ignored.
+func (s *Set) SetCooldownNotice(v bool) {
+	s.cooldownNotice = v
+}
+
+// SetPrefixes replaces the prefixes a command call starts with. Unlike the
+// other settings, this can be changed while the set is in use. E.g.: when
+// the profile is reloaded.
+func (s *Set) SetPrefixes(prefixes []string) {
+	prefixes = append([]string(nil), prefixes...)
+
+	s.m.Lock()
+	s.prefixes = prefixes
+	s.m.Unlock()
+}
+
+// SetAcceptNotice determines if commands sent as a NOTICE are accepted.
+// By default, only PRIVMSG is. Errors in such calls are never reported to
+// the caller, as automatic replies to a NOTICE are not allowed.
+func (s *Set) SetAcceptNotice(v bool) {
+	s.acceptNotice = v
+}
+
+// SetQuiet determines if users should be spared the default error messages
+// when their command call fails. The error is still returned by Dispatch, so
+// the caller can handle it as it sees fit.
+func (s *Set) SetQuiet(v bool) {
+	s.quiet = v
+}
+
+// SetReplyFunc sets the function through which all messages generated by
+// this set are sent. This includes error messages and help output. It
+// defaults to proto.PrivMsg. Passing nil restores the default.
+func (s *Set) SetReplyFunc(fn ReplyFunc) {
+	if fn == nil {
+		fn = proto.PrivMsg
+	}
+	s.replyFunc = fn
+}
+
+// SetCallHook sets a function which is called with the name of each
+// command, right before its handler is run. This can be used to gather
+// usage statistics. Passing nil removes the hook.
+func (s *Set) SetCallHook(fn func(name string)) {
+	s.callHook = fn
+}
+
+// SetPanicHook sets a function which is called when a command handler
+// panics, after the panic has been logged. E.g.: to notify the bot's
+// owner. Passing nil removes the hook.
+func (s *Set) SetPanicHook(fn PanicFunc) {
+	s.panicHook = fn
+}
+
+// SetAuditHook sets a function which is called for each call to a
+// restricted command, whether it was allowed or denied. Allowed calls are
+// reported right before their handler is run. Passing nil removes the hook.
+func (s *Set) SetAuditHook(fn AuditFunc) {
+	s.auditHook = fn
+}
+
+// SetAuditAll determines if calls to unrestricted commands are passed to
+// the audit hook as well. By default, they are not.
+func (s *Set) SetAuditAll(v bool) {
+	s.auditAll = v
+}
+
+// audit passes the given call to the audit hook, if applicable.
+func (s *Set) audit(r *irc.Request, cmd *Command, args []string, allowed bool) {
+	if s.auditHook == nil || !(s.auditAll || cmd.restricted()) {
+		return
+	}
+
+	s.auditHook(AuditEntry{
+		Time:    now(),
+		Mask:    r.SenderMask,
+		Command: cmd.path(),
+		Args:    args,
+		Allowed: allowed,
+	})
+}
+
+// SetReplyToChannel determines if messages generated by this set are sent
+// to the channel the command was called from, instead of to the caller.
+// Commands called in a private message are still answered privately.
+func (s *Set) SetReplyToChannel(v bool) {
+	s.replyChannel = v
+}
+
+// SetHelpPages configures the command overview presented by HelpHandler.
+// The size determines how many command names are listed per page. If
+// paginate is true, the user is sent one page at a time. Otherwise all
+// pages are sent at once.
+func (s *Set) SetHelpPages(size int, paginate bool) {
+	s.helpPageSize = size
+	s.helpPaginate = paginate
+}
+
+// SetHelpFilter determines if HelpHandler hides restricted commands from
+// callers who are not allowed to run them. This is enabled by default.
+// When disabled, everyone sees all commands.
+func (s *Set) SetHelpFilter(v bool) {
+	s.helpFilter = v
 }
 
 // Bind binds the given command.
@@ -124,22 +449,86 @@ func (s *Set) Unbind(name string) {
 	}
 }
 
+// token defines a single word in a command call.
+type token struct {
+	value string // The word, with quotes and escapes removed.
+	rest  string // The call as typed, from the start of this word onwards.
+}
+
 // split splits the given string into a command name and individual
 // parameters. It ensures there are no empty entries from the parameter list.
+//
+// Arguments are separated by whitespace, unless they are enclosed in
+// double quotes. In that case, everything between the quotes is treated
+// as a single argument. A quote can be escaped as \" to include it
+// literally. An unterminated quote consumes the remainder of the line.
 func split(data string) (string, []string) {
-	set := strings.Fields(data)
+	set := tokenize(data)
+	if len(set) == 0 {
+		return "", nil
+	}
+
+	args := make([]string, len(set)-1)
+	for i := range args {
+		args[i] = set[i+1].value
+	}
+
+	return set[0].value, args
+}
 
-	for i := 0; i < len(set); i++ {
-		if len(set[i]) == 0 {
-			copy(set[i:], set[i+1:])
-			set = set[:len(set)-1]
-			i--
+// tokenize splits the given string into words, as described for split.
+// Each word also records the remainder of data, starting at that word.
+// For the last word, this is simply its value, so a quoted value at the
+// end of a call does not keep its quotes.
+func tokenize(data string) []token {
+	var set []token
+	var buf []rune
+	var quoted bool
+	start := -1
+
+	flush := func() {
+		if len(buf) > 0 {
+			set = append(set, token{
+				value: string(buf),
+				rest:  strings.TrimRightFunc(data[start:], unicode.IsSpace),
+			})
 		}
+
+		buf = buf[:0]
+		start = -1
 	}
 
-	if len(set) == 0 {
-		return "", nil
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRuneInString(data[i:])
+
+		space := !quoted && unicode.IsSpace(r)
+		if start == -1 && !space {
+			start = i
+		}
+
+		switch {
+		case r == '\\' && i+1 < len(data) && data[i+1] == '"':
+			buf = append(buf, '"')
+			size++
+
+		case r == '"':
+			quoted = !quoted
+
+		case space:
+			flush()
+
+		default:
+			buf = append(buf, r)
+		}
+
+		i += size
+	}
+
+	flush()
+
+	if len(set) > 0 {
+		set[len(set)-1].rest = set[len(set)-1].value
 	}
 
-	return set[0], set[1:]
+	return set
 }
@@ -0,0 +1,837 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/proto"
+)
+
+// mockWriter records all data written to it.
+type mockWriter struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (mw *mockWriter) Write(p []byte) (int, error) {
+	mw.m.Lock()
+	defer mw.m.Unlock()
+	return mw.buf.Write(p)
+}
+
+func (mw *mockWriter) Close() error { return nil }
+
+func (mw *mockWriter) String() string {
+	mw.m.Lock()
+	defer mw.m.Unlock()
+	return mw.buf.String()
+}
+
+// newRequest creates a new PRIVMSG request with the given sender and data.
+func newRequest(sender, data string) *irc.Request {
+	return &irc.Request{
+		SenderName: sender,
+		SenderMask: "~" + sender + "@example.com",
+		Type:       "PRIVMSG",
+		Target:     "#test",
+		Data:       data,
+	}
+}
+
+// setClock replaces the package clock with a fake one and returns a
+// function which advances it by the given duration.
+func setClock(t *testing.T) func(time.Duration) {
+	var m sync.Mutex
+	clock := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	now = func() time.Time {
+		m.Lock()
+		defer m.Unlock()
+		return clock
+	}
+
+	t.Cleanup(func() { now = time.Now })
+
+	return func(d time.Duration) {
+		m.Lock()
+		clock = clock.Add(d)
+		m.Unlock()
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		in   string
+		name string
+		args []string
+	}{
+		{"", "", nil},
+		{"   ", "", nil},
+		{"join", "join", []string{}},
+		{"join #test", "join", []string{"#test"}},
+		{"  join   #test  ", "join", []string{"#test"}},
+		{`join #test "some long password"`, "join", []string{"#test", "some long password"}},
+		{`join #test "some long password`, "join", []string{"#test", "some long password"}},
+		{`join "" #test`, "join", []string{"#test"}},
+		{`say "a \"quoted\" word"`, "say", []string{`a "quoted" word`}},
+		{`say \"a b\"`, "say", []string{`"a`, `b"`}},
+		{`say foo"bar baz"qux`, "say", []string{"foobar bazqux"}},
+		{`say c:\path`, "say", []string{`c:\path`}},
+		{`say trailing\`, "say", []string{`trailing\`}},
+	}
+
+	for _, tt := range tests {
+		name, args := split(tt.in)
+
+		if name != tt.name || !reflect.DeepEqual(args, tt.args) {
+			t.Fatalf("split mismatch for %q;\nwant: %q %q\nhave: %q %q",
+				tt.in, tt.name, tt.args, name, args)
+		}
+	}
+}
+
+func TestRest(t *testing.T) {
+	var w mockWriter
+	var have []string
+
+	set := New([]string{"!"}, nil)
+	set.Bind("definieer", false, func(_ irc.ResponseWriter, _ *irc.Request, params ParamList) {
+		have = append([]string{params.String(0), params.Rest(1), params.Rest(3)}, params.Words(1)...)
+	}).Add("term", true, RegAny).Add("definitie", true, RegAny)
+
+	for _, tt := range []struct {
+		in   string
+		want []string
+	}{
+		{`!definieer "rode wijn" Een drankje.`, []string{"rode wijn", "Een drankje.", "", "Een", "drankje."}},
+		{`!definieer wijn Een  "rood" drankje.  `, []string{"wijn", `Een  "rood" drankje.`, "drankje.", "Een", "rood", "drankje."}},
+		{`!definieer wijn "Een drankje."`, []string{"wijn", "Een drankje.", "", "Een drankje."}},
+		{`!definieer "wijn" Een, drankje. "`, []string{"wijn", `Een, drankje. "`, "", "Een,", "drankje."}},
+	} {
+		have = nil
+		testDispatch(t, set, &w, newRequest("steve", tt.in), true)
+		set.Wait(time.Second)
+
+		if !reflect.DeepEqual(have, tt.want) {
+			t.Fatalf("rest mismatch for %q;\nwant: %q\nhave: %q", tt.in, tt.want, have)
+		}
+	}
+}
+
+func TestCooldown(t *testing.T) {
+	advance := setClock(t)
+
+	var w mockWriter
+	set := New([]string{"!"}, nil)
+	set.Bind("weer", false, func(irc.ResponseWriter, *irc.Request, ParamList) {}).
+		Cooldown(10 * time.Second)
+
+	testDispatch(t, set, &w, newRequest("steve", "!weer"), true)
+	testDispatch(t, set, &w, newRequest("steve", "!weer"), false)
+	testDispatch(t, set, &w, newRequest("bob", "!weer"), false)
+
+	advance(9 * time.Second)
+	testDispatch(t, set, &w, newRequest("steve", "!weer"), false)
+
+	advance(time.Second)
+	testDispatch(t, set, &w, newRequest("bob", "!weer"), true)
+
+	if w.String() != "" {
+		t.Fatalf("unexpected output: %q", w.String())
+	}
+}
+
+func TestUserCooldown(t *testing.T) {
+	advance := setClock(t)
+
+	var w mockWriter
+	set := New([]string{"!"}, nil)
+	set.SetCooldownNotice(true)
+	set.Bind("weer", false, func(irc.ResponseWriter, *irc.Request, ParamList) {}).
+		UserCooldown(10 * time.Second)
+
+	testDispatch(t, set, &w, newRequest("steve", "!weer"), true)
+	testDispatch(t, set, &w, newRequest("bob", "!weer"), true)
+	testDispatch(t, set, &w, newRequest("steve", "!weer"), false)
+
+	if !strings.HasPrefix(w.String(), "PRIVMSG steve :") {
+		t.Fatalf("expected cooldown notice; have: %q", w.String())
+	}
+
+	advance(10 * time.Second)
+	testDispatch(t, set, &w, newRequest("steve", "!weer"), true)
+}
+
+func TestClosedCooldown(t *testing.T) {
+	setClock(t)
+
+	var w mockWriter
+	set := New([]string{"!"}, nil)
+	cmd := set.Bind("weer", false, func(irc.ResponseWriter, *irc.Request, ParamList) {}).
+		UserCooldown(10 * time.Second)
+
+	set.Close()
+
+	// A call which is not run, does not start a cooldown.
+	if _, err := set.Dispatch(&w, newRequest("steve", "!weer")); err != ErrClosed {
+		t.Fatalf("dispatch error mismatch;\nwant: %v\nhave: %v", ErrClosed, err)
+	}
+
+	if len(cmd.lastCall) > 0 {
+		t.Fatalf("cooldown started for rejected call: %v", cmd.lastCall)
+	}
+}
+
+func testDispatch(t *testing.T, set *Set, w irc.ResponseWriter, r *irc.Request, want bool) {
+	have, _ := set.Dispatch(w, r)
+	if want != have {
+		t.Fatalf("dispatch mismatch for %q by %s;\nwant: %v\nhave: %v",
+			r.Data, r.SenderName, want, have)
+	}
+}
+
+func TestAlias(t *testing.T) {
+	var w mockWriter
+	called := make(chan string, 1)
+
+	set := New([]string{"!"}, nil)
+	set.Bind("koffie", false, func(_ irc.ResponseWriter, r *irc.Request, _ ParamList) {
+		called <- r.Data
+	}).Alias("kof", "Bak")
+
+	for _, name := range []string{"!koffie", "!kof", "!bak", "!BAK"} {
+		testDispatch(t, set, &w, newRequest("steve", name), true)
+
+		select {
+		case have := <-called:
+			if have != name {
+				t.Fatalf("handler mismatch;\nwant: %q\nhave: %q", name, have)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("handler not called for %q", name)
+		}
+	}
+
+	set.Unbind("kof")
+
+	for _, name := range []string{"!koffie", "!kof", "!bak"} {
+		testDispatch(t, set, &w, newRequest("steve", name), false)
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	var w mockWriter
+	called := make(chan string, 1)
+
+	set := New([]string{"!"}, nil)
+	set.Bind("Weer", false, func(_ irc.ResponseWriter, r *irc.Request, _ ParamList) {
+		called <- r.Data
+	})
+	set.Bind("koffie", false, func(irc.ResponseWriter, *irc.Request, ParamList) {})
+
+	for _, name := range []string{"!Weer", "!weer", "!WEER", "!wEeR", "!weer?", "!weer,", "!\"weer\""} {
+		testDispatch(t, set, &w, newRequest("steve", name), true)
+
+		select {
+		case <-called:
+		case <-time.After(time.Second):
+			t.Fatalf("handler not called for %q", name)
+		}
+	}
+
+	for _, name := range []string{"!weerr", "!we?er", "!!"} {
+		testDispatch(t, set, &w, newRequest("steve", name), false)
+	}
+
+	want := "!koffie, !Weer"
+	if have := set.helpPages(newRequest("steve", "!help"))[0]; have != want {
+		t.Fatalf("help mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func TestSubcommands(t *testing.T) {
+	var w mockWriter
+	called := make(chan string, 1)
+
+	handler := func(name string) Handler {
+		return func(_ irc.ResponseWriter, _ *irc.Request, params ParamList) {
+			called <- strings.TrimSpace(name + " " + params.Join())
+		}
+	}
+
+	set := New([]string{"!"}, func(mask string) bool { return mask == "~admin@example.com" })
+	auth := set.Bind("auth", false, handler("auth"))
+	auth.Sub("list", false, handler("list"))
+	auth.Sub("add", true, handler("add")).
+		Add("mask", true, RegAny)
+
+	perm := auth.Sub("perm", false, nil)
+	perm.Sub("show", false, handler("show"))
+
+	testSub(t, set, &w, called, newRequest("steve", "!auth"), "auth")
+	testSub(t, set, &w, called, newRequest("steve", "!auth foo"), "auth")
+	testSub(t, set, &w, called, newRequest("steve", "!auth list"), "list")
+	testSub(t, set, &w, called, newRequest("steve", "!auth LIST"), "list")
+	testSub(t, set, &w, called, newRequest("admin", "!auth add ~bob@foo"), "add ~bob@foo")
+	testSub(t, set, &w, called, newRequest("steve", "!auth perm show"), "show")
+
+	testDispatch(t, set, &w, newRequest("steve", "!auth add ~bob@foo"), false)
+	testDispatch(t, set, &w, newRequest("admin", "!auth add"), false)
+	testDispatch(t, set, &w, newRequest("steve", "!auth perm"), false)
+}
+
+func testSub(t *testing.T, set *Set, w irc.ResponseWriter, called chan string, r *irc.Request, want string) {
+	testDispatch(t, set, w, r, true)
+
+	select {
+	case have := <-called:
+		if want != have {
+			t.Fatalf("handler mismatch for %q;\nwant: %q\nhave: %q", r.Data, want, have)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("handler not called for %q", r.Data)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	var w mockWriter
+	called := make(chan ParamList, 1)
+
+	set := New([]string{"!"}, nil)
+	set.Bind("weer", false, func(_ irc.ResponseWriter, _ *irc.Request, params ParamList) {
+		called <- params
+	}).
+		Add("stad", true, RegAny).
+		AddDefault("dagen", RegUint, "3").
+		Add("land", false, RegAny)
+
+	testDispatch(t, set, &w, newRequest("steve", "!weer Amsterdam"), true)
+	params := <-called
+
+	if params.Len() != 1 || !params.Has(0) || params.Has(1) || params.Has(2) {
+		t.Fatalf("unexpected parameter count: %d", params.Len())
+	}
+
+	if params.Uint(1) != 3 || params.String(2) != "" {
+		t.Fatalf("default mismatch; have: %q %q", params.String(1), params.String(2))
+	}
+
+	if params.Join() != "Amsterdam" {
+		t.Fatalf("join mismatch; have: %q", params.Join())
+	}
+
+	testDispatch(t, set, &w, newRequest("steve", "!weer Amsterdam 5"), true)
+	params = <-called
+
+	if params.Len() != 2 || params.Uint(1) != 5 {
+		t.Fatalf("value mismatch; have: %d %q", params.Len(), params.String(1))
+	}
+}
+
+func TestInvalidDefault(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic for invalid default")
+		}
+	}()
+
+	New([]string{"!"}, nil).Bind("weer", false, nil).AddDefault("dagen", RegUint, "boops")
+}
+
+func TestDispatchErrors(t *testing.T) {
+	var w mockWriter
+	handler := func(irc.ResponseWriter, *irc.Request, ParamList) {}
+
+	set := New([]string{"!"}, nil)
+	set.Bind("join", true, handler)
+	set.Bind("weer", false, handler).
+		Add("stad", true, RegAny).
+		Add("dagen", false, RegUint)
+	set.Bind("auth", false, nil).
+		Sub("list", false, handler)
+	set.Bind("bier", false, handler).
+		Cooldown(time.Hour)
+
+	testDispatchError(t, set, &w, "!boops", nil)
+	testDispatchError(t, set, &w, "!join #test", ErrAccessDenied)
+	testDispatchError(t, set, &w, "!weer", ErrMissingParams)
+	testDispatchError(t, set, &w, "!auth", ErrMissingParams)
+	testDispatchError(t, set, &w, "!bier", nil)
+	testDispatchError(t, set, &w, "!bier", ErrCooldown)
+
+	_, err := set.Dispatch(&w, newRequest("steve", "!weer Amsterdam morgen"))
+
+	var ipe *InvalidParamError
+	if !errors.As(err, &ipe) {
+		t.Fatalf("error mismatch;\nwant: %T\nhave: %v", ipe, err)
+	}
+
+	if ipe.Command != "weer" || ipe.Name != "dagen" || ipe.Value != "morgen" {
+		t.Fatalf("unexpected error contents: %+v", ipe)
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	var w mockWriter
+	called := make(chan string, 1)
+
+	set := New([]string{"!", ".", "bot: ", "!!"}, nil)
+	set.Bind("weer", false, func(_ irc.ResponseWriter, _ *irc.Request, params ParamList) {
+		called <- params.String(0)
+	}).Add("plaats", true, RegAny)
+
+	for _, data := range []string{"!weer utrecht", ".weer utrecht", "bot: weer utrecht", "!!weer utrecht"} {
+		testDispatch(t, set, &w, newRequest("steve", data), true)
+
+		select {
+		case have := <-called:
+			if have != "utrecht" {
+				t.Fatalf("parameter mismatch for %q;\nwant: %q\nhave: %q", data, "utrecht", have)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("handler not called for %q", data)
+		}
+	}
+
+	for _, data := range []string{"weer utrecht", "?weer utrecht", "bot weer utrecht"} {
+		testDispatch(t, set, &w, newRequest("steve", data), false)
+	}
+
+	// Help output uses the primary prefix.
+	set.Bind("help", false, set.HelpHandler).
+		Add("command", false, RegAny)
+
+	testHelp(t, set, &w, ".help", []string{
+		fmt.Sprintf(TextHelpPage, 1, 1, "!help, !weer"),
+	})
+	testHelp(t, set, &w, "!help .weer", []string{
+		fmt.Sprintf(TextHelpUsage, "!weer <plaats>"),
+	})
+
+	// The prefixes can be changed while the set is in use.
+	set.SetPrefixes([]string{"?"})
+	testDispatch(t, set, &w, newRequest("steve", "!weer utrecht"), false)
+	testHelp(t, set, &w, "?help weer", []string{
+		fmt.Sprintf(TextHelpUsage, "?weer <plaats>"),
+	})
+}
+
+func TestQuiet(t *testing.T) {
+	var w mockWriter
+
+	set := New([]string{"!"}, nil)
+	set.SetQuiet(true)
+	set.Bind("join", true, func(irc.ResponseWriter, *irc.Request, ParamList) {})
+
+	testDispatchError(t, set, &w, "!join", ErrAccessDenied)
+
+	if w.String() != "" {
+		t.Fatalf("unexpected output: %q", w.String())
+	}
+}
+
+func testDispatchError(t *testing.T, set *Set, w irc.ResponseWriter, data string, want error) {
+	_, have := set.Dispatch(w, newRequest("steve", data))
+	if want != have {
+		t.Fatalf("error mismatch for %q;\nwant: %v\nhave: %v", data, want, have)
+	}
+}
+
+func TestNoticeCommands(t *testing.T) {
+	var w mockWriter
+	called := make(chan string, 1)
+
+	set := New([]string{"!"}, nil)
+	set.SetReplyFunc(proto.Notice)
+	set.Bind("weer", false, func(_ irc.ResponseWriter, r *irc.Request, _ ParamList) {
+		called <- r.Type
+	})
+	set.Bind("join", true, func(irc.ResponseWriter, *irc.Request, ParamList) {})
+	set.Bind("help", false, set.HelpHandler).
+		Add("command", false, RegAny)
+
+	notice := newRequest("steve", "!weer")
+	notice.Type = "NOTICE"
+
+	// Not accepted by default.
+	testDispatch(t, set, &w, notice, false)
+
+	set.SetAcceptNotice(true)
+	testDispatch(t, set, &w, notice, true)
+
+	select {
+	case have := <-called:
+		if have != "NOTICE" {
+			t.Fatalf("request type mismatch; want: NOTICE, have: %q", have)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler not called")
+	}
+
+	// Errors are not reported, as we may not reply to a NOTICE.
+	notice.Data = "!join"
+	testDispatch(t, set, &w, notice, false)
+
+	if have := w.String(); have != "" {
+		t.Fatalf("unexpected output: %q", have)
+	}
+
+	// Other replies are sent as NOTICE, even though the set uses PRIVMSG.
+	set.SetReplyFunc(nil)
+	notice.Data = "!help"
+	testDispatch(t, set, &w, notice, true)
+	set.Close()
+
+	want := "NOTICE steve :" + fmt.Sprintf(TextHelpPage, 1, 1, "!help, !weer") + "\r\n"
+	if have := w.String(); have != want {
+		t.Fatalf("reply mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func TestReplyFunc(t *testing.T) {
+	var w mockWriter
+
+	set := New([]string{"!"}, nil)
+	set.SetReplyFunc(proto.Notice)
+	set.Bind("join", true, func(irc.ResponseWriter, *irc.Request, ParamList) {})
+
+	set.Dispatch(&w, newRequest("steve", "!join"))
+
+	want := "NOTICE steve :" + fmt.Sprintf(TextAccessDenied, "join") + "\r\n"
+	if have := w.String(); want != have {
+		t.Fatalf("reply mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+
+	w.buf.Reset()
+	set.SetReplyToChannel(true)
+	set.Dispatch(&w, newRequest("steve", "!join"))
+
+	want = "NOTICE #test :" + fmt.Sprintf(TextAccessDenied, "join") + "\r\n"
+	if have := w.String(); want != have {
+		t.Fatalf("reply mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+
+	// Private calls are answered privately, even if the request still
+	// targets the bot itself.
+	w.buf.Reset()
+	r := newRequest("steve", "!join")
+	r.Target = "autimaat"
+	set.Dispatch(&w, r)
+
+	want = "NOTICE steve :" + fmt.Sprintf(TextAccessDenied, "join") + "\r\n"
+	if have := w.String(); want != have {
+		t.Fatalf("reply mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func TestHelpPages(t *testing.T) {
+	var w mockWriter
+	handler := func(irc.ResponseWriter, *irc.Request, ParamList) {}
+
+	set := New([]string{"!"}, nil)
+	set.SetHelpPages(2, true)
+	set.Bind("help", false, set.HelpHandler).
+		Add("command", false, RegAny)
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		set.Bind(name, false, handler)
+	}
+
+	// Commands are sorted by name: !a, !b, !c, !d, !help
+	testHelp(t, set, &w, "!help", []string{
+		fmt.Sprintf(TextHelpPage+TextHelpNextPage, 1, 3, "!a, !b", "!help", 2),
+	})
+	testHelp(t, set, &w, "!help 2", []string{
+		fmt.Sprintf(TextHelpPage+TextHelpNextPage, 2, 3, "!c, !d", "!help", 3),
+	})
+	testHelp(t, set, &w, "!help 3", []string{
+		fmt.Sprintf(TextHelpPage, 3, 3, "!help"),
+	})
+	testHelp(t, set, &w, "!help 4", []string{
+		fmt.Sprintf(TextHelpNoPage, 4, 3),
+	})
+
+	set.SetHelpPages(3, false)
+	testHelp(t, set, &w, "!help", []string{
+		fmt.Sprintf(TextHelpPage, 1, 2, "!a, !b, !c"),
+		fmt.Sprintf(TextHelpPage, 2, 2, "!d, !help"),
+	})
+}
+
+func TestHelpEmpty(t *testing.T) {
+	var w mockWriter
+	handler := func(irc.ResponseWriter, *irc.Request, ParamList) {}
+
+	// The caller may not see any of the commands in this set.
+	set := New([]string{"!"}, nil)
+	set.Bind("join", true, handler)
+
+	testHelp(t, set, &w, "!help", []string{TextHelpEmpty})
+	testHelp(t, set, &w, "!help 1", []string{TextHelpEmpty})
+
+	set.SetHelpPages(3, false)
+	testHelp(t, set, &w, "!help", []string{TextHelpEmpty})
+}
+
+func TestHelpFilter(t *testing.T) {
+	var w mockWriter
+	handler := func(irc.ResponseWriter, *irc.Request, ParamList) {}
+
+	set := New([]string{"!"}, func(mask string) bool {
+		return mask == "~admin@example.com"
+	})
+
+	set.Bind("help", false, set.HelpHandler).
+		Add("command", false, RegAny)
+	set.Bind("join", true, handler)
+	set.Bind("part", true, handler)
+	set.Bind("weer", false, handler)
+
+	testHelpAs(t, set, &w, "steve", "!help", []string{
+		fmt.Sprintf(TextHelpPage, 1, 1, "!help, !weer"),
+	})
+	testHelpAs(t, set, &w, "steve", "!help join", []string{
+		fmt.Sprintf(TextHelpUnknown, "join"),
+	})
+	testHelpAs(t, set, &w, "admin", "!help", []string{
+		fmt.Sprintf(TextHelpPage, 1, 1, "!help, !join*, !part*, !weer"),
+	})
+	testHelpAs(t, set, &w, "admin", "!help join", []string{
+		fmt.Sprintf(TextHelpUsage, "!join"),
+		TextHelpRestricted,
+	})
+
+	set.SetHelpFilter(false)
+	testHelpAs(t, set, &w, "steve", "!help", []string{
+		fmt.Sprintf(TextHelpPage, 1, 1, "!help, !join*, !part*, !weer"),
+	})
+	testHelpAs(t, set, &w, "steve", "!help join", []string{
+		fmt.Sprintf(TextHelpUsage, "!join"),
+		TextHelpRestricted,
+	})
+}
+
+func testHelp(t *testing.T, set *Set, w *mockWriter, data string, want []string) {
+	testHelpAs(t, set, w, "steve", data, want)
+}
+
+func testHelpAs(t *testing.T, set *Set, w *mockWriter, sender, data string, want []string) {
+	w.m.Lock()
+	w.buf.Reset()
+	w.m.Unlock()
+
+	var params ParamList
+	if fields := strings.Fields(data); len(fields) > 1 {
+		params = ParamList{{Value: fields[1]}}
+	}
+
+	set.HelpHandler(w, newRequest(sender, data), params)
+
+	var lines []string
+	for _, line := range want {
+		lines = append(lines, "PRIVMSG "+sender+" :"+line+"\r\n")
+	}
+
+	if have := w.String(); have != strings.Join(lines, "") {
+		t.Fatalf("help mismatch for %q;\nwant: %q\nhave: %q", data, lines, have)
+	}
+}
+
+func TestClose(t *testing.T) {
+	var w mockWriter
+	var m sync.Mutex
+	var finished bool
+
+	started := make(chan struct{})
+
+	set := New([]string{"!"}, nil)
+	set.Bind("slow", false, func(irc.ResponseWriter, *irc.Request, ParamList) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+
+		m.Lock()
+		finished = true
+		m.Unlock()
+	})
+
+	// Calls rejected because the set is closed, never reach the hooks.
+	var calls int
+	set.SetCallHook(func(string) { calls++ })
+
+	if ok, err := set.Dispatch(&w, newRequest("bob", "!slow")); !ok || err != nil {
+		t.Fatalf("dispatch failed: %v %v", ok, err)
+	}
+
+	<-started
+
+	if !set.Close() {
+		t.Fatalf("close timed out")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if !finished {
+		t.Fatalf("close returned before the handler finished")
+	}
+
+	if ok, err := set.Dispatch(&w, newRequest("bob", "!slow")); ok || err != ErrClosed {
+		t.Fatalf("dispatch after close mismatch;\nwant: false %v\nhave: %v %v",
+			ErrClosed, ok, err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("call hook count mismatch;\nwant: 1\nhave: %d", calls)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	var w mockWriter
+	release := make(chan struct{})
+	defer close(release)
+
+	set := New([]string{"!"}, nil)
+	set.Bind("stuck", false, func(irc.ResponseWriter, *irc.Request, ParamList) {
+		<-release
+	})
+
+	set.Dispatch(&w, newRequest("bob", "!stuck"))
+
+	if set.Wait(50 * time.Millisecond) {
+		t.Fatalf("wait returned true while a handler is still running")
+	}
+}
+
+func TestCallHook(t *testing.T) {
+	var w mockWriter
+	var calls []string
+
+	set := New([]string{"!"}, nil)
+	set.Bind("weer", false, func(irc.ResponseWriter, *irc.Request, ParamList) {})
+	set.SetCallHook(func(name string) { calls = append(calls, name) })
+
+	set.Dispatch(&w, newRequest("bob", "!weer"))
+	set.Dispatch(&w, newRequest("bob", "!onbekend"))
+	set.Close()
+
+	if !reflect.DeepEqual(calls, []string{"weer"}) {
+		t.Fatalf("call hook mismatch;\nwant: %q\nhave: %q", []string{"weer"}, calls)
+	}
+}
+
+func TestAuditHook(t *testing.T) {
+	setClock(t)
+
+	var w mockWriter
+	var entries []AuditEntry
+
+	set := New([]string{"!"}, func(mask string) bool { return mask == "~steve@example.com" })
+	set.SetQuiet(true)
+	set.Bind("kick", true, func(irc.ResponseWriter, *irc.Request, ParamList) {}).
+		Add("wie", true, RegAny)
+	set.Bind("weer", false, func(irc.ResponseWriter, *irc.Request, ParamList) {})
+	set.SetAuditHook(func(e AuditEntry) { entries = append(entries, e) })
+
+	set.Dispatch(&w, newRequest("steve", "!kick bob \"doe normaal\""))
+	set.Dispatch(&w, newRequest("bob", "!kick steve"))
+	set.Dispatch(&w, newRequest("bob", "!weer"))
+	set.Close()
+
+	want := []AuditEntry{
+		{now(), "~steve@example.com", "kick", []string{"bob", "doe normaal"}, true},
+		{now(), "~bob@example.com", "kick", []string{"steve"}, false},
+	}
+
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("audit mismatch;\nwant: %v\nhave: %v", want, entries)
+	}
+
+	// Unrestricted commands are only audited if asked to.
+	entries = nil
+	set = New([]string{"!"}, nil)
+	set.Bind("weer", false, func(irc.ResponseWriter, *irc.Request, ParamList) {})
+	set.SetAuditHook(func(e AuditEntry) { entries = append(entries, e) })
+	set.SetAuditAll(true)
+
+	set.Dispatch(&w, newRequest("bob", "!weer"))
+	set.Close()
+
+	if len(entries) != 1 || entries[0].Command != "weer" || !entries[0].Allowed {
+		t.Fatalf("audit mismatch;\nhave: %v", entries)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	setClock(t)
+
+	file := filepath.Join(t.TempDir(), "logs", "audit.txt")
+	al := NewAuditLog(file)
+
+	al.Log(AuditEntry{now(), "~steve@example.com", "kick", []string{"bob", "doe normaal"}, true})
+	al.Log(AuditEntry{now(), "~bob@example.com", "kick", []string{"steve"}, false})
+	al.Close()
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "2017-01-01T12:00:00Z allowed ~steve@example.com kick \"bob doe normaal\"\n" +
+		"2017-01-01T12:00:00Z denied ~bob@example.com kick \"steve\"\n"
+
+	if have := string(data); have != want {
+		t.Fatalf("audit log mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	var w mockWriter
+	var buf mockWriter
+
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	hook := make(chan interface{}, 1)
+
+	set := New([]string{"!"}, nil)
+	set.Bind("boem", false, func(irc.ResponseWriter, *irc.Request, ParamList) {
+		panic("kapot")
+	})
+	set.SetPanicHook(func(_ irc.ResponseWriter, r *irc.Request, v interface{}, stack []byte) {
+		hook <- v
+	})
+
+	set.Dispatch(&w, newRequest("bob", "!boem"))
+
+	select {
+	case v := <-hook:
+		if v != "kapot" {
+			t.Fatalf("panic value mismatch;\nwant: %q\nhave: %v", "kapot", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("panic hook was not called")
+	}
+
+	set.Close()
+
+	have := buf.String()
+	for _, want := range []string{"Command error: kapot", "goroutine ", "TestPanic"} {
+		if !strings.Contains(have, want) {
+			t.Fatalf("log output does not contain %q;\nhave: %s", want, have)
+		}
+	}
+}
@@ -6,5 +6,17 @@ package cmd
 const (
 	TextMissingParameters = "Ontbrekende parameters voor commando: %s"
 	TextInvalidParameter  = "Commando %s: ongeldige waarde voor parameter %q"
+	TextCooldown          = "Commando %s: probeer het over %d seconden nog eens."
 	TextAccessDenied      = "Helaas, pindakaas. Het commando %q mag uitsluitend door beheerders uitgevoerd worden."
+
+	TextHelpPage           = "Commando's (pagina %d/%d): %s."
+	TextHelpNextPage       = " Gebruik %s %d voor de volgende pagina."
+	TextHelpNoPage         = "Pagina %d bestaat niet. Er zijn %d pagina's."
+	TextHelpEmpty          = "Er zijn geen commando's beschikbaar."
+	TextHelpUnknown        = "Het commando %q is niet bekend."
+	TextHelpUsage          = "Gebruik: %s"
+	TextHelpSubcommands    = "Subcommando's:"
+	TextHelpAliases        = "Dit commando is ook bekend als: %s"
+	TextHelpRestricted     = "Dit commando mag uitsluitend door beheerders uitgevoerd worden."
+	TextHelpRestrictedMark = "*"
 )
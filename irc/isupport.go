@@ -0,0 +1,204 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package irc
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Support holds the features advertised by the server the bot is
+// connected to. It is filled by the admin plugin, as the server sends
+// them during registration.
+var Support = NewISupport()
+
+// ISupport holds the tokens sent by a server in numeric 005
+// (RPL_ISUPPORT). These describe the features and limits of the server.
+// E.g.: "NICKLEN" => "30", "CHANTYPES" => "#&". Tokens without a value
+// are stored with an empty string. Token names are case-sensitive and
+// always upper case.
+//
+// ref: https://modern.ircdocs.horse/#rplisupport-parameters
+type ISupport struct {
+	m      sync.RWMutex
+	tokens map[string]string
+}
+
+// NewISupport creates a new, empty token set.
+func NewISupport() *ISupport {
+	return &ISupport{tokens: make(map[string]string)}
+}
+
+// Parse reads the parameters of a single 005 message and records the
+// tokens in it. Servers usually send several of these. A token prefixed
+// with '-' removes a previously advertised token. Parsing stops at the
+// trailing parameter, which holds a human readable text.
+//
+//	CHANTYPES=# PREFIX=(ov)@+ NICKLEN=30 -WATCH :are supported by this server
+func (s *ISupport) Parse(data string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, field := range strings.Fields(data) {
+		if strings.HasPrefix(field, ":") {
+			break
+		}
+
+		if strings.HasPrefix(field, "-") {
+			delete(s.tokens, field[1:])
+			continue
+		}
+
+		var value string
+		if idx := strings.IndexByte(field, '='); idx > -1 {
+			field, value = field[:idx], unescapeValue(field[idx+1:])
+		}
+
+		if len(field) > 0 {
+			s.tokens[field] = value
+		}
+	}
+}
+
+// Reset removes all tokens. This should be called when a new connection
+// is established.
+func (s *ISupport) Reset() {
+	s.m.Lock()
+	s.tokens = make(map[string]string)
+	s.m.Unlock()
+}
+
+// Has returns true if the server advertised the given token.
+func (s *ISupport) Has(name string) bool {
+	_, ok := s.Get(name)
+	return ok
+}
+
+// Get returns the value of the given token. Returns false if the server
+// did not advertise it.
+func (s *ISupport) Get(name string) (string, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	v, ok := s.tokens[name]
+	return v, ok
+}
+
+// Int returns the value of the given token as a number. Returns def if
+// the token was not advertised, or if its value is not a number.
+func (s *ISupport) Int(name string, def int) int {
+	v, ok := s.Get(name)
+	if !ok {
+		return def
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// Tokens returns a copy of all advertised tokens.
+func (s *ISupport) Tokens() map[string]string {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	out := make(map[string]string, len(s.tokens))
+	for k, v := range s.tokens {
+		out[k] = v
+	}
+	return out
+}
+
+// ChanTypes returns the characters which may start a channel name.
+// This defaults to "#&".
+func (s *ISupport) ChanTypes() string {
+	if v, ok := s.Get("CHANTYPES"); ok {
+		return v
+	}
+	return "#&"
+}
+
+// Prefix returns the channel user modes and their matching nickname
+// prefixes, in order of rank. E.g.: "ov" and "@+". This defaults to
+// the latter.
+func (s *ISupport) Prefix() (modes, symbols string) {
+	v, ok := s.Get("PREFIX")
+	if !ok {
+		return "ov", "@+"
+	}
+
+	idx := strings.IndexByte(v, ')')
+	if !strings.HasPrefix(v, "(") || idx == -1 {
+		return "", ""
+	}
+
+	return v[1:idx], v[idx+1:]
+}
+
+// Modes returns the maximum number of parameterized modes which can be
+// set in a single MODE command. This defaults to 3.
+func (s *ISupport) Modes() int { return s.Int("MODES", 3) }
+
+// NickLen returns the maximum length of a nickname. This defaults to 9.
+func (s *ISupport) NickLen() int { return s.Int("NICKLEN", 9) }
+
+// TopicLen returns the maximum length of a channel topic. Returns 0 if
+// the server did not specify a limit.
+func (s *ISupport) TopicLen() int { return s.Int("TOPICLEN", 0) }
+
+// MaxTargets returns the maximum number of targets allowed for the given
+// command, as advertised in TARGMAX. Returns 0 if the server lists the
+// command without a limit. Returns def if the command is not listed.
+func (s *ISupport) MaxTargets(command string, def int) int {
+	v, ok := s.Get("TARGMAX")
+	if !ok {
+		return def
+	}
+
+	for _, pair := range strings.Split(v, ",") {
+		idx := strings.IndexByte(pair, ':')
+		if idx == -1 || !strings.EqualFold(pair[:idx], command) {
+			continue
+		}
+
+		if idx == len(pair)-1 {
+			return 0
+		}
+
+		n, err := strconv.Atoi(pair[idx+1:])
+		if err != nil {
+			return def
+		}
+		return n
+	}
+
+	return def
+}
+
+// unescapeValue replaces \xHH escape sequences in a token value with the
+// characters they represent.
+func unescapeValue(v string) string {
+	if !strings.Contains(v, `\x`) {
+		return v
+	}
+
+	var sb strings.Builder
+
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+3 < len(v) && v[i+1] == 'x' {
+			if n, err := strconv.ParseUint(v[i+2:i+4], 16, 8); err == nil {
+				sb.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+
+		sb.WriteByte(v[i])
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,83 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestISupportParse(t *testing.T) {
+	s := NewISupport()
+	s.Parse("CHANTYPES=# PREFIX=(qaohv)~&@%+ NICKLEN=30 TOPICLEN=390 MODES=4 SILENCE=15 WATCH=128 EXCEPTS :are supported by this server")
+	s.Parse("TARGMAX=NAMES:1,PRIVMSG:4,NOTICE:4,KICK: NETWORK=Example\\x20Net KNOCK :are supported by this server")
+
+	want := map[string]string{
+		"CHANTYPES": "#",
+		"PREFIX":    "(qaohv)~&@%+",
+		"NICKLEN":   "30",
+		"TOPICLEN":  "390",
+		"MODES":     "4",
+		"SILENCE":   "15",
+		"WATCH":     "128",
+		"EXCEPTS":   "",
+		"TARGMAX":   "NAMES:1,PRIVMSG:4,NOTICE:4,KICK:",
+		"NETWORK":   "Example Net",
+		"KNOCK":     "",
+	}
+
+	if have := s.Tokens(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("token mismatch;\nwant: %v\nhave: %v", want, have)
+	}
+
+	if s.ChanTypes() != "#" || s.NickLen() != 30 || s.TopicLen() != 390 || s.Modes() != 4 {
+		t.Fatalf("accessor mismatch: %q %d %d %d",
+			s.ChanTypes(), s.NickLen(), s.TopicLen(), s.Modes())
+	}
+
+	if modes, symbols := s.Prefix(); modes != "qaohv" || symbols != "~&@%+" {
+		t.Fatalf("prefix mismatch;\nwant: qaohv ~&@%%+\nhave: %s %s", modes, symbols)
+	}
+
+	for _, tt := range []struct {
+		command string
+		want    int
+	}{
+		{"PRIVMSG", 4},
+		{"names", 1},
+		{"KICK", 0},
+		{"WHOIS", 1},
+	} {
+		if have := s.MaxTargets(tt.command, 1); have != tt.want {
+			t.Fatalf("MaxTargets mismatch for %s;\nwant: %d\nhave: %d",
+				tt.command, tt.want, have)
+		}
+	}
+
+	// Negated tokens are removed.
+	s.Parse("-WATCH -KNOCK :are supported by this server")
+	if s.Has("WATCH") || s.Has("KNOCK") || !s.Has("SILENCE") {
+		t.Fatalf("negated tokens not removed: %v", s.Tokens())
+	}
+}
+
+func TestISupportDefaults(t *testing.T) {
+	s := NewISupport()
+
+	if s.ChanTypes() != "#&" || s.NickLen() != 9 || s.TopicLen() != 0 || s.Modes() != 3 {
+		t.Fatalf("default mismatch: %q %d %d %d",
+			s.ChanTypes(), s.NickLen(), s.TopicLen(), s.Modes())
+	}
+
+	if modes, symbols := s.Prefix(); modes != "ov" || symbols != "@+" {
+		t.Fatalf("default prefix mismatch: %s %s", modes, symbols)
+	}
+
+	s.Parse("NICKLEN=30")
+	s.Reset()
+
+	if len(s.Tokens()) != 0 {
+		t.Fatalf("tokens not reset: %v", s.Tokens())
+	}
+}
@@ -0,0 +1,259 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package irc
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Members holds the users in the channels the bot is in. It is kept up to
+// date by the admin plugin, from RPL_NAMREPLY (353) replies and JOIN, PART,
+// QUIT, KICK and NICK messages. If the server supports the away-notify
+// capability, it tracks who is away through AWAY messages as well.
+var Members = NewMemberList()
+
+// Member defines a single user in a channel.
+type Member struct {
+	Nick   string // Nickname of the user.
+	Prefix string // Channel status prefixes, highest rank first. E.g.: "@+".
+	Away   string // Away message, if the user is away.
+}
+
+// Has returns true if the member has the given status prefix. E.g.: '@'
+// for channel operators.
+func (m Member) Has(prefix byte) bool {
+	return strings.IndexByte(m.Prefix, prefix) > -1
+}
+
+// MemberList holds the members of a set of channels. Channel names and
+// nicknames are compared case-insensitively.
+type MemberList struct {
+	m        sync.RWMutex
+	channels map[string]map[string]Member // Channel => nick => member.
+	names    map[string]map[string]Member // NAMES listings being received.
+	away     map[string]string            // Nick => away message.
+}
+
+// NewMemberList creates a new, empty member list.
+func NewMemberList() *MemberList {
+	return &MemberList{
+		channels: make(map[string]map[string]Member),
+		names:    make(map[string]map[string]Member),
+		away:     make(map[string]string),
+	}
+}
+
+// Names records the users in a single RPL_NAMREPLY (353) message. Servers
+// send as many of these as needed to list everyone, followed by a single
+// RPL_ENDOFNAMES (366). The data has the form:
+//
+//	= #channel :@steve +bob alice
+//
+// Each name carries the status prefixes of the user. Normally only the
+// highest one, but all of them if the multi-prefix capability is enabled.
+// The prefixes are recognized through the PREFIX token in Support. Names
+// may include the user's host, if the userhost-in-names capability is
+// enabled. This is dropped.
+func (ml *MemberList) Names(data string) {
+	fields := strings.SplitN(data, " ", 3)
+	if len(fields) < 3 {
+		return
+	}
+
+	channel := strings.ToLower(fields[1])
+	_, symbols := Support.Prefix()
+
+	ml.m.Lock()
+	defer ml.m.Unlock()
+
+	set, ok := ml.names[channel]
+	if !ok {
+		set = make(map[string]Member)
+		ml.names[channel] = set
+	}
+
+	for _, name := range strings.Fields(strings.TrimPrefix(fields[2], ":")) {
+		var m Member
+
+		idx := strings.IndexFunc(name, func(r rune) bool {
+			return !strings.ContainsRune(symbols, r)
+		})
+
+		if idx == -1 {
+			continue
+		}
+
+		m.Prefix, m.Nick = name[:idx], name[idx:]
+
+		if idx = strings.IndexByte(m.Nick, '!'); idx > -1 {
+			m.Nick = m.Nick[:idx]
+		}
+
+		set[strings.ToLower(m.Nick)] = m
+	}
+}
+
+// EndOfNames handles RPL_ENDOFNAMES (366). The users received through Names
+// replace the known members of the channel. The data has the form:
+//
+//	#channel :End of /NAMES list.
+func (ml *MemberList) EndOfNames(data string) {
+	channel := data
+	if idx := strings.IndexByte(data, ' '); idx > -1 {
+		channel = data[:idx]
+	}
+
+	channel = strings.ToLower(channel)
+
+	ml.m.Lock()
+	defer ml.m.Unlock()
+
+	set, ok := ml.names[channel]
+	if !ok {
+		set = make(map[string]Member)
+	}
+
+	ml.channels[channel] = set
+	delete(ml.names, channel)
+}
+
+// Join adds the given user to a channel, without any status prefixes.
+func (ml *MemberList) Join(channel, nick string) {
+	channel = strings.ToLower(channel)
+
+	ml.m.Lock()
+	defer ml.m.Unlock()
+
+	set, ok := ml.channels[channel]
+	if !ok {
+		set = make(map[string]Member)
+		ml.channels[channel] = set
+	}
+
+	set[strings.ToLower(nick)] = Member{Nick: nick}
+}
+
+// Part removes the given user from a channel. E.g.: when they leave it,
+// or are kicked from it.
+func (ml *MemberList) Part(channel, nick string) {
+	ml.m.Lock()
+	delete(ml.channels[strings.ToLower(channel)], strings.ToLower(nick))
+	ml.m.Unlock()
+}
+
+// Quit removes the given user from all channels.
+func (ml *MemberList) Quit(nick string) {
+	nick = strings.ToLower(nick)
+
+	ml.m.Lock()
+	for _, set := range ml.channels {
+		delete(set, nick)
+	}
+	delete(ml.away, nick)
+	ml.m.Unlock()
+}
+
+// SetAway records the away message of the given user. An empty message
+// means they are back.
+func (ml *MemberList) SetAway(nick, message string) {
+	nick = strings.ToLower(nick)
+
+	ml.m.Lock()
+	if len(message) > 0 {
+		ml.away[nick] = message
+	} else {
+		delete(ml.away, nick)
+	}
+	ml.m.Unlock()
+}
+
+// Away returns the away message of the given user. Returns false if they
+// are not known to be away.
+func (ml *MemberList) Away(nick string) (string, bool) {
+	ml.m.RLock()
+	defer ml.m.RUnlock()
+
+	msg, ok := ml.away[strings.ToLower(nick)]
+	return msg, ok
+}
+
+// Rename changes the nickname of the given user in all channels.
+func (ml *MemberList) Rename(from, to string) {
+	from = strings.ToLower(from)
+
+	ml.m.Lock()
+	defer ml.m.Unlock()
+
+	for _, set := range ml.channels {
+		if m, ok := set[from]; ok {
+			delete(set, from)
+			m.Nick = to
+			set[strings.ToLower(to)] = m
+		}
+	}
+
+	if msg, ok := ml.away[from]; ok {
+		delete(ml.away, from)
+		ml.away[strings.ToLower(to)] = msg
+	}
+}
+
+// Remove forgets all members of the given channel. E.g.: when the bot
+// leaves it.
+func (ml *MemberList) Remove(channel string) {
+	channel = strings.ToLower(channel)
+
+	ml.m.Lock()
+	delete(ml.channels, channel)
+	delete(ml.names, channel)
+	ml.m.Unlock()
+}
+
+// Reset forgets all channels.
+func (ml *MemberList) Reset() {
+	ml.m.Lock()
+	ml.channels = make(map[string]map[string]Member)
+	ml.names = make(map[string]map[string]Member)
+	ml.away = make(map[string]string)
+	ml.m.Unlock()
+}
+
+// Get returns the given user in a channel. Returns false if they are not
+// in it, or if the channel is not known.
+func (ml *MemberList) Get(channel, nick string) (Member, bool) {
+	ml.m.RLock()
+	defer ml.m.RUnlock()
+
+	nick = strings.ToLower(nick)
+
+	m, ok := ml.channels[strings.ToLower(channel)][nick]
+	m.Away = ml.away[nick]
+	return m, ok
+}
+
+// List returns the members of the given channel, sorted by nickname.
+// Returns false if the channel is not known.
+func (ml *MemberList) List(channel string) ([]Member, bool) {
+	ml.m.RLock()
+	defer ml.m.RUnlock()
+
+	set, ok := ml.channels[strings.ToLower(channel)]
+	if !ok {
+		return nil, false
+	}
+
+	out := make([]Member, 0, len(set))
+	for nick, m := range set {
+		m.Away = ml.away[nick]
+		out = append(out, m)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return strings.ToLower(out[i].Nick) < strings.ToLower(out[j].Nick)
+	})
+
+	return out, true
+}
@@ -0,0 +1,68 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemberList(t *testing.T) {
+	ml := NewMemberList()
+
+	// A NAMES listing, spread over several messages. With multi-prefix
+	// and userhost-in-names enabled for the second one.
+	ml.Names("= #Test :@steve +bob alice")
+	testMembers(t, ml, "#test", nil)
+
+	ml.Names("= #test :@+WiZ carol!~carol@example.com")
+	ml.EndOfNames("#test :End of /NAMES list.")
+
+	testMembers(t, ml, "#test", []Member{
+		{"alice", "", ""}, {"bob", "+", ""}, {"carol", "", ""}, {"steve", "@", ""}, {"WiZ", "@+", ""},
+	})
+
+	if m, ok := ml.Get("#TEST", "wiz"); !ok || !m.Has('@') || !m.Has('+') {
+		t.Fatalf("member mismatch; have: %v %v", m, ok)
+	}
+
+	// People come and go.
+	ml.Join("#test", "dave")
+	ml.Part("#test", "Alice")
+	ml.SetAway("bob", "lunch")
+	ml.Rename("bob", "robert")
+	ml.SetAway("carol", "weg")
+	ml.Quit("carol")
+	ml.SetAway("steve", "slapen")
+	ml.SetAway("steve", "")
+
+	testMembers(t, ml, "#test", []Member{
+		{"dave", "", ""}, {"robert", "+", "lunch"}, {"steve", "@", ""}, {"WiZ", "@+", ""},
+	})
+
+	if msg, ok := ml.Away("ROBERT"); !ok || msg != "lunch" {
+		t.Fatalf("away mismatch; have: %q %v", msg, ok)
+	}
+
+	if _, ok := ml.Away("carol"); ok {
+		t.Fatalf("expected carol not to be away")
+	}
+
+	// A new listing replaces the old one.
+	ml.Names("= #test :@steve")
+	ml.EndOfNames("#test :End of /NAMES list.")
+	testMembers(t, ml, "#test", []Member{{"steve", "@", ""}})
+
+	ml.Remove("#test")
+	if _, ok := ml.List("#test"); ok {
+		t.Fatalf("expected #test to be forgotten")
+	}
+}
+
+func testMembers(t *testing.T, ml *MemberList, channel string, want []Member) {
+	have, _ := ml.List(channel)
+	if !reflect.DeepEqual(want, have) {
+		t.Fatalf("member mismatch for %s;\nwant: %v\nhave: %v", channel, want, have)
+	}
+}
@@ -5,13 +5,22 @@
 package irc
 
 import (
+	"encoding/json"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/monkeybird/autimaat/app/util"
 )
 
 // Profile defines bot configuration data.
+//
+// Restricted commands are available to the users in the whitelist. Those
+// which manage the whitelist, or otherwise affect the bot as a whole, are
+// reserved for owners. For backwards compatibility, a profile without any
+// owners treats all whitelisted users as owners. The bot warns about this
+// on startup.
 type Profile interface {
 	// Root defines the root directory with the bot's configuration data.
 	Root() string
@@ -19,16 +28,27 @@ type Profile interface {
 	// Channels yields all channels the bot should join on startup.
 	Channels() []Channel
 
+	// ChanServJoin returns true if the chanserv flow should be used for
+	// all channels, instead of only those which have their ChanServ flag
+	// set. See proto.Join. This is only useful on networks which have a
+	// chanserv service.
+	ChanServJoin() bool
+
 	// Address defines the host and port of the server/network to connect to.
 	Address() string
 
+	// UseTLS returns true if the connection to the server should be
+	// encrypted. This does not require a client certificate. Setting both
+	// TLSKey and TLSCert implies this.
+	UseTLS() bool
+
 	// TKSKey defines the TLS key file. Along with TLSCert, it defines the
-	// components needed to establish an encrypted connection to the server.
+	// client certificate presented to the server. This is optional and
+	// only needed for servers which require one.
 	TLSKey() string
 
 	// TLSCert defines the TLS certificate file. Along with TLSKey, it
-	// defines the components needed to establish an encrypted connection
-	// to the server.
+	// defines the client certificate presented to the server.
 	TLSCert() string
 
 	// CAPemData defines one ore more, PEM encoded, server root certificates.
@@ -37,18 +57,54 @@ type Profile interface {
 	// certificate is not present in any system wide CA pools.
 	CAPemData() string
 
+	// TLSSkipVerify returns true if the server's certificate should not be
+	// verified. This is insecure and only meant for connecting to test
+	// servers with self-signed certificates.
+	TLSSkipVerify() bool
+
 	// Nickname yields the bot's nickname.
 	Nickname() string
 
+	// Username defines the username (ident) the bot registers with. If
+	// this is empty, the nickname is used.
+	Username() string
+
+	// Realname defines the bot's real name (gecos). If this is empty, the
+	// nickname is used.
+	Realname() string
+
+	// UserModes defines the user mode bitmask sent during registration.
+	// Setting bit 2 (4) requests mode +w and bit 3 (8) requests mode +i.
+	// If this is empty, "8" is used.
+	UserModes() string
+
 	// SetNickname sets the bot's nickname. This is generally only called
 	// when the bot logs in and finds its name alredy in use. If the nick
 	// can not be regained, this function is used to alter it to something
 	// which is still available.
 	SetNickname(string)
 
+	// PreferredNickname yields the nickname the bot would like to have.
+	// This differs from Nickname if the latter had to be altered, because
+	// the preferred name was in use. The bot will try to reclaim it. This
+	// defaults to the current nickname.
+	PreferredNickname() string
+
+	// HasPreferredNickname returns true if a preferred nickname has been
+	// set explicitly, rather than defaulting to the current nickname.
+	HasPreferredNickname() bool
+
+	// SetPreferredNickname sets the nickname the bot would like to have.
+	SetPreferredNickname(string)
+
 	// NickservPassword defines the bot's nickserv password. This will be
 	// used to register the bot when it logs in. It is only relevant if the
 	// bot has a registered nickname and nickserv exists on the server.
+	//
+	// This, and the other passwords, may refer to environment variables,
+	// as ${VAR} or $VAR. These are expanded whenever the value is read,
+	// so the profile never stores the actual secret. A literal $ is
+	// written as $$.
 	NickservPassword() string
 
 	// SetNickservPassword sets the bot's nickserv password. This is be
@@ -56,6 +112,17 @@ type Profile interface {
 	// bot has a registered nickname and nickserv exists on the server.
 	SetNickservPassword(string)
 
+	// UseSasl returns true if the bot should authenticate using SASL PLAIN
+	// when logging in. This requires the server to support the IRCv3 sasl
+	// capability. It is used instead of, or alongside nickserv.
+	UseSasl() bool
+
+	// SaslUsername defines the account name used for SASL authentication.
+	SaslUsername() string
+
+	// SaslPassword defines the password used for SASL authentication.
+	SaslPassword() string
+
 	// OperPassword defines the bot's OPER password. If present, this will
 	// register the bot as a server operator.
 	OperPassword() string
@@ -65,9 +132,92 @@ type Profile interface {
 
 	// CommandPrefix this is the prefix used for all bot commands. Whenever
 	// the bot reads incoming PRIVMSG data, it looks for this prefix to
-	// determine if a command call was issued or not.
+	// determine if a command call was issued or not. If multiple prefixes
+	// are defined, this yields the first one.
 	CommandPrefix() string
 
+	// CommandPrefixes yields all prefixes which can be used for bot
+	// commands. E.g.: "!", "." or "botname: ". The first one is the
+	// primary prefix, which is used in help output. If none are defined,
+	// this yields CommandPrefix.
+	CommandPrefixes() []string
+
+	// Capabilities defines the IRCv3 capabilities the bot should request
+	// from the server when logging in. Those not supported by the server
+	// are ignored. If this is empty, no capability negotiation is done.
+	Capabilities() []string
+
+	// CtcpVersion defines the reply to CTCP VERSION queries. If this is
+	// empty, the application name and version are used.
+	CtcpVersion() string
+
+	// QuitMessage defines the message sent to the server when the bot
+	// shuts down. If this is empty, the application name and version
+	// are used.
+	QuitMessage() string
+
+	// AwayMessage defines the bot's away message. This is restored after
+	// a reconnect. The bot is not away if the message is empty.
+	AwayMessage() string
+
+	// SetAwayMessage sets the bot's away message.
+	SetAwayMessage(string)
+
+	// ReconnectRetries defines the maximum number of consecutive attempts
+	// to reconnect after the connection is lost. Zero means the bot keeps
+	// trying indefinitely.
+	ReconnectRetries() int
+
+	// ReconnectMinDelay defines the delay before the first reconnect
+	// attempt. It doubles with every subsequent attempt.
+	ReconnectMinDelay() time.Duration
+
+	// ReconnectMaxDelay defines the maximum delay between two reconnect
+	// attempts.
+	ReconnectMaxDelay() time.Duration
+
+	// FloodBurst defines the number of messages the bot may send in rapid
+	// succession, before outgoing messages are rate limited.
+	FloodBurst() int
+
+	// FloodInterval defines the delay between two outgoing messages, once
+	// the burst allowance is used up.
+	FloodInterval() time.Duration
+
+	// PingInterval defines how often the bot checks if the connection is
+	// still alive, by sending a PING to the server.
+	PingInterval() time.Duration
+
+	// PingTimeout defines how long the bot waits for the server to answer
+	// a PING. If no answer arrives in time, the connection is considered
+	// lost and the bot reconnects.
+	PingTimeout() time.Duration
+
+	// StatsRetention defines how long the stats plugin remembers users
+	// who have not been seen since. A value of zero disables purging.
+	StatsRetention() time.Duration
+
+	// WeatherUnits defines the units used by the weather plugin, unless
+	// the user asks for others. This is either "metric" or "imperial".
+	WeatherUnits() string
+
+	// LogRetention defines how long log files are kept, before they are
+	// purged.
+	LogRetention() time.Duration
+
+	// LogPurgeInterval defines how often the bot checks for log files
+	// which should be purged.
+	LogPurgeInterval() time.Duration
+
+	// LogRefreshInterval defines how often the bot checks if a new log
+	// file should be started.
+	LogRefreshInterval() time.Duration
+
+	// LogMaxSize defines the size in bytes, after which a log file is
+	// cycled, even if the day has not yet ended. A value of zero means
+	// logs are only cycled daily.
+	LogMaxSize() int64
+
 	// Save saves the profile to disk.
 	Save() error
 
@@ -76,9 +226,20 @@ type Profile interface {
 
 	// IsWhitelisted returns true if the given hostmask is in the whitelist.
 	// This means the user to whom it belongs is allowed to execute restricted
-	// commands. This performs a case-insensitive comparison.
+	// commands. This performs a case-insensitive comparison. Owners are
+	// implicitly whitelisted.
 	IsWhitelisted(string) bool
 
+	// IsOwner returns true if the given hostmask belongs to an owner.
+	// Owners are allowed to execute commands which manage the whitelist,
+	// or otherwise affect the bot as a whole. If no owners are defined,
+	// all whitelisted users are considered owners. This performs a
+	// case-insensitive comparison.
+	IsOwner(string) bool
+
+	// Owners returns a copy of the current list of owners.
+	Owners() []string
+
 	// Whitelist returns a copy of the current whitelist.
 	Whitelist() []string
 
@@ -90,6 +251,23 @@ type Profile interface {
 	// provided it exists.
 	WhitelistRemove(string)
 
+	// Ignores returns a copy of the current ignore list.
+	Ignores() []string
+
+	// IgnoreAdd adds the given mask to the ignore list, provided it does
+	// not already exist.
+	IgnoreAdd(string)
+
+	// IgnoreRemove removes the given mask from the ignore list, provided
+	// it exists.
+	IgnoreRemove(string)
+
+	// IsIgnored returns true if messages from the given user should be
+	// ignored. The user is given as "nick!user@host". Masks in the ignore
+	// list may contain the wildcards '*' and '?'. A mask without a nick
+	// part matches "user@host" only. This is case-insensitive.
+	IsIgnored(string) bool
+
 	// IsNick returns true if the given name equals the bot's nickname.
 	// This is used in request handlers to quickly check if a request
 	// is targeted specifically at this bot or not.
@@ -104,8 +282,92 @@ type Profile interface {
 
 	// Logging determines if logging of incoming data should be enabled or not.
 	SetLogging(bool)
+
+	// JSONLogging returns true if logged incoming data should be written
+	// as JSON objects, rather than plain text.
+	JSONLogging() bool
+
+	// ChannelLogging returns true if chat logs are kept for each channel.
+	ChannelLogging() bool
+
+	// SetChannelLogging determines if chat logs should be kept for each
+	// channel.
+	SetChannelLogging(bool)
+
+	// NoticeCommands returns true if the bot should accept commands which
+	// are sent as a NOTICE, rather than a PRIVMSG. Some bridges and relay
+	// bots send messages this way.
+	NoticeCommands() bool
+
+	// AuditAllCommands returns true if calls to all commands should be
+	// written to the audit log. By default, only restricted commands are.
+	AuditAllCommands() bool
+
+	// MetricsAddr defines the address on which health and metrics data
+	// is served over HTTP. E.g.: "127.0.0.1:8080". This is disabled if
+	// the address is empty.
+	MetricsAddr() string
+
+	// DisabledPlugins returns the names of plugins which should not be
+	// loaded.
+	DisabledPlugins() []string
+
+	// SetPluginEnabled determines if the plugin with the given name
+	// should be loaded.
+	SetPluginEnabled(string, bool)
+
+	// PluginConfig reads the settings for the plugin with the given name
+	// into v. These are stored in the profile, under the plugin's name.
+	// If the profile holds no settings for the plugin, they are read from
+	// the file "<name>.cfg" in the profile directory instead.
+	PluginConfig(name string, v interface{}) error
+
+	// SetPluginConfig stores the given settings for the plugin with the
+	// given name in the profile and saves it.
+	SetPluginConfig(name string, v interface{}) error
 }
 
+// DefaultUserModes defines the user mode bitmask sent during registration,
+// if the profile does not define one. It requests mode +i.
+const DefaultUserModes = "8"
+
+// Default reconnect delays. These are used if the profile does not
+// define them.
+const (
+	DefaultReconnectMinDelay = time.Second * 5
+	DefaultReconnectMaxDelay = time.Minute * 5
+)
+
+// Default flood protection settings. These are used if the profile does
+// not define them.
+const (
+	DefaultFloodBurst    = 5
+	DefaultFloodInterval = time.Second * 2
+)
+
+// Default keepalive settings. These are used if the profile does not
+// define them.
+const (
+	DefaultPingInterval = time.Second * 90
+	DefaultPingTimeout  = time.Second * 60
+)
+
+// DefaultWeatherUnits defines the units used by the weather plugin,
+// if the profile does not define them.
+const DefaultWeatherUnits = "metric"
+
+// DefaultStatsRetention defines how long the stats plugin remembers users,
+// for new profiles.
+const DefaultStatsRetention = time.Hour * 24 * 180
+
+// Default log settings. These are used if the profile does not define
+// them, or if it defines values which are not positive.
+const (
+	DefaultLogRetention       = time.Hour * 24 * 14
+	DefaultLogPurgeInterval   = time.Hour * 24
+	DefaultLogRefreshInterval = time.Minute
+)
+
 // profile defines bot configuration data.
 //
 // The fields are embedded in a sub struct to differentiate them from the
@@ -121,35 +383,93 @@ type profile struct {
 // profileData defines the parts of the profile which are saved to
 // an external configuration file.
 type profileData struct {
+	Owners             []string
 	Whitelist          []string
+	Ignores            []string
 	Channels           []Channel
+	ChanServJoin       bool
 	Address            string
+	UseTLS             bool
 	TLSKey             string
 	TLSCert            string
 	CAPemData          string
+	TLSSkipVerify      bool
 	Nickname           string
+	PreferredNickname  string
+	Username           string
+	Realname           string
+	UserModes          string
 	NickservPassword   string
+	UseSasl            bool
+	SaslUsername       string
+	SaslPassword       string
 	OperPassword       string
 	ConnectionPassword string
 	CommandPrefix      string
+	CommandPrefixes    []string
+	CtcpVersion        string
+	QuitMessage        string
+	AwayMessage        string
+	Capabilities       []string
+	ReconnectRetries   int
+	ReconnectMinDelay  int // In seconds.
+	ReconnectMaxDelay  int // In seconds.
+	FloodBurst         int
+	FloodInterval      int // In milliseconds.
+	PingInterval       int // In seconds.
+	PingTimeout        int // In seconds.
+	StatsRetention     int // In days.
+	WeatherUnits       string
 	Logging            bool
+	JSONLogging        bool
+	ChannelLogging     bool
+	DisabledPlugins    []string
+	PluginConfig       map[string]json.RawMessage
+	NoticeCommands     bool
+	AuditAllCommands   bool
+	MetricsAddr        string
+	LogRetention       int // In days.
+	LogPurgeInterval   int // In hours.
+	LogRefreshInterval int // In seconds.
+	LogMaxSize         int // In megabytes.
 }
 
 // NewProfile creates a new profile for the given root directory.
 func NewProfile(root string) Profile {
 	return &profile{
 		root: root,
-		data: profileData{
-			Logging:  false,
-			Address:  "server.net:6667",
-			Nickname: "bot_name",
-			Channels: []Channel{
-				{Name: "#test_channel"},
-			},
-			Whitelist: []string{
-				"~user@server.com",
-			},
-			CommandPrefix: "!",
+		data: defaultProfileData(),
+	}
+}
+
+// defaultProfileData returns the settings used by a new profile. Settings
+// which are missing from profile.cfg keep these values.
+func defaultProfileData() profileData {
+	return profileData{
+		Logging:  false,
+		Address:  "server.net:6667",
+		Nickname: "bot_name",
+		Channels: []Channel{
+			{Name: "#test_channel"},
+		},
+		Whitelist: []string{
+			"~user@server.com",
+		},
+		CommandPrefix:      "!",
+		ReconnectMinDelay:  5,
+		ReconnectMaxDelay:  300,
+		FloodBurst:         DefaultFloodBurst,
+		FloodInterval:      2000,
+		PingInterval:       90,
+		PingTimeout:        60,
+		StatsRetention:     int(DefaultStatsRetention / (time.Hour * 24)),
+		LogRetention:       int(DefaultLogRetention / (time.Hour * 24)),
+		LogPurgeInterval:   int(DefaultLogPurgeInterval / time.Hour),
+		LogRefreshInterval: int(DefaultLogRefreshInterval / time.Second),
+		Capabilities: []string{
+			"away-notify",
+			"multi-prefix",
+			"server-time",
 		},
 	}
 }
@@ -172,12 +492,24 @@ func (p *profile) Channels() []Channel {
 	return p.data.Channels
 }
 
+func (p *profile) ChanServJoin() bool {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.ChanServJoin
+}
+
 func (p *profile) Address() string {
 	p.m.RLock()
 	defer p.m.RUnlock()
 	return p.data.Address
 }
 
+func (p *profile) UseTLS() bool {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.UseTLS
+}
+
 func (p *profile) TLSKey() string {
 	p.m.RLock()
 	defer p.m.RUnlock()
@@ -196,12 +528,51 @@ func (p *profile) CAPemData() string {
 	return p.data.CAPemData
 }
 
+func (p *profile) TLSSkipVerify() bool {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.TLSSkipVerify
+}
+
 func (p *profile) Nickname() string {
 	p.m.RLock()
 	defer p.m.RUnlock()
 	return p.data.Nickname
 }
 
+func (p *profile) Username() string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if len(p.data.Username) == 0 {
+		return p.data.Nickname
+	}
+
+	return p.data.Username
+}
+
+func (p *profile) Realname() string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if len(p.data.Realname) == 0 {
+		return p.data.Nickname
+	}
+
+	return p.data.Realname
+}
+
+func (p *profile) UserModes() string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if len(p.data.UserModes) == 0 {
+		return DefaultUserModes
+	}
+
+	return p.data.UserModes
+}
+
 func (p *profile) SetNickname(v string) {
 	p.m.Lock()
 	p.data.Nickname = v
@@ -209,37 +580,269 @@ func (p *profile) SetNickname(v string) {
 	p.Save()
 }
 
+func (p *profile) PreferredNickname() string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if len(p.data.PreferredNickname) == 0 {
+		return p.data.Nickname
+	}
+
+	return p.data.PreferredNickname
+}
+
+func (p *profile) HasPreferredNickname() bool {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return len(p.data.PreferredNickname) > 0
+}
+
+func (p *profile) SetPreferredNickname(v string) {
+	p.m.Lock()
+	p.data.PreferredNickname = v
+	p.m.Unlock()
+	p.Save()
+}
+
 func (p *profile) NickservPassword() string {
 	p.m.RLock()
 	defer p.m.RUnlock()
-	return p.data.NickservPassword
+	return util.ExpandEnv(p.data.NickservPassword)
 }
 
 func (p *profile) SetNickservPassword(v string) {
 	p.m.Lock()
-	p.data.NickservPassword = v
+	p.data.NickservPassword = util.EscapeEnv(v)
 	p.m.Unlock()
 	p.Save()
 }
 
+func (p *profile) UseSasl() bool {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.UseSasl
+}
+
+func (p *profile) SaslUsername() string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.SaslUsername
+}
+
+func (p *profile) SaslPassword() string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return util.ExpandEnv(p.data.SaslPassword)
+}
+
 func (p *profile) OperPassword() string {
 	p.m.RLock()
 	defer p.m.RUnlock()
-	return p.data.OperPassword
+	return util.ExpandEnv(p.data.OperPassword)
 }
 
 func (p *profile) ConnectionPassword() string {
 	p.m.RLock()
 	defer p.m.RUnlock()
-	return p.data.ConnectionPassword
+	return util.ExpandEnv(p.data.ConnectionPassword)
 }
 
 func (p *profile) CommandPrefix() string {
 	p.m.RLock()
 	defer p.m.RUnlock()
+
+	if len(p.data.CommandPrefixes) > 0 {
+		return p.data.CommandPrefixes[0]
+	}
+
 	return p.data.CommandPrefix
 }
 
+func (p *profile) CommandPrefixes() []string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if len(p.data.CommandPrefixes) == 0 {
+		return []string{p.data.CommandPrefix}
+	}
+
+	out := make([]string, len(p.data.CommandPrefixes))
+	copy(out, p.data.CommandPrefixes)
+	return out
+}
+
+func (p *profile) Capabilities() []string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	out := make([]string, len(p.data.Capabilities))
+	copy(out, p.data.Capabilities)
+	return out
+}
+
+func (p *profile) CtcpVersion() string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.CtcpVersion
+}
+
+func (p *profile) QuitMessage() string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.QuitMessage
+}
+
+func (p *profile) AwayMessage() string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.AwayMessage
+}
+
+func (p *profile) SetAwayMessage(v string) {
+	p.m.Lock()
+	p.data.AwayMessage = v
+	p.m.Unlock()
+	p.Save()
+}
+
+func (p *profile) ReconnectRetries() int {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.ReconnectRetries
+}
+
+func (p *profile) ReconnectMinDelay() time.Duration {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if p.data.ReconnectMinDelay <= 0 {
+		return DefaultReconnectMinDelay
+	}
+
+	return time.Duration(p.data.ReconnectMinDelay) * time.Second
+}
+
+func (p *profile) ReconnectMaxDelay() time.Duration {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if p.data.ReconnectMaxDelay <= 0 {
+		return DefaultReconnectMaxDelay
+	}
+
+	return time.Duration(p.data.ReconnectMaxDelay) * time.Second
+}
+
+func (p *profile) FloodBurst() int {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if p.data.FloodBurst <= 0 {
+		return DefaultFloodBurst
+	}
+
+	return p.data.FloodBurst
+}
+
+func (p *profile) FloodInterval() time.Duration {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if p.data.FloodInterval <= 0 {
+		return DefaultFloodInterval
+	}
+
+	return time.Duration(p.data.FloodInterval) * time.Millisecond
+}
+
+func (p *profile) PingInterval() time.Duration {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if p.data.PingInterval <= 0 {
+		return DefaultPingInterval
+	}
+
+	return time.Duration(p.data.PingInterval) * time.Second
+}
+
+func (p *profile) PingTimeout() time.Duration {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if p.data.PingTimeout <= 0 {
+		return DefaultPingTimeout
+	}
+
+	return time.Duration(p.data.PingTimeout) * time.Second
+}
+
+func (p *profile) StatsRetention() time.Duration {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if p.data.StatsRetention <= 0 {
+		return 0
+	}
+
+	return time.Duration(p.data.StatsRetention) * time.Hour * 24
+}
+
+func (p *profile) WeatherUnits() string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if len(p.data.WeatherUnits) == 0 {
+		return DefaultWeatherUnits
+	}
+
+	return p.data.WeatherUnits
+}
+
+func (p *profile) LogRetention() time.Duration {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if p.data.LogRetention <= 0 {
+		return DefaultLogRetention
+	}
+
+	return time.Duration(p.data.LogRetention) * time.Hour * 24
+}
+
+func (p *profile) LogPurgeInterval() time.Duration {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if p.data.LogPurgeInterval <= 0 {
+		return DefaultLogPurgeInterval
+	}
+
+	return time.Duration(p.data.LogPurgeInterval) * time.Hour
+}
+
+func (p *profile) LogRefreshInterval() time.Duration {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if p.data.LogRefreshInterval <= 0 {
+		return DefaultLogRefreshInterval
+	}
+
+	return time.Duration(p.data.LogRefreshInterval) * time.Second
+}
+
+func (p *profile) LogMaxSize() int64 {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if p.data.LogMaxSize <= 0 {
+		return 0
+	}
+
+	return int64(p.data.LogMaxSize) * 1024 * 1024
+}
+
 func (p *profile) Whitelist() []string {
 	p.m.RLock()
 	defer p.m.RUnlock()
@@ -284,8 +887,128 @@ func (p *profile) WhitelistRemove(mask string) {
 func (p *profile) IsWhitelisted(mask string) bool {
 	p.m.RLock()
 	defer p.m.RUnlock()
+	return containsMask(p.data.Whitelist, mask) || containsMask(p.data.Owners, mask)
+}
 
-	for _, str := range p.data.Whitelist {
+func (p *profile) Ignores() []string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	out := make([]string, len(p.data.Ignores))
+	copy(out, p.data.Ignores)
+	return out
+}
+
+func (p *profile) IgnoreAdd(mask string) {
+	p.m.Lock()
+
+	if containsMask(p.data.Ignores, mask) {
+		p.m.Unlock()
+		return
+	}
+
+	p.data.Ignores = append(p.data.Ignores, mask)
+	p.m.Unlock()
+	p.Save()
+}
+
+func (p *profile) IgnoreRemove(mask string) {
+	p.m.Lock()
+
+	for i, str := range p.data.Ignores {
+		if !strings.EqualFold(str, mask) {
+			continue
+		}
+
+		copy(p.data.Ignores[i:], p.data.Ignores[i+1:])
+		p.data.Ignores = p.data.Ignores[:len(p.data.Ignores)-1]
+		break
+	}
+
+	p.m.Unlock()
+	p.Save()
+}
+
+func (p *profile) IsIgnored(user string) bool {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	host := user
+	if idx := strings.IndexByte(user, '!'); idx > -1 {
+		host = user[idx+1:]
+	}
+
+	for _, mask := range p.data.Ignores {
+		if strings.IndexByte(mask, '!') > -1 {
+			if matchMask(mask, user) {
+				return true
+			}
+		} else if matchMask(mask, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchMask returns true if v matches the given mask. The mask may contain
+// the wildcards '*', which matches any number of characters, and '?',
+// which matches a single character. This is case-insensitive.
+func matchMask(mask, v string) bool {
+	mask, v = strings.ToLower(mask), strings.ToLower(v)
+
+	// Position of the last '*' and the input it has consumed up to now.
+	// If the rest of the mask does not match, the '*' consumes more.
+	star, next := -1, 0
+	i, j := 0, 0
+
+	for j < len(v) {
+		switch {
+		case i < len(mask) && (mask[i] == '?' || mask[i] == v[j]):
+			i++
+			j++
+		case i < len(mask) && mask[i] == '*':
+			star, next = i, j
+			i++
+		case star > -1:
+			next++
+			i, j = star+1, next
+		default:
+			return false
+		}
+	}
+
+	for i < len(mask) && mask[i] == '*' {
+		i++
+	}
+
+	return i == len(mask)
+}
+
+func (p *profile) Owners() []string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	out := make([]string, len(p.data.Owners))
+	copy(out, p.data.Owners)
+	return out
+}
+
+func (p *profile) IsOwner(mask string) bool {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if len(p.data.Owners) == 0 {
+		return containsMask(p.data.Whitelist, mask)
+	}
+
+	return containsMask(p.data.Owners, mask)
+}
+
+// containsMask returns true if the list contains the given hostmask.
+// This performs a case-insensitive comparison.
+func containsMask(list []string, mask string) bool {
+	for _, str := range list {
 		if strings.EqualFold(str, mask) {
 			return true
 		}
@@ -313,16 +1036,120 @@ func (p *profile) SetLogging(v bool) {
 	p.Save()
 }
 
+func (p *profile) JSONLogging() bool {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.JSONLogging
+}
+
+func (p *profile) ChannelLogging() bool {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.ChannelLogging
+}
+
+func (p *profile) SetChannelLogging(v bool) {
+	p.m.Lock()
+	p.data.ChannelLogging = v
+	p.m.Unlock()
+	p.Save()
+}
+
+func (p *profile) NoticeCommands() bool {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.NoticeCommands
+}
+
+func (p *profile) AuditAllCommands() bool {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.AuditAllCommands
+}
+
+func (p *profile) MetricsAddr() string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.data.MetricsAddr
+}
+
+func (p *profile) DisabledPlugins() []string {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	out := make([]string, len(p.data.DisabledPlugins))
+	copy(out, p.data.DisabledPlugins)
+	return out
+}
+
+func (p *profile) SetPluginEnabled(name string, enabled bool) {
+	p.m.Lock()
+
+	list := p.data.DisabledPlugins[:0]
+	for _, str := range p.data.DisabledPlugins {
+		if !strings.EqualFold(str, name) {
+			list = append(list, str)
+		}
+	}
+
+	if !enabled {
+		list = append(list, name)
+	}
+
+	p.data.DisabledPlugins = list
+	p.m.Unlock()
+	p.Save()
+}
+
+func (p *profile) PluginConfig(name string, v interface{}) error {
+	p.m.RLock()
+	data, ok := p.data.PluginConfig[name]
+	p.m.RUnlock()
+
+	if !ok {
+		return util.ReadFile(filepath.Join(p.Root(), name+".cfg"), v, false)
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func (p *profile) SetPluginConfig(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	p.m.Lock()
+	if p.data.PluginConfig == nil {
+		p.data.PluginConfig = make(map[string]json.RawMessage)
+	}
+	p.data.PluginConfig[name] = data
+	p.m.Unlock()
+	return p.Save()
+}
+
 func (p *profile) Save() error {
 	p.m.RLock()
-	err := util.WriteFile("profile.cfg", p.data, false)
+	err := util.WriteFile(filepath.Join(p.root, "profile.cfg"), p.data, false)
 	p.m.RUnlock()
 	return err
 }
 
+// Load reads the profile from disk. This can be called at any time to
+// reload a modified profile. The new data replaces the old in one go, so
+// concurrent readers never see a partially loaded profile.
 func (p *profile) Load() error {
+	// Start from the defaults, so settings which were removed from the
+	// file no longer keep their old values.
+	data := defaultProfileData()
+
+	err := util.ReadFile(filepath.Join(p.root, "profile.cfg"), &data, false)
+	if err != nil {
+		return err
+	}
+
 	p.m.Lock()
-	err := util.ReadFile("profile.cfg", &p.data, false)
+	p.data = data
 	p.m.Unlock()
-	return err
+	return nil
 }
@@ -0,0 +1,303 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package irc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileEnv(t *testing.T) {
+	os.Setenv("AUTIMAAT_TEST_NICKSERV", "hunter2")
+	os.Setenv("AUTIMAAT_TEST_SERVER", "s3cret")
+	defer os.Unsetenv("AUTIMAAT_TEST_NICKSERV")
+	defer os.Unsetenv("AUTIMAAT_TEST_SERVER")
+
+	root := t.TempDir()
+	file := filepath.Join(root, "profile.cfg")
+
+	err := ioutil.WriteFile(file, []byte(`{
+		"Nickname": "$AUTIMAAT_TEST_NICKSERV",
+		"NickservPassword": "${AUTIMAAT_TEST_NICKSERV}",
+		"ConnectionPassword": "pre-$AUTIMAAT_TEST_SERVER",
+		"OperPassword": "$$literal",
+		"SaslPassword": "plain",
+		"Whitelist": ["$AUTIMAAT_TEST_NICKSERV!*@*"],
+		"Channels": [{"Name": "#$AUTIMAAT_TEST_SERVER"}]
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prof := NewProfile(root)
+	if err := prof.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	testProfileValue(t, "NickservPassword", prof.NickservPassword(), "hunter2")
+	testProfileValue(t, "ConnectionPassword", prof.ConnectionPassword(), "pre-s3cret")
+	testProfileValue(t, "OperPassword", prof.OperPassword(), "$literal")
+	testProfileValue(t, "SaslPassword", prof.SaslPassword(), "plain")
+
+	// Other values are never expanded.
+	testProfileValue(t, "Nickname", prof.Nickname(), "$AUTIMAAT_TEST_NICKSERV")
+	testProfileValue(t, "Whitelist", prof.Whitelist()[0], "$AUTIMAAT_TEST_NICKSERV!*@*")
+	testProfileValue(t, "Channels", prof.Channels()[0].Name, "#$AUTIMAAT_TEST_SERVER")
+
+	// Saving the profile must not write the secrets to disk.
+	if err := prof.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "hunter2") {
+		t.Fatalf("secret written to disk:\n%s", data)
+	}
+
+	prof = NewProfile(root)
+	if err := prof.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	testProfileValue(t, "NickservPassword", prof.NickservPassword(), "hunter2")
+
+	// A password set at runtime is taken literally.
+	prof.SetNickservPassword("a$b")
+	testProfileValue(t, "NickservPassword", prof.NickservPassword(), "a$b")
+}
+
+func TestProfileLogSettings(t *testing.T) {
+	root := t.TempDir()
+
+	prof := NewProfile(root)
+	if prof.LogRetention() != DefaultLogRetention ||
+		prof.LogPurgeInterval() != DefaultLogPurgeInterval ||
+		prof.LogRefreshInterval() != DefaultLogRefreshInterval {
+		t.Fatalf("default log settings mismatch: %s, %s, %s",
+			prof.LogRetention(), prof.LogPurgeInterval(), prof.LogRefreshInterval())
+	}
+
+	err := ioutil.WriteFile(filepath.Join(root, "profile.cfg"), []byte(`{
+		"LogRetention": 3,
+		"LogPurgeInterval": 0,
+		"LogRefreshInterval": 30
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := prof.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if prof.LogRetention() != time.Hour*24*3 ||
+		prof.LogPurgeInterval() != DefaultLogPurgeInterval ||
+		prof.LogRefreshInterval() != time.Second*30 {
+		t.Fatalf("log settings mismatch: %s, %s, %s",
+			prof.LogRetention(), prof.LogPurgeInterval(), prof.LogRefreshInterval())
+	}
+}
+
+func testProfileValue(t *testing.T, name, have, want string) {
+	if have != want {
+		t.Fatalf("%s mismatch;\nwant: %q\nhave: %q", name, want, have)
+	}
+}
+
+func TestIgnores(t *testing.T) {
+	prof := NewProfile(t.TempDir())
+
+	prof.IgnoreAdd("*!*@spam.example.com")
+	prof.IgnoreAdd("~troll@*")
+	prof.IgnoreAdd("Ba?!*@*")
+	prof.IgnoreAdd("~TROLL@*")
+
+	if have := prof.Ignores(); len(have) != 3 {
+		t.Fatalf("ignore list mismatch; have: %q", have)
+	}
+
+	for _, tt := range []struct {
+		user string
+		want bool
+	}{
+		{"bob!~bob@spam.example.com", true},
+		{"bob!~bob@example.com", false},
+		{"steve!~troll@host.example.com", true},
+		{"steve!~trol@host.example.com", false},
+		{"bar!~bar@example.com", true},
+		{"baz!x@y", true},
+		{"bazz!x@y", false},
+		{"~troll@elders.example.com", true},
+	} {
+		if have := prof.IsIgnored(tt.user); have != tt.want {
+			t.Fatalf("IsIgnored mismatch for %q;\nwant: %v\nhave: %v",
+				tt.user, tt.want, have)
+		}
+	}
+
+	prof.IgnoreRemove("~Troll@*")
+
+	if prof.IsIgnored("steve!~troll@host.example.com") {
+		t.Fatalf("removed mask is still ignored")
+	}
+}
+
+func TestMatchMask(t *testing.T) {
+	for _, tt := range []struct {
+		mask string
+		v    string
+		want bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"", "", true},
+		{"", "a", false},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "aXbYcZ", false},
+		{"a*c", "abcbc", true},
+		{"*@*.example.com", "x@a.b.EXAMPLE.com", true},
+		{"?", "", false},
+		{"[nick]!*", "[nick]!x@y", true},
+	} {
+		if have := matchMask(tt.mask, tt.v); have != tt.want {
+			t.Fatalf("matchMask(%q, %q) mismatch;\nwant: %v\nhave: %v",
+				tt.mask, tt.v, tt.want, have)
+		}
+	}
+}
+
+func TestPluginConfig(t *testing.T) {
+	type config struct {
+		ApiKey  string
+		Timeout int
+		Allow   []string
+	}
+
+	root := t.TempDir()
+
+	// Settings are read from the plugin's own file, as long as the
+	// profile has none.
+	err := ioutil.WriteFile(filepath.Join(root, "weer.cfg"),
+		[]byte(`{"ApiKey": "oud", "Timeout": 5}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prof := NewProfile(root)
+
+	var have config
+	if err := prof.PluginConfig("weer", &have); err != nil {
+		t.Fatal(err)
+	}
+
+	if have.ApiKey != "oud" || have.Timeout != 5 {
+		t.Fatalf("config mismatch; have: %+v", have)
+	}
+
+	if err := prof.PluginConfig("url", &have); !os.IsNotExist(err) {
+		t.Fatalf("error mismatch;\nwant: file not found\nhave: %v", err)
+	}
+
+	// Settings in the profile take precedence and survive a reload.
+	want := config{ApiKey: "nieuw", Timeout: 10, Allow: []string{"example.com"}}
+	if err := prof.SetPluginConfig("weer", &want); err != nil {
+		t.Fatal(err)
+	}
+
+	prof = NewProfile(root)
+	if err := prof.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	have = config{}
+	if err := prof.PluginConfig("weer", &have); err != nil {
+		t.Fatal(err)
+	}
+
+	if have.ApiKey != want.ApiKey || have.Timeout != want.Timeout ||
+		strings.Join(have.Allow, ",") != "example.com" {
+		t.Fatalf("config mismatch;\nwant: %+v\nhave: %+v", want, have)
+	}
+}
+
+func TestProfileReload(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "profile.cfg")
+
+	write := func(data string) {
+		if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{
+		"DisabledPlugins": ["weather", "stats"],
+		"Ignores": ["*!*@spam.example.com", "troll!*@*"]
+	}`)
+
+	prof := NewProfile(root)
+	if err := prof.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Entries removed from the file must be gone after a reload.
+	write(`{
+		"DisabledPlugins": ["stats"]
+	}`)
+
+	if err := prof.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if have := prof.DisabledPlugins(); len(have) != 1 || have[0] != "stats" {
+		t.Fatalf("disabled plugins mismatch;\nwant: [stats]\nhave: %q", have)
+	}
+
+	if have := prof.Ignores(); len(have) != 0 {
+		t.Fatalf("ignores mismatch;\nwant: []\nhave: %q", have)
+	}
+}
+
+func TestProfileOwners(t *testing.T) {
+	root := t.TempDir()
+	prof := NewProfile(root)
+
+	// Without owners, all whitelisted users are owners.
+	if !prof.IsOwner("~user@server.com") {
+		t.Fatalf("whitelisted user is not an owner without explicit owners")
+	}
+
+	if prof.IsOwner("~other@server.com") {
+		t.Fatalf("user who is not whitelisted is an owner")
+	}
+
+	// Once there are owners, whitelisted users no longer are.
+	err := ioutil.WriteFile(filepath.Join(root, "profile.cfg"), []byte(`{
+		"Whitelist": ["~user@server.com"],
+		"Owners": ["~boss@server.com"]
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := prof.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if prof.IsOwner("~user@server.com") {
+		t.Fatalf("whitelisted user is an owner, despite explicit owners")
+	}
+
+	if !prof.IsOwner("~boss@server.com") || !prof.IsWhitelisted("~boss@server.com") {
+		t.Fatalf("owner mismatch for ~boss@server.com")
+	}
+}
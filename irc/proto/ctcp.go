@@ -0,0 +1,58 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package proto
+
+import (
+	"io"
+	"strings"
+)
+
+// ref: https://modern.ircdocs.horse/ctcp.html
+
+// Ctcp sends a CTCP query to the given target. The query is sent as
+// a PRIVMSG, wrapped in CTCP markers. E.g.:
+//
+//	PRIVMSG steve :\x01VERSION\x01
+func Ctcp(w io.Writer, target, command string, args ...string) error {
+	return PrivMsg(w, target, "%s", ctcpMessage(command, args))
+}
+
+// CtcpReply sends a reply to a CTCP query to the given target. The reply
+// is sent as a NOTICE, wrapped in CTCP markers. E.g.:
+//
+//	NOTICE steve :\x01VERSION autimaat 1.19\x01
+func CtcpReply(w io.Writer, target, command string, args ...string) error {
+	return Notice(w, target, "%s", ctcpMessage(command, args))
+}
+
+// ParseCtcp parses the given message contents as a CTCP message. It returns
+// the CTCP command and its arguments, if any. Returns false if the message
+// is not a CTCP message. The command is always returned in upper case.
+func ParseCtcp(msg string) (string, string, bool) {
+	if len(msg) < 2 || msg[0] != '\x01' {
+		return "", "", false
+	}
+
+	// The closing marker is optional, according to the spec.
+	msg = strings.TrimSuffix(msg[1:], "\x01")
+
+	command, args := msg, ""
+	if idx := strings.IndexByte(msg, ' '); idx > -1 {
+		command, args = msg[:idx], msg[idx+1:]
+	}
+
+	if len(command) == 0 {
+		return "", "", false
+	}
+
+	return strings.ToUpper(command), args, true
+}
+
+// ctcpMessage returns the given command and arguments as a CTCP message.
+func ctcpMessage(command string, args []string) string {
+	if len(args) == 0 {
+		return "\x01" + command + "\x01"
+	}
+	return "\x01" + command + " " + strings.Join(args, " ") + "\x01"
+}
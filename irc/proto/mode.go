@@ -0,0 +1,134 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package proto
+
+import (
+	"io"
+	"strings"
+
+	"github.com/monkeybird/autimaat/irc"
+)
+
+// ParamModes lists the channel modes which take an argument. Mode 'l'
+// only takes one when it is being set. The list modes (b, e, I), the
+// key (k) and the user prefix modes (q, a, o, h, v) always take one.
+var ParamModes = "beIkqaohvl"
+
+// Mode changes the mode for the given user or channel, with the given
+// arguments. Multiple mode changes can be combined. E.g.:
+//
+//	Mode(w, "#test", "+ov", "bob", "steve")
+//
+// If there are more mode changes with arguments than the server allows
+// in a single message, they are split over multiple messages. The limit
+// is taken from the MODES token the server advertised in RPL_ISUPPORT.
+func Mode(w io.Writer, target, mode string, argv ...string) error {
+	return ModeLimit(w, irc.Support.Modes(), target, mode, argv...)
+}
+
+// ModeLimit is the same as Mode, but uses the given limit of mode changes
+// with arguments for each message.
+func ModeLimit(w io.Writer, max int, target, mode string, argv ...string) error {
+	changes, ok := parseModes(mode, argv)
+
+	// If we can not tell which argument belongs to which mode, send
+	// everything as-is and let the server sort it out.
+	if !ok || max < 1 {
+		return Raw(w, "MODE %s", strings.Join(append([]string{target, mode}, argv...), " "))
+	}
+
+	var line []modeChange
+	var count int
+
+	for _, c := range changes {
+		if c.hasArg && count == max {
+			if err := sendModes(w, target, line); err != nil {
+				return err
+			}
+
+			line, count = nil, 0
+		}
+
+		if c.hasArg {
+			count++
+		}
+
+		line = append(line, c)
+	}
+
+	return sendModes(w, target, line)
+}
+
+// modeChange defines a single mode change, like "+o bob".
+type modeChange struct {
+	sign   byte
+	mode   byte
+	arg    string
+	hasArg bool
+}
+
+// parseModes splits the given mode string into individual changes and
+// assigns each argument to the mode which takes it. Returns false if the
+// number of arguments does not match the modes.
+func parseModes(mode string, argv []string) ([]modeChange, bool) {
+	var out []modeChange
+	sign := byte('+')
+
+	for i := 0; i < len(mode); i++ {
+		switch c := mode[i]; c {
+		case '+', '-':
+			sign = c
+
+		default:
+			mc := modeChange{sign: sign, mode: c}
+
+			if takesArg(sign, c) {
+				if len(argv) == 0 {
+					return nil, false
+				}
+
+				mc.arg, mc.hasArg = argv[0], true
+				argv = argv[1:]
+			}
+
+			out = append(out, mc)
+		}
+	}
+
+	return out, len(argv) == 0 && len(out) > 0
+}
+
+// takesArg returns true if the given mode change requires an argument.
+func takesArg(sign, mode byte) bool {
+	if mode == 'l' {
+		return sign == '+'
+	}
+	return strings.IndexByte(ParamModes, mode) > -1
+}
+
+// sendModes sends a single MODE message for the given changes.
+func sendModes(w io.Writer, target string, changes []modeChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var modes strings.Builder
+	var args []string
+	var sign byte
+
+	for _, c := range changes {
+		if c.sign != sign {
+			modes.WriteByte(c.sign)
+			sign = c.sign
+		}
+
+		modes.WriteByte(c.mode)
+
+		if c.hasArg {
+			args = append(args, c.arg)
+		}
+	}
+
+	return Raw(w, "MODE %s", strings.Join(append([]string{target, modes.String()}, args...), " "))
+}
@@ -0,0 +1,51 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package proto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMode(t *testing.T) {
+	var w bytes.Buffer
+
+	Mode(&w, "#test", "+o", "bob")
+	testOutput(t, &w, "MODE #test +o bob\r\n")
+
+	Mode(&w, "#test", "+nt")
+	testOutput(t, &w, "MODE #test +nt\r\n")
+
+	Mode(&w, "autimaat", "+i")
+	testOutput(t, &w, "MODE autimaat +i\r\n")
+
+	Mode(&w, "#test", "+oo", "bob", "steve")
+	testOutput(t, &w, "MODE #test +oo bob steve\r\n")
+
+	Mode(&w, "#test", "+bev", "*!*@a.com", "*!*@b.com", "bob")
+	testOutput(t, &w, "MODE #test +bev *!*@a.com *!*@b.com bob\r\n")
+
+	Mode(&w, "#test", "+lk-l", "10", "geheim")
+	testOutput(t, &w, "MODE #test +lk-l 10 geheim\r\n")
+}
+
+func TestModeLimit(t *testing.T) {
+	var w bytes.Buffer
+
+	ModeLimit(&w, 3, "#test", "+oooo", "a", "b", "c", "d")
+	testOutput(t, &w, "MODE #test +ooo a b c\r\nMODE #test +o d\r\n")
+
+	ModeLimit(&w, 2, "#test", "+nto-v+b", "a", "b", "c")
+	testOutput(t, &w, "MODE #test +nto-v a b\r\nMODE #test +b c\r\n")
+
+	ModeLimit(&w, 1, "#test", "-oo+v", "a", "b", "c")
+	testOutput(t, &w, "MODE #test -o a\r\nMODE #test -o b\r\nMODE #test +v c\r\n")
+
+	// Arguments which do not match the modes are sent as-is.
+	ModeLimit(&w, 1, "#test", "+x", "a", "b")
+	testOutput(t, &w, "MODE #test +x a b\r\n")
+
+	ModeLimit(&w, 1, "#test", "+oo", "a")
+	testOutput(t, &w, "MODE #test +oo a\r\n")
+}
@@ -14,11 +14,16 @@ import (
 
 // ref: https://en.wikipedia.org/wiki/List_of_Internet_Relay_Chat_commands#User_commands
 
+// MaxLineLength defines the maximum length of a single protocol message,
+// including the trailing `\r\n`.
+const MaxLineLength = irc.MaxLineLength
+
 // Raw sends the given, raw message data.
 //
 // The message being sent is reformatted to match the IRC specification.
 // Meaning that it can not exceed 512 bytes and must end with `\r\n`.
-// Any data beyond 512 bytes is simply discarded.
+// Any data beyond 512 bytes is simply discarded. Use PrivMsg or Notice
+// for long messages. These split them up into multiple lines instead.
 func Raw(w io.Writer, msg string, argv ...interface{}) error {
 	data := []byte(fmt.Sprintf(msg, argv...) + "\r\n")
 	sz := len(data)
@@ -53,15 +58,69 @@ func Admin(w io.Writer, server ...string) error {
 	return Raw(w, "ADMIN")
 }
 
+// Authenticate sends SASL authentication data. This is either the name of
+// the mechanism to use, or the base64 encoded authentication payload.
+// Payloads longer than 400 bytes are sent in multiple chunks. An empty
+// payload is sent as "+".
+//
+// ref: https://ircv3.net/specs/extensions/sasl-3.1
+func Authenticate(w io.Writer, data string) error {
+	const chunkSize = 400
+
+	for len(data) >= chunkSize {
+		err := Raw(w, "AUTHENTICATE %s", data[:chunkSize])
+		if err != nil {
+			return err
+		}
+
+		data = data[chunkSize:]
+	}
+
+	// The last chunk must be shorter than the chunk size. If the data
+	// was an exact multiple of it, this is an empty chunk.
+	if len(data) == 0 {
+		data = "+"
+	}
+
+	return Raw(w, "AUTHENTICATE %s", data)
+}
+
 // Away marks us as being away, provided there is an away message.
 // If the away message is empty, the away status is removed.
 func Away(w io.Writer, message ...string) error {
-	if len(message) > 0 {
-		return Raw(w, "AWAY %s", message[0])
+	if len(message) > 0 && len(message[0]) > 0 {
+		return Raw(w, "AWAY :%s", message[0])
 	}
 	return Raw(w, "AWAY")
 }
 
+// Cap sends a capability negotiation command. The subcommand is one of
+// LS, LIST, REQ, ACK, NAK or END. The last argument is sent as a trailing
+// parameter if it contains spaces. E.g.:
+//
+//	CAP LS 302
+//	CAP REQ :multi-prefix sasl
+//
+// ref: https://ircv3.net/specs/extensions/capability-negotiation
+func Cap(w io.Writer, subcommand string, args ...string) error {
+	if len(args) == 0 {
+		return Raw(w, "CAP %s", subcommand)
+	}
+
+	head := strings.Join(args[:len(args)-1], " ")
+	last := args[len(args)-1]
+
+	if len(last) == 0 || last[0] == ':' || strings.IndexByte(last, ' ') > -1 {
+		last = ":" + last
+	}
+
+	if len(head) > 0 {
+		return Raw(w, "CAP %s %s %s", subcommand, head, last)
+	}
+
+	return Raw(w, "CAP %s %s", subcommand, last)
+}
+
 // CNotice sends a channel NOTICE message to <nickname> on <channel> that
 // bypasses flood protection limits. The target nickname must be in the same
 // channel as the client issuing the command, and the client must be a
@@ -141,11 +200,15 @@ func IsOn(w io.Writer, nicknames ...string) error {
 	return Raw(w, "ISON %s", strings.Join(nicknames, " "))
 }
 
-// Join joins the given channels.
+// Join joins the given channels, using their keys where set. For channels
+// with the ChanServ flag, chanserv is asked for an invite first. If such a
+// channel has a password, we identify with chanserv after joining.
 func Join(w io.Writer, channels ...irc.Channel) (err error) {
 	for _, ch := range channels {
-		if err = Raw(w, "chanserv INVITE %s", ch.Name); err != nil {
-			return
+		if ch.ChanServ {
+			if err = Raw(w, "chanserv INVITE %s", ch.Name); err != nil {
+				return
+			}
 		}
 
 		if len(ch.Key) > 0 {
@@ -158,7 +221,7 @@ func Join(w io.Writer, channels ...irc.Channel) (err error) {
 			return
 		}
 
-		if len(ch.Password) > 0 {
+		if ch.ChanServ && len(ch.Password) > 0 {
 			err = PrivMsg(w, "chanserv", "IDENTIFY %s %s", ch.Name, ch.Password)
 			if err != nil {
 				return
@@ -179,6 +242,38 @@ func Kick(w io.Writer, channel, client string, reason ...string) error {
 	return Raw(w, "KICK %s %s", channel, client)
 }
 
+// KickAll forcibly removes all <clients> from <channel>, with an optional
+// reason. Clients are combined in a single, comma-separated KICK message,
+// as far as the TARGMAX token in RPL_ISUPPORT allows. If the server does
+// not advertise a limit for KICK, each client is kicked separately.
+func KickAll(w io.Writer, channel string, clients []string, reason ...string) error {
+	return KickLimit(w, irc.Support.MaxTargets("KICK", 1), channel, clients, reason...)
+}
+
+// KickLimit is the same as KickAll, but combines at most max clients in
+// each message. A limit of 0 or less combines all of them.
+func KickLimit(w io.Writer, max int, channel string, clients []string, reason ...string) error {
+	if max < 1 {
+		max = len(clients)
+	}
+
+	for len(clients) > 0 {
+		n := max
+		if n > len(clients) {
+			n = len(clients)
+		}
+
+		err := Kick(w, channel, strings.Join(clients[:n], ","), reason...)
+		if err != nil {
+			return err
+		}
+
+		clients = clients[n:]
+	}
+
+	return nil
+}
+
 // Knock sends a NOTICE to an invitation-only <channel> with an optional
 // <message>, requesting an invite.
 //
@@ -201,15 +296,6 @@ func List(w io.Writer, channels ...string) error {
 	return Raw(w, "LIST")
 }
 
-// Mode changes the mode for the given user or channel.
-// Optionally with the given argument.
-func Mode(w io.Writer, target, mode string, argv ...string) error {
-	if len(argv) > 0 {
-		return Raw(w, "MODE %s %s %s", target, mode, argv[0])
-	}
-	return Raw(w, "MODE %s %s", target, mode)
-}
-
 // Names queries users in the given list of <channels>, If <channels> is
 // omitted, all users are shown, grouped by channel name with all users who are
 // not on a channel being shown as part of channel "*". If <server> is specified,
@@ -252,8 +338,11 @@ func Nick(w io.Writer, nickname string, password ...string) error {
 
 // Notice works similarly to PRIVMSG, except automatic replies must never be
 // sent in reply to NOTICE messages.
+//
+// Messages which do not fit in a single protocol message are split up
+// and sent as multiple NOTICEs.
 func Notice(w io.Writer, target, f string, argv ...interface{}) error {
-	return Raw(w, "NOTICE %s :%s", target, fmt.Sprintf(f, argv...))
+	return irc.SendLines(w, "NOTICE", target, fmt.Sprintf(f, argv...))
 }
 
 // Oper authenticates a user as an IRC operator on a server/network.
@@ -262,9 +351,20 @@ func Oper(w io.Writer, nickname, password string) error {
 }
 
 // Part leaves the given channels.
-func Part(w io.Writer, channels ...irc.Channel) (err error) {
+func Part(w io.Writer, channels ...irc.Channel) error {
+	return PartReason(w, "", channels...)
+}
+
+// PartReason leaves the given channels, with the given reason as the part
+// message. The reason is omitted if it is empty.
+func PartReason(w io.Writer, reason string, channels ...irc.Channel) (err error) {
 	for _, ch := range channels {
-		err = Raw(w, "PART %s :", ch.Name)
+		if len(reason) > 0 {
+			err = Raw(w, "PART %s :%s", ch.Name, reason)
+		} else {
+			err = Raw(w, "PART %s", ch.Name)
+		}
+
 		if err != nil {
 			return
 		}
@@ -283,6 +383,12 @@ func Pass(w io.Writer, password string) error {
 	return Raw(w, "PASS %s", password)
 }
 
+// Ping sends a PING message with the given token. The server is expected
+// to answer with a PONG carrying the same token.
+func Ping(w io.Writer, token string) error {
+	return Raw(w, "PING :%s", token)
+}
+
 // Pong sends the given payload as a response to a PING message.
 func Pong(w io.Writer, payload string) error {
 	return Raw(w, "PONG %s", payload)
@@ -290,14 +396,18 @@ func Pong(w io.Writer, payload string) error {
 
 // PrivMsg sends the specified formatted message to the given target.
 // The target may be a channel or nickname.
+//
+// Messages which do not fit in a single protocol message are split up
+// and sent as multiple PRIVMSGs. Each line in a multi-line message is
+// sent separately.
 func PrivMsg(w io.Writer, target, f string, argv ...interface{}) error {
-	return Raw(w, "PRIVMSG %s :%s", target, fmt.Sprintf(f, argv...))
+	return irc.SendLines(w, "PRIVMSG", target, fmt.Sprintf(f, argv...))
 }
 
-// Quit disconnects from the server., optionally with the given message.
+// Quit disconnects from the server, optionally with the given message.
 func Quit(w io.Writer, message ...string) error {
 	if len(message) > 0 {
-		return Raw(w, "QUIT %s", message[0])
+		return Raw(w, "QUIT :%s", message[0])
 	}
 	return Raw(w, "QUIT")
 }
@@ -371,9 +481,11 @@ func Time(w io.Writer, server ...string) error {
 
 // Topic allows the client to query or set the channel topic on <channel>.
 // If channel mode +t is set, only a channel operator may set the topic.
+// Without a topic, the server replies with RPL_TOPIC (332), or with
+// RPL_NOTOPIC (331) if none is set. An empty topic clears it.
 func Topic(w io.Writer, channel string, topic ...string) error {
 	if len(topic) > 0 {
-		return Raw(w, "TOPIC %s %s", channel, topic[0])
+		return Raw(w, "TOPIC %s :%s", channel, topic[0])
 	}
 	return Raw(w, "TOPIC %s", channel)
 }
@@ -427,7 +539,7 @@ func Version(w io.Writer, server ...string) error {
 // Wallops sends a formatted message to all operators connected to the server
 // or all users with user mode 'w' set.
 func Wallops(w io.Writer, f string, argv ...interface{}) error {
-	return Raw(w, "WALLOPS %%s", fmt.Sprintf(f, argv...))
+	return Raw(w, "WALLOPS :%s", fmt.Sprintf(f, argv...))
 }
 
 // Watch adds or removes a user to a client's server-side friends list.
@@ -0,0 +1,251 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package proto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/monkeybird/autimaat/irc"
+)
+
+func TestWallops(t *testing.T) {
+	var w bytes.Buffer
+	Wallops(&w, "hello %s", "world")
+	testOutput(t, &w, "WALLOPS :hello world\r\n")
+}
+
+func testOutput(t *testing.T, w *bytes.Buffer, want string) {
+	have := w.String()
+	w.Reset()
+
+	if want != have {
+		t.Fatalf("output mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func TestPart(t *testing.T) {
+	var w bytes.Buffer
+
+	channels := []irc.Channel{
+		{Name: "#foo"},
+		{Name: "#bar"},
+	}
+
+	Part(&w, channels...)
+	testOutput(t, &w, "PART #foo\r\nPART #bar\r\n")
+
+	PartReason(&w, "", channels...)
+	testOutput(t, &w, "PART #foo\r\nPART #bar\r\n")
+
+	PartReason(&w, "see you later", channels...)
+	testOutput(t, &w, "PART #foo :see you later\r\nPART #bar :see you later\r\n")
+}
+
+func TestJoin(t *testing.T) {
+	var w bytes.Buffer
+
+	Join(&w, irc.Channel{Name: "#foo"}, irc.Channel{Name: "#bar", Key: "sleutel"})
+	testOutput(t, &w, "JOIN #foo\r\nJOIN #bar sleutel\r\n")
+
+	// Passwords are only used in the chanserv flow.
+	Join(&w, irc.Channel{Name: "#foo", Password: "geheim"})
+	testOutput(t, &w, "JOIN #foo\r\n")
+
+	Join(&w, irc.Channel{Name: "#foo", ChanServ: true})
+	testOutput(t, &w, "chanserv INVITE #foo\r\nJOIN #foo\r\n")
+
+	Join(&w, irc.Channel{Name: "#foo", Key: "sleutel", Password: "geheim", ChanServ: true})
+	testOutput(t, &w, "chanserv INVITE #foo\r\nJOIN #foo sleutel\r\n"+
+		"PRIVMSG chanserv :IDENTIFY #foo geheim\r\n")
+}
+
+func TestAway(t *testing.T) {
+	var w bytes.Buffer
+
+	Away(&w, "even koffie halen")
+	testOutput(t, &w, "AWAY :even koffie halen\r\n")
+
+	Away(&w)
+	testOutput(t, &w, "AWAY\r\n")
+
+	Away(&w, "")
+	testOutput(t, &w, "AWAY\r\n")
+}
+
+func TestQuit(t *testing.T) {
+	var w bytes.Buffer
+
+	Quit(&w)
+	testOutput(t, &w, "QUIT\r\n")
+
+	Quit(&w, "see you later")
+	testOutput(t, &w, "QUIT :see you later\r\n")
+}
+
+func TestPrivMsgSplit(t *testing.T) {
+	var w bytes.Buffer
+
+	words := strings.Repeat("hallo wereld, dit is een lang bericht. ", 40)
+	runes := strings.Repeat("ë€😀", 200)
+
+	for _, msg := range []string{words, runes, words + runes} {
+		PrivMsg(&w, "#test", "%s", msg)
+		testSplit(t, &w, "PRIVMSG #test :", "", msg)
+
+		Notice(&w, "steve", "%s", msg)
+		testSplit(t, &w, "NOTICE steve :", "", msg)
+
+		PrivMsg(&w, "#test", "\x01ACTION %s\x01", msg)
+		testSplit(t, &w, "PRIVMSG #test :\x01ACTION ", "\x01", msg)
+	}
+}
+
+func TestReply(t *testing.T) {
+	var w bytes.Buffer
+
+	// Replies are split like any other message.
+	msg := strings.Repeat("hallo wereld, dit is een lang bericht. ", 40)
+	r := irc.Request{SenderName: "steve", Type: "PRIVMSG", Target: "#test"}
+
+	r.Reply(&w, "%s", msg)
+	testSplit(t, &w, "PRIVMSG #test :", "", msg)
+
+	r.ReplyPrivate(&w, "%s", msg)
+	testSplit(t, &w, "PRIVMSG steve :", "", msg)
+}
+
+func TestPrivMsgLines(t *testing.T) {
+	var w bytes.Buffer
+	PrivMsg(&w, "#test", "foo\r\n\nbar\nPRIVMSG #other :baz")
+	testOutput(t, &w, "PRIVMSG #test :foo\r\nPRIVMSG #test :bar\r\nPRIVMSG #test :PRIVMSG #other :baz\r\n")
+}
+
+func TestPrivMsgInjection(t *testing.T) {
+	var w bytes.Buffer
+
+	// A bare carriage return must not end the protocol message early.
+	PrivMsg(&w, "#test", "%s", "hi\rQUIT :pwn")
+	testOutput(t, &w, "PRIVMSG #test :hi\r\nPRIVMSG #test :QUIT :pwn\r\n")
+
+	Notice(&w, "steve", "%s", "hi\x00\r\x00QUIT")
+	testOutput(t, &w, "NOTICE steve :hi\r\nNOTICE steve :QUIT\r\n")
+}
+
+// testSplit ensures each line in w has the given prefix and suffix, fits
+// within MaxLineLength and that the lines combined yield the original text.
+func testSplit(t *testing.T, w *bytes.Buffer, prefix, suffix, want string) {
+	lines := strings.SplitAfter(w.String(), "\r\n")
+	lines = lines[:len(lines)-1]
+	w.Reset()
+
+	if len(lines) < 2 {
+		t.Fatalf("expected message to be split; have %d line(s)", len(lines))
+	}
+
+	var have string
+	for _, line := range lines {
+		if len(line) > MaxLineLength {
+			t.Fatalf("line exceeds %d bytes: %d", MaxLineLength, len(line))
+		}
+
+		if !utf8.ValidString(line) {
+			t.Fatalf("line contains invalid UTF-8: %q", line)
+		}
+
+		line = strings.TrimSuffix(line, "\r\n")
+		if !strings.HasPrefix(line, prefix) || !strings.HasSuffix(line, suffix) {
+			t.Fatalf("malformed line: %q", line)
+		}
+
+		have += line[len(prefix) : len(line)-len(suffix)]
+	}
+
+	if want != have {
+		t.Fatalf("reassembled message mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func TestCtcp(t *testing.T) {
+	var w bytes.Buffer
+
+	Ctcp(&w, "steve", "VERSION")
+	testOutput(t, &w, "PRIVMSG steve :\x01VERSION\x01\r\n")
+
+	CtcpReply(&w, "steve", "PING", "12345")
+	testOutput(t, &w, "NOTICE steve :\x01PING 12345\x01\r\n")
+
+	testParseCtcp(t, "hello", "", "", false)
+	testParseCtcp(t, "\x01", "", "", false)
+	testParseCtcp(t, "\x01version\x01", "VERSION", "", true)
+	testParseCtcp(t, "\x01PING 12345\x01", "PING", "12345", true)
+	testParseCtcp(t, "\x01ACTION waves", "ACTION", "waves", true)
+}
+
+func testParseCtcp(t *testing.T, in, command, args string, ok bool) {
+	haveCommand, haveArgs, haveOk := ParseCtcp(in)
+	if command != haveCommand || args != haveArgs || ok != haveOk {
+		t.Fatalf("CTCP mismatch for %q;\nwant: %q %q %v\nhave: %q %q %v",
+			in, command, args, ok, haveCommand, haveArgs, haveOk)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	var w bytes.Buffer
+
+	Authenticate(&w, "PLAIN")
+	testOutput(t, &w, "AUTHENTICATE PLAIN\r\n")
+
+	Authenticate(&w, "")
+	testOutput(t, &w, "AUTHENTICATE +\r\n")
+
+	data := strings.Repeat("a", 400)
+	Authenticate(&w, data+"bc")
+	testOutput(t, &w, "AUTHENTICATE "+data+"\r\nAUTHENTICATE bc\r\n")
+
+	Authenticate(&w, data)
+	testOutput(t, &w, "AUTHENTICATE "+data+"\r\nAUTHENTICATE +\r\n")
+}
+
+func TestKick(t *testing.T) {
+	var w bytes.Buffer
+
+	Kick(&w, "#test", "bob")
+	testOutput(t, &w, "KICK #test bob\r\n")
+
+	Kick(&w, "#test", "bob", "ga weg")
+	testOutput(t, &w, "KICK #test bob :ga weg\r\n")
+
+	// Combined.
+	KickLimit(&w, 0, "#test", []string{"a", "b", "c"}, "ga weg")
+	testOutput(t, &w, "KICK #test a,b,c :ga weg\r\n")
+
+	KickLimit(&w, 2, "#test", []string{"a", "b", "c"})
+	testOutput(t, &w, "KICK #test a,b\r\nKICK #test c\r\n")
+
+	// Fallback to separate lines.
+	KickLimit(&w, 1, "#test", []string{"a", "b"}, "ga weg")
+	testOutput(t, &w, "KICK #test a :ga weg\r\nKICK #test b :ga weg\r\n")
+}
+
+func TestKickAll(t *testing.T) {
+	var w bytes.Buffer
+
+	irc.Support.Reset()
+	defer irc.Support.Reset()
+
+	// Without TARGMAX, each client is kicked separately.
+	KickAll(&w, "#test", []string{"a", "b"})
+	testOutput(t, &w, "KICK #test a\r\nKICK #test b\r\n")
+
+	irc.Support.Parse("TARGMAX=KICK:4 :are supported by this server")
+	KickAll(&w, "#test", []string{"a", "b"})
+	testOutput(t, &w, "KICK #test a,b\r\n")
+
+	irc.Support.Parse("TARGMAX=KICK: :are supported by this server")
+	KickAll(&w, "#test", []string{"a", "b", "c", "d", "e"})
+	testOutput(t, &w, "KICK #test a,b,c,d,e\r\n")
+}
@@ -5,6 +5,7 @@ package irc
 
 import (
 	"fmt"
+	"io"
 	"strings"
 )
 
@@ -18,6 +19,10 @@ type Request struct {
 	Type       string // Type of message: "001", "PRIVMSG", "PING", etc.
 	Target     string // Receiver of reply.
 	Data       string // Message content.
+
+	// Tags holds IRCv3 message tags, if the server sent any.
+	// E.g.: "time" => "2017-01-01T12:00:00.000Z"
+	Tags map[string]string
 }
 
 // FromChannel returns true if this request came from a channel context
@@ -31,6 +36,81 @@ func (r *Request) FromChannel() bool {
 	return c == '#' || c == '&' || c == '!' || c == '+'
 }
 
+// ReplyTarget returns the name to which replies to this request should be
+// sent. This is the channel for channel messages and the sender otherwise.
+func (r *Request) ReplyTarget() string {
+	if r.FromChannel() {
+		return r.Target
+	}
+	return r.SenderName
+}
+
+// Reply sends a message to the conversation this request came from. That
+// is the channel for channel messages and the sender for private ones.
+func (r *Request) Reply(w io.Writer, f string, argv ...interface{}) error {
+	return SendLines(w, "PRIVMSG", r.ReplyTarget(), fmt.Sprintf(f, argv...))
+}
+
+// ReplyPrivate sends a private message to the sender of this request,
+// regardless of where it came from.
+func (r *Request) ReplyPrivate(w io.Writer, f string, argv ...interface{}) error {
+	return SendLines(w, "PRIVMSG", r.SenderName, fmt.Sprintf(f, argv...))
+}
+
+// IsPrivate returns true if the request is a message sent directly to
+// the bot, instead of to a channel.
+func (r *Request) IsPrivate() bool {
+	return (r.IsPrivMsg() || r.IsNotice()) && len(r.Target) > 0 && !r.FromChannel()
+}
+
+// Mentions returns true if the message payload contains the given
+// nickname as a separate word. The comparison is case-insensitive.
+// E.g.: "bot: hoi" and "hoi @bot!" mention "bot", but "bot_" does not.
+func (r *Request) Mentions(nick string) bool {
+	if len(nick) == 0 {
+		return false
+	}
+
+	data := strings.ToLower(r.Data)
+	nick = strings.ToLower(nick)
+
+	for i := 0; i+len(nick) <= len(data); {
+		idx := strings.Index(data[i:], nick)
+		if idx == -1 {
+			return false
+		}
+
+		start, end := i+idx, i+idx+len(nick)
+		if (start == 0 || !isNickChar(data[start-1])) &&
+			(end == len(data) || !isNickChar(data[end])) {
+			return true
+		}
+
+		i = start + 1
+	}
+
+	return false
+}
+
+// isNickChar returns true if c may be part of a nickname.
+func isNickChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("-[]\\`^_{|}", c) > -1
+}
+
+// Arg returns the n'th word in the message payload. Returns an empty
+// string if there is no such word.
+func (r *Request) Arg(n int) string {
+	words := strings.Fields(r.Data)
+	if n < 0 || n >= len(words) {
+		return ""
+	}
+	return words[n]
+}
+
 // Fields returns the message payload, but skips the first n words.
 // The result is returned as a slice of individual words.
 func (r *Request) Fields(n int) []string {
@@ -51,3 +131,8 @@ func (r *Request) String() string {
 // a channel, as a PRIVMSG. This has its own method, because it is a
 // commonly used filter.
 func (r *Request) IsPrivMsg() bool { return r.Type == "PRIVMSG" }
+
+// IsNotice returns true if the request comes from either a user or
+// a channel, as a NOTICE. Automatic replies must never be sent in
+// response to these.
+func (r *Request) IsNotice() bool { return r.Type == "NOTICE" }
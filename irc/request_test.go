@@ -0,0 +1,98 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package irc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIsPrivate(t *testing.T) {
+	for _, tc := range []struct {
+		typ, target string
+		want        bool
+	}{
+		{"PRIVMSG", "steve", true},
+		{"NOTICE", "steve", true},
+		{"PRIVMSG", "#test", false},
+		{"NOTICE", "&lokaal", false},
+		{"PRIVMSG", "", false},
+		{"JOIN", "steve", false},
+		{"001", "steve", false},
+	} {
+		r := Request{Type: tc.typ, Target: tc.target}
+		if have := r.IsPrivate(); have != tc.want {
+			t.Fatalf("IsPrivate mismatch for %s %s;\nwant: %v\nhave: %v",
+				tc.typ, tc.target, tc.want, have)
+		}
+	}
+}
+
+func TestMentions(t *testing.T) {
+	for _, tc := range []struct {
+		data, nick string
+		want       bool
+	}{
+		{"autimaat: hoi", "autimaat", true},
+		{"hoi Autimaat!", "autimaat", true},
+		{"hoi @autimaat, hoe gaat het?", "autimaat", true},
+		{"(autimaat)", "autimaat", true},
+		{"autimaat", "autimaat", true},
+		{"ik zei autimaat_ niet", "autimaat", false},
+		{"[autimaat] is weg", "autimaat", false}, // A different nick.
+		{"autimaatje", "autimaat", false},
+		{"xautimaat autimaat", "autimaat", true},
+		{"bot|weg: hoi", "bot|weg", true},
+		{"hoi", "", false},
+		{"", "autimaat", false},
+	} {
+		r := Request{Type: "PRIVMSG", Data: tc.data}
+		if have := r.Mentions(tc.nick); have != tc.want {
+			t.Fatalf("Mentions mismatch for %q in %q;\nwant: %v\nhave: %v",
+				tc.nick, tc.data, tc.want, have)
+		}
+	}
+}
+
+func TestArg(t *testing.T) {
+	r := Request{Data: "  #test   steve doei "}
+
+	for i, want := range []string{"#test", "steve", "doei", ""} {
+		if have := r.Arg(i); have != want {
+			t.Fatalf("Arg(%d) mismatch;\nwant: %q\nhave: %q", i, want, have)
+		}
+	}
+
+	if have := r.Arg(-1); have != "" {
+		t.Fatalf("Arg(-1) mismatch;\nwant: %q\nhave: %q", "", have)
+	}
+}
+
+func TestReply(t *testing.T) {
+	for _, tc := range []struct {
+		target      string
+		reply, priv string
+	}{
+		// Channel message.
+		{"#test", "PRIVMSG #test :hoi steve\r\n", "PRIVMSG steve :hoi steve\r\n"},
+
+		// Private message, before and after the bot rewrote its target.
+		{"autimaat", "PRIVMSG steve :hoi steve\r\n", "PRIVMSG steve :hoi steve\r\n"},
+		{"steve", "PRIVMSG steve :hoi steve\r\n", "PRIVMSG steve :hoi steve\r\n"},
+	} {
+		var w bytes.Buffer
+		r := Request{SenderName: "steve", Type: "PRIVMSG", Target: tc.target}
+
+		r.Reply(&w, "hoi %s", r.SenderName)
+		if have := w.String(); have != tc.reply {
+			t.Fatalf("Reply mismatch for %s;\nwant: %q\nhave: %q", tc.target, tc.reply, have)
+		}
+
+		w.Reset()
+		r.ReplyPrivate(&w, "hoi %s", r.SenderName)
+		if have := w.String(); have != tc.priv {
+			t.Fatalf("ReplyPrivate mismatch for %s;\nwant: %q\nhave: %q", tc.target, tc.priv, have)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package irc
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxLineLength defines the maximum length of a single protocol message,
+// including the trailing `\r\n`.
+const MaxLineLength = 512
+
+// SendLines sends msg to the given target, using the specified command.
+// This is either PRIVMSG or NOTICE. The message is split into as many
+// protocol messages as needed for it to fit within MaxLineLength.
+//
+// CTCP messages, like actions, are split as well. Each part is wrapped
+// in its own CTCP markers, so it is still recognized as such.
+//
+// A bare carriage return ends a line as well. Many servers treat it as
+// the end of a protocol message, so it must never reach the wire. NUL
+// bytes are dropped for the same reason.
+//
+// This is used by Request.Reply, as well as by proto.PrivMsg and
+// proto.Notice.
+func SendLines(w io.Writer, command, target, msg string) error {
+	msg = lineBreaks.Replace(msg)
+	lines := strings.Split(msg, "\n")
+
+	for _, line := range lines {
+		if len(line) == 0 && len(lines) > 1 {
+			continue
+		}
+
+		var head, tail string
+		if isCtcp(line) {
+			line = line[1 : len(line)-1]
+			tag := line
+			if idx := strings.IndexByte(line, ' '); idx > -1 {
+				tag = line[:idx+1]
+			}
+
+			head = "\x01" + tag
+			tail = "\x01"
+			line = line[len(tag):]
+		}
+
+		// Determine how much room we have left for the actual message.
+		prefix := command + " " + target + " :" + head
+		size := MaxLineLength - len(prefix) - len(tail) - 2
+
+		for _, part := range splitMessage(line, size) {
+			_, err := io.WriteString(w, prefix+part+tail+"\r\n")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// lineBreaks turns all line endings into a single newline and drops NUL
+// bytes from a message.
+var lineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\x00", "")
+
+// isCtcp returns true if v is wrapped in CTCP markers.
+func isCtcp(v string) bool {
+	return len(v) > 1 && v[0] == '\x01' && v[len(v)-1] == '\x01'
+}
+
+// splitMessage splits msg into parts of at most size bytes. It splits on
+// word boundaries where possible. Whitespace at the boundary remains part
+// of the preceding chunk, so concatenating the parts yields the original
+// message. Multibyte UTF-8 sequences are never split, unless the message
+// is not valid UTF-8.
+func splitMessage(msg string, size int) []string {
+	if size < utf8.UTFMax {
+		size = utf8.UTFMax
+	}
+
+	var out []string
+
+	for len(msg) > size {
+		// Find the last space which fits within the limit.
+		n := strings.LastIndexByte(msg[:size], ' ') + 1
+
+		// No space found; cut the word at the last full rune. Invalid
+		// UTF-8 may not have a rune start at all, so cut it anywhere.
+		if n == 0 {
+			n = size
+			for n > 0 && !utf8.RuneStart(msg[n]) {
+				n--
+			}
+
+			if n == 0 {
+				n = size
+			}
+		}
+
+		out = append(out, msg[:n])
+		msg = msg[n:]
+	}
+
+	return append(out, msg)
+}
@@ -0,0 +1,27 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package irc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitInvalid(t *testing.T) {
+	// A run of continuation bytes has no rune boundary to cut at.
+	msg := strings.Repeat("\x80", 1000)
+
+	var have string
+	for _, part := range splitMessage(msg, 100) {
+		if len(part) == 0 || len(part) > 100 {
+			t.Fatalf("invalid part size: %d", len(part))
+		}
+
+		have += part
+	}
+
+	if have != msg {
+		t.Fatalf("reassembled message mismatch")
+	}
+}
@@ -0,0 +1,57 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package irc
+
+import (
+	"strings"
+	"sync"
+)
+
+// Topics holds the topics of the channels the bot is in. It is kept up to
+// date by the admin plugin, from RPL_TOPIC (332) replies and TOPIC changes.
+var Topics = NewTopicCache()
+
+// TopicCache holds the current topic for a set of channels. Channel
+// names are compared case-insensitively.
+type TopicCache struct {
+	m      sync.RWMutex
+	topics map[string]string
+}
+
+// NewTopicCache creates a new, empty topic cache.
+func NewTopicCache() *TopicCache {
+	return &TopicCache{topics: make(map[string]string)}
+}
+
+// Get returns the topic for the given channel. Returns false if the topic
+// is not known. A channel without a topic yields an empty string.
+func (c *TopicCache) Get(channel string) (string, bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	v, ok := c.topics[strings.ToLower(channel)]
+	return v, ok
+}
+
+// Set sets the topic for the given channel.
+func (c *TopicCache) Set(channel, topic string) {
+	c.m.Lock()
+	c.topics[strings.ToLower(channel)] = topic
+	c.m.Unlock()
+}
+
+// Remove forgets the topic for the given channel. E.g.: when the bot
+// leaves it.
+func (c *TopicCache) Remove(channel string) {
+	c.m.Lock()
+	delete(c.topics, strings.ToLower(channel))
+	c.m.Unlock()
+}
+
+// Reset forgets all topics.
+func (c *TopicCache) Reset() {
+	c.m.Lock()
+	c.topics = make(map[string]string)
+	c.m.Unlock()
+}
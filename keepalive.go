@@ -0,0 +1,170 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc/proto"
+)
+
+// keepalive periodically sends a PING to the server and expects a PONG
+// with the same token in return. If none arrives in time, the connection
+// is considered dead and the timeout handler is called. This catches dead
+// connections much sooner than waiting for the read deadline to expire.
+type keepalive struct {
+	m         sync.Mutex
+	w         io.Writer
+	interval  time.Duration
+	timeout   time.Duration
+	onTimeout func()
+	token     string
+	pong      chan struct{}
+	stop      chan struct{}
+}
+
+// newKeepalive creates a new keepalive which writes to w. It sends a PING
+// every interval and calls onTimeout if no matching PONG is received
+// within the given timeout.
+func newKeepalive(w io.Writer, interval, timeout time.Duration, onTimeout func()) *keepalive {
+	return &keepalive{
+		w:         w,
+		interval:  interval,
+		timeout:   timeout,
+		onTimeout: onTimeout,
+	}
+}
+
+// Start begins sending PINGs. It does nothing if the keepalive is
+// already running.
+func (k *keepalive) Start() {
+	k.m.Lock()
+	defer k.m.Unlock()
+
+	if k.stop != nil {
+		return
+	}
+
+	k.token = ""
+	k.stop = make(chan struct{})
+	k.pong = make(chan struct{}, 1)
+	go k.run(k.stop, k.pong)
+}
+
+// Stop stops sending PINGs. Any outstanding PING is forgotten.
+func (k *keepalive) Stop() {
+	k.m.Lock()
+	defer k.m.Unlock()
+
+	if k.stop != nil {
+		close(k.stop)
+		k.stop = nil
+	}
+
+	k.token = ""
+}
+
+// Pong handles a PONG message with the given token. Returns true if it
+// answers the outstanding PING. Any other PONG is ignored, so it can not
+// reset the timeout.
+func (k *keepalive) Pong(token string) bool {
+	k.m.Lock()
+	defer k.m.Unlock()
+
+	if len(k.token) == 0 || token != k.token {
+		return false
+	}
+
+	k.token = ""
+
+	select {
+	case k.pong <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// run sends a PING every interval and waits for its PONG, until stopped.
+func (k *keepalive) run(stop, pong chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(k.interval):
+		}
+
+		// The PING may sit in the send queue for a while. The server
+		// can not answer before it has been sent, so don't count that
+		// time against the timeout. If it could not be sent at all,
+		// the connection is as good as dead.
+		sent := k.ping()
+
+		select {
+		case <-stop:
+			return
+		case err := <-sent:
+			if err != nil {
+				log.Printf("[bot] Ping failed: %v", err)
+				k.onTimeout()
+				return
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-pong:
+		case <-time.After(k.timeout):
+			log.Printf("[bot] Ping timeout after %s", k.timeout)
+			k.onTimeout()
+			return
+		}
+	}
+}
+
+// ping sends a PING with a new token and marks it as outstanding. The
+// returned channel receives nil once the PING has actually been written,
+// or an error if it could not be written.
+func (k *keepalive) ping() <-chan error {
+	token := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	k.m.Lock()
+	k.token = token
+	k.m.Unlock()
+
+	sent := make(chan error, 1)
+
+	nw, ok := k.w.(notifyWriter)
+	if !ok {
+		sent <- proto.Ping(k.w, token)
+		return sent
+	}
+
+	err := proto.Ping(writerFunc(func(p []byte) (int, error) {
+		return nw.WriteNotify(p, func(err error) { sent <- err })
+	}), token)
+
+	// The callback is not called if the PING was never queued.
+	if err != nil {
+		sent <- err
+	}
+
+	return sent
+}
+
+// notifyWriter is implemented by writers which queue messages, instead of
+// writing them right away. See SendQueue.WriteNotify.
+type notifyWriter interface {
+	WriteNotify(p []byte, sent func(error)) (int, error)
+}
+
+// writerFunc turns a function into an io.Writer.
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
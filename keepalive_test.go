@@ -0,0 +1,177 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pingWriter collects the tokens of all PINGs written to it.
+type pingWriter chan string
+
+func (w pingWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSpace(string(p))
+	w <- strings.TrimPrefix(line, "PING :")
+	return len(p), nil
+}
+
+func TestKeepaliveTimeout(t *testing.T) {
+	w := make(pingWriter, 16)
+	timeout := make(chan struct{})
+
+	k := newKeepalive(w, time.Millisecond, time.Millisecond*50,
+		func() { close(timeout) })
+	k.Start()
+	defer k.Stop()
+
+	token := testPing(t, w)
+
+	// A PONG with the wrong token should not reset the timeout.
+	if k.Pong(token + "x") {
+		t.Fatalf("stray PONG accepted")
+	}
+
+	select {
+	case <-timeout:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("timeout was not triggered")
+	}
+}
+
+func TestKeepalivePong(t *testing.T) {
+	w := make(pingWriter, 16)
+	timeout := make(chan struct{})
+
+	k := newKeepalive(w, time.Millisecond, time.Millisecond*200,
+		func() { close(timeout) })
+	k.Start()
+	defer k.Stop()
+
+	// Keep answering PINGs for longer than the timeout.
+	for i := 0; i < 5; i++ {
+		token := testPing(t, w)
+
+		if !k.Pong(token) {
+			t.Fatalf("PONG %d with token %q rejected", i, token)
+		}
+
+		// The same token can only be used once.
+		if k.Pong(token) {
+			t.Fatalf("PONG %d with token %q accepted twice", i, token)
+		}
+
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	select {
+	case <-timeout:
+		t.Fatalf("timeout triggered, despite PONGs")
+	default:
+	}
+}
+
+func TestKeepaliveQueued(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rec := &recorder{clock: clock, lines: make(chan sentLine, 16), block: make(chan struct{})}
+	defer close(rec.block)
+
+	q := newSendQueue(rec, 1, 0, clock)
+	defer q.Close()
+
+	timeout := make(chan struct{})
+
+	k := newKeepalive(q, time.Millisecond, time.Millisecond*50,
+		func() { close(timeout) })
+	k.Start()
+	defer k.Stop()
+
+	// The PING is stuck in the queue for longer than the timeout. This
+	// must not count against it.
+	select {
+	case <-timeout:
+		t.Fatalf("timeout triggered before the PING was sent")
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	rec.block <- struct{}{}
+	line := testSent(t, rec)
+	token := strings.TrimPrefix(strings.TrimSpace(line.data), "PING :")
+
+	if !k.Pong(token) {
+		t.Fatalf("PONG with token %q rejected", token)
+	}
+}
+
+func TestKeepaliveWriteFailed(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	q := newSendQueue(failWriter{}, 1, 0, clock)
+	defer q.Close()
+
+	timeout := make(chan struct{})
+
+	// The timeout is long enough to never expire during the test. A
+	// failed write must trigger it right away.
+	k := newKeepalive(q, time.Millisecond, time.Hour,
+		func() { close(timeout) })
+	k.Start()
+	defer k.Stop()
+
+	select {
+	case <-timeout:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("timeout was not triggered after a failed write")
+	}
+}
+
+func TestKeepaliveDiscarded(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rec := &recorder{clock: clock, lines: make(chan sentLine, 16), block: make(chan struct{})}
+	defer close(rec.block)
+
+	q := newSendQueue(rec, 1, 0, clock)
+	defer q.Close()
+
+	// Occupy the queue, so the PING stays pending until it is dropped.
+	q.Write([]byte("PRIVMSG #test :hi\r\n"))
+
+	timeout := make(chan struct{})
+
+	k := newKeepalive(q, time.Millisecond, time.Hour,
+		func() { close(timeout) })
+	k.Start()
+	defer k.Stop()
+
+	time.Sleep(time.Millisecond * 50)
+	q.Reset()
+
+	select {
+	case <-timeout:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("timeout was not triggered after the PING was discarded")
+	}
+}
+
+// failWriter fails every write.
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) { return 0, io.ErrClosedPipe }
+func (failWriter) Close() error              { return nil }
+
+// testPing waits for the next PING and returns its token.
+func testPing(t *testing.T, w pingWriter) string {
+	select {
+	case token := <-w:
+		if len(token) == 0 {
+			t.Fatalf("PING without token")
+		}
+		return token
+	case <-time.After(time.Second * 5):
+		t.Fatalf("timed out waiting for PING")
+	}
+
+	return ""
+}
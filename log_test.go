@@ -0,0 +1,95 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc"
+)
+
+func TestLogRequestJSON(t *testing.T) {
+	root := t.TempDir()
+
+	err := ioutil.WriteFile(filepath.Join(root, "profile.cfg"),
+		[]byte(`{"Logging": true, "JSONLogging": true}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prof := irc.NewProfile(root)
+	if err := prof.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetPrefix("[123] ")
+	defer log.SetOutput(os.Stderr)
+	defer log.SetPrefix("")
+
+	b := Bot{profile: prof}
+	b.logRequest(&irc.Request{
+		SenderName: "steve",
+		SenderMask: "~steve@example.com",
+		Type:       "PRIVMSG",
+		Target:     "#test",
+		Data:       `hallo "allemaal"`,
+	})
+	b.logRequest(&irc.Request{Type: "JOIN", SenderName: "bob", Target: "#test"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines; have: %q", lines)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[0], err)
+	}
+
+	for key, want := range map[string]string{
+		"sender": "steve",
+		"mask":   "~steve@example.com",
+		"type":   "PRIVMSG",
+		"target": "#test",
+		"data":   `hallo "allemaal"`,
+	} {
+		if have, _ := entry[key].(string); want != have {
+			t.Fatalf("%s mismatch;\nwant: %q\nhave: %q", key, want, have)
+		}
+	}
+
+	stamp, _ := entry["timestamp"].(string)
+	if _, err := time.Parse(time.RFC3339Nano, stamp); err != nil {
+		t.Fatalf("invalid timestamp %q: %v", stamp, err)
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[1], err)
+	}
+}
+
+func TestLogRequestText(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	b := Bot{profile: prof}
+	b.logRequest(&irc.Request{Type: "JOIN", SenderName: "bob", Target: "#test"})
+
+	if have := buf.String(); !strings.Contains(have, "[>]  bob JOIN #test") {
+		t.Fatalf("unexpected text log line: %q", have)
+	}
+}
@@ -10,26 +10,37 @@ package action
 
 import (
 	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/monkeybird/autimaat/app/util"
 	"github.com/monkeybird/autimaat/irc"
 	"github.com/monkeybird/autimaat/irc/cmd"
-	"github.com/monkeybird/autimaat/irc/proto"
 	"github.com/monkeybird/autimaat/plugins"
 )
 
 func init() { plugins.Register(&plugin{}) }
 
 type plugin struct {
+	m   sync.Mutex
 	cmd *cmd.Set
 	rng *rand.Rand
 }
 
 // Load initializes the module and loads any internal resources
 // which may be required.
+//
+// The actions are read from actions.cfg in the profile directory. If
+// this file does not exist, the built-in TextActions are used.
 func (p *plugin) Load(prof irc.Profile) error {
-	p.cmd = cmd.New(prof.CommandPrefix(), nil)
+	p.cmd = cmd.New(prof.CommandPrefixes(), nil)
+	p.cmd.SetAcceptNotice(prof.NoticeCommands())
+	plugins.Track(p, p.cmd)
 	p.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 	// action returns a command handler which presents a channel with
@@ -42,27 +53,183 @@ func (p *plugin) Load(prof irc.Profile) error {
 				targ = params.String(0)
 			}
 
-			idx := p.rng.Intn(len(set))
+			idx := p.intn(len(set))
 			msg := util.Action(set[idx], targ)
-			proto.PrivMsg(w, r.Target, msg)
+			r.Reply(w, "%s", msg)
 		}
 	}
 
-	// Bind all known actions.
-	for _, a := range TextActions {
-		handler := action(a.Answers)
+	p.cmd.Bind(TextRollName, false, p.cmdRoll).
+		Alias(TextRollAliases...).
+		Add(TextRollDice, false, regDice)
+	p.cmd.Bind(TextChooseName, false, p.cmdChoose).
+		Add(TextChooseOptions, false, cmd.RegAny)
+
+	actions, err := loadActions(filepath.Join(prof.Root(), "actions.cfg"))
+
+	// Bind all known actions. The first name is the command name,
+	// any others are aliases.
+	for _, a := range actions {
+		p.cmd.Bind(a.Names[0], false, action(a.Answers)).
+			Alias(a.Names[1:]...).
+			Add(TextUserName, false, cmd.RegAny)
+	}
+
+	return err
+}
+
+// Bounds for dice rolls.
+const (
+	MaxDice  = 100
+	MaxSides = 1000
+)
+
+// regDice matches dice specifications like "2d6" or "d20".
+var regDice = regexp.MustCompile(`^(?i)(\d*)d(\d+)$`)
+
+// cmdRoll rolls a number of dice and reports the individual rolls,
+// along with their sum. Without a specification, a single six-sided
+// die is rolled.
+func (p *plugin) cmdRoll(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	spec := "d6"
+	if params.Len() > 0 {
+		spec = strings.ToLower(params.String(0))
+	}
+
+	m := regDice.FindStringSubmatch(spec)
+	if m == nil {
+		r.Reply(w, TextRollInvalid, r.SenderName, MaxDice, MaxSides)
+		return
+	}
 
-		for _, name := range a.Names {
-			p.cmd.Bind(name, false, handler).
-				Add(TextUserName, false, cmd.RegAny)
+	n := 1
+	if len(m[1]) > 0 {
+		n, _ = strconv.Atoi(m[1])
+	}
+
+	sides, _ := strconv.Atoi(m[2])
+
+	if n < 1 || n > MaxDice || sides < 1 || sides > MaxSides {
+		r.Reply(w, TextRollInvalid, r.SenderName, MaxDice, MaxSides)
+		return
+	}
+
+	rolls := make([]string, n)
+	sum := 0
+
+	for i := range rolls {
+		v := p.intn(sides) + 1
+		rolls[i] = strconv.Itoa(v)
+		sum += v
+	}
+
+	if n == 1 {
+		r.Reply(w, TextRollSingle, r.SenderName, spec, util.Bold("%d", sum))
+		return
+	}
+
+	r.Reply(w, TextRollMultiple, r.SenderName, spec,
+		strings.Join(rolls, " + "), util.Bold("%d", sum))
+}
+
+// cmdChoose picks one of the comma-separated options at random. Options
+// may be quoted.
+func (p *plugin) cmdChoose(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	var options []string
+	for _, v := range strings.Split(strings.Join(params.Words(0), " "), ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			options = append(options, v)
 		}
 	}
 
+	switch len(options) {
+	case 0:
+		r.Reply(w, TextChooseNone, r.SenderName)
+	case 1:
+		r.Reply(w, TextChooseSingle, r.SenderName, options[0])
+	default:
+		r.Reply(w, TextChooseResult, r.SenderName,
+			options[p.intn(len(options))])
+	}
+}
+
+// intn returns a random number in the range [0, n).
+// The random source is not safe for concurrent use.
+func (p *plugin) intn(n int) int {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.rng.Intn(n)
+}
+
+// loadActions reads action definitions from the given file. It yields
+// TextActions if the file does not exist, or can not be read. Answers
+// which do not hold exactly one %s placeholder for the target are
+// skipped, as are actions without names or answers.
+func loadActions(file string) ([]action, error) {
+	var set []action
+
+	err := util.ReadFile(file, &set, false)
+	if os.IsNotExist(err) {
+		return TextActions, nil
+	}
+
+	if err != nil {
+		return TextActions, err
+	}
+
+	out := set[:0]
+	for _, a := range set {
+		answers := a.Answers[:0]
+		for _, v := range a.Answers {
+			if validAnswer(v) {
+				answers = append(answers, v)
+			}
+		}
+
+		if len(a.Names) > 0 && len(answers) > 0 {
+			a.Answers = answers
+			out = append(out, a)
+		}
+	}
+
+	return out, nil
+}
+
+// validAnswer returns true if v holds exactly one %s placeholder and no
+// other formatting verbs, besides escaped percent signs.
+func validAnswer(v string) bool {
+	var n int
+
+	for i := 0; i < len(v); i++ {
+		if v[i] != '%' {
+			continue
+		}
+
+		if i++; i == len(v) {
+			return false
+		}
+
+		switch v[i] {
+		case '%':
+		case 's':
+			n++
+		default:
+			return false
+		}
+	}
+
+	return n == 1
+}
+
+// Reload reloads the plugin's configuration.
+func (p *plugin) Reload(prof irc.Profile) error {
+	p.cmd.SetPrefixes(prof.CommandPrefixes())
 	return nil
 }
 
 // Unload cleans the module up and unloads any internal resources.
 func (p *plugin) Unload(prof irc.Profile) error {
+	p.cmd.Close()
 	return nil
 }
 
@@ -0,0 +1,194 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package action
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/app/util"
+	"github.com/monkeybird/autimaat/irc"
+)
+
+type mockWriter struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (mw *mockWriter) Write(p []byte) (int, error) {
+	mw.m.Lock()
+	defer mw.m.Unlock()
+	return mw.buf.Write(p)
+}
+
+func (mw *mockWriter) String() string {
+	mw.m.Lock()
+	defer mw.m.Unlock()
+	return mw.buf.String()
+}
+
+func (mw *mockWriter) Close() error { return nil }
+
+func TestCustomActions(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	cfg := `[
+		{"Names": ["knuffel", "hug"], "Answers": ["knuffelt %s.", "geeft %s een dikke knuffel."]},
+		{"Names": ["leeg"], "Answers": []},
+		{"Names": ["fout"], "Answers": ["zwaait.", "geeft %s %d koekjes.", "zegt %s en %s."]},
+		{"Names": ["taart"], "Answers": ["geeft %s 100%% van de taart.", "eet de taart voor %s op."]}
+	]`
+
+	err := ioutil.WriteFile(filepath.Join(prof.Root(), "actions.cfg"), []byte(cfg), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p plugin
+	if err := p.Load(prof); err != nil {
+		t.Fatal(err)
+	}
+
+	defer p.Unload(prof)
+
+	want := []string{
+		"PRIVMSG #test :" + util.Action("knuffelt %s.", "bob") + "\r\n",
+		"PRIVMSG #test :" + util.Action("geeft %s een dikke knuffel.", "bob") + "\r\n",
+	}
+
+	testAction(t, &p, "!knuffel bob", want...)
+	testAction(t, &p, "!hug bob", want...)
+
+	testAction(t, &p, "!taart bob",
+		"PRIVMSG #test :"+util.Action("geeft %s 100%% van de taart.", "bob")+"\r\n",
+		"PRIVMSG #test :"+util.Action("eet de taart voor %s op.", "bob")+"\r\n")
+
+	// Neither the empty action, one without valid answers, nor the
+	// built-in ones are bound.
+	testAction(t, &p, "!leeg bob")
+	testAction(t, &p, "!fout bob")
+	testAction(t, &p, "!bier bob")
+}
+
+func TestDefaultActions(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	if err := p.Load(prof); err != nil {
+		t.Fatal(err)
+	}
+
+	defer p.Unload(prof)
+
+	var want []string
+	for _, answer := range TextActions[1].Answers {
+		want = append(want, "PRIVMSG #test :"+util.Action(answer, "steve")+"\r\n")
+	}
+
+	testAction(t, &p, "!"+TextActions[1].Names[0], want...)
+}
+
+func TestRoll(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	if err := p.Load(prof); err != nil {
+		t.Fatal(err)
+	}
+
+	defer p.Unload(prof)
+
+	p.rng = rand.New(rand.NewSource(1))
+	rng := rand.New(rand.NewSource(1))
+
+	a := rng.Intn(6) + 1
+	b := rng.Intn(6) + 1
+	testAction(t, &p, "!roll 2D6", fmt.Sprintf("PRIVMSG #test :steve gooit 2d6: %d + %d = %s\r\n",
+		a, b, util.Bold("%d", a+b)))
+
+	a = rng.Intn(20) + 1
+	testAction(t, &p, "!dobbel d20", fmt.Sprintf("PRIVMSG #test :steve gooit d20: %s\r\n",
+		util.Bold("%d", a)))
+
+	a = rng.Intn(6) + 1
+	testAction(t, &p, "!roll", fmt.Sprintf("PRIVMSG #test :steve gooit d6: %s\r\n",
+		util.Bold("%d", a)))
+
+	invalid := "PRIVMSG #test :" + fmt.Sprintf(TextRollInvalid, "steve", MaxDice, MaxSides) + "\r\n"
+	testAction(t, &p, "!roll 0d6", invalid)
+	testAction(t, &p, "!roll 101d6", invalid)
+	testAction(t, &p, "!roll 2d0", invalid)
+	testAction(t, &p, "!roll 2d1001", invalid)
+}
+
+func TestChoose(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	if err := p.Load(prof); err != nil {
+		t.Fatal(err)
+	}
+
+	defer p.Unload(prof)
+
+	p.rng = rand.New(rand.NewSource(1))
+	rng := rand.New(rand.NewSource(1))
+
+	options := []string{"pizza", "friet met mayo", "sushi"}
+	want := fmt.Sprintf("PRIVMSG #test :steve, ik kies: %s\r\n", options[rng.Intn(len(options))])
+	testAction(t, &p, "!kies pizza, , friet  met mayo ,sushi,", want)
+
+	// Quoted options lose their quotes.
+	want = fmt.Sprintf("PRIVMSG #test :steve, ik kies: %s\r\n", options[rng.Intn(len(options))])
+	testAction(t, &p, `!kies "pizza", "friet met mayo", sushi`, want)
+
+	testAction(t, &p, "!kies  pizza , ,",
+		"PRIVMSG #test :steve, veel keus heb je niet: pizza\r\n")
+	testAction(t, &p, "!kies , ,",
+		"PRIVMSG #test :"+fmt.Sprintf(TextChooseNone, "steve")+"\r\n")
+	testAction(t, &p, "!kies",
+		"PRIVMSG #test :"+fmt.Sprintf(TextChooseNone, "steve")+"\r\n")
+}
+
+// testAction dispatches the given message and ensures the output matches
+// one of the wanted values. No output is expected if none are given.
+func testAction(t *testing.T, p *plugin, data string, want ...string) {
+	var w mockWriter
+
+	ok, _ := p.cmd.Dispatch(&w, &irc.Request{
+		SenderName: "steve",
+		SenderMask: "~steve@example.com",
+		Type:       "PRIVMSG",
+		Target:     "#test",
+		Data:       data,
+	})
+
+	if !ok {
+		if len(want) > 0 {
+			t.Fatalf("command %q not handled", data)
+		}
+		return
+	}
+
+	// Command handlers run asynchronously.
+	var have string
+	for i := 0; i < 100 && len(have) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+		have = w.String()
+	}
+
+	for _, v := range want {
+		if have == v {
+			return
+		}
+	}
+
+	t.Fatalf("output mismatch for %q;\nwant one of: %q\nhave: %q", data, want, have)
+}
@@ -3,13 +3,30 @@
 
 package action
 
-const TextUserName = "wie"
+const (
+	TextUserName      = "wie"
+	TextRollName      = "roll"
+	TextRollDice      = "dobbelstenen"
+	TextRollSingle    = "%s gooit %s: %s"
+	TextRollMultiple  = "%s gooit %s: %s = %s"
+	TextRollInvalid   = "%s, dat is geen geldige worp. Probeer iets als 2d6 of d20, met maximaal %d stenen van %d zijden."
+	TextChooseName    = "kies"
+	TextChooseOptions = "opties"
+	TextChooseResult  = "%s, ik kies: %s"
+	TextChooseSingle  = "%s, veel keus heb je niet: %s"
+	TextChooseNone    = "%s, waaruit moet ik kiezen? Scheid de opties met komma's."
+)
+
+var TextRollAliases = []string{"dobbel"}
 
 // action defines a single action with a set of possible replies.
 // One of which will be chosen at random, by the bot.
 //
 // The answers should be written as if part of an action.
 // E.g.: "/me <something something...>"
+//
+// Custom actions can be defined in a JSON encoded actions.cfg file,
+// in the profile directory. It holds a list of these structures.
 type action struct {
 	Names   []string // Name by which the action is invoked.
 	Answers []string // Possible set of replies for this action.
@@ -0,0 +1,89 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd"
+)
+
+// nopWriter discards all data written to it.
+type nopWriter struct{}
+
+func (nopWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (nopWriter) Close() error                { return nil }
+
+func TestOwnerCommands(t *testing.T) {
+	root := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(root, "profile.cfg"), []byte(`{
+		"CommandPrefix": "!",
+		"Owners": ["~owner@example.com"],
+		"Whitelist": ["~admin@example.com"]
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prof := irc.NewProfile(root)
+	if err := prof.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	for _, name := range []string{"!baas ~new@example.com", "!ontbaas ~admin@example.com", "!herstart", "!raw AWAY"} {
+		testAccess(t, &p, "~admin@example.com", name, cmd.ErrAccessDenied)
+		testAccess(t, &p, "~guest@example.com", name, cmd.ErrAccessDenied)
+	}
+
+	for _, name := range []string{"!join #test", "!part #test", "!log", "!bazen"} {
+		testAccess(t, &p, "~admin@example.com", name, nil)
+		testAccess(t, &p, "~owner@example.com", name, nil)
+		testAccess(t, &p, "~guest@example.com", name, cmd.ErrAccessDenied)
+	}
+
+	testAccess(t, &p, "~owner@example.com", "!baas ~new@example.com", nil)
+}
+
+func TestOwnerFallback(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	// Without owners, whitelisted users are owners.
+	testAccess(t, &p, prof.Whitelist()[0], "!ontbaas ~other@example.com", nil)
+}
+
+// testAccess dispatches the given command as the user with the given
+// hostmask and ensures it yields the expected error.
+func testAccess(t *testing.T, p *plugin, mask, data string, want error) {
+	r := &irc.Request{
+		SenderName: "steve",
+		SenderMask: mask,
+		Type:       "PRIVMSG",
+		Target:     "#test",
+		Data:       data,
+	}
+
+	ok, err := p.cmd.Dispatch(nopWriter{}, r)
+	if !ok && err == nil {
+		ok, err = p.owner.Dispatch(nopWriter{}, r)
+	}
+
+	if err != want {
+		t.Fatalf("access mismatch for %q by %s;\nwant: %v\nhave: %v", data, mask, want, err)
+	}
+
+	if want == nil && !ok {
+		t.Fatalf("command %q by %s was not run", data, mask)
+	}
+}
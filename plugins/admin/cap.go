@@ -0,0 +1,226 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"encoding/base64"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/proto"
+)
+
+// capState tracks IRCv3 capability negotiation during login.
+//
+// ref: https://ircv3.net/specs/extensions/capability-negotiation
+type capState struct {
+	m         sync.Mutex
+	want      []string // Capabilities we wish to enable.
+	available []string // Capabilities advertised by the server.
+	enabled   []string // Capabilities acknowledged by the server.
+	listing   bool     // An LS reply spanning multiple lines is in progress.
+	listed    bool     // An LS reply was received on the current connection.
+	saslUser  string   // SASL account name, if SASL is used.
+	saslPass  string   // SASL password, if SASL is used.
+}
+
+// newCapState creates a new negotiation state for the given capabilities.
+func newCapState(want []string) *capState {
+	return &capState{want: want}
+}
+
+// useSasl configures the negotiation to authenticate with SASL PLAIN,
+// using the given credentials. This adds the sasl capability to the
+// wanted set, if it is not already in there.
+func (c *capState) useSasl(user, pass string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.saslUser = user
+	c.saslPass = pass
+
+	if !hasCap(c.want, "sasl") {
+		c.want = append(c.want, "sasl")
+	}
+}
+
+// Enabled returns true if the given capability has been acknowledged
+// by the server.
+func (c *capState) Enabled(name string) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return hasCap(c.enabled, name)
+}
+
+// onCap handles a CAP message from the server. These have the form:
+//
+//	:server CAP * LS * :multi-prefix sasl=PLAIN,EXTERNAL
+//	:server CAP * LS :server-time
+//	:server CAP * ACK :multi-prefix sasl
+//	:server CAP * NAK :sasl
+//
+// A '*' following LS indicates more lines are to follow.
+func (c *capState) onCap(w irc.ResponseWriter, r *irc.Request) {
+	fields := strings.Fields(r.Data)
+	if len(fields) == 0 {
+		return
+	}
+
+	sub := strings.ToUpper(fields[0])
+	fields = fields[1:]
+
+	more := len(fields) > 0 && fields[0] == "*"
+	if more {
+		fields = fields[1:]
+	}
+
+	if len(fields) > 0 {
+		fields[0] = strings.TrimPrefix(fields[0], ":")
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	switch sub {
+	case "LS":
+		// The first line of an LS reply starts a new negotiation. Forget
+		// the results of any earlier one, e.g. from before a reconnect.
+		if !c.listing {
+			c.reset()
+			c.listed = true
+		}
+
+		c.listing = more
+
+		for _, f := range fields {
+			// Strip capability values. E.g.: "sasl=PLAIN,EXTERNAL"
+			if idx := strings.IndexByte(f, '='); idx > -1 {
+				f = f[:idx]
+			}
+
+			if len(f) > 0 {
+				c.available = append(c.available, strings.ToLower(f))
+			}
+		}
+
+		if !more {
+			c.request(w)
+		}
+
+	case "ACK":
+		for _, f := range fields {
+			if len(f) > 0 && f[0] != '-' {
+				c.enabled = append(c.enabled, strings.ToLower(f))
+			}
+		}
+
+		log.Println("[admin] Capabilities enabled:", strings.Join(c.enabled, ", "))
+
+		// If we are to authenticate through SASL, the negotiation is
+		// ended once authentication is complete.
+		if len(c.saslUser) > 0 && hasCap(c.enabled, "sasl") {
+			proto.Authenticate(w, "PLAIN")
+			return
+		}
+
+		proto.Cap(w, "END")
+
+	case "NAK":
+		log.Println("[admin] Capabilities rejected:", strings.Join(fields, ", "))
+		proto.Cap(w, "END")
+	}
+}
+
+// onAuthenticate handles an AUTHENTICATE message from the server. A "+"
+// indicates the server is ready for our credentials. These are sent as
+// base64 encoded: "\x00<user>\x00<password>".
+func (c *capState) onAuthenticate(w irc.ResponseWriter, r *irc.Request) {
+	if strings.TrimSpace(r.Data) != "+" {
+		return
+	}
+
+	c.m.Lock()
+	payload := "\x00" + c.saslUser + "\x00" + c.saslPass
+	c.m.Unlock()
+
+	proto.Authenticate(w, base64.StdEncoding.EncodeToString([]byte(payload)))
+}
+
+// onSaslResult handles the numeric replies which conclude SASL
+// authentication. Either way, capability negotiation is ended, so
+// registration can complete.
+func (c *capState) onSaslResult(w irc.ResponseWriter, r *irc.Request) {
+	switch r.Type {
+	case "903": // RPL_SASLSUCCESS
+		log.Println("[admin] SASL authentication successful")
+
+	case "904": // ERR_SASLFAIL
+		log.Println("[admin] SASL authentication failed")
+
+	case "905": // ERR_SASLTOOLONG
+		log.Println("[admin] SASL authentication failed: message too long")
+
+	case "906": // ERR_SASLABORTED
+		log.Println("[admin] SASL authentication aborted")
+
+	default:
+		return
+	}
+
+	proto.Cap(w, "END")
+}
+
+// onWelcome is called once registration with the server is complete.
+// An LS reply which is still in progress is abandoned. If the server did
+// not send one at all, nothing was negotiated on this connection and any
+// capabilities from an earlier one are forgotten.
+func (c *capState) onWelcome() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if !c.listed {
+		c.reset()
+	}
+
+	c.listing = false
+	c.listed = false
+}
+
+// reset clears the results of a negotiation. The caller must hold the lock.
+func (c *capState) reset() {
+	c.available = nil
+	c.enabled = nil
+	c.listing = false
+}
+
+// request requests all wanted capabilities which are supported by the
+// server. If there are none, the negotiation is ended.
+func (c *capState) request(w irc.ResponseWriter) {
+	var set []string
+
+	for _, name := range c.want {
+		if hasCap(c.available, name) && !hasCap(set, name) {
+			set = append(set, strings.ToLower(name))
+		}
+	}
+
+	if len(set) == 0 {
+		proto.Cap(w, "END")
+		return
+	}
+
+	proto.Cap(w, "REQ", strings.Join(set, " "))
+}
+
+// hasCap returns true if set contains the given capability name.
+func hasCap(set []string, name string) bool {
+	for _, v := range set {
+		if strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/monkeybird/autimaat/irc"
+)
+
+// mockWriter records all data written to it.
+type mockWriter struct {
+	bytes.Buffer
+}
+
+func (mw *mockWriter) Close() error { return nil }
+
+func TestCapNegotiation(t *testing.T) {
+	var w mockWriter
+	c := newCapState([]string{"multi-prefix", "server-time", "sasl"})
+
+	testCap(t, c, &w, "LS * :multi-prefix sasl=PLAIN,EXTERNAL away-notify", "")
+	testCap(t, c, &w, "LS :account-tag server-time", "CAP REQ :multi-prefix server-time sasl\r\n")
+	testCap(t, c, &w, "ACK :multi-prefix server-time sasl ", "CAP END\r\n")
+
+	for _, name := range []string{"multi-prefix", "server-time", "sasl"} {
+		if !c.Enabled(name) {
+			t.Fatalf("expected capability %q to be enabled", name)
+		}
+	}
+
+	if c.Enabled("away-notify") {
+		t.Fatalf("unexpected capability %q enabled", "away-notify")
+	}
+}
+
+func TestCapRenegotiate(t *testing.T) {
+	var w mockWriter
+	c := newCapState([]string{"multi-prefix", "server-time"})
+
+	testCap(t, c, &w, "LS :multi-prefix server-time", "CAP REQ :multi-prefix server-time\r\n")
+	testCap(t, c, &w, "ACK :multi-prefix server-time", "CAP END\r\n")
+	c.onWelcome()
+
+	// After a reconnect, the new server only supports one of them.
+	testCap(t, c, &w, "LS * :multi-prefix", "")
+	testCap(t, c, &w, "LS :away-notify", "CAP REQ multi-prefix\r\n")
+	testCap(t, c, &w, "ACK :multi-prefix", "CAP END\r\n")
+	c.onWelcome()
+
+	if !c.Enabled("multi-prefix") {
+		t.Fatalf("expected capability %q to be enabled", "multi-prefix")
+	}
+
+	if c.Enabled("server-time") {
+		t.Fatalf("capability %q survived renegotiation", "server-time")
+	}
+
+	// Reconnecting to a server without capability negotiation.
+	c.onWelcome()
+
+	if c.Enabled("multi-prefix") {
+		t.Fatalf("capability %q survived reconnect", "multi-prefix")
+	}
+}
+
+func TestCapNone(t *testing.T) {
+	var w mockWriter
+	c := newCapState([]string{"sasl"})
+
+	testCap(t, c, &w, "LS :multi-prefix", "CAP END\r\n")
+}
+
+func TestCapSingle(t *testing.T) {
+	var w mockWriter
+	c := newCapState([]string{"sasl"})
+
+	testCap(t, c, &w, "LS :sasl", "CAP REQ sasl\r\n")
+	testCap(t, c, &w, "NAK :sasl", "CAP END\r\n")
+
+	if c.Enabled("sasl") {
+		t.Fatalf("unexpected capability %q enabled", "sasl")
+	}
+}
+
+func testCap(t *testing.T, c *capState, w *mockWriter, data, want string) {
+	c.onCap(w, &irc.Request{Type: "CAP", Target: "*", Data: data})
+
+	have := w.String()
+	w.Reset()
+
+	if want != have {
+		t.Fatalf("CAP reply mismatch for %q;\nwant: %q\nhave: %q", data, want, have)
+	}
+}
+
+func TestSaslSuccess(t *testing.T) {
+	var w mockWriter
+	c := newCapState([]string{"multi-prefix"})
+	c.useSasl("steve", "hunter2")
+
+	testCap(t, c, &w, "LS :multi-prefix sasl=PLAIN", "CAP REQ :multi-prefix sasl\r\n")
+	testCap(t, c, &w, "ACK :multi-prefix sasl", "AUTHENTICATE PLAIN\r\n")
+
+	// base64("\x00steve\x00hunter2")
+	testSasl(t, c, &w, "AUTHENTICATE", "+", "AUTHENTICATE AHN0ZXZlAGh1bnRlcjI=\r\n")
+	testSasl(t, c, &w, "900", "bot!~bot@example.com steve :You are now logged in as steve", "")
+	testSasl(t, c, &w, "903", ":SASL authentication successful", "CAP END\r\n")
+}
+
+func TestSaslFailure(t *testing.T) {
+	var w mockWriter
+	c := newCapState(nil)
+	c.useSasl("steve", "wrong")
+
+	testCap(t, c, &w, "LS :sasl", "CAP REQ sasl\r\n")
+	testCap(t, c, &w, "ACK :sasl", "AUTHENTICATE PLAIN\r\n")
+	testSasl(t, c, &w, "AUTHENTICATE", "+", "AUTHENTICATE AHN0ZXZlAHdyb25n\r\n")
+	testSasl(t, c, &w, "904", ":SASL authentication failed", "CAP END\r\n")
+}
+
+func TestSaslUnsupported(t *testing.T) {
+	var w mockWriter
+	c := newCapState(nil)
+	c.useSasl("steve", "hunter2")
+
+	testCap(t, c, &w, "LS :multi-prefix", "CAP END\r\n")
+}
+
+func testSasl(t *testing.T, c *capState, w *mockWriter, typ, data, want string) {
+	r := &irc.Request{Type: typ, Target: "*", Data: data}
+
+	if typ == "AUTHENTICATE" {
+		c.onAuthenticate(w, r)
+	} else {
+		c.onSaslResult(w, r)
+	}
+
+	have := w.String()
+	w.Reset()
+
+	if want != have {
+		t.Fatalf("SASL reply mismatch for %s %q;\nwant: %q\nhave: %q", typ, data, want, have)
+	}
+}
@@ -0,0 +1,162 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/monkeybird/autimaat/app/util"
+	"github.com/monkeybird/autimaat/irc"
+)
+
+// channelSet keeps track of the channels the bot is in. This allows it to
+// rejoin all of them after a reconnect, not just the ones defined in the
+// profile.
+//
+// Channels joined at runtime through the join command are saved to disk,
+// so they are restored after a full restart as well. They are forgotten
+// once the bot is told to leave them through the part command.
+type channelSet struct {
+	m       sync.Mutex
+	file    string
+	runtime []irc.Channel
+	current map[string]irc.Channel
+}
+
+// newChannelSet creates a new channel set, persisted in the given file.
+// Any channels previously saved to it, are loaded.
+func newChannelSet(file string) *channelSet {
+	cs := &channelSet{
+		file:    file,
+		current: make(map[string]irc.Channel),
+	}
+
+	err := util.ReadFile(file, &cs.runtime, false)
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("[admin] Load channels:", err)
+	}
+
+	return cs
+}
+
+// Add adds the given channel to the set of runtime channels.
+func (cs *channelSet) Add(ch irc.Channel) {
+	cs.m.Lock()
+	defer cs.m.Unlock()
+
+	if idx := indexChannel(cs.runtime, ch.Name); idx > -1 {
+		cs.runtime[idx] = ch
+	} else {
+		cs.runtime = append(cs.runtime, ch)
+	}
+
+	cs.save()
+}
+
+// Remove removes the given channel from the set of runtime channels.
+func (cs *channelSet) Remove(name string) {
+	cs.m.Lock()
+	defer cs.m.Unlock()
+
+	delete(cs.current, strings.ToLower(name))
+
+	idx := indexChannel(cs.runtime, name)
+	if idx == -1 {
+		return
+	}
+
+	copy(cs.runtime[idx:], cs.runtime[idx+1:])
+	cs.runtime = cs.runtime[:len(cs.runtime)-1]
+	cs.save()
+}
+
+// Joined marks the given channel as one the bot is currently in.
+func (cs *channelSet) Joined(name string) {
+	cs.m.Lock()
+	defer cs.m.Unlock()
+
+	ch := irc.Channel{Name: name}
+	if idx := indexChannel(cs.runtime, name); idx > -1 {
+		ch = cs.runtime[idx]
+	}
+
+	cs.current[strings.ToLower(name)] = ch
+}
+
+// Left marks the given channel as one the bot is no longer in.
+func (cs *channelSet) Left(name string) {
+	cs.m.Lock()
+	delete(cs.current, strings.ToLower(name))
+	cs.m.Unlock()
+}
+
+// Has returns true if the bot is currently in the given channel.
+func (cs *channelSet) Has(name string) bool {
+	cs.m.Lock()
+	_, ok := cs.current[strings.ToLower(name)]
+	cs.m.Unlock()
+	return ok
+}
+
+// List returns all channels the bot should be in. These are the given
+// channels from the profile, the runtime channels and any other channels
+// the bot is currently in. Each channel is listed only once.
+func (cs *channelSet) List(defaults []irc.Channel) []irc.Channel {
+	cs.m.Lock()
+	defer cs.m.Unlock()
+
+	var out []irc.Channel
+
+	add := func(ch irc.Channel) {
+		if indexChannel(out, ch.Name) == -1 {
+			out = append(out, ch)
+		}
+	}
+
+	for _, ch := range defaults {
+		add(ch)
+	}
+
+	for _, ch := range cs.runtime {
+		add(ch)
+	}
+
+	names := make([]string, 0, len(cs.current))
+	for name := range cs.current {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		add(cs.current[name])
+	}
+
+	return out
+}
+
+// save writes the runtime channels to disk.
+// This expects the lock to be held.
+func (cs *channelSet) save() {
+	err := util.WriteFile(cs.file, cs.runtime, false)
+	if err != nil {
+		log.Println("[admin] Save channels:", err)
+	}
+}
+
+// indexChannel returns the index of the channel with the given name.
+// Returns -1 if it is not in the list. Channel names are compared
+// case-insensitively.
+func indexChannel(list []irc.Channel, name string) int {
+	for i, ch := range list {
+		if strings.EqualFold(ch.Name, name) {
+			return i
+		}
+	}
+
+	return -1
+}
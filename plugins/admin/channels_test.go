@@ -0,0 +1,71 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd/cmdtest"
+)
+
+func TestRejoin(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+	prof.WhitelistAdd(cmdtest.Mask)
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	// Initial login.
+	testRejoin(t, &p, "#test_channel")
+
+	// Join some channels at runtime. One through a command, the other
+	// by other means.
+	var w mockWriter
+	cmdtest.Run(t, p.cmd, cmdtest.NewRequest(cmdtest.Mask, "steve", "!join #extra"))
+	dispatch(&p, &w, &irc.Request{SenderName: prof.Nickname(), Type: "JOIN", Target: "#extra"})
+	dispatch(&p, &w, &irc.Request{SenderName: prof.Nickname(), Type: "JOIN", Target: "#invited"})
+	dispatch(&p, &w, &irc.Request{SenderName: "someone", Type: "JOIN", Target: "#other"})
+
+	// After a reconnect, all of them should be rejoined.
+	testRejoin(t, &p, "#test_channel", "#extra", "#invited")
+
+	// Channels we were kicked from are not rejoined, unless they are
+	// defined in the profile or were joined through a command.
+	dispatch(&p, &w, &irc.Request{SenderName: "op", Type: "KICK", Target: "#invited",
+		Data: prof.Nickname() + " :doei"})
+	cmdtest.Run(t, p.cmd, cmdtest.NewRequest(cmdtest.Mask, "steve", "!part #test_channel"))
+	testRejoin(t, &p, "#test_channel", "#extra")
+
+	// After a restart, the runtime channels should be restored.
+	var q plugin
+	q.Load(prof)
+	defer q.Unload(prof)
+
+	testRejoin(t, &q, "#test_channel", "#extra")
+
+	cmdtest.Run(t, p.cmd, cmdtest.NewRequest(cmdtest.Mask, "steve", "!part #extra"))
+	q.Load(prof)
+	testRejoin(t, &q, "#test_channel")
+}
+
+// testRejoin simulates a login and ensures the given channels are joined.
+func testRejoin(t *testing.T, p *plugin, want ...string) {
+	var w mockWriter
+	dispatch(p, &w, &irc.Request{SenderName: "irc.example.com", Type: "422"})
+
+	var have []string
+	for _, line := range strings.Split(w.String(), "\r\n") {
+		if strings.HasPrefix(line, "JOIN ") {
+			have = append(have, line[5:])
+		}
+	}
+
+	if !reflect.DeepEqual(want, have) {
+		t.Fatalf("rejoin mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
@@ -0,0 +1,134 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/monkeybird/autimaat/app/logger"
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/proto"
+)
+
+// chatLog writes readable chat logs for each channel. It keeps track
+// of the channels in which users have been seen, so nick changes end
+// up in the right logs.
+type chatLog struct {
+	m       sync.Mutex
+	log     *logger.ChannelLog
+	members map[string]map[string]bool // Nick => channels.
+}
+
+// newChatLog creates a chat log which writes to the given directory.
+func newChatLog(dir string) *chatLog {
+	return &chatLog{
+		log:     logger.NewChannelLog(dir),
+		members: make(map[string]map[string]bool),
+	}
+}
+
+// Close closes all open log files.
+func (cl *chatLog) Close() {
+	cl.log.Close()
+}
+
+// Log writes the given request to the appropriate channel logs, if it
+// is a channel message, join, part or nick change.
+func (cl *chatLog) Log(r *irc.Request) {
+	cl.m.Lock()
+	defer cl.m.Unlock()
+
+	switch r.Type {
+	case "PRIVMSG":
+		if !r.FromChannel() {
+			return
+		}
+
+		cl.join(r.SenderName, r.Target)
+
+		if cmd, msg, ok := proto.ParseCtcp(r.Data); ok {
+			if cmd == "ACTION" {
+				cl.printf(r.Target, "* %s %s", r.SenderName, msg)
+			}
+			return
+		}
+
+		cl.printf(r.Target, "<%s> %s", r.SenderName, r.Data)
+
+	case "JOIN":
+		cl.join(r.SenderName, r.Target)
+		cl.printf(r.Target, "--> %s (%s) has joined %s", r.SenderName, r.SenderMask, r.Target)
+
+	case "PART":
+		cl.part(r.SenderName, r.Target)
+
+		if len(r.Data) > 0 {
+			cl.printf(r.Target, "<-- %s (%s) has left %s (%s)", r.SenderName, r.SenderMask, r.Target, r.Data)
+		} else {
+			cl.printf(r.Target, "<-- %s (%s) has left %s", r.SenderName, r.SenderMask, r.Target)
+		}
+
+	case "KICK":
+		if victim := r.Arg(0); len(victim) > 0 {
+			cl.part(victim, r.Target)
+		}
+
+	case "QUIT":
+		delete(cl.members, strings.ToLower(r.SenderName))
+
+	case "NICK":
+		// Depending on how the server formats the message, the new
+		// nick is either the target or the message.
+		nick := r.Data
+		if len(nick) == 0 {
+			nick = r.Target
+		}
+
+		old := strings.ToLower(r.SenderName)
+		channels := cl.members[old]
+		delete(cl.members, old)
+
+		for channel := range channels {
+			cl.join(nick, channel)
+			cl.printf(channel, "--- %s is now known as %s", r.SenderName, nick)
+		}
+	}
+}
+
+// join records that the given user is in the given channel. The caller
+// must hold the lock.
+func (cl *chatLog) join(nick, channel string) {
+	nick = strings.ToLower(nick)
+
+	set, ok := cl.members[nick]
+	if !ok {
+		set = make(map[string]bool)
+		cl.members[nick] = set
+	}
+
+	set[strings.ToLower(channel)] = true
+}
+
+// part records that the given user has left the given channel. The
+// caller must hold the lock.
+func (cl *chatLog) part(nick, channel string) {
+	nick = strings.ToLower(nick)
+
+	if set, ok := cl.members[nick]; ok {
+		delete(set, strings.ToLower(channel))
+		if len(set) == 0 {
+			delete(cl.members, nick)
+		}
+	}
+}
+
+// printf writes a line to the log of the given channel.
+func (cl *chatLog) printf(channel, format string, argv ...interface{}) {
+	err := cl.log.Printf(channel, format, argv...)
+	if err != nil {
+		log.Println("[admin] Channel log:", err)
+	}
+}
@@ -0,0 +1,81 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/monkeybird/autimaat/irc"
+)
+
+func TestChatLog(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+	prof.SetChannelLogging(true)
+
+	var p plugin
+	p.Load(prof)
+
+	for _, r := range []irc.Request{
+		{Type: "JOIN", SenderName: "steve", SenderMask: "~steve@example.com", Target: "#een"},
+		{Type: "JOIN", SenderName: "bob", SenderMask: "~bob@example.com", Target: "#Twee"},
+		{Type: "PRIVMSG", SenderName: "steve", Target: "#een", Data: "hallo"},
+		{Type: "PRIVMSG", SenderName: "bob", Target: "#twee", Data: "\x01ACTION zwaait\x01"},
+		{Type: "PRIVMSG", SenderName: "bob", Target: "steve", Data: "privé"},
+		{Type: "NICK", SenderName: "steve", Target: "stevie"},
+		{Type: "PART", SenderName: "bob", SenderMask: "~bob@example.com", Target: "#twee", Data: "doei"},
+	} {
+		r := r
+		dispatch(&p, &mockWriter{}, &r)
+	}
+
+	p.Unload(prof)
+
+	testChatLog(t, prof.Root(), "#een", ""+
+		"--> steve (~steve@example.com) has joined #een\n"+
+		"<steve> hallo\n"+
+		"--- steve is now known as stevie\n")
+
+	testChatLog(t, prof.Root(), "#twee", ""+
+		"--> bob (~bob@example.com) has joined #Twee\n"+
+		"* bob zwaait\n"+
+		"<-- bob (~bob@example.com) has left #twee (doei)\n")
+}
+
+func TestChatLogDisabled(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	p.Load(prof)
+
+	dispatch(&p, &mockWriter{}, &irc.Request{Type: "PRIVMSG", SenderName: "steve", Target: "#een", Data: "hallo"})
+	p.Unload(prof)
+
+	files, _ := filepath.Glob(filepath.Join(prof.Root(), "logs", "*", "*"))
+	if len(files) > 0 {
+		t.Fatalf("unexpected channel logs: %q", files)
+	}
+}
+
+// regTimestamp matches the time stamps in channel logs.
+var regTimestamp = regexp.MustCompile(`(?m)^\d\d:\d\d:\d\d `)
+
+func testChatLog(t *testing.T, root, channel, want string) {
+	files, err := filepath.Glob(filepath.Join(root, "logs", channel, "*.txt"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one log file for %q; have: %q, %v", channel, files, err)
+	}
+
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	have := regTimestamp.ReplaceAllString(string(data), "")
+	if want != have {
+		t.Fatalf("log mismatch for %q;\nwant: %q\nhave: %q", channel, want, have)
+	}
+}
@@ -0,0 +1,239 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd"
+	"github.com/monkeybird/autimaat/irc/cmd/cmdtest"
+)
+
+func TestSayAct(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	prof.WhitelistAdd(cmdtest.Mask)
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	p.channels.Joined("#test")
+
+	cmdtest.Check(t, p.cmd, "#test", "!say #test Hallo allemaal!",
+		"PRIVMSG #test :Hallo allemaal!\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!act #TEST zwaait naar iedereen",
+		"PRIVMSG #TEST :\x01ACTION zwaait naar iedereen\x01\r\n")
+
+	// Quotes and spacing in the message are kept as-is.
+	cmdtest.Check(t, p.cmd, "#test", `!say "#test" Een  "quote" hier`,
+		"PRIVMSG #test :Een  \"quote\" hier\r\n")
+	cmdtest.Check(t, p.cmd, "#test", `!act #test "zwaait  breed"`,
+		"PRIVMSG #test :\x01ACTION zwaait  breed\x01\r\n")
+
+	// The bot is not in this channel.
+	want := "PRIVMSG steve :" + fmt.Sprintf(TextNotInChannel, "#other") + "\r\n"
+	cmdtest.Check(t, p.cmd, "#test", "!say #other hallo", want)
+	cmdtest.Check(t, p.cmd, "#test", "!act #other zwaait", want)
+}
+
+func TestModes(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	prof.WhitelistAdd(cmdtest.Mask)
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	for _, tt := range []struct {
+		name string
+		mode string
+	}{
+		{TextOpName, "+o"},
+		{TextDeopName, "-o"},
+		{TextVoiceName, "+v"},
+		{TextDevoiceName, "-v"},
+	} {
+		// Explicit channel.
+		cmdtest.Check(t, p.cmd, "steve", "!"+tt.name+" bob #other",
+			"MODE #other "+tt.mode+" bob\r\n")
+
+		// Implicit channel.
+		cmdtest.Check(t, p.cmd, "#test", "!"+tt.name+" bob",
+			"MODE #test "+tt.mode+" bob\r\n")
+
+		// No channel at all.
+		cmdtest.Check(t, p.cmd, "steve", "!"+tt.name+" bob",
+			"PRIVMSG steve :"+fmt.Sprintf(cmd.TextMissingParameters, tt.name)+"\r\n")
+	}
+
+	cmdtest.Check(t, p.cmd, "#test", "!n00p",
+		"MODE #test -o "+prof.Nickname()+"\r\n")
+	cmdtest.Check(t, p.cmd, "steve", "!n00p #other",
+		"MODE #other -o "+prof.Nickname()+"\r\n")
+}
+
+func TestKickBan(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	prof.WhitelistAdd(cmdtest.Mask)
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	cmdtest.Check(t, p.cmd, "#test", "!kick #test bob",
+		"KICK #test bob\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!kick #test bob ga   eens weg",
+		"KICK #test bob :ga   eens weg\r\n")
+	cmdtest.Check(t, p.cmd, "#test", `!kick #test "bob" "ga weg"`,
+		"KICK #test bob :ga weg\r\n")
+
+	// Bans by mask are used verbatim.
+	cmdtest.Check(t, p.cmd, "#test", "!ban #test *!*@evil.example.com",
+		"MODE #test +b *!*@evil.example.com\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!ban #test bob!*@*",
+		"MODE #test +b bob!*@*\r\n")
+
+	// Bans by nickname use the host, if known. The user is kicked too.
+	cmdtest.Check(t, p.cmd, "#test", "!ban #test bob",
+		"MODE #test +b bob!*@*\r\nKICK #test bob\r\n")
+
+	var w mockWriter
+	dispatch(&p, &w, &irc.Request{SenderName: "bob", SenderMask: "~bob@host.example.com",
+		Type: "PRIVMSG", Target: "#test", Data: "hoi"})
+	dispatch(&p, &w, &irc.Request{SenderName: "bob", SenderMask: "~bob@host.example.com",
+		Type: "NICK", Target: "bobby"})
+
+	cmdtest.Check(t, p.cmd, "#test", "!ban #test BOBBY doei",
+		"MODE #test +b *!*@host.example.com\r\nKICK #test BOBBY :doei\r\n")
+}
+
+func TestRaw(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	prof.WhitelistAdd(cmdtest.Mask)
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	cmdtest.Check(t, p.owner, "steve", "!raw PRIVMSG #test :hallo  daar",
+		"PRIVMSG #test :hallo  daar\r\n")
+
+	want := "PRIVMSG steve :" + TextRawInvalid + "\r\n"
+	cmdtest.Check(t, p.owner, "steve", "!raw PRIVMSG #test :hallo\r\nQUIT :doei", want)
+	cmdtest.Check(t, p.owner, "steve", "!raw PRIVMSG #test :hallo\nQUIT", want)
+	cmdtest.Check(t, p.owner, "steve", "!raw PRIVMSG #test :hallo\rQUIT", want)
+}
+
+func TestIgnoreCommands(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	prof.WhitelistAdd(cmdtest.Mask)
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	irc.Support.Reset()
+	defer irc.Support.Reset()
+
+	// Without server support, only the local list is updated.
+	cmdtest.Check(t, p.owner, "steve", "!ignore ~troll@*",
+		"PRIVMSG steve :"+fmt.Sprintf(TextIgnoreDisplay, "~troll@*")+"\r\n")
+
+	if !prof.IsIgnored("bob!~troll@example.com") {
+		t.Fatalf("mask was not added to the ignore list")
+	}
+
+	irc.Support.Parse("SILENCE=15 :are supported by this server")
+
+	cmdtest.Check(t, p.owner, "steve", "!ignore bob!*@*",
+		"SILENCE +bob!*@*\r\nPRIVMSG steve :"+fmt.Sprintf(TextIgnoreDisplay, "bob!*@*")+"\r\n")
+	cmdtest.Check(t, p.owner, "steve", "!unignore ~troll@*",
+		"SILENCE -*!~troll@*\r\nPRIVMSG steve :"+fmt.Sprintf(TextUnignoreDisplay, "~troll@*")+"\r\n")
+	cmdtest.Check(t, p.owner, "steve", "!ignores",
+		"PRIVMSG steve :"+fmt.Sprintf(TextIgnoreListDisplay, "bob!*@*")+"\r\n")
+
+	cmdtest.Check(t, p.owner, "steve", "!unignore bob!*@*",
+		"SILENCE -bob!*@*\r\nPRIVMSG steve :"+fmt.Sprintf(TextUnignoreDisplay, "bob!*@*")+"\r\n")
+	cmdtest.Check(t, p.owner, "steve", "!ignores",
+		"PRIVMSG steve :"+TextIgnoreListEmpty+"\r\n")
+}
+
+func TestAwayBack(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	prof.WhitelistAdd(cmdtest.Mask)
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	cmdtest.Check(t, p.cmd, "steve", "!away even koffie halen",
+		"AWAY :even koffie halen\r\nPRIVMSG steve :"+
+			fmt.Sprintf(TextAwayDisplay, "even koffie halen")+"\r\n")
+
+	if have := prof.AwayMessage(); have != "even koffie halen" {
+		t.Fatalf("away message mismatch; have: %q", have)
+	}
+
+	// The away status is restored on login.
+	var w mockWriter
+	p.onFinalizeLogin(&w, &irc.Request{})
+	if have := w.String(); !strings.HasSuffix(have, "AWAY :even koffie halen\r\n") {
+		t.Fatalf("expected away status to be restored; have: %q", have)
+	}
+
+	cmdtest.Check(t, p.cmd, "steve", "!back",
+		"AWAY\r\nPRIVMSG steve :"+TextBackDisplay+"\r\n")
+
+	if have := prof.AwayMessage(); have != "" {
+		t.Fatalf("expected away message to be cleared; have: %q", have)
+	}
+
+	w.Reset()
+	p.onFinalizeLogin(&w, &irc.Request{})
+	if strings.Contains(w.String(), "AWAY") {
+		t.Fatalf("unexpected away status after login: %q", w.String())
+	}
+
+	// Without a message, a default is used.
+	cmdtest.Check(t, p.cmd, "steve", "!away",
+		"AWAY :"+TextAwayDefault+"\r\nPRIVMSG steve :"+
+			fmt.Sprintf(TextAwayDisplay, TextAwayDefault)+"\r\n")
+}
+
+func TestPart(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	prof.WhitelistAdd(cmdtest.Mask)
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	cmdtest.Check(t, p.cmd, "steve", "!part #test", "PART #test\r\n")
+	cmdtest.Check(t, p.cmd, "steve", `!part "#test" Tot  ziens!`,
+		"PART #test :Tot  ziens!\r\n")
+}
+
+func TestVersion(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	// A private call is answered privately, not sent to the bot itself.
+	for _, target := range []string{"#test", prof.Nickname()} {
+		want := "PRIVMSG steve :"
+		if target[0] == '#' {
+			want = "PRIVMSG #test :"
+		}
+
+		r := cmdtest.NewRequest(cmdtest.Mask, target, "!"+TextVersionName)
+		if have := cmdtest.Run(t, p.cmd, r); !strings.HasPrefix(have, want) {
+			t.Fatalf("output mismatch for %s;\nwant: %q...\nhave: %q", target, want, have)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"strings"
+	"sync"
+)
+
+// MaxHosts defines the number of users for which a host is remembered.
+const MaxHosts = 4096
+
+// hostCache remembers the host of each user the bot has seen a message
+// from. This allows bans to target a user's host, when only their
+// nickname is known. It holds at most size entries. Once full, the user
+// who was seen least recently is forgotten first.
+type hostCache struct {
+	m     sync.RWMutex
+	hosts map[string]*hostEntry
+	size  int
+	seq   uint64 // Incremented for each update; orders the entries.
+}
+
+type hostEntry struct {
+	host string
+	seen uint64
+}
+
+// newHostCache creates a new, empty cache which holds at most size hosts.
+func newHostCache(size int) *hostCache {
+	if size <= 0 {
+		size = MaxHosts
+	}
+
+	return &hostCache{
+		hosts: make(map[string]*hostEntry),
+		size:  size,
+	}
+}
+
+// Seen records the host from the given hostmask for the given nickname.
+// The hostmask has the form: user@host
+func (hc *hostCache) Seen(nick, mask string) {
+	idx := strings.LastIndexByte(mask, '@')
+	if len(nick) == 0 || idx == -1 {
+		return
+	}
+
+	hc.m.Lock()
+	hc.set(strings.ToLower(nick), mask[idx+1:])
+	hc.m.Unlock()
+}
+
+// Renamed moves the host known for one nickname to another.
+func (hc *hostCache) Renamed(from, to string) {
+	hc.m.Lock()
+	defer hc.m.Unlock()
+
+	from = strings.ToLower(from)
+	if e, ok := hc.hosts[from]; ok {
+		delete(hc.hosts, from)
+		hc.set(strings.ToLower(to), e.host)
+	}
+}
+
+// set stores the host for the given nickname. If the cache is full, the
+// least recently seen entry is removed first. The caller must hold the
+// write lock.
+func (hc *hostCache) set(nick, host string) {
+	hc.seq++
+
+	if e, ok := hc.hosts[nick]; ok {
+		e.host, e.seen = host, hc.seq
+		return
+	}
+
+	if len(hc.hosts) >= hc.size {
+		hc.evict()
+	}
+
+	hc.hosts[nick] = &hostEntry{host: host, seen: hc.seq}
+}
+
+// evict removes the least recently seen entry. The caller must hold the
+// write lock.
+func (hc *hostCache) evict() {
+	var oldest string
+	var oldestSeen uint64
+
+	for nick, e := range hc.hosts {
+		if len(oldest) == 0 || e.seen < oldestSeen {
+			oldest, oldestSeen = nick, e.seen
+		}
+	}
+
+	delete(hc.hosts, oldest)
+}
+
+// BanMask returns a ban mask for the given nickname. If the user's host
+// is known, the mask matches any user on that host: *!*@host. Otherwise,
+// it matches the nickname: nick!*@*
+func (hc *hostCache) BanMask(nick string) string {
+	hc.m.RLock()
+	defer hc.m.RUnlock()
+
+	if e, ok := hc.hosts[strings.ToLower(nick)]; ok {
+		return "*!*@" + e.host
+	}
+
+	return nick + "!*@*"
+}
+
+// isMask returns true if v looks like a hostmask, rather than a nickname.
+func isMask(v string) bool {
+	return strings.ContainsAny(v, "!@*")
+}
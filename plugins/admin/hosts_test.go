@@ -0,0 +1,37 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import "testing"
+
+func TestHostCache(t *testing.T) {
+	hc := newHostCache(2)
+	hc.Seen("bob", "~bob@a.example.com")
+	hc.Seen("steve", "~steve@b.example.com")
+
+	testBanMask(t, hc, "Bob", "*!*@a.example.com")
+	testBanMask(t, hc, "alice", "alice!*@*")
+
+	hc.Renamed("steve", "stevie")
+	testBanMask(t, hc, "steve", "steve!*@*")
+	testBanMask(t, hc, "stevie", "*!*@b.example.com")
+
+	// The cache is full. Bob was seen least recently, so he goes first.
+	hc.Seen("alice", "~alice@c.example.com")
+	testBanMask(t, hc, "bob", "bob!*@*")
+	testBanMask(t, hc, "stevie", "*!*@b.example.com")
+	testBanMask(t, hc, "alice", "*!*@c.example.com")
+
+	if len(hc.hosts) != 2 {
+		t.Fatalf("cache size mismatch;\nwant: 2\nhave: %d", len(hc.hosts))
+	}
+}
+
+func testBanMask(t *testing.T, hc *hostCache, nick, want string) {
+	t.Helper()
+
+	if have := hc.BanMask(nick); have != want {
+		t.Fatalf("ban mask mismatch for %q;\nwant: %q\nhave: %q", nick, want, have)
+	}
+}
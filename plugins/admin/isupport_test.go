@@ -0,0 +1,37 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"testing"
+
+	"github.com/monkeybird/autimaat/irc"
+)
+
+func TestISupport(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	var w mockWriter
+	dispatch(&p, &w, &irc.Request{Type: "001", Target: prof.Nickname()})
+	dispatch(&p, &w, &irc.Request{
+		Type:   "005",
+		Target: prof.Nickname(),
+		Data:   "NICKLEN=30 MODES=6 SILENCE=15 :are supported by this server",
+	})
+
+	if irc.Support.NickLen() != 30 || irc.Support.Modes() != 6 || !irc.Support.Has("SILENCE") {
+		t.Fatalf("ISUPPORT tokens not recorded: %v", irc.Support.Tokens())
+	}
+
+	// A new login starts over.
+	dispatch(&p, &w, &irc.Request{Type: "001", Target: prof.Nickname()})
+
+	if irc.Support.Has("NICKLEN") {
+		t.Fatalf("ISUPPORT tokens not reset: %v", irc.Support.Tokens())
+	}
+}
@@ -0,0 +1,167 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd/cmdtest"
+	"github.com/monkeybird/autimaat/plugins"
+)
+
+func TestMembers(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+	defer irc.Members.Reset()
+
+	var w mockWriter
+	dispatch(&p, &w, &irc.Request{Type: "001", Target: prof.Nickname()})
+
+	// We join a channel and ask who is there.
+	dispatch(&p, &w, &irc.Request{SenderName: prof.Nickname(), Type: "JOIN", Target: "#test"})
+	if have := w.String(); have != "NAMES #test\r\n" {
+		t.Fatalf("output mismatch;\nwant: %q\nhave: %q", "NAMES #test\r\n", have)
+	}
+
+	for _, data := range []string{
+		"= #test :" + prof.Nickname() + " @steve",
+		"= #test :+bob alice",
+		"#test :End of /NAMES list.",
+	} {
+		typ := "353"
+		if data[0] == '#' {
+			typ = "366"
+		}
+
+		dispatch(&p, &w, &irc.Request{SenderName: "irc.example.com", Type: typ,
+			Target: "irc.example.com", Data: data})
+	}
+
+	testMembers(t, "#test", "alice", "+bob", prof.Nickname(), "@steve")
+
+	dispatch(&p, &w, &irc.Request{SenderName: "carol", Type: "JOIN", Target: "#test"})
+	dispatch(&p, &w, &irc.Request{SenderName: "alice", Type: "PART", Target: "#test"})
+	dispatch(&p, &w, &irc.Request{SenderName: "steve", Type: "KICK", Target: "#test", Data: "bob :doei"})
+	dispatch(&p, &w, &irc.Request{SenderName: "carol", Type: "NICK", Target: "caroline"})
+	testMembers(t, "#test", prof.Nickname(), "caroline", "@steve")
+
+	dispatch(&p, &w, &irc.Request{SenderName: "steve", Type: "QUIT", Data: "tot ziens"})
+	testMembers(t, "#test", prof.Nickname(), "caroline")
+
+	// Away status is tracked through away-notify.
+	dispatch(&p, &w, &irc.Request{SenderName: "caroline", Type: "AWAY", Data: "lunch"})
+	if msg, ok := irc.Members.Away("caroline"); !ok || msg != "lunch" {
+		t.Fatalf("away mismatch; have: %q %v", msg, ok)
+	}
+
+	dispatch(&p, &w, &irc.Request{SenderName: "caroline", Type: "AWAY"})
+	if _, ok := irc.Members.Away("caroline"); ok {
+		t.Fatalf("expected caroline to be back")
+	}
+
+	// Status changes have the list fetched again.
+	w.Reset()
+	dispatch(&p, &w, &irc.Request{SenderName: "op", Type: "MODE", Target: "#test", Data: "+o caroline"})
+	dispatch(&p, &w, &irc.Request{SenderName: "op", Type: "MODE", Target: "#test", Data: "+m"})
+	if have := w.String(); have != "NAMES #test\r\n" {
+		t.Fatalf("output mismatch;\nwant: %q\nhave: %q", "NAMES #test\r\n", have)
+	}
+
+	// We leave.
+	dispatch(&p, &w, &irc.Request{SenderName: prof.Nickname(), Type: "PART", Target: "#test"})
+	if _, ok := irc.Members.List("#test"); ok {
+		t.Fatalf("expected #test to be forgotten")
+	}
+}
+
+func TestMembersOwnNick(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+	prof.WhitelistAdd(cmdtest.Mask)
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+	defer irc.Members.Reset()
+
+	var w mockWriter
+	dispatch(&p, &w, &irc.Request{SenderName: prof.Nickname(), Type: "JOIN", Target: "#test"})
+	dispatch(&p, &w, &irc.Request{Type: "353", Data: "= #test :" + prof.Nickname() + " @steve"})
+	dispatch(&p, &w, &irc.Request{Type: "366", Data: "#test :End of /NAMES list."})
+
+	// An operator changes our nick. The profile is updated before the
+	// server echoes the change.
+	cmdtest.Check(t, p.cmd, "#test", "!"+TextNickName+" nieuw", "NICK nieuw\r\n")
+	dispatch(&p, &w, &irc.Request{SenderName: "bot_name", Type: "NICK", Target: "nieuw"})
+
+	testMembers(t, "#test", "nieuw", "@steve")
+}
+
+func TestMembersOrder(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	plugins.Load(prof)
+	defer plugins.Unload(prof)
+	defer irc.Members.Reset()
+
+	var w syncWriter
+
+	// Each message is handled in a separate goroutine by the plugin's
+	// Dispatch method. The end of the listing must still not overtake
+	// the names in it.
+	for i := 0; i < 100; i++ {
+		channel := fmt.Sprintf("#test%d", i)
+		for _, r := range []irc.Request{
+			{Type: "353", Data: "= " + channel + " :@steve +bob"},
+			{Type: "353", Data: "= " + channel + " :alice"},
+			{Type: "366", Data: channel + " :End of /NAMES list."},
+		} {
+			r := r
+			plugins.Dispatch(&w, &r)
+		}
+
+		testMembers(t, channel, "alice", "+bob", "@steve")
+	}
+}
+
+// syncWriter is a mockWriter which can be written to from multiple
+// goroutines.
+type syncWriter struct {
+	m sync.Mutex
+	mockWriter
+}
+
+func (sw *syncWriter) Write(p []byte) (int, error) {
+	sw.m.Lock()
+	defer sw.m.Unlock()
+	return sw.mockWriter.Write(p)
+}
+
+// dispatch passes the given request to the plugin, the same way the plugins
+// package does.
+func dispatch(p *plugin, w irc.ResponseWriter, r *irc.Request) {
+	p.Observe(w, r)
+	p.Dispatch(w, r)
+}
+
+// testMembers ensures the given channel has the given members, written
+// with their prefixes.
+func testMembers(t *testing.T, channel string, want ...string) {
+	var have []string
+
+	list, _ := irc.Members.List(channel)
+	for _, m := range list {
+		have = append(have, m.Prefix+m.Nick)
+	}
+
+	if !reflect.DeepEqual(want, have) {
+		t.Fatalf("member mismatch for %s;\nwant: %q\nhave: %q", channel, want, have)
+	}
+}
@@ -0,0 +1,95 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/proto"
+)
+
+// NickCheckInterval defines how often the bot checks if its preferred
+// nickname has become available, while it is using another one.
+const NickCheckInterval = time.Minute * 2
+
+// pollNick periodically checks if the preferred nickname can be
+// reclaimed, until quit is closed.
+func (p *plugin) pollNick(quit chan struct{}) {
+	for {
+		select {
+		case <-quit:
+			return
+
+		case <-time.After(NickCheckInterval):
+			if c := irc.Connection; c != nil {
+				p.checkNick(c)
+			}
+		}
+	}
+}
+
+// checkNick asks the server if the preferred nickname is in use. This
+// does nothing if we already have it. The answer is handled by onIsOn.
+func (p *plugin) checkNick(w irc.ResponseWriter) {
+	want := p.profile.PreferredNickname()
+	if p.profile.IsNick(want) {
+		return
+	}
+
+	p.m.Lock()
+	p.nickQuery = true
+	p.m.Unlock()
+
+	proto.IsOn(w, want)
+}
+
+// onIsOn handles the answer to our ISON query. It lists the nicknames
+// which are in use. If the preferred nickname is not among them, we
+// change to it and identify with nickserv, if we have a password.
+func (p *plugin) onIsOn(w irc.ResponseWriter, r *irc.Request) {
+	p.m.Lock()
+	query := p.nickQuery
+	p.nickQuery = false
+	p.m.Unlock()
+
+	want := p.profile.PreferredNickname()
+	if !query || p.profile.IsNick(want) {
+		return
+	}
+
+	for _, name := range strings.Fields(r.Data) {
+		if strings.EqualFold(name, want) {
+			return
+		}
+	}
+
+	p.m.Lock()
+	p.nickReclaim = true
+	p.m.Unlock()
+
+	log.Println("[admin] Reclaiming nick:", want)
+
+	if pass := p.profile.NickservPassword(); len(pass) > 0 {
+		proto.Nick(w, want, pass)
+	} else {
+		proto.Nick(w, want)
+	}
+}
+
+// onNick handles nickname changes. If it is our own, the new name is
+// stored in the profile.
+func (p *plugin) onNick(r *irc.Request) {
+	if !p.profile.IsNick(r.SenderName) {
+		return
+	}
+
+	p.m.Lock()
+	p.nickReclaim = false
+	p.m.Unlock()
+
+	p.profile.SetNickname(r.Target)
+}
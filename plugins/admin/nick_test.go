@@ -0,0 +1,102 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"testing"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd/cmdtest"
+)
+
+func TestReclaimNick(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	// We have the nick we want.
+	testNick(t, &p, "checkNick", nil, "")
+
+	// Our nick is taken during login.
+	testNick(t, &p, "433", &irc.Request{Type: "433"}, "NICK bot_name_\r\n")
+
+	if prof.Nickname() != "bot_name_" || prof.PreferredNickname() != "bot_name" {
+		t.Fatalf("nick mismatch; have: %q, preferred: %q",
+			prof.Nickname(), prof.PreferredNickname())
+	}
+
+	// It is still taken.
+	testNick(t, &p, "checkNick", nil, "ISON bot_name\r\n")
+	testNick(t, &p, "303", &irc.Request{Type: "303", Target: "bot_name_", Data: "bot_name"}, "")
+
+	// It became available, but someone else beat us to it.
+	testNick(t, &p, "checkNick", nil, "ISON bot_name\r\n")
+	testNick(t, &p, "303", &irc.Request{Type: "303", Target: "bot_name_"}, "NICK bot_name\r\n")
+	testNick(t, &p, "433", &irc.Request{Type: "433"}, "")
+
+	if prof.Nickname() != "bot_name_" {
+		t.Fatalf("nick mismatch; want: %q, have: %q", "bot_name_", prof.Nickname())
+	}
+
+	// Unsolicited ISON replies are ignored.
+	testNick(t, &p, "303", &irc.Request{Type: "303", Target: "bot_name_"}, "")
+
+	// It became available and we identify with nickserv.
+	prof.SetNickservPassword("geheim")
+	testNick(t, &p, "checkNick", nil, "ISON bot_name\r\n")
+	testNick(t, &p, "303", &irc.Request{Type: "303", Target: "bot_name_"},
+		"NICK bot_name\r\nPRIVMSG nickserv :IDENTIFY geheim\r\n")
+	testNick(t, &p, "NICK", &irc.Request{Type: "NICK", SenderName: "bot_name_", Target: "bot_name"}, "")
+
+	if prof.Nickname() != "bot_name" {
+		t.Fatalf("nick mismatch; want: %q, have: %q", "bot_name", prof.Nickname())
+	}
+
+	// We have our nick back, so there is nothing left to check.
+	testNick(t, &p, "checkNick", nil, "")
+}
+
+func TestOperatorNick(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+	prof.WhitelistAdd(cmdtest.Mask)
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	// The profile is updated before the server echoes the change.
+	cmdtest.Check(t, p.cmd, "#test", "!"+TextNickName+" nieuw", "NICK nieuw\r\n")
+	testNick(t, &p, "NICK", &irc.Request{Type: "NICK", SenderName: "bot_name",
+		SenderMask: "~bot@bot.example.com", Target: "nieuw"}, "")
+
+	if prof.Nickname() != "nieuw" || prof.PreferredNickname() != "nieuw" {
+		t.Fatalf("nick mismatch; have: %q, preferred: %q",
+			prof.Nickname(), prof.PreferredNickname())
+	}
+
+	// Our host moved along with the nick.
+	testBanMask(t, p.hosts, "nieuw", "*!*@bot.example.com")
+	testBanMask(t, p.hosts, "bot_name", "bot_name!*@*")
+
+	// We were not trying to reclaim anything.
+	testNick(t, &p, "checkNick", nil, "")
+}
+
+// testNick dispatches the given request, or runs a nick check if it is
+// nil, and compares the output.
+func testNick(t *testing.T, p *plugin, name string, r *irc.Request, want string) {
+	var w mockWriter
+
+	if r == nil {
+		p.checkNick(&w)
+	} else {
+		dispatch(p, &w, r)
+	}
+
+	if have := w.String(); want != have {
+		t.Fatalf("output mismatch for %s;\nwant: %q\nhave: %q", name, want, have)
+	}
+}
@@ -6,11 +6,13 @@
 package admin
 
 import (
+	"fmt"
 	"log"
-	"math"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -28,7 +30,24 @@ var lastRestart = time.Now()
 func init() { plugins.Register(&plugin{}) }
 
 type plugin struct {
-	cmd *cmd.Set
+	cmd      *cmd.Set
+	owner    *cmd.Set
+	caps     *capState
+	channels *channelSet
+	hosts    *hostCache
+	chatlog  *chatLog
+
+	// Tracks the current connection. The number of logins tells us
+	// how often the bot has reconnected.
+	m           sync.Mutex
+	connectedAt time.Time
+	logins      int
+
+	// Tracks attempts to reclaim the preferred nickname.
+	nickQuery   bool // An ISON query is pending.
+	nickReclaim bool // A NICK change to the preferred name is pending.
+	quitOnce    sync.Once
+	quit        chan struct{}
 
 	// This will store the bot's profile, but only as a subset of
 	// the full interface. We only need access to some parts.
@@ -36,15 +55,27 @@ type plugin struct {
 		WhitelistAdd(string)
 		WhitelistRemove(string)
 		Whitelist() []string
+		IgnoreAdd(string)
+		IgnoreRemove(string)
+		Ignores() []string
 		Logging() bool
 		SetLogging(bool)
+		ChannelLogging() bool
+		SetChannelLogging(bool)
+		AwayMessage() string
+		SetAwayMessage(string)
 
 		Nickname() string
 		SetNickname(string)
+		PreferredNickname() string
+		HasPreferredNickname() bool
+		SetPreferredNickname(string)
 		NickservPassword() string
 		SetNickservPassword(string)
 
 		Channels() []irc.Channel
+		ChanServJoin() bool
+		IsNick(string) bool
 	}
 }
 
@@ -52,15 +83,22 @@ type plugin struct {
 // which may be required.
 func (p *plugin) Load(prof irc.Profile) error {
 	p.profile = prof
+	p.hosts = newHostCache(MaxHosts)
+	p.chatlog = newChatLog(filepath.Join(prof.Root(), "logs"))
+	p.channels = newChannelSet(filepath.Join(prof.Root(), "channels.cfg"))
+	p.caps = newCapState(prof.Capabilities())
+	if prof.UseSasl() {
+		p.caps.useSasl(prof.SaslUsername(), prof.SaslPassword())
+	}
 	p.cmd = cmd.New(
-		prof.CommandPrefix(),
+		prof.CommandPrefixes(),
 		prof.IsWhitelisted,
 	)
+	p.cmd.SetAcceptNotice(prof.NoticeCommands())
 
-	// Two aliases for the same command. Can be invoked through
-	// !help or !<bot nickname>
-	p.cmd.Bind(TextHelpName, false, p.cmdHelp)
-	p.cmd.Bind(prof.Nickname(), false, p.cmdHelp)
+	// Can be invoked through !help or !<bot nickname>
+	p.cmd.Bind(TextHelpName, false, p.cmdHelp).
+		Alias(prof.Nickname())
 
 	p.cmd.Bind(TextNickName, true, p.cmdNick).
 		Add(TextNickNickName, true, cmd.RegAny).
@@ -72,54 +110,300 @@ func (p *plugin) Load(prof irc.Profile) error {
 		Add(TextJoinKeyName, false, cmd.RegAny)
 
 	p.cmd.Bind(TextPartName, true, p.cmdPart).
-		Add(TextPartChannelName, true, cmd.RegChannel)
+		Add(TextPartChannelName, true, cmd.RegChannel).
+		Add(TextPartReasonName, false, cmd.RegAny)
+
+	p.cmd.Bind(TextSayName, true, p.cmdSay).
+		Add(TextSayChannelName, true, cmd.RegChannel).
+		Add(TextSayMessageName, true, cmd.RegAny)
+
+	p.cmd.Bind(TextActName, true, p.cmdAct).
+		Add(TextActChannelName, true, cmd.RegChannel).
+		Add(TextActMessageName, true, cmd.RegAny)
+
+	p.cmd.Bind(TextKickName, true, p.cmdKick).
+		Add(TextKickChannelName, true, cmd.RegChannel).
+		Add(TextKickNickName, true, cmd.RegAny).
+		Add(TextKickReasonName, false, cmd.RegAny)
+
+	p.cmd.Bind(TextBanName, true, p.cmdBan).
+		Add(TextBanChannelName, true, cmd.RegChannel).
+		Add(TextBanMaskName, true, cmd.RegAny).
+		Add(TextBanReasonName, false, cmd.RegAny)
+
+	p.cmd.Bind(TextTopicName, true, p.cmdTopic).
+		Add(TextTopicChannelName, false, cmd.RegAny).
+		Add(TextTopicTextName, false, cmd.RegAny)
 
 	p.cmd.Bind(TextNoopName, true, p.cmdNoop).
 		Add(TextNoopChannelName, false, cmd.RegChannel)
 
+	for _, m := range []struct{ name, mode string }{
+		{TextOpName, "+o"},
+		{TextDeopName, "-o"},
+		{TextVoiceName, "+v"},
+		{TextDevoiceName, "-v"},
+	} {
+		p.cmd.Bind(m.name, true, p.cmdMode(m.name, m.mode)).
+			Add(TextModeNickName, true, cmd.RegAny).
+			Add(TextModeChannelName, false, cmd.RegChannel)
+	}
+
 	p.cmd.Bind(TextAuthListName, true, p.cmdAuthList)
 
-	p.cmd.Bind(TextAuthorizeName, true, p.cmdAuthorize).
+	p.cmd.Bind(TextLogName, true, p.cmdLog).
+		Add(TextLogValueName, false, cmd.RegBool)
+
+	p.cmd.Bind(TextChannelLogName, true, p.cmdChannelLog).
+		Add(TextLogValueName, false, cmd.RegBool)
+
+	p.cmd.Bind(TextAwayName, true, p.cmdAway).
+		Add(TextAwayMessageName, false, cmd.RegAny)
+
+	p.cmd.Bind(TextBackName, true, p.cmdBack)
+
+	p.cmd.Bind(TextVersionName, false, p.cmdVersion)
+
+	// These commands manage the whitelist or affect the bot as a whole.
+	// They are reserved for owners.
+	p.owner = cmd.New(
+		prof.CommandPrefixes(),
+		prof.IsOwner,
+	)
+	p.owner.SetAcceptNotice(prof.NoticeCommands())
+	plugins.Track(p, p.cmd, p.owner)
+
+	p.owner.Bind(TextAuthorizeName, true, p.cmdAuthorize).
 		Add(TextAuthorizeMaskName, true, cmd.RegAny)
 
-	p.cmd.Bind(TextDeauthorizeName, true, p.cmdDeauthorize).
+	p.owner.Bind(TextDeauthorizeName, true, p.cmdDeauthorize).
 		Add(TextDeauthorizeMaskName, true, cmd.RegAny)
 
-	p.cmd.Bind(TextLogName, true, p.cmdLog).
-		Add(TextLogValueName, false, cmd.RegBool)
+	p.owner.Bind(TextReloadName, true, p.cmdReload)
 
-	p.cmd.Bind(TextReloadName, true, p.cmdReload)
-	p.cmd.Bind(TextVersionName, false, p.cmdVersion)
+	p.owner.Bind(TextIgnoreName, true, p.cmdIgnore).
+		Add(TextIgnoreMaskName, true, cmd.RegAny)
+
+	p.owner.Bind(TextUnignoreName, true, p.cmdUnignore).
+		Add(TextIgnoreMaskName, true, cmd.RegAny)
+
+	p.owner.Bind(TextIgnoreListName, true, p.cmdIgnoreList)
+
+	p.owner.Bind(TextRawName, true, p.cmdRaw).
+		Add(TextRawMessageName, true, cmd.RegAny)
+
+	p.owner.Bind(TextPluginName, true, p.cmdPlugin).
+		Add(TextPluginNameName, true, cmd.RegAny).
+		Add(TextPluginStateName, false, cmd.RegBool)
+
+	p.owner.Bind(TextPluginsName, true, p.cmdPlugins)
 
+	p.quitOnce = sync.Once{}
+	p.quit = make(chan struct{})
+	go p.pollNick(p.quit)
+
+	return nil
+}
+
+// Reload reloads the plugin's configuration.
+func (p *plugin) Reload(prof irc.Profile) error {
+	p.cmd.SetPrefixes(prof.CommandPrefixes())
+	p.owner.SetPrefixes(prof.CommandPrefixes())
 	return nil
 }
 
 // Unload cleans the module up and unloads any internal resources.
 func (p *plugin) Unload(prof irc.Profile) error {
+	p.quitOnce.Do(func() {
+		close(p.quit)
+	})
+
+	p.cmd.Close()
+	p.owner.Close()
+	p.chatlog.Close()
 	p.profile = nil
 	return nil
 }
 
+// Observe keeps track of the state of the connection and the channels we
+// are in. These messages are only meaningful in the order in which they
+// were received.
+func (p *plugin) Observe(w irc.ResponseWriter, r *irc.Request) {
+	switch r.Type {
+	case "001": // received WELCOME
+		p.onWelcome()
+
+	case "005": // received ISUPPORT
+		irc.Support.Parse(r.Data)
+
+	case "JOIN":
+		p.onJoin(w, r)
+
+	case "PART":
+		p.onPart(r.Target, r.SenderName)
+
+	case "QUIT":
+		irc.Members.Quit(r.SenderName)
+
+	case "AWAY": // Requires the away-notify capability.
+		irc.Members.SetAway(r.SenderName, r.Data)
+
+	case "353": // received NAMREPLY
+		irc.Members.Names(r.Data)
+
+	case "366": // received ENDOFNAMES
+		irc.Members.EndOfNames(r.Data)
+
+	case "331", "332": // received NOTOPIC or TOPIC
+		p.onTopicReply(r)
+
+	case "TOPIC":
+		irc.Topics.Set(r.Target, r.Data)
+
+	case "NICK":
+		irc.Members.Rename(r.SenderName, r.Target)
+		p.onNick(r)
+
+	case "KICK":
+		if victim := r.Arg(0); len(victim) > 0 {
+			p.onPart(r.Target, victim)
+		}
+	}
+}
+
 // Dispatch sends the given, incoming IRC message to the plugin for
 // processing as it sees fit.
 func (p *plugin) Dispatch(w irc.ResponseWriter, r *irc.Request) {
+	// Remember where users are coming from, so we can ban them.
+	p.hosts.Seen(r.SenderName, r.SenderMask)
+
+	if p.profile.ChannelLogging() {
+		p.chatlog.Log(r)
+	}
+
 	switch r.Type {
+	case "001": // received WELCOME
+		p.caps.onWelcome()
+
 	case "375", "422": // received START_MOTD or NO_MOTD
 		p.onFinalizeLogin(w, r)
 
 	case "433":
 		p.onNickInUse(w, r)
 
-	case "PRIVMSG":
+	case "303": // received ISON
+		p.onIsOn(w, r)
+
+	case "MODE":
+		p.onMode(w, r)
+
+	case "NICK":
+		p.hosts.Renamed(r.SenderName, r.Target)
+
+	case "CAP":
+		p.caps.onCap(w, r)
+
+	case "AUTHENTICATE":
+		p.caps.onAuthenticate(w, r)
+
+	case "903", "904", "905", "906":
+		p.caps.onSaslResult(w, r)
+
+	case "PRIVMSG", "NOTICE":
 		p.cmd.Dispatch(w, r)
+		p.owner.Dispatch(w, r)
+	}
+}
+
+// onJoin handles a user joining a channel. If it is the bot itself, the
+// channel is remembered and its members are requested.
+func (p *plugin) onJoin(w irc.ResponseWriter, r *irc.Request) {
+	irc.Members.Join(r.Target, r.SenderName)
+
+	if p.profile.IsNick(r.SenderName) {
+		p.channels.Joined(r.Target)
+		proto.Names(w, r.Target)
+	}
+}
+
+// onPart handles a user leaving a channel, or being kicked from it. If it
+// is the bot itself, everything we know about the channel is forgotten.
+func (p *plugin) onPart(channel, nick string) {
+	if !p.profile.IsNick(nick) {
+		irc.Members.Part(channel, nick)
+		return
 	}
+
+	p.channels.Left(channel)
+	irc.Topics.Remove(channel)
+	irc.Members.Remove(channel)
+}
+
+// onMode handles mode changes. If the status of channel members changed,
+// their list is requested again, so their prefixes are up to date.
+func (p *plugin) onMode(w irc.ResponseWriter, r *irc.Request) {
+	if !r.FromChannel() {
+		return
+	}
+
+	modes, _ := irc.Support.Prefix()
+	if strings.ContainsAny(r.Arg(0), modes) {
+		proto.Names(w, r.Target)
+	}
+}
+
+// onTopicReply records the topic sent in RPL_TOPIC or RPL_NOTOPIC. The
+// data has the form "#channel :topic".
+func (p *plugin) onTopicReply(r *irc.Request) {
+	channel, topic := r.Data, ""
+	if idx := strings.IndexByte(r.Data, ' '); idx > -1 {
+		channel, topic = r.Data[:idx], strings.TrimPrefix(r.Data[idx+1:], ":")
+	}
+
+	if r.Type == "331" {
+		topic = ""
+	}
+
+	irc.Topics.Set(channel, topic)
 }
 
 // onFinalizeLogin is called to complete the login sequence.
 // It joins channels defined in the profile and is triggered when we
-// receive either the STARTMOTD or NOMOTD messages.
+// receive either the STARTMOTD or NOMOTD messages. This happens on
+// every login, including those after a reconnect. Any channels joined
+// at runtime are rejoined as well.
 func (p *plugin) onFinalizeLogin(w irc.ResponseWriter, r *irc.Request) {
-	proto.Join(w, p.profile.Channels()...)
+	proto.Join(w, p.chanServ(p.channels.List(p.profile.Channels()))...)
+
+	// Have the server apply the ignore list as well, if it can.
+	var masks []string
+	for _, mask := range p.profile.Ignores() {
+		masks = append(masks, "+"+silenceMask(mask))
+	}
+
+	if len(masks) > 0 && irc.Support.Has("SILENCE") {
+		proto.Silence(w, masks...)
+	}
+
+	// The server forgets we were away when the connection is lost.
+	if msg := p.profile.AwayMessage(); len(msg) > 0 {
+		proto.Away(w, msg)
+	}
+}
+
+// onWelcome is called when the server accepts our login. This happens once
+// for every new connection.
+func (p *plugin) onWelcome() {
+	// The server will tell us what it supports, after this. Topics and
+	// channel members are sent again when channels are rejoined.
+	irc.Support.Reset()
+	irc.Topics.Reset()
+	irc.Members.Reset()
+
+	p.m.Lock()
+	p.connectedAt = time.Now()
+	p.logins++
+	p.m.Unlock()
 }
 
 // onNickInUse signals that our nick is in use. If we can regain it, do so.
@@ -127,12 +411,30 @@ func (p *plugin) onFinalizeLogin(w irc.ResponseWriter, r *irc.Request) {
 func (p *plugin) onNickInUse(w irc.ResponseWriter, r *irc.Request) {
 	pr := p.profile
 
+	// An attempt to reclaim our preferred nick failed. We still have
+	// the one we had, so leave it be.
+	p.m.Lock()
+	reclaim := p.nickReclaim
+	p.nickReclaim = false
+	p.m.Unlock()
+
+	if reclaim {
+		log.Println("[admin] Nick in use: can not reclaim:", pr.PreferredNickname())
+		return
+	}
+
 	if len(pr.NickservPassword()) > 0 {
 		log.Println("[bot] Nick in use: trying to recover")
 		proto.Recover(w, pr.Nickname(), pr.NickservPassword())
 		return
 	}
 
+	// Remember the name we were after, so we can reclaim it later. If we
+	// were already after another one, keep that.
+	if !pr.HasPreferredNickname() {
+		pr.SetPreferredNickname(pr.Nickname())
+	}
+
 	pr.SetNickname(pr.Nickname() + "_")
 
 	log.Println("[admin] Nick in use: changing nick to:", pr.Nickname())
@@ -142,12 +444,13 @@ func (p *plugin) onNickInUse(w irc.ResponseWriter, r *irc.Request) {
 // cmdHelp presents the user with a short message, pointing them to
 // a resource where the full bot help can be viewed.
 func (p *plugin) cmdHelp(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
-	proto.PrivMsg(w, r.Target, TextHelpDisplay, r.SenderName)
+	r.Reply(w, TextHelpDisplay, r.SenderName)
 }
 
 // cmdNick allows the bot to change its name.
 func (p *plugin) cmdNick(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
 	p.profile.SetNickname(params.String(0))
+	p.profile.SetPreferredNickname(params.String(0))
 
 	if params.Len() > 1 {
 		proto.Nick(w, params.String(0), params.String(1))
@@ -157,7 +460,8 @@ func (p *plugin) cmdNick(w irc.ResponseWriter, r *irc.Request, params cmd.ParamL
 	}
 }
 
-// cmdJoin makes the bot join a new channel.
+// cmdJoin makes the bot join a new channel. The channel is remembered,
+// so it is rejoined after a reconnect or restart.
 func (p *plugin) cmdJoin(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
 	var channel irc.Channel
 	channel.Name = params.String(0)
@@ -170,50 +474,219 @@ func (p *plugin) cmdJoin(w irc.ResponseWriter, r *irc.Request, params cmd.ParamL
 		channel.Key = params.String(2)
 	}
 
-	proto.Join(w, channel)
+	p.channels.Add(channel)
+	proto.Join(w, p.chanServ([]irc.Channel{channel})...)
 }
 
-// cmdPart makes the bot leave a given channel.
+// chanServ returns the given channels with their ChanServ flag set, if the
+// profile asks for the chanserv flow to be used for all channels.
+func (p *plugin) chanServ(channels []irc.Channel) []irc.Channel {
+	if p.profile.ChanServJoin() {
+		for i := range channels {
+			channels[i].ChanServ = true
+		}
+	}
+	return channels
+}
+
+// cmdPart makes the bot leave a given channel, optionally with a reason.
 func (p *plugin) cmdPart(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
-	proto.Part(w, irc.Channel{
-		Name: params.String(0),
-	})
+	p.channels.Remove(params.String(0))
+	proto.PartReason(w, params.Rest(1), irc.Channel{Name: params.String(0)})
+}
+
+// cmdSay makes the bot send a message to a channel it is in.
+func (p *plugin) cmdSay(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	if p.inChannel(w, r, params.String(0)) {
+		proto.PrivMsg(w, params.String(0), "%s", params.Rest(1))
+	}
+}
+
+// cmdAct makes the bot perform an action in a channel it is in.
+func (p *plugin) cmdAct(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	if p.inChannel(w, r, params.String(0)) {
+		proto.PrivMsg(w, params.String(0), "%s", util.Action("%s", params.Rest(1)))
+	}
+}
+
+// inChannel returns true if the bot is in the given channel. If not, the
+// caller is told so.
+func (p *plugin) inChannel(w irc.ResponseWriter, r *irc.Request, channel string) bool {
+	if p.channels.Has(channel) {
+		return true
+	}
+
+	r.ReplyPrivate(w, TextNotInChannel, channel)
+	return false
+}
+
+// cmdKick removes users from a channel, optionally with a reason. Multiple
+// users can be given as a comma-separated list.
+func (p *plugin) cmdKick(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	reason := params.Rest(2)
+
+	var nicks []string
+	for _, nick := range strings.Split(params.String(1), ",") {
+		if len(nick) > 0 {
+			nicks = append(nicks, nick)
+		}
+	}
+
+	if len(reason) > 0 {
+		proto.KickAll(w, params.String(0), nicks, reason)
+	} else {
+		proto.KickAll(w, params.String(0), nicks)
+	}
+}
+
+// cmdBan bans a user from a channel. This accepts either a hostmask, which
+// is used as-is, or a nickname. For the latter, a mask is built from the
+// user's host and they are kicked from the channel as well.
+func (p *plugin) cmdBan(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	channel, target := params.String(0), params.String(1)
+
+	if isMask(target) {
+		proto.Mode(w, channel, "+b", target)
+		return
+	}
+
+	proto.Mode(w, channel, "+b", p.hosts.BanMask(target))
+	p.cmdKick(w, r, params)
 }
 
 // cmdNoop makes the bot de-op itself.
 func (p *plugin) cmdNoop(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
-	var channel_name string
-	if params.Len() > 0 {
-		channel_name = params.String(0)
-	} else {
-		if r.FromChannel() {
-			channel_name = r.Target
-		} else {
-			// ugly?
-			proto.PrivMsg(w, r.SenderName, cmd.TextMissingParameters, r.Data[1:])
-			return
+	channel, ok := targetChannel(w, r, params, 0, TextNoopName)
+	if ok {
+		proto.Mode(w, channel, "-o", p.profile.Nickname())
+	}
+}
+
+// cmdTopic reports the known topic of a channel. If a new topic is given,
+// it is set instead. The channel may be omitted, in which case the channel
+// the command came from is used.
+func (p *plugin) cmdTopic(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	channel := r.Target
+	text := params.Rest(0)
+
+	// The first argument is only a channel if it looks like one.
+	if params.Has(0) && cmd.RegChannel.MatchString(params.String(0)) {
+		channel = params.String(0)
+		text = params.Rest(1)
+	} else if !r.FromChannel() {
+		r.ReplyPrivate(w, cmd.TextMissingParameters, TextTopicName)
+		return
+	}
+
+	if len(text) > 0 {
+		if p.inChannel(w, r, channel) {
+			proto.Topic(w, channel, text)
+		}
+		return
+	}
+
+	topic, ok := irc.Topics.Get(channel)
+	switch {
+	case !ok:
+		r.Reply(w, TextTopicUnknown, channel)
+	case len(topic) == 0:
+		r.Reply(w, TextTopicEmpty, channel)
+	default:
+		r.Reply(w, TextTopicDisplay, channel, topic)
+	}
+}
+
+// cmdMode returns a command handler which sets the given mode for a user.
+// E.g.: "+o" to make them a channel operator.
+func (p *plugin) cmdMode(name, mode string) cmd.Handler {
+	return func(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+		channel, ok := targetChannel(w, r, params, 1, name)
+		if ok {
+			proto.Mode(w, channel, mode, params.String(0))
 		}
 	}
-	proto.Mode(w, channel_name, "-o", p.profile.Nickname())
+}
+
+// targetChannel returns the channel in parameter n, if it was supplied.
+// Otherwise it returns the channel from whence the command came. If the
+// command was not sent to a channel, the caller is told the channel is
+// missing and false is returned.
+func targetChannel(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList, n int, command string) (string, bool) {
+	if params.Has(n) {
+		return params.String(n), true
+	}
+
+	if r.FromChannel() {
+		return r.Target, true
+	}
+
+	r.ReplyPrivate(w, cmd.TextMissingParameters, command)
+	return "", false
 }
 
 // cmdAuthList lists all whitelisted users.
 func (p *plugin) cmdAuthList(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
 	list := p.profile.Whitelist()
 	out := strings.Join(list, ", ")
-	proto.PrivMsg(w, r.SenderName, TextAuthListDisplay, out)
+	r.ReplyPrivate(w, TextAuthListDisplay, out)
 }
 
 // cmdAuthorize adds a new whitelisted user.
 func (p *plugin) cmdAuthorize(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
 	p.profile.WhitelistAdd(params.String(0))
-	proto.PrivMsg(w, r.SenderName, TextAuthorizeDisplay, params.String(0))
+	r.ReplyPrivate(w, TextAuthorizeDisplay, params.String(0))
 }
 
 // cmdDeauthorize removes a user from the whitelist.
 func (p *plugin) cmdDeauthorize(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
 	p.profile.WhitelistRemove(params.String(0))
-	proto.PrivMsg(w, r.SenderName, TextDeauthorizeDisplay, params.String(0))
+	r.ReplyPrivate(w, TextDeauthorizeDisplay, params.String(0))
+}
+
+// cmdIgnore adds a mask to the ignore list. Messages from matching users
+// are no longer processed. If the server supports it, it is asked to stop
+// sending them altogether.
+func (p *plugin) cmdIgnore(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	mask := params.String(0)
+	p.profile.IgnoreAdd(mask)
+
+	if irc.Support.Has("SILENCE") {
+		proto.Silence(w, "+"+silenceMask(mask))
+	}
+
+	r.ReplyPrivate(w, TextIgnoreDisplay, mask)
+}
+
+// cmdUnignore removes a mask from the ignore list.
+func (p *plugin) cmdUnignore(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	mask := params.String(0)
+	p.profile.IgnoreRemove(mask)
+
+	if irc.Support.Has("SILENCE") {
+		proto.Silence(w, "-"+silenceMask(mask))
+	}
+
+	r.ReplyPrivate(w, TextUnignoreDisplay, mask)
+}
+
+// cmdIgnoreList lists the ignored masks.
+func (p *plugin) cmdIgnoreList(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	list := p.profile.Ignores()
+	if len(list) == 0 {
+		r.ReplyPrivate(w, TextIgnoreListEmpty)
+		return
+	}
+
+	r.ReplyPrivate(w, TextIgnoreListDisplay, strings.Join(list, ", "))
+}
+
+// silenceMask returns the given ignore mask in the nick!user@host form
+// expected by SILENCE. Masks without a nick part match any nick.
+func silenceMask(mask string) string {
+	if strings.IndexByte(mask, '!') == -1 {
+		return "*!" + mask
+	}
+	return mask
 }
 
 // cmdLog changes and/or reports the current logging state.
@@ -223,39 +696,146 @@ func (p *plugin) cmdLog(w irc.ResponseWriter, r *irc.Request, params cmd.ParamLi
 	}
 
 	if p.profile.Logging() {
-		proto.PrivMsg(w, r.SenderName, TextLogEnabled)
+		r.ReplyPrivate(w, TextLogEnabled)
+	} else {
+		r.ReplyPrivate(w, TextLogDisabled)
+	}
+}
+
+// cmdChannelLog changes and/or reports the current channel logging state.
+func (p *plugin) cmdChannelLog(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	if params.Len() > 0 {
+		p.profile.SetChannelLogging(params.Bool(0))
+	}
+
+	if p.profile.ChannelLogging() {
+		r.ReplyPrivate(w, TextChannelLogEnabled)
 	} else {
-		proto.PrivMsg(w, r.SenderName, TextLogDisabled)
+		r.ReplyPrivate(w, TextChannelLogDisabled)
 	}
 }
 
+// cmdAway marks the bot as away, with an optional message. The message is
+// kept in the profile, so it can be restored after a reconnect.
+func (p *plugin) cmdAway(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	msg := params.Rest(0)
+	if len(msg) == 0 {
+		msg = TextAwayDefault
+	}
+
+	proto.Away(w, msg)
+	p.profile.SetAwayMessage(msg)
+	r.ReplyPrivate(w, TextAwayDisplay, msg)
+}
+
+// cmdBack clears the bot's away status.
+func (p *plugin) cmdBack(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	proto.Away(w)
+	p.profile.SetAwayMessage("")
+	r.ReplyPrivate(w, TextBackDisplay)
+}
+
+// cmdPlugin enables or disables a plugin and reports its state.
+func (p *plugin) cmdPlugin(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	name := params.String(0)
+
+	if params.Len() > 1 {
+		var err error
+		if params.Bool(1) {
+			err = plugins.Enable(name)
+		} else {
+			err = plugins.Disable(name)
+		}
+
+		switch err {
+		case nil:
+		case plugins.ErrNoSuchPlugin:
+			r.ReplyPrivate(w, TextPluginUnknown, name)
+			return
+		case plugins.ErrProtected:
+			r.ReplyPrivate(w, TextPluginProtected, name)
+			return
+		default:
+			r.ReplyPrivate(w, TextPluginError, name, err)
+			return
+		}
+	}
+
+	for _, info := range plugins.List() {
+		if !strings.EqualFold(info.Name, name) {
+			continue
+		}
+
+		if info.Enabled {
+			r.ReplyPrivate(w, TextPluginEnabled, info.Name)
+		} else {
+			r.ReplyPrivate(w, TextPluginDisabled, info.Name)
+		}
+		return
+	}
+
+	r.ReplyPrivate(w, TextPluginUnknown, name)
+}
+
+// cmdPlugins lists all plugins, along with their state.
+func (p *plugin) cmdPlugins(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	var set []string
+
+	for _, info := range plugins.List() {
+		if info.Enabled {
+			set = append(set, fmt.Sprintf(TextPluginsOn, info.Name))
+		} else {
+			set = append(set, fmt.Sprintf(TextPluginsOff, info.Name))
+		}
+	}
+
+	r.ReplyPrivate(w, TextPluginsDisplay, strings.Join(set, ", "))
+}
+
 // cmdReload forces the bot to fork itself. This is achieved by
 // sending SIGUSR1 to the current process.
 func (p *plugin) cmdReload(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
 	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
 }
 
+// cmdRaw sends the remainder of the message to the server, as-is. Every
+// use is logged. Messages with embedded line breaks are refused, as they
+// could be used to sneak in additional commands.
+func (p *plugin) cmdRaw(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	line := params.Rest(0)
+
+	if strings.ContainsAny(line, "\r\n\x00") {
+		r.ReplyPrivate(w, TextRawInvalid)
+		return
+	}
+
+	log.Printf("[admin] Raw message by %s: %s", r.SenderMask, line)
+	proto.Raw(w, "%s", line)
+}
+
 // cmdVersion prints version information.
 func (p *plugin) cmdVersion(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
 	rev, _ := strconv.ParseInt(app.VersionRevision, 10, 64)
 	stamp := time.Unix(rev, 0)
-	utime := math.Abs(time.Since(lastRestart).Hours())
 
-	var upSince string
-	if utime < 1 {
-		upSince = util.Bold("<1")
-	} else {
-		upSince = util.Bold("%.0f", utime)
+	p.m.Lock()
+	connected := time.Since(p.connectedAt)
+	reconnects := p.logins - 1
+	p.m.Unlock()
+
+	if reconnects < 0 {
+		reconnects = 0
 	}
 
-	proto.PrivMsg(
-		w, r.Target,
-		TextVersionDisplay,
+	r.Reply(
+		w, TextVersionDisplay,
 		r.SenderName,
 		util.Bold(app.Name),
 		util.Bold("%d.%d", app.VersionMajor, app.VersionMinor),
 		stamp.Format(TextDateFormat),
 		stamp.Format(TextTimeFormat),
-		upSince,
+		util.Bold("%s", util.FormatDuration(time.Since(lastRestart))),
+		util.Bold("%s", util.FormatDuration(connected)),
+		reconnects,
 	)
 }
@@ -22,12 +22,51 @@ const (
 
 	TextPartName        = "part"
 	TextPartChannelName = "kanaal"
+	TextPartReasonName  = "reden"
+
+	TextSayName        = "say"
+	TextSayChannelName = "kanaal"
+	TextSayMessageName = "bericht"
+
+	TextActName        = "act"
+	TextActChannelName = "kanaal"
+	TextActMessageName = "actie"
+
+	TextNotInChannel = "Ik zit niet in kanaal %s."
+
+	TextOpName          = "op"
+	TextDeopName        = "deop"
+	TextVoiceName       = "voice"
+	TextDevoiceName     = "devoice"
+	TextModeNickName    = "naam"
+	TextModeChannelName = "kanaal"
+
+	TextKickName        = "kick"
+	TextKickChannelName = "kanaal"
+	TextKickNickName    = "naam"
+	TextKickReasonName  = "reden"
+
+	TextBanName        = "ban"
+	TextBanChannelName = "kanaal"
+	TextBanMaskName    = "naam"
+	TextBanReasonName  = "reden"
+
+	TextTopicName        = "topic"
+	TextTopicChannelName = "kanaal"
+	TextTopicTextName    = "onderwerp"
+	TextTopicDisplay     = "Het onderwerp van %s is: %s"
+	TextTopicEmpty       = "Kanaal %s heeft geen onderwerp."
+	TextTopicUnknown     = "Ik ken het onderwerp van %s niet."
 
 	TextNoopName        = "n00p"
 	TextNoopChannelName = "kanaal"
 
 	TextReloadName = "herstart"
 
+	TextRawName        = "raw"
+	TextRawMessageName = "bericht"
+	TextRawInvalid     = "Een raw bericht mag geen regeleinden bevatten."
+
 	TextAuthListName    = "bazen"
 	TextAuthListDisplay = "De beheerders zijn: %s"
 
@@ -39,11 +78,45 @@ const (
 	TextDeauthorizeMaskName = "hostmask"
 	TextDeauthorizeDisplay  = "Gebruiker %q is verwijderd van de beheerderslijst."
 
+	TextIgnoreName        = "ignore"
+	TextUnignoreName      = "unignore"
+	TextIgnoreMaskName    = "hostmask"
+	TextIgnoreDisplay     = "Berichten van %q worden voortaan genegeerd."
+	TextUnignoreDisplay   = "Berichten van %q worden niet langer genegeerd."
+	TextIgnoreListName    = "ignores"
+	TextIgnoreListDisplay = "Genegeerde gebruikers: %s"
+	TextIgnoreListEmpty   = "Er worden geen gebruikers genegeerd."
+
 	TextVersionName    = "versie"
-	TextVersionDisplay = "%s, ik ben %s, versie %s. Mijn laatste revisie was op %s, om %s. De laatste herstart was %s uur geleden. Mijn broncode is te vinden op: https://github.com/monkeybird/autimaat"
+	TextVersionDisplay = "%s, ik ben %s, versie %s. Mijn laatste revisie was op %s, om %s. Ik draai al %s. De huidige verbinding bestaat %s en ik heb %d keer opnieuw verbinding gemaakt. Mijn broncode is te vinden op: https://github.com/monkeybird/autimaat"
 
 	TextLogName      = "log"
 	TextLogValueName = "status"
 	TextLogEnabled   = "Logging is ingeschakeld."
 	TextLogDisabled  = "Logging is uitgeschakeld."
+
+	TextChannelLogName     = "kanaallog"
+	TextChannelLogEnabled  = "Kanaallogs zijn ingeschakeld."
+	TextChannelLogDisabled = "Kanaallogs zijn uitgeschakeld."
+
+	TextAwayName        = "away"
+	TextAwayMessageName = "bericht"
+	TextAwayDefault     = "Even weg."
+	TextAwayDisplay     = "Ik ben nu afwezig: %s"
+	TextBackName        = "back"
+	TextBackDisplay     = "Ik ben weer terug."
+
+	TextPluginName      = "plugin"
+	TextPluginNameName  = "naam"
+	TextPluginStateName = "status"
+	TextPluginEnabled   = "Plugin %q is ingeschakeld."
+	TextPluginDisabled  = "Plugin %q is uitgeschakeld."
+	TextPluginUnknown   = "Plugin %q bestaat niet."
+	TextPluginProtected = "Plugin %q kan niet worden uitgeschakeld."
+	TextPluginError     = "Plugin %q is ingeschakeld, maar meldt een fout: %v"
+
+	TextPluginsName    = "plugins"
+	TextPluginsDisplay = "Plugins: %s"
+	TextPluginsOn      = "%s (aan)"
+	TextPluginsOff     = "%s (uit)"
 )
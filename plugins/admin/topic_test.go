@@ -0,0 +1,102 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package admin
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd"
+	"github.com/monkeybird/autimaat/irc/cmd/cmdtest"
+)
+
+func TestTopicCache(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	prof.WhitelistAdd(cmdtest.Mask)
+	p.Load(prof)
+	defer p.Unload(prof)
+	defer irc.Topics.Reset()
+
+	var w mockWriter
+	dispatch(&p, &w, &irc.Request{Type: "001", Target: prof.Nickname()})
+
+	// Reply to a JOIN or TOPIC query.
+	dispatch(&p, &w, &irc.Request{
+		SenderName: "irc.example.com",
+		Type:       "332",
+		Target:     "irc.example.com",
+		Data:       "#Test :Welkom in #test: wees aardig",
+	})
+	testTopic(t, "#test", "Welkom in #test: wees aardig", true)
+
+	// Someone changes the topic.
+	dispatch(&p, &w, &irc.Request{
+		SenderName: "bob",
+		Type:       "TOPIC",
+		Target:     "#test",
+		Data:       "Nieuw onderwerp",
+	})
+	testTopic(t, "#TEST", "Nieuw onderwerp", true)
+
+	// A channel without topic.
+	dispatch(&p, &w, &irc.Request{
+		Type: "331",
+		Data: "#leeg :No topic is set",
+	})
+	testTopic(t, "#leeg", "", true)
+
+	// The bot leaves the channel.
+	dispatch(&p, &w, &irc.Request{
+		SenderName: prof.Nickname(),
+		Type:       "PART",
+		Target:     "#test",
+	})
+	testTopic(t, "#test", "", false)
+}
+
+func testTopic(t *testing.T, channel, want string, wantOk bool) {
+	have, ok := irc.Topics.Get(channel)
+	if have != want || ok != wantOk {
+		t.Fatalf("topic mismatch for %s;\nwant: %q %v\nhave: %q %v",
+			channel, want, wantOk, have, ok)
+	}
+}
+
+func TestTopicCommand(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	prof.WhitelistAdd(cmdtest.Mask)
+	p.Load(prof)
+	defer p.Unload(prof)
+	defer irc.Topics.Reset()
+
+	p.channels.Joined("#test")
+	irc.Topics.Set("#test", "Hallo")
+	irc.Topics.Set("#leeg", "")
+
+	cmdtest.Check(t, p.cmd, "#test", "!topic",
+		"PRIVMSG #test :"+fmt.Sprintf(TextTopicDisplay, "#test", "Hallo")+"\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!topic #leeg",
+		"PRIVMSG #test :"+fmt.Sprintf(TextTopicEmpty, "#leeg")+"\r\n")
+	cmdtest.Check(t, p.cmd, "steve", "!topic #ander",
+		"PRIVMSG steve :"+fmt.Sprintf(TextTopicUnknown, "#ander")+"\r\n")
+	cmdtest.Check(t, p.cmd, "steve", "!topic",
+		"PRIVMSG steve :"+fmt.Sprintf(cmd.TextMissingParameters, TextTopicName)+"\r\n")
+
+	// Setting the topic.
+	cmdtest.Check(t, p.cmd, "#test", "!topic Een  nieuw onderwerp",
+		"TOPIC #test :Een  nieuw onderwerp\r\n")
+	cmdtest.Check(t, p.cmd, "steve", "!topic #test Een nieuw onderwerp",
+		"TOPIC #test :Een nieuw onderwerp\r\n")
+	cmdtest.Check(t, p.cmd, "steve", "!topic, #test hallo",
+		"TOPIC #test :hallo\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!TOPIC? Topic  in de tekst",
+		"TOPIC #test :Topic  in de tekst\r\n")
+	cmdtest.Check(t, p.cmd, "steve", "!topic #ander Een nieuw onderwerp",
+		"PRIVMSG steve :"+fmt.Sprintf(TextNotInChannel, "#ander")+"\r\n")
+}
@@ -15,11 +15,21 @@
 //
 //    <steve> !reminder 18:15 Make food.
 //
+// Create a new alarm for 18:15 in London:
+//
+//    <steve> !reminder 18:15@Europe/London Make food.
+//
+// Create a new alarm for 1.5 hours from now, delivered by private message:
+//
+//    <steve> !reminder pm 1h30m Take pills.
+//
 package alarm
 
 import (
+	"fmt"
 	"math/rand"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -41,6 +51,17 @@ type alarm struct {
 	Target     string
 	Message    string
 	When       time.Time
+	Zone       string `json:",omitempty"`
+}
+
+// in returns t in the alarm's time zone, if it has one.
+func (a *alarm) in(t time.Time) time.Time {
+	if len(a.Zone) > 0 {
+		if loc, err := time.LoadLocation(a.Zone); err == nil {
+			return t.In(loc)
+		}
+	}
+	return t
 }
 
 type plugin struct {
@@ -55,23 +76,34 @@ type plugin struct {
 // Load initializes the module and loads any internal resources
 // which may be required.
 func (p *plugin) Load(prof irc.Profile) error {
+	p.quitOnce = sync.Once{}
 	p.quit = make(chan struct{})
 	p.table = make(map[string]alarm)
 	p.file = filepath.Join(prof.Root(), "alarm.dat")
 
-	p.cmd = cmd.New(prof.CommandPrefix(), nil)
+	p.cmd = cmd.New(prof.CommandPrefixes(), nil)
+	p.cmd.SetAcceptNotice(prof.NoticeCommands())
+	plugins.Track(p, p.cmd)
 	p.cmd.Bind(TextReminder, false, p.onReminder).
 		Add(TextTimestamp, true, cmd.RegAny).
 		Add(TextMessage, false, cmd.RegAny)
 	p.cmd.Bind(TextClearReminder, false, p.onClearReminder).
 		Add(TextID, true, cmd.RegAny)
+	p.cmd.Bind(TextListReminders, false, p.onListReminders)
 
-	go p.pollReminders()
+	go p.pollReminders(p.quit)
 	return util.ReadFile(p.file, &p.table, true)
 }
 
+// Reload reloads the plugin's configuration.
+func (p *plugin) Reload(prof irc.Profile) error {
+	p.cmd.SetPrefixes(prof.CommandPrefixes())
+	return nil
+}
+
 // Unload cleans the module up and unloads any internal resources.
 func (p *plugin) Unload(prof irc.Profile) error {
+	p.cmd.Close()
 	p.quitOnce.Do(func() {
 		close(p.quit)
 	})
@@ -102,26 +134,78 @@ func (p *plugin) onClearReminder(w irc.ResponseWriter, r *irc.Request, params cm
 	a, ok := p.table[id]
 	if ok && strings.EqualFold(a.SenderMask, r.SenderMask) {
 		delete(p.table, id)
-		proto.PrivMsg(w, r.Target, TextAlarmUnset, r.SenderName)
+		r.Reply(w, TextAlarmUnset, r.SenderName)
 		util.WriteFile(p.file, p.table, true)
 	}
 
 	p.m.Unlock()
 }
 
+// onListReminders sends the caller a list of their scheduled alarms,
+// sorted by time. This is sent as a private message, so others do not
+// get to see the alarms or their cancellation codes.
+func (p *plugin) onListReminders(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	p.m.RLock()
+
+	var ids []string
+	for id, a := range p.table {
+		if len(a.SenderMask) > 0 && strings.EqualFold(a.SenderMask, r.SenderMask) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return p.table[ids[i]].When.Before(p.table[ids[j]].When)
+	})
+
+	set := make([]alarm, len(ids))
+	for i, id := range ids {
+		set[i] = p.table[id]
+	}
+
+	p.m.RUnlock()
+
+	if len(set) == 0 {
+		r.ReplyPrivate(w, TextNoAlarms, r.SenderName)
+		return
+	}
+
+	r.ReplyPrivate(w, TextAlarmList, r.SenderName, len(set))
+
+	for i, a := range set {
+		// Strip the greeting from the message, as it is
+		// meaningless in this context.
+		when := a.in(a.When).Format(TextTimeFormat)
+		msg := fmt.Sprintf(a.Message, a.SenderName, when)
+		msg = strings.TrimPrefix(msg, fmt.Sprintf(TextMessagePrefix, a.SenderName, when))
+
+		r.ReplyPrivate(w, TextAlarmEntry, util.Bold("%s", ids[i]),
+			a.in(a.When).Format(TextDateTimeFormat), msg)
+	}
+}
+
 // addReminder does what the docs on addReminder describe. This is a separate
 // method with the unique id as added parameter to make unit test code
 // easier to write. This returns false if the alarm was not scheduled.
 // This can happen when the tim value is invalid. If this is the case, the
 // given id should either be removed from the table, or reused.
 func (p *plugin) addReminder(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList, id string) bool {
-	when := parseTime(params.String(0))
+	// The alarm is delivered in the channel it was set in, unless the
+	// user asks for a private message.
+	target := r.Target
+	stamp, msg := params.String(0), params.Rest(1)
+
+	if params.Has(1) && strings.EqualFold(stamp, TextPrivateFlag) {
+		target = r.SenderName
+		stamp, msg = params.String(1), params.Rest(2)
+	}
+
+	when := parseTime(stamp, time.Now())
 	if when <= 0 {
-		proto.PrivMsg(w, r.Target, TextInvalidTime, r.SenderName, params.String(0))
+		r.Reply(w, TextInvalidTime, r.SenderName, stamp)
 		return false
 	}
 
-	msg := strings.Join(r.Fields(2), " ")
 	if len(msg) == 0 {
 		msg = TextDefaultMessage
 	} else {
@@ -131,25 +215,32 @@ func (p *plugin) addReminder(w irc.ResponseWriter, r *irc.Request, params cmd.Pa
 	p.m.Lock()
 
 	p.table[id] = alarm{
-		Target:     r.Target,
+		Target:     target,
 		SenderMask: r.SenderMask,
 		SenderName: r.SenderName,
 		Message:    msg,
 		When:       time.Now().Add(when),
 	}
 
+	if idx := strings.Index(stamp, "@"); idx > -1 {
+		a := p.table[id]
+		a.Zone = stamp[idx+1:]
+		p.table[id] = a
+	}
+
 	util.WriteFile(p.file, p.table, true)
 	p.m.Unlock()
 
-	proto.PrivMsg(w, r.Target, TextAlarmSet, r.SenderName, util.Bold(id))
+	r.Reply(w, TextAlarmSet, r.SenderName, util.Bold("%s", id))
 	return true
 }
 
-// pollReminders periodically checks if any of the defined reminders have expired.
-func (p *plugin) pollReminders() {
+// pollReminders periodically checks if any of the defined reminders have
+// expired, until quit is closed.
+func (p *plugin) pollReminders(quit chan struct{}) {
 	for {
 		select {
-		case <-p.quit:
+		case <-quit:
 			return
 
 		case <-time.After(time.Minute):
@@ -218,38 +309,58 @@ func (p *plugin) checkExpiredAlarms() {
 		}
 
 		proto.PrivMsg(c, alarm.Target, alarm.Message,
-			alarm.SenderName, time.Now().Format(TextTimeFormat))
+			alarm.SenderName, alarm.in(now).Format(TextTimeFormat))
 
 		delete(p.table, id)
 		util.WriteFile(p.file, p.table, true)
 	}
 }
 
-// parseTime treats the given value as either an absolute time, or
-// an offset in minutes. It returns the value which represents the
-// duration between now and then.
-func parseTime(v string) time.Duration {
+// parseTime treats the given value as either an absolute time, an offset
+// in minutes, or a duration like "1h30m". It returns the value which
+// represents the duration between now and then.
+//
+// An absolute time may be followed by a time zone name, as in
+// "18:15@Europe/London". The time is then taken to be in that zone,
+// rather than the bot's local time.
+func parseTime(v string, now time.Time) time.Duration {
+	loc := now.Location()
+	idx := strings.Index(v, "@")
+
+	if idx > -1 {
+		var err error
+		loc, err = time.LoadLocation(v[idx+1:])
+		if err != nil || len(v[idx+1:]) == 0 {
+			return 0
+		}
+
+		v = v[:idx]
+	}
+
 	then, err := time.Parse(TextTimeFormat, v)
 
 	if err == nil {
 		// We expect the given time to include only the time.
-		// We must set the date components manually.
-
-		now := time.Now()
-		then = time.Date(now.Year(), now.Month(), now.Day(),
-			then.Hour(), then.Minute(), 0, 0, now.Location())
+		// We must set the date components manually, as seen
+		// from the requested time zone.
 
-		delta := then.Sub(now)
+		local := now.In(loc)
+		then = time.Date(local.Year(), local.Month(), local.Day(),
+			then.Hour(), then.Minute(), 0, 0, loc)
 
-		// If delta is negative, we are probably dealing with a time which
-		// is meant to mean 'tomorrow'. So add 24 hours to the clock and
+		// If then has passed, we are probably dealing with a time which
+		// is meant to mean 'tomorrow'. So move it forward by a day and
 		// recalculate the difference.
-		if delta < 0 {
-			then = then.Add(time.Hour * 24)
-			delta = then.Sub(now)
+		if then.Before(now) {
+			then = then.AddDate(0, 0, 1)
 		}
 
-		return delta
+		return then.Sub(now)
+	}
+
+	// A time zone only applies to absolute times.
+	if idx > -1 {
+		return 0
 	}
 
 	// If not an absolute time, the value is expected to be an offset
@@ -261,5 +372,12 @@ func parseTime(v string) time.Duration {
 		return time.Duration(num) * time.Minute
 	}
 
+	// Lastly, try a duration with explicit units. E.g.: "1h30m" or "45s".
+	// Again, negative values are caught by the caller.
+	d, err := time.ParseDuration(v)
+	if err == nil {
+		return d
+	}
+
 	return 0
 }
@@ -0,0 +1,195 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package alarm
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd"
+	"github.com/monkeybird/autimaat/irc/cmd/cmdtest"
+)
+
+type mockWriter struct {
+	bytes.Buffer
+}
+
+func (mw *mockWriter) Close() error { return nil }
+
+func TestListReminders(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	day := time.Date(2017, 1, 2, 0, 0, 0, 0, time.Local)
+
+	p.table["aaaaa"] = alarm{
+		SenderMask: "~steve@example.com",
+		SenderName: "steve",
+		Target:     "#test",
+		Message:    TextMessagePrefix + "Eten koken.",
+		When:       day.Add(18*time.Hour + 15*time.Minute),
+	}
+	p.table["bbbbb"] = alarm{
+		SenderMask: "~bob@example.com",
+		SenderName: "bob",
+		Target:     "#test",
+		Message:    TextDefaultMessage,
+		When:       day.Add(9 * time.Hour),
+	}
+	p.table["ccccc"] = alarm{
+		SenderMask: "~Steve@example.com",
+		SenderName: "steve",
+		Target:     "#test",
+		Message:    TextDefaultMessage,
+		When:       day.Add(12 * time.Hour),
+	}
+
+	cmdtest.CheckAs(t, p.cmd, "~steve@example.com", "#test", "!reminders",
+		"PRIVMSG steve :steve, je hebt 2 alarm(en) ingesteld:\r\n"+
+			"PRIVMSG steve :\x02ccccc\x02 op 02-01-2017 12:00: Snooze tijd!\r\n"+
+			"PRIVMSG steve :\x02aaaaa\x02 op 02-01-2017 18:15: Eten koken.\r\n")
+
+	cmdtest.CheckAs(t, p.cmd, "~alice@example.com", "#test", "!reminders",
+		"PRIVMSG steve :steve, je hebt geen alarmen ingesteld.\r\n")
+}
+
+func TestParseTimeZones(t *testing.T) {
+	amsterdam := mustLoadLocation(t, "Europe/Amsterdam")
+	newYork := mustLoadLocation(t, "America/New_York")
+	tokyo := mustLoadLocation(t, "Asia/Tokyo")
+
+	// 2017-01-02 12:00 in Amsterdam. This is 06:00 in New York
+	// and 20:00 in Tokyo.
+	now := time.Date(2017, 1, 2, 12, 0, 0, 0, amsterdam)
+
+	for _, tt := range []struct {
+		now  time.Time
+		v    string
+		want time.Duration
+	}{
+		{now, "18:15", 6*time.Hour + 15*time.Minute},
+		{now, "11:00", 23 * time.Hour},
+		{now, "18:15@Europe/Amsterdam", 6*time.Hour + 15*time.Minute},
+		{now, "07:00@America/New_York", time.Hour},
+		{now, "05:00@America/New_York", 23 * time.Hour},
+		{now, "21:30@Asia/Tokyo", 90 * time.Minute},
+		{now, "08:00@Asia/Tokyo", 12 * time.Hour},
+		{now, "12:00@UTC", time.Hour},
+		{now.In(newYork), "07:00", time.Hour},
+		{now.In(tokyo), "07:00@Europe/Amsterdam", 19 * time.Hour},
+		{now, "10", 10 * time.Minute},
+		{now, "10@UTC", 0},
+		{now, "18:15@Mars/Olympus", 0},
+		{now, "18:15@", 0},
+	} {
+		if have := parseTime(tt.v, tt.now); have != tt.want {
+			t.Fatalf("duration mismatch for %q at %v;\nwant: %v\nhave: %v",
+				tt.v, tt.now, tt.want, have)
+		}
+	}
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skip("time zone data not available:", err)
+	}
+	return loc
+}
+
+func TestParseTimeDurations(t *testing.T) {
+	now := time.Date(2017, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		v    string
+		want time.Duration
+	}{
+		{"1h30m", 90 * time.Minute},
+		{"90", 90 * time.Minute},
+		{"45s", 45 * time.Second},
+		{"2h", 2 * time.Hour},
+		{"18:15", 6*time.Hour + 15*time.Minute},
+		{"-1h", -time.Hour},
+		{"1h30", 0},
+		{"morgen", 0},
+		{"", 0},
+	} {
+		if have := parseTime(tt.v, now); have != tt.want {
+			t.Fatalf("duration mismatch for %q;\nwant: %v\nhave: %v", tt.v, tt.want, have)
+		}
+	}
+}
+
+func TestPrivateReminder(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	var w cmdtest.Writer
+	for id, data := range map[string]string{
+		"aaaaa": "!reminder pm 1s Pillen innemen.",
+		"bbbbb": "!reminder 1s Eten koken.",
+		"ccccc": "!reminder PM 1s",
+		"ddddd": `!reminder "1s" "Eten" koken.`,
+	} {
+		var params cmd.ParamList
+		set := cmd.New([]string{"!"}, nil)
+		set.Bind(TextReminder, false, func(_ irc.ResponseWriter, _ *irc.Request, v cmd.ParamList) {
+			params = v
+		}).Add(TextTimestamp, true, cmd.RegAny).Add(TextMessage, false, cmd.RegAny)
+
+		r := cmdtest.NewRequest(cmdtest.Mask, "#test", data)
+		cmdtest.Run(t, set, r)
+
+		if !p.addReminder(&w, r, params, id) {
+			t.Fatalf("reminder %q not set", data)
+		}
+	}
+
+	for id, msg := range map[string]string{"aaaaa": "Pillen innemen.", "ddddd": `"Eten" koken.`} {
+		if have := p.table[id].Message; have != TextMessagePrefix+msg {
+			t.Fatalf("message mismatch for %q;\nwant: %q\nhave: %q", id, TextMessagePrefix+msg, have)
+		}
+	}
+
+	want := map[string]string{"aaaaa": "steve", "bbbbb": "#test", "ccccc": "steve", "ddddd": "#test"}
+	for id, target := range want {
+		if have := p.table[id].Target; have != target {
+			t.Fatalf("target mismatch for %q;\nwant: %q\nhave: %q", id, target, have)
+		}
+	}
+
+	// Fire the alarms.
+	for id, a := range p.table {
+		a.When = time.Now().Add(-time.Second)
+		p.table[id] = a
+	}
+
+	var out mockWriter
+	irc.Connection = &out
+	defer func() { irc.Connection = nil }()
+
+	p.checkExpiredAlarms()
+
+	have := out.String()
+	for _, line := range []string{
+		"PRIVMSG steve :steve, het is ",
+		"PRIVMSG #test :steve, het is ",
+	} {
+		if !bytes.Contains([]byte(have), []byte(line)) {
+			t.Fatalf("missing %q in output:\n%s", line, have)
+		}
+	}
+
+	if n := bytes.Count([]byte(have), []byte("PRIVMSG steve :")); n != 2 {
+		t.Fatalf("private message count mismatch;\nwant: 2\nhave: %d", n)
+	}
+}
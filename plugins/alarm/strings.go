@@ -15,4 +15,10 @@ const (
 	TextMessagePrefix  = "%s, het is %s: "
 	TextAlarmSet       = "%s, het alarm is ingesteld. Je kunt het verwijderen met: !reminder_remove %s"
 	TextAlarmUnset     = "%s, het alarm is verwijderd."
+	TextListReminders  = "reminders"
+	TextPrivateFlag    = "pm"
+	TextDateTimeFormat = "02-01-2006 15:04"
+	TextNoAlarms       = "%s, je hebt geen alarmen ingesteld."
+	TextAlarmList      = "%s, je hebt %d alarm(en) ingesteld:"
+	TextAlarmEntry     = "%s op %s: %s"
 )
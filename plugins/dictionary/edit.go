@@ -0,0 +1,193 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package dictionary
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/monkeybird/autimaat/app/util"
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd"
+)
+
+// timeNow returns the current time. It can be replaced by tests.
+var timeNow = time.Now
+
+// cmdAdd adds a new definition for the given term.
+func (p *plugin) cmdAdd(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	term := strings.ToLower(params.String(0))
+	if strings.Contains(term, ",") {
+		r.Reply(w, TextAddInvalid, r.SenderName, util.Bold("%s", params.String(0)))
+		return
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	meta := &metadata{
+		Nick: r.SenderName,
+		Mask: r.SenderMask,
+		When: timeNow(),
+	}
+
+	if !p.add(term, params.Rest(1), meta) {
+		r.Reply(w, TextAddDuplicate, r.SenderName, util.Bold("%s", term))
+		return
+	}
+
+	if !p.save(w, r) {
+		return
+	}
+
+	r.Reply(w, TextAddDone, r.SenderName, util.Bold("%s", term))
+}
+
+// cmdRemove removes the definitions of the given term. If an index is
+// given, only that definition is removed. Indices start at 1.
+func (p *plugin) cmdRemove(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	term := strings.ToLower(params.String(0))
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	indices, ok := p.terms[term]
+	if !ok {
+		r.Reply(w, TextDefineNotFound, r.SenderName, util.Bold("%s", term))
+		return
+	}
+
+	if params.Len() < 2 {
+		delete(p.terms, term)
+
+		if p.save(w, r) {
+			r.Reply(w, TextRemoveDone, r.SenderName, util.Bold("%s", term))
+		}
+		return
+	}
+
+	n := int(params.Uint(1))
+	if n < 1 || n > len(indices) {
+		r.Reply(w, TextRemoveInvalidIndex, r.SenderName, util.Bold("%s", term), n)
+		return
+	}
+
+	// The index list may be shared with other terms, so it must be copied.
+	set := make([]int, 0, len(indices)-1)
+	set = append(set, indices[:n-1]...)
+	set = append(set, indices[n:]...)
+
+	if len(set) == 0 {
+		delete(p.terms, term)
+	} else {
+		p.terms[term] = set
+	}
+
+	if p.save(w, r) {
+		r.Reply(w, TextRemoveIndexDone, r.SenderName, n, util.Bold("%s", term))
+	}
+}
+
+// add adds the given definition to the given term. Existing definitions
+// are shared, like they are when loading the dictionary. The metadata is
+// only stored for new definitions. Returns false if the term already has
+// this definition. The caller must hold the write lock.
+func (p *plugin) add(term, definition string, meta *metadata) bool {
+	index := indexOf(p.definitions, definition)
+	if index == -1 {
+		p.definitions = append(p.definitions, definition)
+		index = len(p.definitions) - 1
+		p.metadata[index] = meta
+	}
+
+	indices := p.terms[term]
+	for _, v := range indices {
+		if v == index {
+			return false
+		}
+	}
+
+	// The index list may be shared with other terms, so it must be copied.
+	set := make([]int, 0, len(indices)+1)
+	set = append(set, indices...)
+	p.terms[term] = append(set, index)
+	return true
+}
+
+// save writes the dictionary to disk. It informs the user if this fails.
+// The caller must hold the write lock.
+func (p *plugin) save(w irc.ResponseWriter, r *irc.Request) bool {
+	err := p.saveFile()
+	if err == nil {
+		return true
+	}
+
+	log.Println("[dictionary] save:", err)
+	r.Reply(w, TextSaveFailed, r.SenderName)
+	return false
+}
+
+// saveFile writes the dictionary to disk, in the format read by loadFile.
+// Terms with the exact same definitions are written as a single entry.
+// The caller must hold the write lock.
+func (p *plugin) saveFile() error {
+	groups := make(map[string][]string)
+	for term, indices := range p.terms {
+		key := fmt.Sprint(indices)
+		groups[key] = append(groups[key], term)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key, terms := range groups {
+		sort.Strings(terms)
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return groups[keys[i]][0] < groups[keys[j]][0]
+	})
+
+	tmp := p.file + ".tmp"
+	fd, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(fd)
+	for i, key := range keys {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+
+		terms := groups[key]
+		fmt.Fprintln(bw, strings.Join(terms, ", "))
+
+		for _, index := range p.terms[terms[0]] {
+			fmt.Fprint(bw, "> ", p.definitions[index])
+
+			if m, ok := p.metadata[index]; ok {
+				fmt.Fprint(bw, m)
+			}
+
+			fmt.Fprintln(bw)
+		}
+	}
+
+	err = bw.Flush()
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, p.file)
+}
@@ -0,0 +1,166 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package dictionary
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc/cmd/cmdtest"
+)
+
+func TestAddRemove(t *testing.T) {
+	p, prof := newTestPlugin(t)
+	defer p.Unload(prof)
+
+	timeNow = func() time.Time { return time.Date(2017, 1, 2, 13, 4, 5, 0, time.UTC) }
+	defer func() { timeNow = time.Now }()
+
+	cmdtest.Check(t, p.cmd, "#test", "!definieer Koffie Een zwarte, hete drank.",
+		"PRIVMSG #test :steve, de definitie voor \x02koffie\x02 is opgeslagen.\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!definieer koffie een ZWARTE, hete drank.",
+		"PRIVMSG #test :steve, deze definitie voor \x02koffie\x02 is al bekend.\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!definieer thee,koffie Drankjes.",
+		"PRIVMSG #test :steve, \x02thee,koffie\x02 is geen geldige term.\r\n")
+
+	// Terms of multiple words are quoted. The definition is not.
+	cmdtest.Check(t, p.cmd, "#test", `!definieer "rode wijn" Een drankje.`,
+		"PRIVMSG #test :steve, de definitie voor \x02rode wijn\x02 is opgeslagen.\r\n")
+	cmdtest.Check(t, p.cmd, "#test", `!watis "rode wijn"`,
+		"PRIVMSG #test :steve: Een drankje.\r\n")
+	cmdtest.Check(t, p.cmd, "#test", `!ondefinieer "rode wijn"`,
+		"PRIVMSG #test :steve, de term \x02rode wijn\x02 is verwijderd.\r\n")
+
+	// Adding a definition to a term must not affect terms which
+	// shared its definitions.
+	cmdtest.Check(t, p.cmd, "#test", "!definieer go Het bordspel.",
+		"PRIVMSG #test :steve, de definitie voor \x02go\x02 is opgeslagen.\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!watis golang",
+		"PRIVMSG #test :steve: Een programmeertaal, ontworpen bij Google.\r\n")
+
+	cmdtest.Check(t, p.cmd, "#test", "!ondefinieer irc 3",
+		"PRIVMSG #test :steve, \x02irc\x02 heeft geen definitie 3.\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!ondefinieer irc 1",
+		"PRIVMSG #test :steve, definitie 1 van \x02irc\x02 is verwijderd.\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!ondefinieer robot",
+		"PRIVMSG #test :steve, de term \x02robot\x02 is verwijderd.\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!ondefinieer robot",
+		"PRIVMSG #test :steve, de term \x02robot\x02 is niet bekend.\r\n")
+
+	want := `bot
+> Een programma dat automatisch taken uitvoert.
+
+go
+> Een programmeertaal, ontworpen bij Google.
+> Het bordspel. {{steve!~steve@example.com 2017-01-02T13:04:05Z}}
+
+golang
+> Een programmeertaal, ontworpen bij Google.
+
+irc
+> Een plek waar je tijd verdwijnt.
+
+koffie
+> Een zwarte, hete drank. {{steve!~steve@example.com 2017-01-02T13:04:05Z}}
+`
+
+	data, err := ioutil.ReadFile(p.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have := string(data); have != want {
+		t.Fatalf("file mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+
+	// The saved file should load into the same dictionary.
+	var q plugin
+	q.Load(prof)
+
+	cmdtest.Check(t, q.cmd, "#test", "!watis GO",
+		"PRIVMSG #test :steve: Een programmeertaal, ontworpen bij Google.\r\n"+
+			"PRIVMSG #test :steve: Het bordspel.\r\n")
+	cmdtest.Check(t, q.cmd, "#test", "!watis koffie",
+		"PRIVMSG #test :steve: Een zwarte, hete drank.\r\n")
+}
+
+func TestSaveShared(t *testing.T) {
+	p, prof := newTestPlugin(t)
+	defer p.Unload(prof)
+
+	p.m.Lock()
+	err := p.saveFile()
+	p.m.Unlock()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `bot, robot
+> Een programma dat automatisch taken uitvoert.
+
+go, golang
+> Een programmeertaal, ontworpen bij Google.
+
+irc
+> Internet Relay Chat: een chatprotocol uit 1988.
+> Een plek waar je tijd verdwijnt.
+`
+
+	data, _ := ioutil.ReadFile(p.file)
+	if have := string(data); have != want {
+		t.Fatalf("file mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	p, prof := newTestPlugin(t)
+	defer p.Unload(prof)
+
+	timeNow = func() time.Time { return time.Date(2017, 1, 2, 13, 4, 5, 0, time.UTC) }
+	defer func() { timeNow = time.Now }()
+
+	cmdtest.Check(t, p.cmd, "#test", "!definieer koffie Een zwarte, hete drank.",
+		"PRIVMSG #test :steve, de definitie voor \x02koffie\x02 is opgeslagen.\r\n")
+
+	// Metadata is hidden by default.
+	cmdtest.Check(t, p.cmd, "#test", "!watis koffie",
+		"PRIVMSG #test :steve: Een zwarte, hete drank.\r\n")
+
+	cfg := []byte(`{"ShowMetadata": true}`)
+	if err := ioutil.WriteFile(filepath.Join(prof.Root(), "dictionary.cfg"), cfg, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load the saved dictionary with metadata enabled.
+	var q plugin
+	q.Load(prof)
+
+	cmdtest.Check(t, q.cmd, "#test", "!watis koffie",
+		"PRIVMSG #test :steve: Een zwarte, hete drank. [toegevoegd door steve op 02-01-2017]\r\n")
+	cmdtest.Check(t, q.cmd, "#test", "!watis irc",
+		"PRIVMSG #test :steve: Internet Relay Chat: een chatprotocol uit 1988.\r\n"+
+			"PRIVMSG #test :steve: Een plek waar je tijd verdwijnt.\r\n")
+
+	m := q.metadata[indexOf(q.definitions, "Een zwarte, hete drank.")]
+	if m == nil || m.Nick != "steve" || m.Mask != "~steve@example.com" || !m.When.Equal(timeNow()) {
+		t.Fatalf("metadata mismatch: %+v", m)
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	for _, line := range []string{
+		"Gewone tekst.",
+		"Tekst met {{haakjes}}",
+		"Tekst met {{steve!mask geen-tijd}}",
+		"Tekst met {{steve 2017-01-02T13:04:05Z}}",
+	} {
+		def, m := parseMetadata(line)
+		if def != line || m != nil {
+			t.Fatalf("metadata mismatch for %q;\nwant: %q, <nil>\nhave: %q, %+v", line, line, def, m)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package dictionary
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// metadata describes who added a definition and when. It is stored at
+// the end of a definition line, as: "> definition {{nick!mask time}}".
+// The time is in RFC 3339 format. Definitions without it are still valid.
+type metadata struct {
+	Nick string
+	Mask string
+	When time.Time
+}
+
+const (
+	metadataOpen  = " {{"
+	metadataClose = "}}"
+)
+
+// String returns the metadata in the format it is stored in.
+func (m *metadata) String() string {
+	return fmt.Sprintf("%s%s!%s %s%s", metadataOpen, m.Nick, m.Mask,
+		m.When.UTC().Format(time.RFC3339), metadataClose)
+}
+
+// parseMetadata splits the given definition line into the definition
+// and its metadata. The metadata is nil if the line has none, or if it
+// can not be parsed. The line is then returned as is.
+func parseMetadata(line string) (string, *metadata) {
+	if !strings.HasSuffix(line, metadataClose) {
+		return line, nil
+	}
+
+	idx := strings.LastIndex(line, metadataOpen)
+	if idx == -1 {
+		return line, nil
+	}
+
+	fields := strings.Fields(line[idx+len(metadataOpen) : len(line)-len(metadataClose)])
+	if len(fields) != 2 {
+		return line, nil
+	}
+
+	sender := strings.SplitN(fields[0], "!", 2)
+	if len(sender) != 2 {
+		return line, nil
+	}
+
+	when, err := time.Parse(time.RFC3339, fields[1])
+	if err != nil {
+		return line, nil
+	}
+
+	return strings.TrimSpace(line[:idx]), &metadata{
+		Nick: sender[0],
+		Mask: sender[1],
+		When: when,
+	}
+}
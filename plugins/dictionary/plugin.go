@@ -7,11 +7,15 @@ package dictionary
 
 import (
 	"bufio"
+	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
 
 	"github.com/monkeybird/autimaat/app/util"
 	"github.com/monkeybird/autimaat/irc"
@@ -25,9 +29,14 @@ func init() { plugins.Register(&plugin{}) }
 type plugin struct {
 	m           sync.RWMutex
 	cmd         *cmd.Set
+	rng         *rand.Rand
 	file        string
 	terms       map[string][]int
 	definitions []string
+	metadata    map[int]*metadata
+	config      struct {
+		ShowMetadata bool
+	}
 }
 
 // Load initializes the module and loads any internal resources
@@ -37,21 +46,58 @@ func (p *plugin) Load(prof irc.Profile) error {
 
 	p.file = filepath.Join(prof.Root(), "dictionary.txt")
 	p.terms = make(map[string][]int)
+	p.metadata = make(map[int]*metadata)
+	p.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
 	p.cmd = cmd.New(
-		prof.CommandPrefix(),
+		prof.CommandPrefixes(),
 		prof.IsWhitelisted,
 	)
+	p.cmd.SetAcceptNotice(prof.NoticeCommands())
+	plugins.Track(p, p.cmd)
 
 	p.cmd.Bind(TextDefineName, false, p.cmdDefine).
 		Add(TextDefineTermName, true, cmd.RegAny)
 	p.cmd.Bind(TextDefinitionsName, false, p.cmdDefinitions)
-
+	p.cmd.Bind(TextSearchName, false, p.cmdSearch).
+		Add(TextSearchQueryName, true, cmd.RegAny)
+	p.cmd.Bind(TextRandomName, false, p.cmdRandom)
+	p.cmd.Bind(TextAddName, true, p.cmdAdd).
+		Add(TextDefineTermName, true, cmd.RegAny).
+		Add(TextAddDefinitionName, true, cmd.RegAny)
+	p.cmd.Bind(TextRemoveName, true, p.cmdRemove).
+		Add(TextDefineTermName, true, cmd.RegAny).
+		Add(TextRemoveIndexName, false, cmd.RegUint)
+
+	p.loadConfig(prof)
 	p.m.Unlock()
 	return p.loadFile()
 }
 
+// Reload reloads the plugin's configuration.
+func (p *plugin) Reload(prof irc.Profile) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.cmd.SetPrefixes(prof.CommandPrefixes())
+	return p.loadConfig(prof)
+}
+
+// loadConfig reads the plugin configuration from the profile. It is
+// optional. The caller must hold the write lock.
+func (p *plugin) loadConfig(prof irc.Profile) error {
+	p.config.ShowMetadata = false
+
+	err := prof.PluginConfig("dictionary", &p.config)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
 // Unload cleans the module up and unloads any internal resources.
 func (p *plugin) Unload(prof irc.Profile) error {
+	p.cmd.Close()
 	return nil
 }
 
@@ -69,12 +115,18 @@ func (p *plugin) cmdDefine(w irc.ResponseWriter, r *irc.Request, params cmd.Para
 	key := strings.ToLower(params.String(0))
 	indices, ok := p.terms[key]
 	if !ok {
-		proto.PrivMsg(w, r.Target, TextDefineNotFound, r.SenderName, util.Bold(params.String(0)))
+		r.Reply(w, TextDefineNotFound, r.SenderName, util.Bold("%s", params.String(0)))
 		return
 	}
 
 	for _, index := range indices {
-		proto.PrivMsg(w, r.Target, TextDefineDisplay, r.SenderName, p.definitions[index])
+		def := p.definitions[index]
+
+		if m, ok := p.metadata[index]; ok && p.config.ShowMetadata {
+			def += fmt.Sprintf(TextDefineMetadata, m.Nick, m.When.Format(TextDateFormat))
+		}
+
+		r.Reply(w, TextDefineDisplay, r.SenderName, def)
 	}
 }
 
@@ -91,21 +143,161 @@ func (p *plugin) cmdDefinitions(w irc.ResponseWriter, r *irc.Request, params cmd
 
 	sort.Strings(set)
 
-	proto.PrivMsg(w, r.SenderName, TextDefinitionsDisplay, util.Bold("%d", len(set)))
+	r.ReplyPrivate(w, TextDefinitionsDisplay, util.Bold("%d", len(set)))
+	sendList(w, r.SenderName, set, 30, ", ")
+}
+
+// cmdSearch presents the user with a list of all terms whose definitions
+// contain the given query, along with a snippet of the definition.
+func (p *plugin) cmdSearch(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	query := params.Rest(0)
+	set := p.search(query)
+
+	if len(set) == 0 {
+		r.Reply(w, TextSearchNotFound, r.SenderName, util.Bold("%s", query))
+		return
+	}
+
+	r.ReplyPrivate(w, TextSearchDisplay, util.Bold("%d", len(set)), util.Bold("%s", query))
+	sendList(w, r.SenderName, set, 5, " | ")
+}
+
+// cmdRandom presents the user with a random term and one of its
+// definitions.
+func (p *plugin) cmdRandom(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	// The random source is not safe for concurrent use, so
+	// this needs the write lock.
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if len(p.terms) == 0 {
+		r.Reply(w, TextRandomEmpty, r.SenderName)
+		return
+	}
+
+	// Map order is random as well, but not in a way we can seed.
+	set := make([]string, 0, len(p.terms))
+	for key := range p.terms {
+		set = append(set, key)
+	}
+
+	sort.Strings(set)
+
+	term := set[p.rng.Intn(len(set))]
+	indices := p.terms[term]
+	index := indices[p.rng.Intn(len(indices))]
+
+	r.Reply(w, TextRandomDisplay, util.Bold("%s", term), p.definitions[index])
+}
+
+// search returns a sorted list of entries for all definitions which
+// contain the given query. Each entry holds the terms which share the
+// definition and a snippet of it. The caller must hold the read lock.
+func (p *plugin) search(query string) []string {
+	needle := []rune(strings.TrimSpace(query))
+	for i, r := range needle {
+		needle[i] = unicode.ToLower(r)
+	}
+	if len(needle) == 0 {
+		return nil
+	}
+
+	var set []string
+	for index, def := range p.definitions {
+		pos := indexRunes(def, needle)
+		if pos == -1 {
+			continue
+		}
+
+		terms := p.termsFor(index)
+		if len(terms) == 0 {
+			continue
+		}
+
+		set = append(set, fmt.Sprintf(TextSearchEntry,
+			strings.Join(terms, ", "), snippet(def, pos, len(needle))))
+	}
+
+	sort.Strings(set)
+	return set
+}
+
+// termsFor returns the sorted list of terms which use the definition
+// with the given index. The caller must hold the read lock.
+func (p *plugin) termsFor(index int) []string {
+	var set []string
+
+	for key, indices := range p.terms {
+		for _, v := range indices {
+			if v == index {
+				set = append(set, key)
+				break
+			}
+		}
+	}
 
-	// We want to send this list in chunks. Else it will be cut
-	// off early and most of it is lost.
+	sort.Strings(set)
+	return set
+}
+
+// sendList sends the given list to target in chunks of the given size.
+// Else it will be cut off early and most of it is lost.
+func sendList(w irc.ResponseWriter, target string, set []string, size int, sep string) {
 	for {
-		if len(set) > 30 {
-			proto.PrivMsg(w, r.SenderName, strings.Join(set[:30], ", "))
-			set = set[30:]
+		if len(set) > size {
+			proto.PrivMsg(w, target, "%s", strings.Join(set[:size], sep))
+			set = set[size:]
 		} else {
-			proto.PrivMsg(w, r.SenderName, strings.Join(set, ", "))
+			proto.PrivMsg(w, target, "%s", strings.Join(set, sep))
 			break
 		}
 	}
 }
 
+// indexRunes returns the rune offset of the lower case needle in v.
+// The comparison is case-insensitive. Returns -1 if not found.
+func indexRunes(v string, needle []rune) int {
+	hay := []rune(v)
+	for i, r := range hay {
+		hay[i] = unicode.ToLower(r)
+	}
+
+	for i := 0; i+len(needle) <= len(hay); i++ {
+		if string(hay[i:i+len(needle)]) == string(needle) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// snippet returns the part of v surrounding the match of length n at
+// rune offset pos. Omitted text is marked with an ellipsis.
+func snippet(v string, pos, n int) string {
+	const context = 30
+
+	runes := []rune(v)
+	start, end := pos-context, pos+n+context
+
+	var prefix, suffix string
+	if start > 0 {
+		prefix = "..."
+	} else {
+		start = 0
+	}
+
+	if end < len(runes) {
+		suffix = "..."
+	} else {
+		end = len(runes)
+	}
+
+	return prefix + string(runes[start:end]) + suffix
+}
+
 // loadFile loads dictionary contents from disk.
 func (p *plugin) loadFile() error {
 	p.m.Lock()
@@ -131,7 +323,7 @@ func (p *plugin) loadFile() error {
 		// New definition for currently active term?
 		// These lines start with >
 		if strings.HasPrefix(line, ">") {
-			line = strings.TrimSpace(line[1:])
+			line, meta := parseMetadata(strings.TrimSpace(line[1:]))
 			if len(line) == 0 {
 				continue
 			}
@@ -145,6 +337,10 @@ func (p *plugin) loadFile() error {
 
 			p.definitions = append(p.definitions, line)
 			indices = append(indices, len(p.definitions)-1)
+
+			if meta != nil {
+				p.metadata[len(p.definitions)-1] = meta
+			}
 			continue
 		}
 
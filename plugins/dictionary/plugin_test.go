@@ -0,0 +1,96 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package dictionary
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd/cmdtest"
+)
+
+type mockWriter struct {
+	bytes.Buffer
+}
+
+func (mw *mockWriter) Close() error { return nil }
+
+// testDictionary defines the dictionary contents used by the tests.
+const testDictionary = `go, golang
+> Een programmeertaal, ontworpen bij Google.
+
+irc
+> Internet Relay Chat: een chatprotocol uit 1988.
+> Een plek waar je tijd verdwijnt.
+
+bot, robot
+> Een programma dat automatisch taken uitvoert.
+`
+
+// newTestPlugin returns a plugin, loaded with the test dictionary.
+func newTestPlugin(t *testing.T) (*plugin, irc.Profile) {
+	prof := irc.NewProfile(t.TempDir())
+	prof.WhitelistAdd(cmdtest.Mask)
+
+	file := filepath.Join(prof.Root(), "dictionary.txt")
+	if err := ioutil.WriteFile(file, []byte(testDictionary), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var p plugin
+	if err := p.Load(prof); err != nil {
+		t.Fatal(err)
+	}
+
+	return &p, prof
+}
+
+func TestSearch(t *testing.T) {
+	p, prof := newTestPlugin(t)
+	defer p.Unload(prof)
+
+	cmdtest.Check(t, p.cmd, "#test", "!zoek PROGRAM",
+		"PRIVMSG steve :Ik heb \x022\x02 definities gevonden met \x02PROGRAM\x02:\r\n"+
+			"PRIVMSG steve :bot, robot: Een programma dat automatisch taken uitvo... | "+
+			"go, golang: Een programmeertaal, ontworpen bij Google...\r\n")
+
+	cmdtest.Check(t, p.cmd, "#test", "!zoek chatprotocol uit",
+		"PRIVMSG steve :Ik heb \x021\x02 definities gevonden met \x02chatprotocol uit\x02:\r\n"+
+			"PRIVMSG steve :irc: Internet Relay Chat: een chatprotocol uit 1988.\r\n")
+
+	cmdtest.Check(t, p.cmd, "#test", `!zoek "een chatprotocol"`,
+		"PRIVMSG steve :Ik heb \x021\x02 definities gevonden met \x02een chatprotocol\x02:\r\n"+
+			"PRIVMSG steve :irc: Internet Relay Chat: een chatprotocol uit 1988.\r\n")
+
+	cmdtest.Check(t, p.cmd, "#test", "!zoek koffie",
+		"PRIVMSG #test :steve, ik heb geen definities gevonden met \x02koffie\x02.\r\n")
+}
+
+func TestRandom(t *testing.T) {
+	p, prof := newTestPlugin(t)
+	defer p.Unload(prof)
+
+	// Terms are picked from the sorted list: bot, go, golang, irc, robot.
+	// With this seed, the picks are irc and its second definition.
+	p.rng = rand.New(rand.NewSource(3))
+	cmdtest.Check(t, p.cmd, "#test", "!willekeurig",
+		"PRIVMSG #test :\x02irc\x02: Een plek waar je tijd verdwijnt.\r\n")
+
+	p.terms = make(map[string][]int)
+	cmdtest.Check(t, p.cmd, "#test", "!willekeurig",
+		"PRIVMSG #test :steve, ik ken nog geen termen.\r\n")
+}
+
+func TestSnippet(t *testing.T) {
+	v := "Dit is een hele lange definitie, waarin ergens het woord koffie voorkomt, maar niet vooraan."
+	want := "...itie, waarin ergens het woord koffie voorkomt, maar niet vooraan."
+
+	if have := snippet(v, indexRunes(v, []rune("koffie")), 6); have != want {
+		t.Fatalf("snippet mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
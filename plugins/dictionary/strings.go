@@ -8,7 +8,31 @@ const (
 	TextDefineTermName = "term"
 	TextDefineNotFound = "%s, de term %s is niet bekend."
 	TextDefineDisplay  = "%s: %s"
+	TextDefineMetadata = " [toegevoegd door %s op %s]"
+	TextDateFormat     = "02-01-2006"
 
 	TextDefinitionsName    = "definities"
 	TextDefinitionsDisplay = "Ik ken %s termen:"
+
+	TextSearchName      = "zoek"
+	TextSearchQueryName = "zoekterm"
+	TextSearchNotFound  = "%s, ik heb geen definities gevonden met %s."
+	TextSearchDisplay   = "Ik heb %s definities gevonden met %s:"
+	TextSearchEntry     = "%s: %s"
+
+	TextRandomName    = "willekeurig"
+	TextRandomEmpty   = "%s, ik ken nog geen termen."
+	TextRandomDisplay = "%s: %s"
+
+	TextAddName            = "definieer"
+	TextAddDefinitionName  = "definitie"
+	TextAddDone            = "%s, de definitie voor %s is opgeslagen."
+	TextAddDuplicate       = "%s, deze definitie voor %s is al bekend."
+	TextAddInvalid         = "%s, %s is geen geldige term."
+	TextRemoveName         = "ondefinieer"
+	TextRemoveIndexName    = "nummer"
+	TextRemoveDone         = "%s, de term %s is verwijderd."
+	TextRemoveIndexDone    = "%s, definitie %d van %s is verwijderd."
+	TextRemoveInvalidIndex = "%s, %s heeft geen definitie %d."
+	TextSaveFailed         = "%s, het woordenboek kon niet worden opgeslagen."
 )
@@ -5,9 +5,18 @@
 package plugins
 
 import (
+	"errors"
 	"log"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 
+	"github.com/monkeybird/autimaat/app/metrics"
 	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd"
 )
 
 // Plugin defines the interface for a single plugin.
@@ -24,41 +33,294 @@ type Plugin interface {
 	Dispatch(irc.ResponseWriter, *irc.Request)
 }
 
+// Reloader is implemented by plugins which can reload their configuration
+// while the bot is running. E.g.: to pick up a changed API key.
+type Reloader interface {
+	// Reload reloads the plugin's configuration.
+	Reload(irc.Profile) error
+}
+
+// Observer is implemented by plugins which track state from incoming
+// messages, where the order of those messages matters. E.g.: the members
+// of a channel, which are listed in multiple NAMES replies.
+type Observer interface {
+	// Observe is called for each incoming message, in the order they
+	// were received, before the message is passed to Dispatch. It must
+	// not block.
+	Observe(irc.ResponseWriter, *irc.Request)
+}
+
+// These errors are returned by Enable and Disable.
+var (
+	ErrNoSuchPlugin = errors.New("no such plugin")
+	ErrProtected    = errors.New("plugin can not be disabled")
+)
+
+// Protected lists the names of plugins which can not be disabled at
+// runtime. The admin plugin provides the commands to enable them again.
+var Protected = []string{"admin"}
+
 // List of registered plugins. This is to be filled during
 // proigram initialization and is considered read-only from then on.
 var plugins []Plugin
 
+var (
+	// change serializes calls which load or unload individual plugins.
+	// It also guards the profile, which is kept for plugins which are
+	// enabled after startup.
+	change  sync.Mutex
+	profile irc.Profile
+
+	// audit records calls to restricted commands. It writes to
+	// logs/audit.txt in the profile directory.
+	audit *cmd.AuditLog
+
+	// m guards the set of loaded plugins. Each one has a wait group,
+	// which tracks the calls to its Dispatch method.
+	m      sync.RWMutex
+	loaded = make(map[Plugin]*sync.WaitGroup)
+)
+
+// Info describes a registered plugin.
+type Info struct {
+	Name    string // Name of the plugin.
+	Enabled bool   // Is the plugin currently loaded?
+}
+
 // Register registers the given plugin. This is meant to be called during
 // program initialization, by imported plugin packages.
 func Register(p Plugin) { plugins = append(plugins, p) }
 
-// Load initializes all plugins.
-func Load(prof irc.Profile) {
+// Name returns the name of the given plugin. This is the name of the
+// package which defines it. E.g.: "weather".
+func Name(p Plugin) string {
+	t := reflect.TypeOf(p)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return path.Base(t.PkgPath())
+}
+
+// Track counts command calls in the given sets as calls handled by the
+// given plugin. The counts are reported by the metrics package. Calls to
+// restricted commands are written to the audit log. This is meant to be
+// called from a plugin's Load method.
+func Track(p Plugin, sets ...*cmd.Set) {
+	name := Name(p)
+	all := profile != nil && profile.AuditAllCommands()
+
+	for _, s := range sets {
+		s.SetCallHook(func(string) { metrics.Command(name) })
+		s.SetAuditHook(audit.Log)
+		s.SetAuditAll(all)
+	}
+}
+
+// List returns the names and states of all registered plugins, sorted
+// by name.
+func List() []Info {
+	m.RLock()
+	defer m.RUnlock()
+
+	out := make([]Info, 0, len(plugins))
 	for _, p := range plugins {
-		log.Printf("[plugins] Loading: %T", p)
+		out = append(out, Info{Name: Name(p), Enabled: loaded[p] != nil})
+	}
 
-		err := p.Load(prof)
-		if err != nil {
-			log.Printf("[%T] %v", p, err)
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// find returns the registered plugin with the given name, or nil if
+// there is none.
+func find(name string) Plugin {
+	for _, p := range plugins {
+		if strings.EqualFold(Name(p), name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Load initializes all plugins, except for those which are disabled in
+// the profile.
+func Load(prof irc.Profile) {
+	change.Lock()
+	defer change.Unlock()
+
+	profile = prof
+	disabled := prof.DisabledPlugins()
+
+	if audit == nil {
+		audit = cmd.NewAuditLog(filepath.Join(prof.Root(), "logs", "audit.txt"))
+	}
+
+	for _, p := range plugins {
+		if hasName(disabled, Name(p)) && !hasName(Protected, Name(p)) {
+			log.Printf("[plugins] Skipping disabled plugin: %T", p)
+			continue
 		}
+
+		load(prof, p)
 	}
 }
 
-// Unload unloads all plugins.
+// Unload unloads all loaded plugins.
 func Unload(prof irc.Profile) {
+	change.Lock()
+	defer change.Unlock()
+
+	for _, p := range plugins {
+		unload(prof, p)
+	}
+
+	audit.Close()
+}
+
+// Enable loads the plugin with the given name and marks it as enabled in
+// the profile passed to Load. This does nothing if the plugin is already
+// loaded. An error returned by the plugin's Load method is passed on, but
+// the plugin is considered loaded regardless; the same as when the bot
+// starts up.
+func Enable(name string) error {
+	change.Lock()
+	defer change.Unlock()
+
+	p := find(name)
+	if p == nil || profile == nil {
+		return ErrNoSuchPlugin
+	}
+
+	profile.SetPluginEnabled(Name(p), true)
+	return load(profile, p)
+}
+
+// Disable unloads the plugin with the given name and marks it as disabled
+// in the profile passed to Load, so it stays disabled after a restart. This does nothing
+// if the plugin is not loaded. Protected plugins can not be disabled.
+func Disable(name string) error {
+	change.Lock()
+	defer change.Unlock()
+
+	p := find(name)
+	if p == nil || profile == nil {
+		return ErrNoSuchPlugin
+	}
+
+	if hasName(Protected, Name(p)) {
+		return ErrProtected
+	}
+
+	profile.SetPluginEnabled(Name(p), false)
+	return unload(profile, p)
+}
+
+// load loads the given plugin, if it is not already loaded. The caller
+// must hold the change lock.
+func load(prof irc.Profile, p Plugin) error {
+	if isLoaded(p) {
+		return nil
+	}
+
+	log.Printf("[plugins] Loading: %T", p)
+
+	err := p.Load(prof)
+	if err != nil {
+		log.Printf("[%T] %v", p, err)
+	}
+
+	m.Lock()
+	loaded[p] = new(sync.WaitGroup)
+	m.Unlock()
+	return err
+}
+
+// unload unloads the given plugin, if it is loaded. The plugin stops
+// receiving messages and pending calls to its Dispatch method are allowed
+// to finish, before its Unload method is called. The caller must hold the
+// change lock.
+func unload(prof irc.Profile, p Plugin) error {
+	m.Lock()
+	wg := loaded[p]
+	delete(loaded, p)
+	m.Unlock()
+
+	if wg == nil {
+		return nil
+	}
+
+	wg.Wait()
+
+	log.Printf("[plugins] Unloading: %T", p)
+
+	err := p.Unload(prof)
+	if err != nil {
+		log.Printf("[%T] %v", p, err)
+	}
+	return err
+}
+
+// Reload reloads the configuration of all loaded plugins which support it.
+func Reload(prof irc.Profile) {
+	change.Lock()
+	defer change.Unlock()
+
 	for _, p := range plugins {
-		log.Printf("[plugins] Unloading: %T", p)
+		r, ok := p.(Reloader)
+		if !ok || !isLoaded(p) {
+			continue
+		}
+
+		log.Printf("[plugins] Reloading: %T", p)
 
-		err := p.Unload(prof)
+		err := r.Reload(prof)
 		if err != nil {
 			log.Printf("[%T] %v", p, err)
 		}
 	}
 }
 
-// Dispatch sends the given, incoming IRC message to all plugins.
+// Dispatch sends the given, incoming IRC message to all loaded plugins.
+// Plugins which implement Observer see it first. This happens before
+// Dispatch returns, so they see messages in the order they are passed in.
+// Each plugin's Dispatch method runs in a separate goroutine.
 func Dispatch(w irc.ResponseWriter, r *irc.Request) {
+	m.RLock()
+	defer m.RUnlock()
+
+	for _, p := range plugins {
+		if o, ok := p.(Observer); ok && loaded[p] != nil {
+			o.Observe(w, r)
+		}
+	}
+
 	for _, p := range plugins {
-		go p.Dispatch(w, r)
+		wg := loaded[p]
+		if wg == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(p Plugin) {
+			defer wg.Done()
+			p.Dispatch(w, r)
+		}(p)
+	}
+}
+
+// isLoaded returns true if the given plugin is loaded.
+func isLoaded(p Plugin) bool {
+	m.RLock()
+	defer m.RUnlock()
+	return loaded[p] != nil
+}
+
+// hasName returns true if list contains a case-insensitive version of name.
+func hasName(list []string, name string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, name) {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,188 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package plugins
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd"
+	"github.com/monkeybird/autimaat/irc/proto"
+)
+
+// mockWriter records all data written to it.
+type mockWriter struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (mw *mockWriter) Write(p []byte) (int, error) {
+	mw.m.Lock()
+	defer mw.m.Unlock()
+	return mw.buf.Write(p)
+}
+
+func (mw *mockWriter) Close() error { return nil }
+
+func (mw *mockWriter) String() string {
+	mw.m.Lock()
+	defer mw.m.Unlock()
+	return mw.buf.String()
+}
+
+// mockPlugin answers the "ping" command and counts Load and Unload calls.
+type mockPlugin struct {
+	cmd     *cmd.Set
+	loads   int
+	unloads int
+}
+
+func (p *mockPlugin) Load(prof irc.Profile) error {
+	p.loads++
+	p.cmd = cmd.New([]string{"!"}, nil)
+	p.cmd.Bind("ping", false, func(w irc.ResponseWriter, r *irc.Request, _ cmd.ParamList) {
+		proto.PrivMsg(w, r.Target, "pong")
+	})
+	return nil
+}
+
+func (p *mockPlugin) Unload(prof irc.Profile) error {
+	p.unloads++
+	p.cmd.Close()
+	return nil
+}
+
+func (p *mockPlugin) Dispatch(w irc.ResponseWriter, r *irc.Request) {
+	p.cmd.Dispatch(w, r)
+}
+
+// setPlugins replaces the registry with the given plugins for the
+// duration of the test.
+func setPlugins(t *testing.T, list ...Plugin) {
+	old := plugins
+	plugins = list
+	loaded = make(map[Plugin]*sync.WaitGroup)
+
+	t.Cleanup(func() {
+		plugins = old
+		loaded = make(map[Plugin]*sync.WaitGroup)
+		profile = nil
+	})
+}
+
+// ping dispatches a ping command and returns true if it was answered
+// within a reasonable time.
+func ping() bool {
+	var w mockWriter
+
+	Dispatch(&w, &irc.Request{
+		SenderName: "steve",
+		SenderMask: "~steve@example.com",
+		Type:       "PRIVMSG",
+		Target:     "#test",
+		Data:       "!ping",
+	})
+
+	for i := 0; i < 20; i++ {
+		if strings.Contains(w.String(), "pong") {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestEnableDisable(t *testing.T) {
+	var mp mockPlugin
+	setPlugins(t, &mp)
+
+	prof := irc.NewProfile(t.TempDir())
+	Load(prof)
+	defer Unload(prof)
+
+	name := Name(&mp)
+
+	if !ping() {
+		t.Fatalf("loaded plugin did not answer")
+	}
+
+	if err := Disable(name); err != nil {
+		t.Fatalf("disable failed: %v", err)
+	}
+
+	// Disabling twice should do nothing.
+	if err := Disable(name); err != nil {
+		t.Fatalf("second disable failed: %v", err)
+	}
+
+	if mp.unloads != 1 {
+		t.Fatalf("unload count mismatch;\nwant: 1\nhave: %d", mp.unloads)
+	}
+
+	if ping() {
+		t.Fatalf("disabled plugin answered")
+	}
+
+	if list := prof.DisabledPlugins(); len(list) != 1 || list[0] != name {
+		t.Fatalf("disabled list mismatch;\nwant: [%s]\nhave: %q", name, list)
+	}
+
+	if err := Enable(name); err != nil {
+		t.Fatalf("enable failed: %v", err)
+	}
+
+	// Enabling twice should do nothing.
+	if err := Enable(strings.ToUpper(name)); err != nil {
+		t.Fatalf("second enable failed: %v", err)
+	}
+
+	if mp.loads != 2 {
+		t.Fatalf("load count mismatch;\nwant: 2\nhave: %d", mp.loads)
+	}
+
+	if !ping() {
+		t.Fatalf("re-enabled plugin did not answer")
+	}
+
+	if list := prof.DisabledPlugins(); len(list) != 0 {
+		t.Fatalf("disabled list should be empty; have: %q", list)
+	}
+}
+
+func TestLoadDisabled(t *testing.T) {
+	var mp mockPlugin
+	setPlugins(t, &mp)
+
+	prof := irc.NewProfile(t.TempDir())
+	prof.SetPluginEnabled(Name(&mp), false)
+
+	Load(prof)
+	defer Unload(prof)
+
+	if mp.loads != 0 {
+		t.Fatalf("disabled plugin was loaded")
+	}
+
+	list := List()
+	if len(list) != 1 || list[0].Enabled {
+		t.Fatalf("plugin list mismatch; have: %+v", list)
+	}
+}
+
+func TestEnableErrors(t *testing.T) {
+	setPlugins(t)
+	Load(irc.NewProfile(t.TempDir()))
+
+	if err := Enable("missing"); err != ErrNoSuchPlugin {
+		t.Fatalf("enable error mismatch;\nwant: %v\nhave: %v", ErrNoSuchPlugin, err)
+	}
+
+	if err := Disable("missing"); err != ErrNoSuchPlugin {
+		t.Fatalf("disable error mismatch;\nwant: %v\nhave: %v", ErrNoSuchPlugin, err)
+	}
+}
@@ -0,0 +1,72 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Histogram counts the number of messages sent during each hour of the day.
+// Hours are taken from the bot's local time.
+type Histogram [24]uint64
+
+// Add increments the counter for the given hour.
+func (h *Histogram) Add(hour int) {
+	if hour >= 0 && hour < len(h) {
+		h[hour]++
+	}
+}
+
+// Peak returns the hour with the most messages.
+func (h *Histogram) Peak() int {
+	var peak int
+	for i, n := range h {
+		if n > h[peak] {
+			peak = i
+		}
+	}
+	return peak
+}
+
+// String renders the histogram as a compact bar of block characters,
+// one for each hour. Hours without messages are rendered as the lowest
+// block. Others are scaled relative to the busiest hour.
+func (h *Histogram) String() string {
+	blocks := []rune("▁▂▃▄▅▆▇█")
+	max := h[h.Peak()]
+
+	bar := make([]rune, len(h))
+	for i, n := range h {
+		if n == 0 {
+			bar[i] = blocks[0]
+			continue
+		}
+
+		level := (n*uint64(len(blocks)-1) + max - 1) / max
+		bar[i] = blocks[level]
+	}
+
+	return string(bar)
+}
+
+// statsData defines the contents of the stats data file.
+type statsData struct {
+	Users UserList
+
+	// Activity holds message histograms, keyed by lower case
+	// channel name.
+	Activity map[string]*Histogram `json:",omitempty"`
+}
+
+// UnmarshalJSON decodes the stats data. Older data files contain only
+// the list of users. These are still accepted.
+func (d *statsData) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return json.Unmarshal(data, &d.Users)
+	}
+
+	type plain statsData
+	return json.Unmarshal(data, (*plain)(d))
+}
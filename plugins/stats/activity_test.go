@@ -0,0 +1,66 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package stats
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd/cmdtest"
+)
+
+func TestActivity(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+	defer func() { timeNow = time.Now }()
+
+	send := func(hour int, target, data string) {
+		timeNow = func() time.Time {
+			return time.Date(2017, 1, 1, hour, 30, 0, 0, time.Local)
+		}
+
+		p.record(&irc.Request{SenderName: "bob", SenderMask: "~bob@example.com",
+			Type: "PRIVMSG", Target: target, Data: data})
+	}
+
+	for i := 0; i < 7; i++ {
+		send(21, "#test", "hallo")
+	}
+
+	send(9, "#test", "goedemorgen")
+	send(9, "#TEST", "koffie?")
+	send(9, "#test", "!weer")
+	send(0, "#other", "nacht")
+
+	h := p.activity["#test"]
+	if h == nil {
+		t.Fatalf("missing histogram for #test")
+	}
+
+	want := Histogram{9: 2, 21: 7}
+	if *h != want {
+		t.Fatalf("histogram mismatch;\nwant: %v\nhave: %v", want, *h)
+	}
+
+	cmdtest.Check(t, p.cmd, "#test", "!activity",
+		"PRIVMSG #test :Activiteit in #test (00-23 uur): ▁▁▁▁▁▁▁▁▁▃▁▁▁▁▁▁▁▁▁▁▁█▁▁. Drukste uur: 21:00.\r\n")
+}
+
+func TestLegacyData(t *testing.T) {
+	var d statsData
+
+	err := json.Unmarshal([]byte(`[{"Hostmask":"~bob@example.com","Nicknames":["bob"]}]`), &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Users) != 1 || d.Users[0].Nickname() != "bob" || d.Users[0].MessageCount("#test") != 0 {
+		t.Fatalf("legacy data mismatch: %+v", d.Users)
+	}
+}
@@ -0,0 +1,98 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package stats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/monkeybird/autimaat/app/util"
+)
+
+// regExportFormat matches the supported export formats.
+var regExportFormat = regexp.MustCompile(`^(?i)(csv|json)$`)
+
+// exportUser defines a single user, as written to an export file.
+type exportUser struct {
+	Hostmask  string
+	Nicknames []string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Messages  uint64
+}
+
+// csvHeader defines the column names of a CSV export.
+var csvHeader = []string{"hostmask", "nicknames", "first_seen", "last_seen", "messages"}
+
+// snapshot returns a copy of the user list, suitable for exporting.
+// The caller must hold at least the read lock.
+func (ul UserList) snapshot() []exportUser {
+	set := make([]exportUser, len(ul))
+
+	for i, u := range ul {
+		var total uint64
+		for _, n := range u.Messages {
+			total += n
+		}
+
+		set[i] = exportUser{
+			Hostmask:  u.Hostmask,
+			Nicknames: append([]string(nil), u.Nicknames...),
+			FirstSeen: u.FirstSeen,
+			LastSeen:  u.LastSeen,
+			Messages:  total,
+		}
+	}
+
+	return set
+}
+
+// exportFile writes the given users to a file in the given directory,
+// in the given format. It returns the name of the file.
+func exportFile(dir, format string, set []exportUser) (string, error) {
+	format = strings.ToLower(format)
+	file := filepath.Join(dir, "stats-export."+format)
+
+	switch format {
+	case "json":
+		return file, util.WriteFile(file, set, false)
+	case "csv":
+		return file, writeCSV(file, set)
+	}
+
+	return "", fmt.Errorf("unsupported export format %q", format)
+}
+
+// writeCSV writes the given users to the given file as CSV. Nicknames
+// are separated by spaces and times are in RFC 3339 format.
+func writeCSV(file string, set []exportUser) error {
+	fd, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	defer fd.Close()
+
+	w := csv.NewWriter(fd)
+	w.Write(csvHeader)
+
+	for _, u := range set {
+		w.Write([]string{
+			u.Hostmask,
+			strings.Join(u.Nicknames, " "),
+			u.FirstSeen.Format(time.RFC3339),
+			u.LastSeen.Format(time.RFC3339),
+			strconv.FormatUint(u.Messages, 10),
+		})
+	}
+
+	w.Flush()
+	return w.Error()
+}
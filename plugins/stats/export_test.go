@@ -0,0 +1,109 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package stats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/app/util"
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd/cmdtest"
+)
+
+func TestExport(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	prof.WhitelistAdd(cmdtest.Mask)
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	first := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	last := time.Date(2017, 3, 1, 8, 30, 0, 0, time.UTC)
+
+	p.users = UserList{
+		{
+			Hostmask:  "~bob@example.com",
+			Nicknames: []string{"bob", "bobby"},
+			FirstSeen: first,
+			LastSeen:  last,
+			Messages:  map[string]uint64{"#test": 3, "#other": 2},
+		},
+		{
+			Hostmask:  "~steve@example.com",
+			Nicknames: []string{"steve"},
+			FirstSeen: first,
+			LastSeen:  first,
+		},
+	}
+
+	want := []exportUser{
+		{"~bob@example.com", []string{"bob", "bobby"}, first, last, 5},
+		{"~steve@example.com", []string{"steve"}, first, first, 0},
+	}
+
+	for _, format := range []string{"json", "CSV"} {
+		file := filepath.Join(prof.Root(), "stats-export."+strings.ToLower(format))
+
+		cmdtest.Check(t, p.owner, "steve", "!statsexport "+format,
+			"PRIVMSG steve :"+fmt.Sprintf(TextExportDone, "steve", 2, file)+"\r\n")
+
+		var have []exportUser
+		if format == "json" {
+			if err := util.ReadFile(file, &have, false); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			have = readCSV(t, file)
+		}
+
+		if !reflect.DeepEqual(have, want) {
+			t.Fatalf("%s export mismatch;\nwant: %v\nhave: %v", format, want, have)
+		}
+	}
+}
+
+// readCSV reads the users back from a CSV export.
+func readCSV(t *testing.T, file string) []exportUser {
+	fd, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer fd.Close()
+
+	records, err := csv.NewReader(fd).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) == 0 || !reflect.DeepEqual(records[0], csvHeader) {
+		t.Fatalf("missing csv header in %q", records)
+	}
+
+	var set []exportUser
+	for _, rec := range records[1:] {
+		first, _ := time.Parse(time.RFC3339, rec[2])
+		last, _ := time.Parse(time.RFC3339, rec[3])
+		n, _ := strconv.ParseUint(rec[4], 10, 64)
+
+		set = append(set, exportUser{
+			Hostmask:  rec[0],
+			Nicknames: strings.Fields(rec[1]),
+			FirstSeen: first,
+			LastSeen:  last,
+			Messages:  n,
+		})
+	}
+
+	return set
+}
@@ -0,0 +1,116 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package stats
+
+import (
+	"encoding/hex"
+	"net"
+	"strings"
+)
+
+// MaskRule rewrites the user and host parts of a hostmask. It returns
+// the new values and true if it applied, or the original values and
+// false otherwise.
+type MaskRule func(user, host string) (string, string, bool)
+
+// MaskRules defines the rules applied by NormalizeMask, in order.
+var MaskRules = []MaskRule{
+	StripIdent,
+	GatewayIP,
+	HexIdent,
+	NormalizeIPv6,
+}
+
+// NormalizeMask normalizes the given user@host mask, so that users
+// connecting through different gateways or with differently formatted
+// hosts, map to the same identity. The result is in lower case.
+func NormalizeMask(mask string) string {
+	idx := strings.LastIndex(mask, "@")
+	if idx == -1 {
+		return strings.ToLower(mask)
+	}
+
+	user, host := mask[:idx], mask[idx+1:]
+	for _, rule := range MaskRules {
+		user, host, _ = rule(user, host)
+	}
+
+	return strings.ToLower(user + "@" + host)
+}
+
+// StripIdent removes the '~' prefix the server adds to user names which
+// were not confirmed by an ident server.
+func StripIdent(user, host string) (string, string, bool) {
+	if !strings.HasPrefix(user, "~") {
+		return user, host, false
+	}
+	return user[1:], host, true
+}
+
+// GatewayIP replaces gateway hosts which embed the user's address, with
+// the address itself. E.g.: "gateway/web/freenode/ip.1.2.3.4".
+func GatewayIP(user, host string) (string, string, bool) {
+	idx := strings.LastIndex(host, "/ip.")
+	if idx == -1 {
+		return user, host, false
+	}
+
+	ip := net.ParseIP(host[idx+4:])
+	if ip == nil {
+		return user, host, false
+	}
+
+	return user, ip.String(), true
+}
+
+// hexIdentHosts lists the hosts of web gateways which encode the user's
+// IPv4 address as a hexadecimal user name.
+var hexIdentHosts = []string{
+	"mibbit.com",
+	"mibbit.net",
+	"kiwiirc.com",
+}
+
+// HexIdent replaces the host of a known web gateway with the user's IPv4
+// address, which these gateways encode as a hexadecimal user name.
+// E.g.: "5b8f1a2c@mibbit.com" yields "5b8f1a2c@91.143.26.44".
+func HexIdent(user, host string) (string, string, bool) {
+	if len(user) != 8 || !isGatewayHost(host) {
+		return user, host, false
+	}
+
+	data, err := hex.DecodeString(user)
+	if err != nil {
+		return user, host, false
+	}
+
+	return user, net.IP(data).String(), true
+}
+
+// isGatewayHost returns true if host is, or is a sub domain of,
+// one of the hexIdentHosts.
+func isGatewayHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, v := range hexIdentHosts {
+		if host == v || strings.HasSuffix(host, "."+v) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeIPv6 rewrites IPv6 hosts into their canonical form, so that
+// differently abbreviated versions of the same address match.
+func NormalizeIPv6(user, host string) (string, string, bool) {
+	if !strings.Contains(host, ":") {
+		return user, host, false
+	}
+
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	if ip == nil || ip.To4() != nil {
+		return user, host, false
+	}
+
+	return user, ip.String(), true
+}
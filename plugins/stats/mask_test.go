@@ -0,0 +1,29 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package stats
+
+import "testing"
+
+func TestNormalizeMask(t *testing.T) {
+	for _, tt := range []struct {
+		mask string
+		want string
+	}{
+		{"~Steve@Example.com", "steve@example.com"},
+		{"5b8f1a2c@mibbit.com", "5b8f1a2c@91.143.26.44"},
+		{"~5B8F1A2C@webchat.mibbit.com", "5b8f1a2c@91.143.26.44"},
+		{"~5b8f1a2c@gateway/web/freenode/ip.91.143.26.44", "5b8f1a2c@91.143.26.44"},
+		{"~bob@gateway/web/cgi-irc/kiwiirc.com/ip.2001:db8::1", "bob@2001:db8::1"},
+		{"bob@2001:0DB8:0000:0000:0000:0000:0000:0001", "bob@2001:db8::1"},
+		{"bob@2001:db8::1", "bob@2001:db8::1"},
+		{"bob@ABCD:EF01:2345:IP", "bob@abcd:ef01:2345:ip"},
+		{"nothex12@mibbit.com", "nothex12@mibbit.com"},
+		{"5b8f1a2c@example.com", "5b8f1a2c@example.com"},
+		{"server.example.com", "server.example.com"},
+	} {
+		if have := NormalizeMask(tt.mask); have != tt.want {
+			t.Fatalf("mask mismatch for %q;\nwant: %q\nhave: %q", tt.mask, tt.want, have)
+		}
+	}
+}
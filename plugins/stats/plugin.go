@@ -0,0 +1,467 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package stats keeps track of users the bot has seen. It records the
+// hostmasks and nicknames they use, when they were first and last seen,
+// and how many messages they send to channels.
+//
+// Find out when someone was first seen:
+//
+//	<steve> !firston bob
+//	<bot> steve, ik zag bob voor het eerst op 01-02-2017 13:37.
+//
+// Find out when someone was last seen and what they said:
+//
+//	<steve> !seen bob
+//	<bot> steve, ik zag bob 2 uur en 5 minuten geleden in #test: doei!
+//
+// List the most active users in the current channel:
+//
+//	<steve> !top 3
+//	<bot> Meest actieve gebruikers in #test: 1. bob (120), 2. steve (80), 3. alice (12)
+//
+// Show the number of messages in the current channel for each hour of the
+// day. Hours are in the bot's local time:
+//
+//	<steve> !activity
+//	<bot> Activiteit in #test (00-23 uur): ▁▁▁▁▁▁▁▂▃▄▄▅▅▄▃▄▅▆▇█▇▅▃▂. Drukste uur: 19:00.
+package stats
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/monkeybird/autimaat/app/util"
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd"
+	"github.com/monkeybird/autimaat/plugins"
+)
+
+func init() { plugins.Register(&plugin{}) }
+
+var (
+	// SaveInterval defines how often modified user data is written to disk.
+	SaveInterval = time.Minute * 5
+
+	// PurgeCheck defines how often users who have not been seen for
+	// longer than the profile's retention period, are removed.
+	PurgeCheck = time.Hour * 24
+)
+
+const (
+	// DefaultTopCount defines the number of users listed by !top,
+	// if no explicit count is given.
+	DefaultTopCount = 5
+
+	// MaxTopCount defines the maximum number of users listed by !top.
+	MaxTopCount = 10
+
+	// MaxSnippetLength defines the maximum number of characters of
+	// a user's last message, shown by !seen.
+	MaxSnippetLength = 100
+)
+
+// timeNow returns the current time. It can be replaced by tests.
+var timeNow = time.Now
+
+type plugin struct {
+	m        sync.RWMutex
+	profile  irc.Profile
+	file     string
+	nickname string
+	prefixes []string
+	root     string
+	cmd      *cmd.Set
+	owner    *cmd.Set
+	users    UserList
+	activity map[string]*Histogram
+	dirty    bool
+	quitOnce sync.Once
+	quit     chan struct{}
+}
+
+// Load initializes the module and loads any internal resources
+// which may be required.
+func (p *plugin) Load(prof irc.Profile) error {
+	p.quitOnce = sync.Once{}
+	p.quit = make(chan struct{})
+	p.profile = prof
+	p.root = prof.Root()
+	p.file = filepath.Join(p.root, "stats.dat")
+	p.nickname = prof.Nickname()
+	p.prefixes = prof.CommandPrefixes()
+
+	p.cmd = cmd.New(prof.CommandPrefixes(), nil)
+	p.cmd.SetAcceptNotice(prof.NoticeCommands())
+	p.cmd.Bind(TextFirstOnName, false, p.cmdFirstOn).
+		Add(TextNick, true, cmd.RegAny)
+	p.cmd.Bind(TextTopName, false, p.cmdTop).
+		Add(TextCount, false, cmd.RegUint)
+	p.cmd.Bind(TextSeenName, false, p.cmdSeen).
+		Add(TextNick, true, cmd.RegAny)
+	p.cmd.Bind(TextActivityName, false, p.cmdActivity)
+
+	// Exporting user data is reserved for owners.
+	p.owner = cmd.New(prof.CommandPrefixes(), prof.IsOwner)
+	p.owner.SetAcceptNotice(prof.NoticeCommands())
+	plugins.Track(p, p.cmd, p.owner)
+	p.owner.Bind(TextExportName, true, p.cmdExport).
+		Add(TextFormat, true, regExportFormat)
+	p.owner.Bind(TextPurgeName, true, p.cmdPurge)
+
+	var data statsData
+	err := util.ReadFile(p.file, &data, true)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	p.users = data.Users
+	p.users.Normalize()
+	p.activity = data.Activity
+	if p.activity == nil {
+		p.activity = make(map[string]*Histogram)
+	}
+
+	// The bot may have been offline for a while. Don't wait for the
+	// first purge check to remove users who went stale in the meantime.
+	if n := p.purge(); n > 0 {
+		log.Printf("[stats] Purged %d stale user(s)", n)
+	}
+
+	go p.poll(p.quit)
+	return nil
+}
+
+// Reload reloads the plugin's configuration.
+func (p *plugin) Reload(prof irc.Profile) error {
+	p.m.Lock()
+	p.prefixes = prof.CommandPrefixes()
+	p.m.Unlock()
+
+	p.cmd.SetPrefixes(prof.CommandPrefixes())
+	p.owner.SetPrefixes(prof.CommandPrefixes())
+	return nil
+}
+
+// Unload cleans the module up and unloads any internal resources.
+func (p *plugin) Unload(prof irc.Profile) error {
+	p.cmd.Close()
+	p.owner.Close()
+
+	p.quitOnce.Do(func() {
+		close(p.quit)
+	})
+	return p.save()
+}
+
+// Dispatch sends the given, incoming IRC message to the plugin for
+// processing as it sees fit.
+func (p *plugin) Dispatch(w irc.ResponseWriter, r *irc.Request) {
+	switch r.Type {
+	case "JOIN", "PRIVMSG":
+		p.record(r)
+
+	case "NICK":
+		p.rename(r)
+	}
+
+	p.cmd.Dispatch(w, r)
+	p.owner.Dispatch(w, r)
+}
+
+// record updates the user data for the sender of the given request.
+// Channel messages are counted, unless they are commands. Messages
+// from the bot itself are ignored altogether.
+func (p *plugin) record(r *irc.Request) {
+	if len(r.SenderMask) == 0 || strings.EqualFold(r.SenderName, p.nickname) {
+		return
+	}
+
+	now := timeNow()
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	u := p.users.Get(NormalizeMask(r.SenderMask), now)
+	u.AddNickname(r.SenderName)
+	u.LastSeen = now
+
+	if r.IsPrivMsg() && r.FromChannel() {
+		u.LastMessage = r.Data
+		u.LastChannel = r.Target
+
+		if !p.isCommand(r.Data) {
+			u.AddMessage(r.Target)
+			p.histogram(r.Target).Add(now.Hour())
+		}
+	}
+
+	p.dirty = true
+}
+
+// rename adds the new nickname from the given NICK request to the user
+// with the sender's hostmask. This links the old and new names to the
+// same user.
+func (p *plugin) rename(r *irc.Request) {
+	// The new nickname is normally parsed into the Target field. Some
+	// servers send it as a trailing parameter, which ends up in Data.
+	nick := strings.TrimPrefix(r.Data, ":")
+	if len(nick) == 0 {
+		nick = r.Target
+	}
+
+	if len(r.SenderMask) == 0 || len(nick) == 0 {
+		return
+	}
+
+	now := timeNow()
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	u := p.users.Get(NormalizeMask(r.SenderMask), now)
+	u.AddNickname(r.SenderName)
+	u.AddNickname(nick)
+	u.LastSeen = now
+	p.dirty = true
+}
+
+// isCommand returns true if the given message starts with a
+// command prefix.
+func (p *plugin) isCommand(v string) bool {
+	for _, prefix := range p.prefixes {
+		if len(prefix) > 0 && strings.HasPrefix(v, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// poll periodically writes modified user data to disk and purges
+// stale users, until quit is closed.
+func (p *plugin) poll(quit chan struct{}) {
+	save := time.NewTicker(SaveInterval)
+	defer save.Stop()
+
+	purge := time.NewTicker(PurgeCheck)
+	defer purge.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+
+		case <-save.C:
+			err := p.save()
+			if err != nil {
+				log.Println("[stats] save:", err)
+			}
+
+		case <-purge.C:
+			if n := p.purge(); n > 0 {
+				log.Printf("[stats] Purged %d stale user(s)", n)
+			}
+		}
+	}
+}
+
+// purge removes users who have not been seen for longer than the
+// profile's retention period. It returns the number of users removed.
+// Nothing is removed if the retention period is zero.
+func (p *plugin) purge() int {
+	retention := p.profile.StatsRetention()
+	if retention <= 0 {
+		return 0
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	n := p.users.Purge(timeNow().Add(-retention))
+	if n > 0 {
+		p.dirty = true
+	}
+
+	return n
+}
+
+// save writes the user data to disk, if it has been modified.
+func (p *plugin) save() error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if !p.dirty {
+		return nil
+	}
+
+	p.dirty = false
+	return util.WriteFile(p.file, &statsData{
+		Users:    p.users,
+		Activity: p.activity,
+	}, true)
+}
+
+// histogram returns the activity histogram for the given channel. It is
+// created if it does not yet exist. The caller must hold the write lock.
+func (p *plugin) histogram(channel string) *Histogram {
+	channel = strings.ToLower(channel)
+
+	h, ok := p.activity[channel]
+	if !ok {
+		h = new(Histogram)
+		p.activity[channel] = h
+	}
+
+	return h
+}
+
+// cmdFirstOn tells the caller when the given user was first seen.
+func (p *plugin) cmdFirstOn(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	name := params.String(0)
+
+	u := p.users.Find(name)
+	if u == nil {
+		r.Reply(w, TextUnknownUser, r.SenderName, util.Bold("%s", name))
+		return
+	}
+
+	r.Reply(w, TextFirstOn, r.SenderName,
+		util.Bold("%s", u.Nickname()), u.FirstSeen.Format(TextDateFormat))
+}
+
+// cmdTop lists the most active users in the current channel.
+func (p *plugin) cmdTop(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	if !r.FromChannel() {
+		r.Reply(w, TextChannelOnly, r.SenderName)
+		return
+	}
+
+	n := DefaultTopCount
+	if params.Len() > 0 {
+		n = int(params.Uint(0))
+	}
+
+	if n < 1 {
+		n = DefaultTopCount
+	} else if n > MaxTopCount {
+		n = MaxTopCount
+	}
+
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	top := p.users.Top(r.Target, n)
+	if len(top) == 0 {
+		r.Reply(w, TextTopEmpty, r.SenderName, r.Target)
+		return
+	}
+
+	set := make([]string, len(top))
+	for i, u := range top {
+		set[i] = fmt.Sprintf(TextTopEntry, i+1, u.Nickname(), u.MessageCount(r.Target))
+	}
+
+	r.Reply(w, TextTop, r.Target, strings.Join(set, ", "))
+}
+
+// cmdSeen tells the caller when the given user was last seen and, if
+// known, what their last channel message was.
+func (p *plugin) cmdSeen(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	name := params.String(0)
+
+	u := p.users.Find(name)
+	if u == nil {
+		r.Reply(w, TextUnknownUser, r.SenderName, util.Bold("%s", name))
+		return
+	}
+
+	nick := util.Bold("%s", u.Nickname())
+	ago := util.FormatDuration(timeNow().Sub(u.LastSeen))
+
+	if len(u.LastMessage) == 0 {
+		r.Reply(w, TextSeen, r.SenderName, nick, ago)
+	} else {
+		r.Reply(w, TextSeenMessage, r.SenderName, nick, ago,
+			u.LastChannel, snippet(u.Nickname(), u.LastMessage))
+	}
+
+	// Only known if the server supports the away-notify capability.
+	if msg, ok := irc.Members.Away(u.Nickname()); ok {
+		r.Reply(w, TextSeenAway, nick, msg)
+	}
+}
+
+// snippet returns a shortened, printable version of the given message.
+// CTCP actions are rendered as "* nick action".
+func snippet(nick, msg string) string {
+	const action = "\x01ACTION "
+	if strings.HasPrefix(msg, action) {
+		msg = "* " + nick + " " + strings.TrimSuffix(msg[len(action):], "\x01")
+	}
+
+	runes := []rune(msg)
+	if len(runes) > MaxSnippetLength {
+		msg = string(runes[:MaxSnippetLength]) + "..."
+	}
+
+	return msg
+}
+
+// cmdActivity shows the number of messages in the current channel for
+// each hour of the day.
+func (p *plugin) cmdActivity(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	if !r.FromChannel() {
+		r.Reply(w, TextChannelOnly, r.SenderName)
+		return
+	}
+
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	h, ok := p.activity[strings.ToLower(r.Target)]
+	if !ok {
+		r.Reply(w, TextTopEmpty, r.SenderName, r.Target)
+		return
+	}
+
+	r.Reply(w, TextActivity, r.Target, h.String(), h.Peak())
+}
+
+// cmdExport writes the user data to a file in the profile directory,
+// as either CSV or JSON. The data is copied under the read lock, so the
+// file itself can be written without blocking other handlers.
+func (p *plugin) cmdExport(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	p.m.RLock()
+	set := p.users.snapshot()
+	p.m.RUnlock()
+
+	file, err := exportFile(p.root, params.String(0), set)
+	if err != nil {
+		log.Println("[stats] export:", err)
+		r.ReplyPrivate(w, TextExportFailed, r.SenderName)
+		return
+	}
+
+	r.ReplyPrivate(w, TextExportDone, r.SenderName, len(set), file)
+}
+
+// cmdPurge removes stale users right away.
+func (p *plugin) cmdPurge(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
+	if p.profile.StatsRetention() <= 0 {
+		r.Reply(w, TextPurgeDisabled, r.SenderName)
+		return
+	}
+
+	r.Reply(w, TextPurged, r.SenderName, p.purge())
+}
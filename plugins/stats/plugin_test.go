@@ -0,0 +1,160 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package stats
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd/cmdtest"
+)
+
+type mockWriter struct {
+	bytes.Buffer
+}
+
+func (mw *mockWriter) Close() error { return nil }
+
+func TestMessageCount(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	send := func(nick, target, data string) {
+		p.record(&irc.Request{
+			SenderName: nick,
+			SenderMask: "~" + nick + "@example.com",
+			Type:       "PRIVMSG",
+			Target:     target,
+			Data:       data,
+		})
+	}
+
+	for i := 0; i < 3; i++ {
+		send("bob", "#test", "hallo")
+	}
+
+	send("steve", "#test", "hoi")
+	send("steve", "#test", "!top")
+	send("alice", "#test", "hee")
+	send("alice", "#test", "hee")
+	send("alice", "#other", "hee")
+	send("alice", "bot", "prive")
+	send(prof.Nickname(), "#test", "ik tel niet mee")
+
+	testCount(t, &p, "bob", "#test", 3)
+	testCount(t, &p, "steve", "#test", 1)
+	testCount(t, &p, "alice", "#TEST", 2)
+	testCount(t, &p, "alice", "#other", 1)
+
+	if u := p.users.Find(prof.Nickname()); u != nil {
+		t.Fatalf("bot messages should not be recorded")
+	}
+
+	cmdtest.Check(t, p.cmd, "#test", "!top",
+		"PRIVMSG #test :"+fmt.Sprintf(TextTop, "#test", "1. bob (3), 2. alice (2), 3. steve (1)")+"\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!top 2",
+		"PRIVMSG #test :"+fmt.Sprintf(TextTop, "#test", "1. bob (3), 2. alice (2)")+"\r\n")
+	cmdtest.Check(t, p.cmd, "#empty", "!top",
+		"PRIVMSG #empty :"+fmt.Sprintf(TextTopEmpty, "steve", "#empty")+"\r\n")
+}
+
+func TestPersistence(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var a plugin
+	a.Load(prof)
+	a.record(&irc.Request{SenderName: "bob", SenderMask: "~bob@example.com",
+		Type: "PRIVMSG", Target: "#test", Data: "hallo"})
+	a.Unload(prof)
+
+	var b plugin
+	b.Load(prof)
+	defer b.Unload(prof)
+
+	testCount(t, &b, "bob", "#test", 1)
+}
+
+func TestSeen(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	start := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return start }
+	defer func() { timeNow = time.Now }()
+
+	p.record(&irc.Request{SenderName: "bobby", SenderMask: "~bob@example.com",
+		Type: "JOIN", Target: "#test"})
+	p.record(&irc.Request{SenderName: "alice", SenderMask: "~alice@example.com",
+		Type: "JOIN", Target: "#test"})
+	p.record(&irc.Request{SenderName: "alice", SenderMask: "~alice@example.com",
+		Type: "PRIVMSG", Target: "#test", Data: "\x01ACTION zwaait\x01"})
+
+	timeNow = func() time.Time { return start.Add(2*time.Hour + 5*time.Minute) }
+
+	cmdtest.Check(t, p.cmd, "#test", "!seen bob",
+		"PRIVMSG #test :steve, ik zag \x02bobby\x02 2 uur en 5 minuten geleden.\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!seen ALI",
+		"PRIVMSG #test :steve, ik zag \x02alice\x02 2 uur en 5 minuten geleden in #test: * alice zwaait\r\n")
+	cmdtest.Check(t, p.cmd, "#test", "!seen carol",
+		"PRIVMSG #test :steve, ik ken niemand met de naam \x02carol\x02.\r\n")
+
+	irc.Members.SetAway("bobby", "lunch")
+	defer irc.Members.Reset()
+
+	cmdtest.Check(t, p.cmd, "#test", "!seen bob",
+		"PRIVMSG #test :steve, ik zag \x02bobby\x02 2 uur en 5 minuten geleden.\r\n"+
+			"PRIVMSG #test :\x02bobby\x02 is momenteel afwezig: lunch\r\n")
+}
+
+func TestRename(t *testing.T) {
+	prof := irc.NewProfile(t.TempDir())
+
+	var p plugin
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	p.Dispatch(&mockWriter{}, &irc.Request{SenderName: "bob",
+		SenderMask: "~bob@example.com", Type: "JOIN", Target: "#test"})
+	p.Dispatch(&mockWriter{}, &irc.Request{SenderName: "bob",
+		SenderMask: "~bob@example.com", Type: "NICK", Target: "bobby"})
+	p.Dispatch(&mockWriter{}, &irc.Request{SenderName: "bobby",
+		SenderMask: "~bob@example.com", Type: "NICK", Data: ":bobbel"})
+
+	if len(p.users) != 1 {
+		t.Fatalf("user count mismatch;\nwant: 1\nhave: %d", len(p.users))
+	}
+
+	want := []string{"bob", "bobby", "bobbel"}
+	have := p.users[0].Nicknames
+	if fmt.Sprint(have) != fmt.Sprint(want) {
+		t.Fatalf("nickname mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+
+	for _, nick := range want {
+		if u := p.users.Find(nick); u != p.users[0] {
+			t.Fatalf("find mismatch for %q", nick)
+		}
+	}
+}
+
+func testCount(t *testing.T, p *plugin, nick, channel string, want uint64) {
+	u := p.users.Find(nick)
+	if u == nil {
+		t.Fatalf("user %q not found", nick)
+	}
+
+	if have := u.MessageCount(channel); have != want {
+		t.Fatalf("message count mismatch for %q in %q;\nwant: %d\nhave: %d",
+			nick, channel, want, have)
+	}
+}
@@ -0,0 +1,108 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package stats
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/app/util"
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd/cmdtest"
+)
+
+// retentionProfile overrides the retention period of a profile.
+type retentionProfile struct {
+	irc.Profile
+	retention time.Duration
+}
+
+func (p *retentionProfile) StatsRetention() time.Duration { return p.retention }
+
+func TestPurge(t *testing.T) {
+	prof := &retentionProfile{
+		Profile:   irc.NewProfile(t.TempDir()),
+		retention: irc.DefaultStatsRetention,
+	}
+
+	var p plugin
+	prof.WhitelistAdd(cmdtest.Mask)
+	p.Load(prof)
+	defer p.Unload(prof)
+
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	day := time.Hour * 24
+	for _, tt := range []struct {
+		nick string
+		age  time.Duration
+	}{
+		{"old", 365 * day},
+		{"bob", 2 * day},
+		{"stale", 181 * day},
+		{"edge", 180 * day},
+		{"steve", 0},
+	} {
+		p.users = append(p.users, &User{
+			Hostmask:  "~" + tt.nick + "@example.com",
+			Nicknames: []string{tt.nick},
+			LastSeen:  now.Add(-tt.age),
+		})
+	}
+
+	// Purging is disabled.
+	prof.retention = 0
+	cmdtest.Check(t, p.owner, "steve", "!statspurge",
+		"PRIVMSG steve :"+fmt.Sprintf(TextPurgeDisabled, "steve")+"\r\n")
+
+	prof.retention = irc.DefaultStatsRetention
+	cmdtest.Check(t, p.owner, "steve", "!statspurge",
+		"PRIVMSG steve :"+fmt.Sprintf(TextPurged, "steve", 2)+"\r\n")
+
+	var have []string
+	for _, u := range p.users {
+		have = append(have, u.Nickname())
+	}
+
+	want := []string{"bob", "edge", "steve"}
+	if fmt.Sprint(have) != fmt.Sprint(want) {
+		t.Fatalf("purge mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func TestPurgeOnLoad(t *testing.T) {
+	root := t.TempDir()
+	prof := &retentionProfile{
+		Profile:   irc.NewProfile(root),
+		retention: irc.DefaultStatsRetention,
+	}
+
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	err := util.WriteFile(filepath.Join(root, "stats.dat"), &statsData{
+		Users: UserList{
+			{Hostmask: "old@example.com", Nicknames: []string{"old"}, LastSeen: now.AddDate(-1, 0, 0)},
+			{Hostmask: "bob@example.com", Nicknames: []string{"bob"}, LastSeen: now},
+		},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p plugin
+	if err := p.Load(prof); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Unload(prof)
+
+	if len(p.users) != 1 || p.users[0].Nickname() != "bob" {
+		t.Fatalf("stale users were not purged on load: %v", p.users)
+	}
+}
@@ -0,0 +1,31 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package stats
+
+const (
+	TextDateFormat    = "02-01-2006 15:04"
+	TextFirstOnName   = "firston"
+	TextTopName       = "top"
+	TextActivityName  = "activity"
+	TextExportName    = "statsexport"
+	TextFormat        = "formaat"
+	TextPurgeName     = "statspurge"
+	TextSeenName      = "seen"
+	TextNick          = "naam"
+	TextCount         = "aantal"
+	TextUnknownUser   = "%s, ik ken niemand met de naam %s."
+	TextFirstOn       = "%s, ik zag %s voor het eerst op %s."
+	TextTop           = "Meest actieve gebruikers in %s: %s"
+	TextTopEntry      = "%d. %s (%d)"
+	TextTopEmpty      = "%s, ik heb nog geen berichten geteld in %s."
+	TextChannelOnly   = "%s, dit commando werkt alleen in een kanaal."
+	TextSeen          = "%s, ik zag %s %s geleden."
+	TextSeenMessage   = "%s, ik zag %s %s geleden in %s: %s"
+	TextSeenAway      = "%s is momenteel afwezig: %s"
+	TextActivity      = "Activiteit in %s (00-23 uur): %s. Drukste uur: %02d:00."
+	TextExportDone    = "%s, %d gebruikers zijn geëxporteerd naar: %s"
+	TextExportFailed  = "%s, het exporteren is mislukt."
+	TextPurged        = "%s, er zijn %d verouderde gebruikers verwijderd."
+	TextPurgeDisabled = "%s, het opschonen van gebruikers is uitgeschakeld."
+)
@@ -0,0 +1,234 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package stats
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// User defines a single user, as identified by their hostmask.
+type User struct {
+	Hostmask  string
+	Nicknames []string
+	FirstSeen time.Time
+	LastSeen  time.Time
+
+	// LastMessage and LastChannel hold the last channel message sent
+	// by the user and the channel it was sent to.
+	LastMessage string `json:",omitempty"`
+	LastChannel string `json:",omitempty"`
+
+	// Messages holds the number of channel messages sent by the
+	// user, keyed by lower case channel name.
+	Messages map[string]uint64 `json:",omitempty"`
+}
+
+// Nickname returns the nickname the user was most recently seen with.
+func (u *User) Nickname() string {
+	if len(u.Nicknames) == 0 {
+		return ""
+	}
+	return u.Nicknames[len(u.Nicknames)-1]
+}
+
+// AddNickname adds the given nickname to the user's list of names. The
+// most recently used name is always the last one in the list.
+func (u *User) AddNickname(nick string) {
+	for i, v := range u.Nicknames {
+		if strings.EqualFold(v, nick) {
+			copy(u.Nicknames[i:], u.Nicknames[i+1:])
+			u.Nicknames = u.Nicknames[:len(u.Nicknames)-1]
+			break
+		}
+	}
+
+	u.Nicknames = append(u.Nicknames, nick)
+}
+
+// AddMessage increments the message counter for the given channel.
+func (u *User) AddMessage(channel string) {
+	if u.Messages == nil {
+		u.Messages = make(map[string]uint64)
+	}
+	u.Messages[strings.ToLower(channel)]++
+}
+
+// MessageCount returns the number of messages the user sent to the
+// given channel.
+func (u *User) MessageCount(channel string) uint64 {
+	return u.Messages[strings.ToLower(channel)]
+}
+
+// UserList defines a set of known users.
+type UserList []*User
+
+// Index returns the index of the user with the given hostmask.
+// Returns -1 if it can not be found.
+func (ul UserList) Index(mask string) int {
+	for i, u := range ul {
+		if strings.EqualFold(u.Hostmask, mask) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns the user with the given hostmask. A new entry is created
+// if it does not yet exist.
+func (ul *UserList) Get(mask string, now time.Time) *User {
+	if idx := ul.Index(mask); idx > -1 {
+		return (*ul)[idx]
+	}
+
+	u := &User{
+		Hostmask:  mask,
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+
+	*ul = append(*ul, u)
+	return u
+}
+
+// Normalize normalizes the hostmasks of all users. Users whose masks
+// end up being equal are merged into a single entry.
+func (ul *UserList) Normalize() {
+	set := (*ul)[:0]
+	seen := make(map[string]*User, len(*ul))
+
+	for _, u := range *ul {
+		u.Hostmask = NormalizeMask(u.Hostmask)
+
+		if v, ok := seen[u.Hostmask]; ok {
+			v.merge(u)
+			continue
+		}
+
+		seen[u.Hostmask] = u
+		set = append(set, u)
+	}
+
+	for i := len(set); i < len(*ul); i++ {
+		(*ul)[i] = nil
+	}
+
+	*ul = set
+}
+
+// merge adds the data of the given user to u. Values which only have
+// meaning for one entry, like the last message, are taken from the user
+// who was seen most recently.
+func (u *User) merge(v *User) {
+	older, newer := v, u
+	if u.LastSeen.Before(v.LastSeen) {
+		older, newer = u, v
+	}
+
+	names := append([]string(nil), older.Nicknames...)
+	merged := User{Nicknames: names}
+	for _, nick := range newer.Nicknames {
+		merged.AddNickname(nick)
+	}
+	u.Nicknames = merged.Nicknames
+
+	if v.FirstSeen.Before(u.FirstSeen) {
+		u.FirstSeen = v.FirstSeen
+	}
+
+	u.LastSeen = newer.LastSeen
+	u.LastMessage, u.LastChannel = newer.LastMessage, newer.LastChannel
+	if len(u.LastMessage) == 0 {
+		u.LastMessage, u.LastChannel = older.LastMessage, older.LastChannel
+	}
+
+	for channel, n := range v.Messages {
+		if u.Messages == nil {
+			u.Messages = make(map[string]uint64)
+		}
+		u.Messages[channel] += n
+	}
+}
+
+// Purge removes all users who were last seen before the given time.
+// It returns the number of users removed.
+func (ul *UserList) Purge(before time.Time) int {
+	set := (*ul)[:0]
+
+	for _, u := range *ul {
+		if !u.LastSeen.Before(before) {
+			set = append(set, u)
+		}
+	}
+
+	for i := len(set); i < len(*ul); i++ {
+		(*ul)[i] = nil
+	}
+
+	n := len(*ul) - len(set)
+	*ul = set
+	return n
+}
+
+// Find finds the user with the given nickname. An exact match is preferred.
+// If there is none, a nickname starting with, or containing the given name
+// will do. If multiple users qualify, the one seen most recently is
+// returned. Returns nil if no user qualifies.
+func (ul UserList) Find(name string) *User {
+	name = strings.ToLower(name)
+	if len(name) == 0 {
+		return nil
+	}
+
+	matchers := []func(string) bool{
+		func(v string) bool { return v == name },
+		func(v string) bool { return strings.HasPrefix(v, name) },
+		func(v string) bool { return strings.Contains(v, name) },
+	}
+
+	for _, match := range matchers {
+		var found *User
+
+		for _, u := range ul {
+			for _, nick := range u.Nicknames {
+				if !match(strings.ToLower(nick)) {
+					continue
+				}
+
+				if found == nil || u.LastSeen.After(found.LastSeen) {
+					found = u
+				}
+				break
+			}
+		}
+
+		if found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// Top returns at most n users with the most messages in the given channel,
+// in descending order. Users without messages in the channel are skipped.
+func (ul UserList) Top(channel string, n int) []*User {
+	set := make([]*User, 0, len(ul))
+	for _, u := range ul {
+		if u.MessageCount(channel) > 0 {
+			set = append(set, u)
+		}
+	}
+
+	sort.SliceStable(set, func(i, j int) bool {
+		return set[i].MessageCount(channel) > set[j].MessageCount(channel)
+	})
+
+	if len(set) > n {
+		set = set[:n]
+	}
+
+	return set
+}
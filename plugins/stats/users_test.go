@@ -0,0 +1,103 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package stats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFind(t *testing.T) {
+	now := time.Now()
+
+	var ul UserList
+	ul.Get("~bob@a.example.com", now).AddNickname("bob")
+	ul.Get("~bobby@b.example.com", now.Add(time.Minute)).AddNickname("bobby")
+	ul.Get("~steve@c.example.com", now).AddNickname("xsteve")
+
+	testFind(t, ul, "BOB", "~bob@a.example.com")
+	testFind(t, ul, "bobb", "~bobby@b.example.com")
+	testFind(t, ul, "steve", "~steve@c.example.com")
+	testFind(t, ul, "alice", "")
+	testFind(t, ul, "", "")
+}
+
+func TestAddNickname(t *testing.T) {
+	var u User
+	u.AddNickname("bob")
+	u.AddNickname("bobby")
+	u.AddNickname("Bob")
+
+	if len(u.Nicknames) != 2 || u.Nickname() != "Bob" {
+		t.Fatalf("nickname mismatch;\nwant: %q\nhave: %q",
+			[]string{"bobby", "Bob"}, u.Nicknames)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	ul := UserList{
+		{
+			Hostmask:    "~bob@a.example.com",
+			Nicknames:   []string{"bob", "bobby"},
+			FirstSeen:   now.Add(-time.Hour),
+			LastSeen:    now,
+			LastMessage: "hallo",
+			LastChannel: "#test",
+			Messages:    map[string]uint64{"#test": 2},
+		},
+		{
+			Hostmask:  "~steve@b.example.com",
+			Nicknames: []string{"steve"},
+			FirstSeen: now,
+			LastSeen:  now,
+		},
+		{
+			Hostmask:    "bob@A.example.com",
+			Nicknames:   []string{"Bobby", "robert"},
+			FirstSeen:   now.Add(-time.Minute),
+			LastSeen:    now.Add(-time.Minute),
+			LastMessage: "oud",
+			LastChannel: "#test",
+			Messages:    map[string]uint64{"#test": 3, "#other": 1},
+		},
+	}
+
+	ul.Normalize()
+
+	if len(ul) != 2 {
+		t.Fatalf("user count mismatch;\nwant: 2\nhave: %d", len(ul))
+	}
+
+	u := ul[0]
+	if u.Hostmask != "bob@a.example.com" || ul[1].Hostmask != "steve@b.example.com" {
+		t.Fatalf("hostmask mismatch: %q, %q", u.Hostmask, ul[1].Hostmask)
+	}
+
+	want := []string{"robert", "bob", "bobby"}
+	if fmt.Sprint(u.Nicknames) != fmt.Sprint(want) {
+		t.Fatalf("nickname mismatch;\nwant: %q\nhave: %q", want, u.Nicknames)
+	}
+
+	if !u.FirstSeen.Equal(now.Add(-time.Hour)) || !u.LastSeen.Equal(now) || u.LastMessage != "hallo" {
+		t.Fatalf("merged user mismatch: %+v", u)
+	}
+
+	if u.MessageCount("#test") != 5 || u.MessageCount("#other") != 1 {
+		t.Fatalf("message count mismatch: %v", u.Messages)
+	}
+}
+
+func testFind(t *testing.T, ul UserList, name, want string) {
+	var have string
+	if u := ul.Find(name); u != nil {
+		have = u.Hostmask
+	}
+
+	if have != want {
+		t.Fatalf("find mismatch for %q;\nwant: %q\nhave: %q", name, want, have)
+	}
+}
@@ -0,0 +1,120 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import (
+	"sync"
+	"time"
+)
+
+// Default cache settings.
+const (
+	DefaultCacheTTL   = time.Minute * 10
+	DefaultCacheSize  = 256
+	DefaultFailureTTL = time.Minute
+)
+
+// titleCache holds recently fetched page titles, keyed by url. An empty
+// title denotes a failed lookup. These are kept for a shorter time.
+type titleCache struct {
+	m          sync.Mutex
+	entries    map[string]*cacheEntry
+	ttl        time.Duration
+	failureTTL time.Duration
+	size       int
+}
+
+type cacheEntry struct {
+	title    string
+	expires  time.Time
+	lastUsed time.Time
+}
+
+// newTitleCache creates a cache which holds at most size titles for the
+// given duration. The failure duration is capped by ttl.
+func newTitleCache(ttl time.Duration, size int) *titleCache {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	failureTTL := DefaultFailureTTL
+	if failureTTL > ttl {
+		failureTTL = ttl
+	}
+
+	return &titleCache{
+		entries:    make(map[string]*cacheEntry),
+		ttl:        ttl,
+		failureTTL: failureTTL,
+		size:       size,
+	}
+}
+
+// Get returns the cached title for the given url, along with true if
+// an entry exists and has not yet expired.
+func (c *titleCache) Get(url string, now time.Time) (string, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.entries[url]
+	if !ok {
+		return "", false
+	}
+
+	if !now.Before(e.expires) {
+		delete(c.entries, url)
+		return "", false
+	}
+
+	e.lastUsed = now
+	return e.title, true
+}
+
+// Set adds the given title to the cache. If the cache is full, expired
+// entries are removed first, followed by the least recently used one.
+func (c *titleCache) Set(url, title string, now time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	ttl := c.ttl
+	if len(title) == 0 {
+		ttl = c.failureTTL
+	}
+
+	if _, ok := c.entries[url]; !ok && len(c.entries) >= c.size {
+		c.evict(now)
+	}
+
+	c.entries[url] = &cacheEntry{
+		title:    title,
+		expires:  now.Add(ttl),
+		lastUsed: now,
+	}
+}
+
+// evict removes all expired entries. If none have expired, it removes
+// the least recently used one. The caller must hold the lock.
+func (c *titleCache) evict(now time.Time) {
+	var oldest string
+	var oldestTime time.Time
+
+	for url, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, url)
+			continue
+		}
+
+		if len(oldest) == 0 || e.lastUsed.Before(oldestTime) {
+			oldest, oldestTime = url, e.lastUsed
+		}
+	}
+
+	if len(c.entries) >= c.size {
+		delete(c.entries, oldest)
+	}
+}
@@ -0,0 +1,88 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc"
+)
+
+func TestTitleCache(t *testing.T) {
+	now := time.Now()
+	c := newTitleCache(time.Minute*10, 2)
+
+	c.Set("a", "Titel A", now)
+	c.Set("b", "", now)
+
+	testCacheGet(t, c, "a", now.Add(time.Minute*9), "Titel A", true)
+	testCacheGet(t, c, "a", now.Add(time.Minute*10), "", false)
+
+	// Failed lookups expire sooner.
+	testCacheGet(t, c, "b", now.Add(DefaultFailureTTL-time.Second), "", true)
+	testCacheGet(t, c, "b", now.Add(DefaultFailureTTL), "", false)
+}
+
+func TestTitleCacheEviction(t *testing.T) {
+	now := time.Now()
+	c := newTitleCache(time.Minute*10, 2)
+
+	c.Set("a", "Titel A", now)
+	c.Set("b", "Titel B", now.Add(time.Second))
+	testCacheGet(t, c, "a", now.Add(time.Second*2), "Titel A", true)
+
+	// b is now the least recently used entry.
+	c.Set("c", "Titel C", now.Add(time.Second*3))
+	testCacheGet(t, c, "a", now.Add(time.Second*4), "Titel A", true)
+	testCacheGet(t, c, "b", now.Add(time.Second*4), "", false)
+	testCacheGet(t, c, "c", now.Add(time.Second*4), "Titel C", true)
+}
+
+func testCacheGet(t *testing.T, c *titleCache, url string, now time.Time, want string, wantOk bool) {
+	have, ok := c.Get(url, now)
+	if want != have || wantOk != ok {
+		t.Fatalf("cache mismatch for %q;\nwant: %q, %v\nhave: %q, %v",
+			url, want, wantOk, have, ok)
+	}
+}
+
+func TestFetchTitleCached(t *testing.T) {
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "<html><head><title>Populaire link</title></head></html>")
+	}))
+
+	defer srv.Close()
+
+	p := &plugin{
+		lookup: lookup{
+			client: http.DefaultClient,
+			cache:  newTitleCache(time.Minute, 10),
+		},
+	}
+
+	want := "PRIVMSG #test :De link van steve toont: Populaire link\r\n"
+
+	for i := 0; i < 2; i++ {
+		var w mockWriter
+		p.fetchTitle(&w, &irc.Request{SenderName: "steve", Target: "#test"}, srv.URL)
+
+		if have := w.String(); want != have {
+			t.Fatalf("output mismatch;\nwant: %q\nhave: %q", want, have)
+		}
+
+		// A HEAD and a GET request for the first lookup only.
+		if n := atomic.LoadInt32(&requests); n != 2 {
+			t.Fatalf("request count mismatch after lookup %d;\nwant: 2\nhave: %d", i+1, n)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import (
+	"mime"
+	"strings"
+)
+
+// pageCharset returns the character set of the given HTML document, in
+// lower case. It is taken from the Content-Type header, if set. Otherwise
+// the document's <meta> tags are consulted. This returns "utf-8" if no
+// character set is specified.
+func pageCharset(body []byte, ctype string) string {
+	if v := contentCharset(ctype); len(v) > 0 {
+		return v
+	}
+
+	for _, tag := range regMetaTag.FindAll(body, -1) {
+		attr := metaAttributes(tag)
+
+		// <meta charset="iso-8859-1">
+		if v := strings.TrimSpace(attr["charset"]); len(v) > 0 {
+			return strings.ToLower(v)
+		}
+
+		// <meta http-equiv="Content-Type" content="text/html; charset=iso-8859-1">
+		if strings.EqualFold(attr["http-equiv"], "content-type") {
+			if v := contentCharset(attr["content"]); len(v) > 0 {
+				return v
+			}
+		}
+	}
+
+	return "utf-8"
+}
+
+// contentCharset returns the charset parameter of the given content type,
+// in lower case.
+func contentCharset(ctype string) string {
+	_, params, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(params["charset"]))
+}
+
+// toUTF8 converts the given data from the specified character set to
+// UTF-8. Data in character sets we do not know about, is returned as-is.
+func toUTF8(data []byte, charset string) []byte {
+	var table *[128]rune
+
+	switch charset {
+	case "iso-8859-1", "iso8859-1", "latin1", "l1", "windows-1252", "cp1252":
+		// Web browsers treat ISO-8859-1 as Windows-1252, since documents
+		// labeled as such frequently use the latter's extra characters.
+		table = &windows1252
+	case "iso-8859-15", "iso8859-15", "latin9", "l9":
+		table = &iso885915
+	default:
+		return data
+	}
+
+	out := make([]byte, 0, len(data)*2)
+	for _, b := range data {
+		if b < 0x80 {
+			out = append(out, b)
+		} else {
+			out = append(out, string(table[b-0x80])...)
+		}
+	}
+
+	return out
+}
+
+// windows1252 maps bytes 0x80-0xff in Windows-1252 to their unicode code
+// points. Undefined bytes map to the code point of the same value.
+var windows1252 = upperHalf(map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„',
+	0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ',
+	0x89: '‰', 0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ',
+	0x8e: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“',
+	0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9a: 'š', 0x9b: '›',
+	0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+})
+
+// iso885915 maps bytes 0x80-0xff in ISO-8859-15 to their unicode code
+// points.
+var iso885915 = upperHalf(map[byte]rune{
+	0xa4: '€', 0xa6: 'Š', 0xa8: 'š', 0xb4: 'Ž',
+	0xb8: 'ž', 0xbc: 'Œ', 0xbd: 'œ', 0xbe: 'Ÿ',
+})
+
+// upperHalf returns a table for bytes 0x80-0xff, which maps each byte to
+// the code point of the same value, except for the given differences.
+func upperHalf(diff map[byte]rune) [128]rune {
+	var table [128]rune
+	for i := range table {
+		table[i] = rune(i + 0x80)
+	}
+	for b, r := range diff {
+		table[b-0x80] = r
+	}
+	return table
+}
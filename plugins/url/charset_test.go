@@ -0,0 +1,76 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestPageCharset(t *testing.T) {
+	testPageCharset(t, "", "", "utf-8")
+	testPageCharset(t, "", "text/html", "utf-8")
+	testPageCharset(t, "", "text/html; charset=ISO-8859-1", "iso-8859-1")
+	testPageCharset(t, `<meta charset="Shift_JIS">`, "text/html", "shift_jis")
+	testPageCharset(t, `<meta http-equiv="content-type" content="text/html; charset=windows-1252">`, "", "windows-1252")
+	testPageCharset(t, `<meta charset="iso-8859-15">`, "text/html; charset=utf-8", "utf-8")
+}
+
+func testPageCharset(t *testing.T, body, ctype, want string) {
+	have := pageCharset([]byte(body), ctype)
+	if want != have {
+		t.Fatalf("charset mismatch for %q, %q;\nwant: %q\nhave: %q",
+			body, ctype, want, have)
+	}
+}
+
+func TestCharsetFixtures(t *testing.T) {
+	testCharsetFixture(t, "latin1_meta.html", "Café & crème brûlée – € 5")
+	testCharsetFixture(t, "latin9_meta.html", "Prijs: € 10, œuvre")
+}
+
+func testCharsetFixture(t *testing.T, file, want string) {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	have := pageTitle(toUTF8(body, pageCharset(body, "text/html")))
+	if want != have {
+		t.Fatalf("title mismatch for %q;\nwant: %q\nhave: %q",
+			file, want, have)
+	}
+}
+
+func TestFetchLatin1(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=ISO-8859-1")
+		w.Write([]byte("<html><head><title>Ni\xf1o en ni\xf1a</title></head></html>"))
+	}))
+
+	defer srv.Close()
+
+	body, err := fetchBody(http.DefaultClient, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Niño en niña"
+	have := pageTitle(body)
+	if want != have {
+		t.Fatalf("title mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func TestUnknownCharset(t *testing.T) {
+	data := []byte("\x83e\x83X\x83g")
+
+	have := toUTF8(data, "shift_jis")
+	if string(have) != string(data) {
+		t.Fatalf("data mismatch;\nwant: %q\nhave: %q", data, have)
+	}
+}
@@ -0,0 +1,81 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import (
+	"net/url"
+	"strings"
+)
+
+// TrackingParams lists the query parameters which are removed from URLs
+// before they are fetched. Entries ending in "*" match any parameter with
+// the given prefix.
+var TrackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"msclkid",
+	"mc_cid",
+	"mc_eid",
+	"igshid",
+	"yclid",
+	"_hsenc",
+	"_hsmi",
+}
+
+// cleanURL returns the given url, without any of the query parameters in
+// TrackingParams. The url is returned unchanged if it has no tracking
+// parameters, or if it can not be parsed.
+func cleanURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil || len(u.RawQuery) == 0 {
+		return v
+	}
+
+	// The query is filtered by hand, rather than through url.Values,
+	// so the order and encoding of the remaining parameters is kept.
+	params := strings.Split(u.RawQuery, "&")
+	kept := params[:0]
+
+	for _, param := range params {
+		key := param
+		if n := strings.IndexByte(key, '='); n > -1 {
+			key = key[:n]
+		}
+
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+
+		if !isTrackingParam(key) {
+			kept = append(kept, param)
+		}
+	}
+
+	if len(kept) == len(params) {
+		return v
+	}
+
+	u.RawQuery = strings.Join(kept, "&")
+	return u.String()
+}
+
+// isTrackingParam returns true if the given query parameter name is
+// matched by TrackingParams.
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, v := range TrackingParams {
+		if strings.HasSuffix(v, "*") {
+			if strings.HasPrefix(key, v[:len(v)-1]) {
+				return true
+			}
+		} else if key == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,24 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import "testing"
+
+func TestCleanURL(t *testing.T) {
+	testCleanURL(t, "https://example.com/", "https://example.com/")
+	testCleanURL(t, "https://example.com/page?id=5&sort=asc", "https://example.com/page?id=5&sort=asc")
+	testCleanURL(t, "https://example.com/page?utm_source=twitter", "https://example.com/page")
+	testCleanURL(t, "https://example.com/page?id=5&utm_source=x&UTM_Medium=y&utm_campaign=z", "https://example.com/page?id=5")
+	testCleanURL(t, "https://example.com/page?fbclid=abc&q=a+b%26c#deel", "https://example.com/page?q=a+b%26c#deel")
+	testCleanURL(t, "https://example.com/?gclid=1&msclkid=2&mc_cid=3&mc_eid=4", "https://example.com/")
+	testCleanURL(t, "https://www.youtube.com/watch?v=gc1VA_W3M-Y&feature=share&si=x", "https://www.youtube.com/watch?v=gc1VA_W3M-Y&feature=share&si=x")
+	testCleanURL(t, "https://example.com/page?utm=1&fbclid_x=2", "https://example.com/page?utm=1&fbclid_x=2")
+}
+
+func testCleanURL(t *testing.T, in, want string) {
+	have := cleanURL(in)
+	if want != have {
+		t.Fatalf("url mismatch for %q;\nwant: %q\nhave: %q", in, want, have)
+	}
+}
@@ -0,0 +1,57 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import (
+	"net/url"
+	"strings"
+)
+
+// domainList defines a set of domain patterns. A pattern like
+// "example.com" matches the domain itself, as well as all of its
+// subdomains. A pattern like "*.example.com" only matches subdomains.
+type domainList []string
+
+// Match returns true if the given host matches any of the patterns.
+func (dl domainList) Match(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	for _, pat := range dl {
+		pat = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pat)), ".")
+
+		if strings.HasPrefix(pat, "*.") {
+			if strings.HasSuffix(host, pat[1:]) {
+				return true
+			}
+			continue
+		}
+
+		if len(pat) > 0 && (host == pat || strings.HasSuffix(host, "."+pat)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowURL returns true if titles may be fetched for the given url.
+// Domains in the deny list are never fetched. If the allow list is
+// not empty, only domains in that list are fetched.
+func (p *plugin) allowURL(v string) bool {
+	u, err := url.Parse(v)
+	if err != nil {
+		return false
+	}
+
+	host := u.Hostname()
+
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if p.data.Deny.Match(host) {
+		return false
+	}
+
+	return len(p.data.Allow) == 0 || p.data.Allow.Match(host)
+}
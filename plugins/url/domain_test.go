@@ -0,0 +1,53 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import "testing"
+
+func TestDomainList(t *testing.T) {
+	dl := domainList{"example.com", "*.intern.nl", " Bad.ORG. "}
+
+	testDomain(t, dl, "example.com", true)
+	testDomain(t, dl, "www.example.com", true)
+	testDomain(t, dl, "WWW.EXAMPLE.COM.", true)
+	testDomain(t, dl, "notexample.com", false)
+	testDomain(t, dl, "example.com.evil.net", false)
+	testDomain(t, dl, "intern.nl", false)
+	testDomain(t, dl, "wiki.intern.nl", true)
+	testDomain(t, dl, "a.b.intern.nl", true)
+	testDomain(t, dl, "bad.org", true)
+	testDomain(t, domainList{""}, "example.com", false)
+}
+
+func testDomain(t *testing.T, dl domainList, host string, want bool) {
+	if have := dl.Match(host); want != have {
+		t.Fatalf("match mismatch for %q;\nwant: %v\nhave: %v", host, want, have)
+	}
+}
+
+func TestAllowURL(t *testing.T) {
+	var p plugin
+
+	// Everything is allowed by default.
+	testAllowURL(t, &p, "https://example.com/page", true)
+
+	p.data.Deny = domainList{"*.nsfw.com", "localhost.lan"}
+	testAllowURL(t, &p, "https://www.nsfw.com/page", false)
+	testAllowURL(t, &p, "http://wiki.localhost.lan:8080/", false)
+	testAllowURL(t, &p, "https://example.com/page", true)
+
+	p.data.Allow = domainList{"example.com", "www.nsfw.com"}
+	testAllowURL(t, &p, "https://example.com/page", true)
+	testAllowURL(t, &p, "https://news.example.com/page", true)
+	testAllowURL(t, &p, "https://other.net/page", false)
+
+	// Deny wins over allow.
+	testAllowURL(t, &p, "https://www.nsfw.com/page", false)
+}
+
+func testAllowURL(t *testing.T, p *plugin, url string, want bool) {
+	if have := p.allowURL(url); want != have {
+		t.Fatalf("allow mismatch for %q;\nwant: %v\nhave: %v", url, want, have)
+	}
+}
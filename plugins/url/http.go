@@ -4,18 +4,23 @@
 package url
 
 import (
+	"bufio"
 	"bytes"
-	"fmt"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
 	"html"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/monkeybird/autimaat/app/util"
 	"github.com/monkeybird/autimaat/irc"
-	"github.com/monkeybird/autimaat/irc/proto"
-	"github.com/monkeybird/autimaat/plugins/url/youtube"
 )
 
 var (
@@ -24,53 +29,265 @@ var (
 	regUrl = regexp.MustCompile(`\bhttps?\://[a-zA-Z0-9\-\.]+\.[a-zA-Z]+(\:[0-9]+)?(/\S*)?\b`)
 
 	// These values are used to extract title contents from HTML.
+	bOpenTitle  = []byte("<title")
 	bOpenTitle1 = []byte("<title>")
 	bOpenTitle2 = []byte("<title ")
 	bCloseTitle = []byte("</title>")
 	bCloseTag   = []byte(">")
+
+	// These are used to extract attributes from <meta> tags.
+	regMetaTag   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	regAttribute = regexp.MustCompile(`([a-zA-Z:\-]+)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
 )
 
 // fetchTitle attempts to retrieve the title element for a given url.
-func fetchTitle(w irc.ResponseWriter, r *irc.Request, url, apiKey string) {
+// Recently fetched titles are taken from the cache.
+func (p *plugin) fetchTitle(w irc.ResponseWriter, r *irc.Request, url string) {
+	l := p.config()
+
+	var err error
+
+	title, ok := l.cache.Get(url, time.Now())
+	if !ok {
+		title, err = l.title(url)
+		l.cache.Set(url, title, time.Now())
+	}
+
+	// Show the title to the channel from whence the URL came.
+	if len(title) > 0 {
+		r.Reply(w, TextDisplay, r.SenderName, title)
+	}
+
+	// Let the channel know why extra information is missing, but
+	// don't go on about it.
+	if nc, ok := err.(*util.NotConfiguredError); ok && p.notices.Allow(r.Target) {
+		r.Reply(w, TextNotConfigured, nc.Feature)
+	}
+}
+
+// title fetches the title for the given url. This returns an empty
+// string if no title could be found. The error is set if a provider
+// failed to add extra information to the title.
+func (l *lookup) title(url string) (string, error) {
+	body, err := fetchBody(l.client, url)
+	if err != nil {
+		return "", nil
+	}
+
+	title := pageTitle(body)
+	if len(title) == 0 {
+		return "", nil
+	}
+
+	// If we are dealing with a link to a known site, like a youtube
+	// video, add whatever extra information we can find.
+	return enrichTitle(l.providers, l.client, url, title, l.maxTitle)
+}
+
+// MaxContentLength defines the largest document size, as advertised by
+// the server, for which we will attempt to fetch a title.
+const MaxContentLength = 1024 * 1024 * 16
+
+// MaxDownloadSize defines the maximum number of bytes read from a
+// response body, as sent by the server. For compressed bodies, this is
+// the compressed data. It guards against servers which lie about, or do
+// not report, the size of the document. The amount of decompressed data
+// is limited separately, by MaxScanSize and MaxTitleSize.
+const MaxDownloadSize = 1024 * 1024
+
+var (
+	// errNotHTML is returned by fetchBody for documents which are not HTML.
+	errNotHTML = errors.New("not a HTML document")
+
+	// errTooLarge is returned by fetchBody for documents which exceed
+	// MaxContentLength.
+	errTooLarge = errors.New("document too large")
+)
+
+// fetchBody fetches the start of the HTML document at the given url,
+// using the given client.
+func fetchBody(client *http.Client, url string) ([]byte, error) {
 	// Ensure the url targets a HTML page. We do this by issueing a HEAD
 	// request and checking its content type header.
-	resp, err := http.Head(url)
+	resp, err := client.Head(url)
 	if err != nil {
-		return
+		return nil, err
 	}
 
 	resp.Body.Close()
 
+	if resp.ContentLength > MaxContentLength {
+		return nil, errTooLarge
+	}
+
 	ctype := strings.ToLower(resp.Header.Get("Content-Type"))
 	if strings.Index(ctype, "text/html") == -1 &&
 		strings.Index(ctype, "text/xhtml") == -1 {
-		return
+		return nil, errNotHTML
 	}
 
-	// We have an HTML document -- Fetch its contents.
-	resp, err = http.Get(url)
+	// We have an HTML document -- Fetch its contents. We ask for a
+	// compressed version, but the server is free to ignore this.
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	// buf defines the maximum amount of data we will be reading from a page,
-	// before stopping our search for the <title> tag.
-	//
-	// 16kB is a chunky buffer, but some sites packa a ludicrous amount of
-	// crud in their page headers, before getting to the <title> tag.
-	var buf [1024 * 16]byte
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
 
-	// Read the body.
-	n, err := io.ReadFull(resp.Body, buf[:])
-	resp.Body.Close()
+	resp, err = client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.ContentLength > MaxContentLength {
+		return nil, errTooLarge
+	}
+
+	resp.Body = ioutil.NopCloser(io.LimitReader(resp.Body, MaxDownloadSize))
+
+	rd, err := decodeBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := scanBody(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	return toUTF8(body, pageCharset(body, resp.Header.Get("Content-Type"))), nil
+}
 
-	if err != nil && n <= 0 {
-		return // Exit only if no data was read at all.
+// MaxScanSize defines the maximum amount of data we will be reading from
+// a page, before stopping our search for the <title> tag. This applies to
+// the decompressed data.
+//
+// 16kB is a chunky amount, but some sites pack a ludicrous amount of crud
+// in their page headers, before getting to the <title> tag.
+const MaxScanSize = 1024 * 16
+
+// MaxTitleSize defines how much we read past MaxScanSize, to complete a
+// title which starts before it.
+const MaxTitleSize = 1024
+
+// scanBody reads the start of a HTML document from r. It stops as soon as
+// a usable title has been read, or when MaxScanSize bytes have been read
+// and no title has been started. Data read before an error is returned
+// as is; the error is only returned if nothing could be read at all.
+func scanBody(r io.Reader) ([]byte, error) {
+	r = io.LimitReader(r, MaxScanSize+MaxTitleSize)
+
+	var body, lower []byte
+	var buf [1024 * 4]byte
+	open := -1
+
+	for {
+		n, err := r.Read(buf[:])
+		from := len(lower)
+		body = append(body, buf[:n]...)
+		lower = appendLower(lower, buf[:n])
+
+		// Search a little before the new data, in case a tag was split
+		// between two reads.
+		if open == -1 {
+			start := back(from, len(bOpenTitle))
+			if i := bytes.Index(lower[start:], bOpenTitle); i > -1 {
+				open = start + i
+			}
+		}
+
+		if open > -1 {
+			start := back(from, len(bCloseTitle))
+			if start < open {
+				start = open
+			}
+
+			// Pages with a generic title may have a better one further
+			// on. See pageTitle.
+			if bytes.Contains(lower[start:], bCloseTitle) && !Ignore[htmlTitle(body)] {
+				return body, nil
+			}
+		} else if len(body) >= MaxScanSize {
+			return body, nil
+		}
+
+		if err != nil {
+			if len(body) > 0 {
+				return body, nil
+			}
+			return nil, err
+		}
 	}
+}
+
+// back returns n bytes before offset i, without going below 0.
+func back(i, n int) int {
+	if i < n {
+		return 0
+	}
+	return i - n
+}
+
+// appendLower appends the ASCII lower case version of p to dst. Unlike
+// bytes.ToLower, this retains the length of the data.
+func appendLower(dst, p []byte) []byte {
+	for _, c := range p {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
 
-	body := buf[:n]
+// decodeBody returns a reader for the response body, which decompresses
+// it according to the response's Content-Encoding.
+func decodeBody(resp *http.Response) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(resp.Body)
 
-	// Extract the title.
+	case "deflate":
+		// Deflate data should be wrapped in a zlib stream, but some
+		// servers send raw deflate data instead.
+		br := bufio.NewReader(resp.Body)
+		hdr, err := br.Peek(2)
+		if err == nil && hdr[0]&0x0f == 8 && (uint16(hdr[0])<<8|uint16(hdr[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	}
+
+	return resp.Body, nil
+}
+
+// pageTitle returns the title of the given HTML document. If the document
+// has no <title> tag, or its title is in the Ignore list, this falls back
+// to the OpenGraph title and then the page description. This returns an
+// empty string if no usable title is found.
+func pageTitle(body []byte) string {
+	title := htmlTitle(body)
+	if len(title) > 0 && !Ignore[title] {
+		return title
+	}
+
+	if v := metaContent(body, "property", "og:title"); len(v) > 0 && !Ignore[v] {
+		return v
+	}
+
+	if v := metaContent(body, "name", "description"); len(v) > 0 && !Ignore[v] {
+		return v
+	}
+
+	return ""
+}
+
+// htmlTitle returns the contents of the <title> tag in the given
+// HTML document.
+func htmlTitle(body []byte) string {
 	s := bytes.Index(bytes.ToLower(body), bOpenTitle1)
 	if s == -1 {
 		// title could be something like:
@@ -79,14 +296,14 @@ func fetchTitle(w irc.ResponseWriter, r *irc.Request, url, apiKey string) {
 		//
 		s = bytes.Index(bytes.ToLower(body), bOpenTitle2)
 		if s == -1 {
-			return
+			return ""
 		}
 
 		body = body[s+len(bOpenTitle2):]
 
 		s = bytes.Index(body, bCloseTag)
 		if s == -1 {
-			return
+			return ""
 		}
 
 		body = body[s+1:]
@@ -94,35 +311,43 @@ func fetchTitle(w irc.ResponseWriter, r *irc.Request, url, apiKey string) {
 		body = body[s+len(bOpenTitle1):]
 	}
 
+	// The page may have been cut off before the end of the title.
 	e := bytes.Index(bytes.ToLower(body), bCloseTitle)
 	if e == -1 {
-		e = len(body) - 1
+		e = len(body)
 	}
 
 	body = bytes.TrimSpace(body[:e])
-	if len(body) == 0 {
-		return
-	}
-
-	title := html.UnescapeString(string(body))
+	return html.UnescapeString(string(body))
+}
 
-	// If we are dealing with a youtube link, try to fetch the
-	// video duration and append it to our response.
-	if id := isYoutube(url); len(id) > 0 {
-		info, err := youtube.GetVideoInfo(apiKey, id)
-		if err == nil {
-			title += fmt.Sprintf(TextYoutubeDuration, info.Duration)
+// metaContent returns the content attribute of the first <meta> tag in
+// the given HTML document, whose attribute key has the given value.
+// E.g.: metaContent(body, "property", "og:title") finds:
+//
+//	<meta property="og:title" content="....">
+func metaContent(body []byte, key, value string) string {
+	for _, tag := range regMetaTag.FindAll(body, -1) {
+		attr := metaAttributes(tag)
+		if strings.EqualFold(attr[key], value) {
+			return strings.TrimSpace(html.UnescapeString(attr["content"]))
 		}
 	}
 
-	// If the title matches one of the titles that we want to ignore,
-	// do not show it.
-	if Ignore[title] {
-		return
+	return ""
+}
+
+// metaAttributes returns the attributes of the given <meta> tag. Attribute
+// names are lower case.
+func metaAttributes(tag []byte) map[string]string {
+	attr := make(map[string]string)
+
+	for _, m := range regAttribute.FindAllSubmatch(tag, -1) {
+		name := strings.ToLower(string(m[1]))
+		attr[name] = strings.Trim(string(m[2]), `"'`)
 	}
 
-	// Show the title to the channel from whence the URL came.
-	proto.PrivMsg(w, r.Target, TextDisplay, r.SenderName, title)
+	return attr
 }
 
 // isYoutube returns a video ID and true if v denotes a recognized youtube
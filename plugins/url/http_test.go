@@ -0,0 +1,212 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPage = "<html><head><title>Gecomprimeerde pagina</title></head><body></body></html>"
+
+func TestFetchCompressed(t *testing.T) {
+	testFetchCompressed(t, "", testPage)
+	testFetchCompressed(t, "gzip", testPage)
+	testFetchCompressed(t, "deflate", testPage)
+	testFetchCompressed(t, "raw-deflate", testPage)
+}
+
+func TestFetchCompressedLarge(t *testing.T) {
+	// The compressed page is smaller than the read buffer, but its
+	// contents are not. The title must still be found.
+	page := "<html><head><title>Grote pagina</title></head><body>" +
+		strings.Repeat("a", 1024*64) + "</body></html>"
+	testFetchTitle(t, "gzip", page, "Grote pagina")
+}
+
+func TestFetchScanLimit(t *testing.T) {
+	const head = "<html><head>"
+
+	// The title ends exactly at the scan limit.
+	title := "<title>Op de grens</title>"
+	page := head + strings.Repeat(" ", MaxScanSize-len(head)-len(title)) + title
+	testFetchTitle(t, "", page+"</head></html>", "Op de grens")
+	testFetchTitle(t, "", page, "Op de grens")
+
+	// The title starts before the limit and ends after it.
+	title = "<title>Over de grens</title>"
+	page = head + strings.Repeat(" ", MaxScanSize-len(head)-10) + title + "</head></html>"
+	testFetchTitle(t, "", page, "Over de grens")
+
+	// The title starts after the limit.
+	title = "<title>Te laat</title>"
+	page = head + strings.Repeat(" ", MaxScanSize) + title + "</head></html>"
+	testFetchTitle(t, "", page, "")
+}
+
+func TestFetchUnexpectedEOF(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", "1000")
+
+		// Send less than advertised. The connection is closed once
+		// we return.
+		if r.Method == "GET" {
+			io.WriteString(w, testPage)
+		}
+	}))
+
+	defer srv.Close()
+
+	body, err := fetchBody(http.DefaultClient, srv.URL)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+
+	if have := pageTitle(body); have != "Gecomprimeerde pagina" {
+		t.Fatalf("title mismatch;\nwant: %q\nhave: %q", "Gecomprimeerde pagina", have)
+	}
+}
+
+func TestScanBodyStops(t *testing.T) {
+	// The page never ends, but we need not read more than its title.
+	r := io.MultiReader(strings.NewReader(testPage), endless{})
+
+	body, err := scanBody(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body) >= MaxScanSize {
+		t.Fatalf("read too much: %d bytes", len(body))
+	}
+
+	// Generic titles do not stop the scan, so a better one can be
+	// found.
+	r = io.MultiReader(strings.NewReader("<title>Tweakers</title>"), endless{})
+
+	if body, _ = scanBody(r); len(body) != MaxScanSize+MaxTitleSize {
+		t.Fatalf("read size mismatch;\nwant: %d\nhave: %d", MaxScanSize+MaxTitleSize, len(body))
+	}
+}
+
+// endless yields spaces forever.
+type endless struct{}
+
+func (endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = ' '
+	}
+	return len(p), nil
+}
+
+func testFetchCompressed(t *testing.T, encoding, page string) {
+	testFetchTitle(t, encoding, page, "Gecomprimeerde pagina")
+}
+
+func testFetchTitle(t *testing.T, encoding, page, want string) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		if len(encoding) == 0 || !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			io.WriteString(w, page)
+			return
+		}
+
+		var buf bytes.Buffer
+		var zw io.WriteCloser
+
+		header := encoding
+		switch encoding {
+		case "gzip":
+			zw = gzip.NewWriter(&buf)
+		case "deflate":
+			zw = zlib.NewWriter(&buf)
+		case "raw-deflate":
+			zw, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+			header = "deflate"
+		}
+
+		io.WriteString(zw, page)
+		zw.Close()
+
+		w.Header().Set("Content-Encoding", header)
+		w.Write(buf.Bytes())
+	}))
+
+	defer srv.Close()
+
+	body, err := fetchBody(http.DefaultClient, srv.URL)
+	if err != nil {
+		t.Fatalf("fetch failed for %q: %v", encoding, err)
+	}
+
+	have := pageTitle(body)
+	if want != have {
+		t.Fatalf("title mismatch for %q;\nwant: %q\nhave: %q",
+			encoding, want, have)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	done := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.Method == "HEAD" {
+			return
+		}
+
+		// Send the headers and stall.
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-done
+	}))
+
+	defer srv.Close()
+	defer close(done)
+
+	client := &http.Client{Timeout: time.Millisecond * 100}
+	start := time.Now()
+
+	_, err := fetchBody(client, srv.URL)
+	if err == nil {
+		t.Fatalf("expected fetch to fail")
+	}
+
+	if d := time.Since(start); d > time.Second*2 {
+		t.Fatalf("fetch took too long: %v", d)
+	}
+}
+
+func TestFetchTooLarge(t *testing.T) {
+	var gets int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", "10000000000")
+		if r.Method == "GET" {
+			gets++
+		}
+	}))
+
+	defer srv.Close()
+
+	_, err := fetchBody(http.DefaultClient, srv.URL)
+	if err != errTooLarge {
+		t.Fatalf("error mismatch;\nwant: %v\nhave: %v", errTooLarge, err)
+	}
+
+	if gets > 0 {
+		t.Fatalf("document should not have been fetched")
+	}
+}
@@ -0,0 +1,83 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFindURLs(t *testing.T) {
+	p := &plugin{lookup: lookup{maxURLs: 3}}
+
+	var links []string
+	for i := 0; i < 50; i++ {
+		links = append(links, fmt.Sprintf("https://example.com/%d", i))
+	}
+
+	have := p.findURLs("kijk: " + strings.Join(links, " "))
+	want := links[:3]
+	if fmt.Sprint(want) != fmt.Sprint(have) {
+		t.Fatalf("url mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+
+	// Duplicates, after removing tracking parameters, count only once.
+	have = p.findURLs("https://example.com/a https://example.com/a?utm_source=x https://example.com/b")
+	want = []string{"https://example.com/a", "https://example.com/b"}
+	if fmt.Sprint(want) != fmt.Sprint(have) {
+		t.Fatalf("url mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	const max = 3
+
+	p := &plugin{lookup: lookup{sem: make(chan struct{}, max)}}
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	var inFlight, peak, started int32
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go p.limit(func() {
+			defer wg.Done()
+
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				v := atomic.LoadInt32(&peak)
+				if n <= v || atomic.CompareAndSwapInt32(&peak, v, n) {
+					break
+				}
+			}
+
+			atomic.AddInt32(&started, 1)
+			<-release
+			atomic.AddInt32(&inFlight, -1)
+		})
+	}
+
+	// Wait for the first batch to start, and give the others a chance
+	// to get past the limit if they can.
+	for i := 0; i < 100 && atomic.LoadInt32(&started) < max; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	time.Sleep(time.Millisecond * 50)
+
+	if n := atomic.LoadInt32(&started); n != max {
+		t.Fatalf("started mismatch;\nwant: %d\nhave: %d", max, n)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&peak); n > max {
+		t.Fatalf("too many lookups in flight;\nwant: <= %d\nhave: %d", max, n)
+	}
+}
@@ -8,6 +8,10 @@
 package url
 
 import (
+	"net/http"
+	"sync"
+	"time"
+
 	"github.com/monkeybird/autimaat/app/util"
 	"github.com/monkeybird/autimaat/irc"
 	"github.com/monkeybird/autimaat/plugins"
@@ -15,21 +19,152 @@ import (
 
 func init() { plugins.Register(&plugin{}) }
 
+// DefaultFetchTimeout defines the default time after which a page
+// lookup is considered failed.
+const DefaultFetchTimeout = time.Second * 10
+
+// DefaultMaxFetches defines the default number of page lookups which
+// may be performed at the same time.
+const DefaultMaxFetches = 3
+
+// DefaultMaxURLs defines the default number of URLs in a single message
+// for which titles are fetched. Any others are ignored.
+const DefaultMaxURLs = 5
+
+// DefaultMaxTitleLength defines the default maximum length of a title,
+// in characters.
+const DefaultMaxTitleLength = 300
+
+// NoticeInterval defines how often a channel is told that a provider
+// lacks its API keys.
+const NoticeInterval = time.Hour * 6
+
 type plugin struct {
-	data struct {
+	m       sync.RWMutex
+	lookup  lookup
+	notices *util.Throttle
+	data    struct {
 		YoutubeApiKey string
+
+		// Credentials for the Twitch Helix API. These are needed to
+		// show details for Twitch clips.
+		TwitchClientID string
+		TwitchToken    string
+
+		// Allow and Deny define the domains for which titles are,
+		// or are not fetched. See domainList for the format.
+		Allow domainList
+		Deny  domainList
+
+		// FetchTimeout defines the maximum time in seconds, a single
+		// page lookup may take.
+		FetchTimeout int
+
+		// CacheTTL defines the time in seconds for which fetched titles
+		// are remembered. CacheSize defines the maximum number of titles
+		// remembered.
+		CacheTTL  int
+		CacheSize int
+
+		// MaxTitleLength defines the maximum length of a title, in
+		// characters. Longer titles are truncated.
+		MaxTitleLength int
+
+		// MaxFetches defines the maximum number of page lookups which
+		// may be performed at the same time. MaxURLs defines the maximum
+		// number of URLs in a single message, for which titles are fetched.
+		MaxFetches int
+		MaxURLs    int
+
+		// RepeatWindow defines the time in seconds, during which a URL
+		// is not previewed again, if it is posted more than once in the
+		// same channel. A negative value disables this. The window can
+		// be set for individual channels through ChannelRepeatWindow.
+		RepeatWindow        int
+		ChannelRepeatWindow map[string]int
 	}
 }
 
+// lookup holds the settings used to fetch page titles.
+type lookup struct {
+	client    *http.Client
+	providers []Provider
+	cache     *titleCache
+	maxTitle  int
+	maxURLs   int
+	repeats   *repeatFilter
+	sem       chan struct{} // Limits the number of concurrent lookups.
+}
+
 // Load initializes the module and loads any internal resources
 // which may be required.
 func (p *plugin) Load(prof irc.Profile) error {
-	return util.ReadFile("url.cfg", &p.data, false)
+	p.notices = util.NewThrottle(NoticeInterval)
+	return p.loadConfig(prof)
+}
+
+// Reload reloads the plugin's configuration.
+func (p *plugin) Reload(prof irc.Profile) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.loadConfig(prof)
+}
+
+// loadConfig reads the plugin configuration from the profile. The API
+// keys may refer to environment variables, as ${VAR} or $VAR.
+func (p *plugin) loadConfig(prof irc.Profile) error {
+	err := prof.PluginConfig("url", &p.data)
+	p.data.YoutubeApiKey = util.ExpandEnv(p.data.YoutubeApiKey)
+	p.data.TwitchClientID = util.ExpandEnv(p.data.TwitchClientID)
+	p.data.TwitchToken = util.ExpandEnv(p.data.TwitchToken)
+
+	providers := []Provider{
+		&youtubeProvider{apiKey: p.data.YoutubeApiKey},
+		&vimeoProvider{},
+		&twitchProvider{clientID: p.data.TwitchClientID, token: p.data.TwitchToken},
+	}
+
+	timeout := time.Duration(p.data.FetchTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultFetchTimeout
+	}
+
+	maxTitle := p.data.MaxTitleLength
+	if maxTitle <= 0 {
+		maxTitle = DefaultMaxTitleLength
+	}
+
+	maxFetches := p.data.MaxFetches
+	if maxFetches <= 0 {
+		maxFetches = DefaultMaxFetches
+	}
+
+	maxURLs := p.data.MaxURLs
+	if maxURLs <= 0 {
+		maxURLs = DefaultMaxURLs
+	}
+
+	p.lookup = lookup{
+		client:    &http.Client{Timeout: timeout},
+		providers: providers,
+		cache:     newTitleCache(time.Duration(p.data.CacheTTL)*time.Second, p.data.CacheSize),
+		maxTitle:  maxTitle,
+		maxURLs:   maxURLs,
+		repeats:   newRepeatFilter(time.Duration(p.data.RepeatWindow)*time.Second, p.data.ChannelRepeatWindow),
+		sem:       make(chan struct{}, maxFetches),
+	}
+
+	return err
 }
 
 // Unload cleans the module up and unloads any internal resources.
 func (p *plugin) Unload(prof irc.Profile) error {
+	p.m.Lock()
 	p.data.YoutubeApiKey = ""
+	p.data.TwitchClientID = ""
+	p.data.TwitchToken = ""
+	p.lookup.providers = nil
+	p.m.Unlock()
 	return nil
 }
 
@@ -40,14 +175,64 @@ func (p *plugin) Dispatch(w irc.ResponseWriter, r *irc.Request) {
 		return
 	}
 
-	// Find all URLs in the message body.
-	list := regUrl.FindAllString(r.Data, -1)
-	if len(list) == 0 {
-		return
+	// Fetch title data for each URL in the message body. Skip those
+	// which were just previewed in the same channel.
+	repeats := p.config().repeats
+	now := time.Now()
+
+	for _, url := range p.findURLs(r.Data) {
+		if repeats.Repeated(r.Target, url, now) {
+			continue
+		}
+
+		url := url
+		go p.limit(func() { p.fetchTitle(w, r, url) })
 	}
+}
+
+// findURLs returns the URLs in the given message, for which titles should
+// be fetched. Tracking parameters are removed and duplicates are ignored.
+// This returns no more than the configured maximum number of URLs.
+func (p *plugin) findURLs(data string) []string {
+	max := p.config().maxURLs
+	var out []string
+
+	for _, url := range regUrl.FindAllString(data, -1) {
+		if len(out) >= max {
+			break
+		}
 
-	// Fetch title data for each of them.
-	for _, url := range list {
-		go fetchTitle(w, r, url, p.data.YoutubeApiKey)
+		url = cleanURL(url)
+		if p.allowURL(url) && !hasString(out, url) {
+			out = append(out, url)
+		}
 	}
+
+	return out
+}
+
+// limit calls fn, once fewer than the configured maximum number of
+// lookups are in progress.
+func (p *plugin) limit(fn func()) {
+	sem := p.config().sem
+	sem <- struct{}{}
+	defer func() { <-sem }()
+	fn()
+}
+
+// hasString returns true if list contains v.
+func hasString(list []string, v string) bool {
+	for _, lv := range list {
+		if lv == v {
+			return true
+		}
+	}
+	return false
+}
+
+// config returns the current lookup settings.
+func (p *plugin) config() lookup {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.lookup
 }
@@ -4,10 +4,19 @@
 package url
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
+type mockWriter struct {
+	bytes.Buffer
+}
+
+func (mw *mockWriter) Close() error { return nil }
+
 func TestMain(m *testing.M) {
 	ret := m.Run()
 	os.Exit(ret)
@@ -27,6 +36,31 @@ func TestYoutube(t *testing.T) {
 	testYoutube(t, "https://www.youtube.com/watch?v=gc1VA_W3M-Y&index=2&list=PLJwv6sN_mnF0QsOTcKlFDeyzwXMM0MWru", "gc1VA_W3M-Y")
 }
 
+func TestPageTitle(t *testing.T) {
+	testPageTitle(t, "title.html", "Gewone titel")
+	testPageTitle(t, "og_title.html", "Kabinet & Kamer bereiken akkoord")
+	testPageTitle(t, "description.html", "Een korte omschrijving van deze pagina.")
+	testPageTitle(t, "og_description.html", "Nieuwe videokaart aangekondigd")
+
+	// Pages which are cut off in, or right after, the title tag.
+	testPageTitle(t, "truncated_title.html", "")
+	testPageTitle(t, "truncated_title_attr.html", "")
+	testPageTitle(t, "truncated_title_text.html", "Afgebroken titel")
+}
+
+func testPageTitle(t *testing.T, file, want string) {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	have := pageTitle(body)
+	if want != have {
+		t.Fatalf("title mismatch for %q;\nwant: %q\nhave: %q",
+			file, want, have)
+	}
+}
+
 func testYoutube(t *testing.T, in, want string) {
 	have := isYoutube(in)
 
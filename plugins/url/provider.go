@@ -0,0 +1,296 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/monkeybird/autimaat/app/util"
+	"github.com/monkeybird/autimaat/plugins/url/youtube"
+)
+
+// MediaInfo defines details about a linked resource, as supplied by
+// a Provider. Fields which are unknown are left empty.
+type MediaInfo struct {
+	Title    string        // Title of the resource.
+	Uploader string        // Name of the person or channel who posted it.
+	Duration time.Duration // Playback duration.
+	Views    uint64        // Number of times the resource was viewed.
+	Note     string        // Remark about the resource's availability.
+}
+
+// Provider supplies additional information for links to a specific
+// site, like the playback duration of a video.
+type Provider interface {
+	// Match returns an identifier for the resource at the given url.
+	// This returns an empty string if the url is not handled by the
+	// provider.
+	Match(url string) string
+
+	// Info returns details about the resource with the given identifier.
+	Info(client *http.Client, id string) (*MediaInfo, error)
+}
+
+// findProvider returns the first provider which handles the given url,
+// along with the resource identifier it returned. This returns nil if
+// no provider matches.
+func findProvider(list []Provider, url string) (Provider, string) {
+	for _, p := range list {
+		if id := p.Match(url); len(id) > 0 {
+			return p, id
+		}
+	}
+	return nil, ""
+}
+
+// enrichTitle returns the given page title, extended with information
+// from a matching provider. The page title is used unchanged if no
+// provider matches, or if the provider fails. The title is truncated to
+// fit the given length, including any information added to it. The
+// provider's error is returned along with the title.
+func enrichTitle(list []Provider, client *http.Client, url, title string, max int) (string, error) {
+	var suffix string
+	var err error
+
+	if p, id := findProvider(list, url); p != nil {
+		var info *MediaInfo
+		if info, err = p.Info(client, id); err == nil {
+			if v := strings.TrimSpace(info.Title); len(v) > 0 {
+				title = v
+			}
+
+			if len(info.Uploader) > 0 {
+				suffix += fmt.Sprintf(TextUploader, info.Uploader)
+			}
+
+			if info.Duration > 0 {
+				suffix += fmt.Sprintf(TextDuration, info.Duration)
+			}
+
+			if info.Views > 0 {
+				suffix += fmt.Sprintf(TextViews, formatCount(info.Views))
+			}
+
+			if len(info.Note) > 0 {
+				suffix += fmt.Sprintf(TextNote, info.Note)
+			}
+		}
+	}
+
+	// Leave at least half the space for the title itself.
+	size := max - utf8.RuneCountInString(suffix)
+	if size < max/2 {
+		size = max / 2
+	}
+
+	return truncate(title, size) + suffix, err
+}
+
+// truncate shortens s to at most n characters. An ellipsis is added
+// if s was shortened.
+func truncate(s string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+// formatCount formats n with a dot between each group of thousands.
+func formatCount(n uint64) string {
+	s := strconv.FormatUint(n, 10)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "." + s[i:]
+	}
+	return s
+}
+
+// youtubeProvider fetches video details from the YouTube Data API.
+type youtubeProvider struct {
+	apiKey string
+}
+
+func (p *youtubeProvider) Match(url string) string { return isYoutube(url) }
+
+func (p *youtubeProvider) Info(client *http.Client, id string) (*MediaInfo, error) {
+	if len(p.apiKey) == 0 {
+		return nil, &util.NotConfiguredError{Feature: "YouTube"}
+	}
+
+	info, err := youtube.GetVideoInfo(client, p.apiKey, id)
+	return youtubeMediaInfo(info, err)
+}
+
+// youtubeMediaInfo converts the result of a video lookup. Videos which
+// are unavailable or restricted get a note explaining why.
+func youtubeMediaInfo(info *youtube.VideoInfo, err error) (*MediaInfo, error) {
+	var note string
+
+	switch err {
+	case nil:
+	case youtube.ErrNoSuchVideo:
+		return &MediaInfo{Note: TextVideoUnavailable}, nil
+	case youtube.ErrVideoPrivate:
+		note = TextVideoPrivate
+	case youtube.ErrVideoRegionBlocked:
+		note = TextVideoRegionBlocked
+	case youtube.ErrVideoAgeRestricted:
+		note = TextVideoAgeRestricted
+	default:
+		return nil, err
+	}
+
+	return &MediaInfo{
+		Title:    info.Title,
+		Uploader: info.ChannelTitle,
+		Duration: info.Duration,
+		Views:    info.ViewCount,
+		Note:     note,
+	}, nil
+}
+
+// vimeoProvider fetches video details through Vimeo's oEmbed API.
+// This requires no API key.
+type vimeoProvider struct{}
+
+// regVimeoPath matches the paths of Vimeo video URLs, like "/76979871"
+// or "/video/76979871".
+var regVimeoPath = regexp.MustCompile(`^/(?:video/|channels/[^/]+/)?(\d+)/?$`)
+
+func (p *vimeoProvider) Match(v string) string {
+	u, err := url.Parse(v)
+	if err != nil {
+		return ""
+	}
+
+	switch strings.ToLower(u.Host) {
+	case "vimeo.com", "www.vimeo.com", "player.vimeo.com":
+		if m := regVimeoPath.FindStringSubmatch(u.Path); m != nil {
+			return m[1]
+		}
+	}
+
+	return ""
+}
+
+func (p *vimeoProvider) Info(client *http.Client, id string) (*MediaInfo, error) {
+	const oembedURL = "https://vimeo.com/api/oembed.json?url=%s"
+
+	var resp struct {
+		Title      string `json:"title"`
+		AuthorName string `json:"author_name"`
+		Duration   int    `json:"duration"` // Seconds.
+	}
+
+	target := url.QueryEscape("https://vimeo.com/" + id)
+	req, err := http.NewRequest("GET", fmt.Sprintf(oembedURL, target), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fetchJSON(client, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &MediaInfo{
+		Title:    resp.Title,
+		Uploader: resp.AuthorName,
+		Duration: time.Duration(resp.Duration) * time.Second,
+	}, nil
+}
+
+// twitchProvider fetches clip details from the Twitch Helix API. This
+// requires a client ID and an app access token.
+type twitchProvider struct {
+	clientID string
+	token    string
+}
+
+// regTwitchClip matches the paths of Twitch clip URLs on www.twitch.tv,
+// like "/channel/clip/SomeClipSlug".
+var regTwitchClip = regexp.MustCompile(`^/[^/]+/clip/([\w-]+)/?$`)
+
+func (p *twitchProvider) Match(v string) string {
+	u, err := url.Parse(v)
+	if err != nil {
+		return ""
+	}
+
+	switch strings.ToLower(u.Host) {
+	case "clips.twitch.tv":
+		return strings.Trim(u.Path, "/")
+	case "twitch.tv", "www.twitch.tv", "m.twitch.tv":
+		if m := regTwitchClip.FindStringSubmatch(u.Path); m != nil {
+			return m[1]
+		}
+	}
+
+	return ""
+}
+
+func (p *twitchProvider) Info(client *http.Client, id string) (*MediaInfo, error) {
+	const clipsURL = "https://api.twitch.tv/helix/clips?id=%s"
+
+	if len(p.clientID) == 0 || len(p.token) == 0 {
+		return nil, &util.NotConfiguredError{Feature: "Twitch"}
+	}
+
+	var resp struct {
+		Data []struct {
+			Title           string  `json:"title"`
+			BroadcasterName string  `json:"broadcaster_name"`
+			Duration        float64 `json:"duration"` // Seconds.
+		} `json:"data"`
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf(clipsURL, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Client-Id", p.clientID)
+	req.Header.Set("Authorization", "Bearer "+p.token)
+
+	if err := fetchJSON(client, req, &resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Data) == 0 {
+		return nil, errors.New("no such clip")
+	}
+
+	clip := resp.Data[0]
+	return &MediaInfo{
+		Title:    clip.Title,
+		Uploader: clip.BroadcasterName,
+		Duration: time.Duration(clip.Duration * float64(time.Second)),
+	}, nil
+}
+
+// fetchJSON performs the given request and unmarshals the JSON response
+// into v.
+func fetchJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", req.URL.Host, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,296 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/monkeybird/autimaat/app/util"
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/plugins/url/youtube"
+)
+
+// mockProvider handles URLs matched by its embedded provider and
+// returns a fixed result.
+type mockProvider struct {
+	Provider
+	info  *MediaInfo
+	err   error
+	calls []string
+}
+
+func (p *mockProvider) Info(client *http.Client, id string) (*MediaInfo, error) {
+	p.calls = append(p.calls, id)
+	return p.info, p.err
+}
+
+func TestProviderDispatch(t *testing.T) {
+	yt := &mockProvider{Provider: &youtubeProvider{}, info: &MediaInfo{Duration: time.Minute}}
+	vimeo := &mockProvider{Provider: &vimeoProvider{}, info: &MediaInfo{
+		Title:    "Een korte film",
+		Uploader: "Steve",
+		Duration: time.Minute + time.Second*30,
+	}}
+
+	list := []Provider{yt, vimeo}
+
+	want := "Een korte film (door Steve) (speelduur: 1m30s)"
+	have, _ := enrichTitle(list, http.DefaultClient, "https://vimeo.com/76979871", "Vimeo", 100)
+	if want != have {
+		t.Fatalf("title mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+
+	if len(yt.calls) != 0 || len(vimeo.calls) != 1 || vimeo.calls[0] != "76979871" {
+		t.Fatalf("unexpected provider calls: youtube %q, vimeo %q", yt.calls, vimeo.calls)
+	}
+
+	// Unknown links keep the page title.
+	want = "Gewone pagina"
+	have, _ = enrichTitle(list, http.DefaultClient, "https://example.com/76979871", want, 100)
+	if want != have {
+		t.Fatalf("title mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+
+	// Failing providers keep the page title.
+	vimeo.err = errors.New("boom")
+	want = "Vimeo"
+	have, _ = enrichTitle(list, http.DefaultClient, "https://player.vimeo.com/video/76979871", want, 100)
+	if want != have {
+		t.Fatalf("title mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func TestUnconfiguredProviders(t *testing.T) {
+	_, err := (&youtubeProvider{}).Info(http.DefaultClient, "HKNXXpqareI")
+	testNotConfigured(t, err, "YouTube")
+
+	_, err = (&twitchProvider{}).Info(http.DefaultClient, "SomeClip")
+	testNotConfigured(t, err, "Twitch")
+}
+
+func TestYoutubeProviderClient(t *testing.T) {
+	var host string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"items":[{"id":"HKNXXpqareI","snippet":{"title":"Video"}}]}`)
+	}))
+	defer srv.Close()
+
+	// Lookups must go through the given client, so they honour its
+	// timeout and transport.
+	client := &http.Client{Transport: roundTripper(func(r *http.Request) (*http.Response, error) {
+		host = r.URL.Host
+		r.URL.Scheme = "http"
+		r.URL.Host = srv.Listener.Addr().String()
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	info, err := (&youtubeProvider{apiKey: "hunter2"}).Info(client, "HKNXXpqareI")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if host != "www.googleapis.com" || info.Title != "Video" {
+		t.Fatalf("unexpected lookup: host %q, info %+v", host, info)
+	}
+}
+
+// roundTripper turns a function into a http.RoundTripper.
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func testNotConfigured(t *testing.T, err error, want string) {
+	nc, ok := err.(*util.NotConfiguredError)
+	if !ok {
+		t.Fatalf("error mismatch;\nwant: *util.NotConfiguredError\nhave: %T (%v)", err, err)
+	}
+
+	if nc.Feature != want {
+		t.Fatalf("feature mismatch;\nwant: %q\nhave: %q", want, nc.Feature)
+	}
+}
+
+func TestProviderMatch(t *testing.T) {
+	vimeo := &vimeoProvider{}
+	testProviderMatch(t, vimeo, "https://vimeo.com/76979871", "76979871")
+	testProviderMatch(t, vimeo, "https://www.vimeo.com/76979871/", "76979871")
+	testProviderMatch(t, vimeo, "https://player.vimeo.com/video/76979871", "76979871")
+	testProviderMatch(t, vimeo, "https://vimeo.com/channels/staffpicks/76979871", "76979871")
+	testProviderMatch(t, vimeo, "https://vimeo.com/about", "")
+	testProviderMatch(t, vimeo, "https://notvimeo.com/76979871", "")
+
+	twitch := &twitchProvider{}
+	testProviderMatch(t, twitch, "https://clips.twitch.tv/FunnyClipSlug-abc123", "FunnyClipSlug-abc123")
+	testProviderMatch(t, twitch, "https://www.twitch.tv/steve/clip/FunnyClipSlug", "FunnyClipSlug")
+	testProviderMatch(t, twitch, "https://www.twitch.tv/steve", "")
+	testProviderMatch(t, twitch, "https://clips.twitch.tv/", "")
+}
+
+func TestFormatCount(t *testing.T) {
+	for in, want := range map[uint64]string{
+		0:          "0",
+		999:        "999",
+		1000:       "1.000",
+		123456:     "123.456",
+		1234567890: "1.234.567.890",
+	} {
+		if have := formatCount(in); want != have {
+			t.Fatalf("count mismatch for %d;\nwant: %q\nhave: %q", in, want, have)
+		}
+	}
+}
+
+func TestYoutubeTitle(t *testing.T) {
+	yt := &mockProvider{Provider: &youtubeProvider{}, info: &MediaInfo{
+		Title:    "Never Gonna Give You Up",
+		Uploader: "Rick Astley",
+		Duration: 3*time.Minute + 33*time.Second,
+		Views:    1234567,
+	}}
+
+	want := "Never Gonna Give You Up (door Rick Astley) (speelduur: 3m33s) (1.234.567 keer bekeken)"
+	have, _ := enrichTitle([]Provider{yt}, http.DefaultClient, "https://youtu.be/dQw4w9WgXcQ", "YouTube", 300)
+	if want != have {
+		t.Fatalf("title mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func TestYoutubeRestrictions(t *testing.T) {
+	info := &youtube.VideoInfo{Title: "Geblokkeerd", ChannelTitle: "Omroep", Duration: time.Minute}
+
+	testYoutubeNote(t, info, nil, "Geblokkeerd", "")
+	testYoutubeNote(t, nil, youtube.ErrNoSuchVideo, "", TextVideoUnavailable)
+	testYoutubeNote(t, info, youtube.ErrVideoPrivate, "Geblokkeerd", TextVideoPrivate)
+	testYoutubeNote(t, info, youtube.ErrVideoRegionBlocked, "Geblokkeerd", TextVideoRegionBlocked)
+	testYoutubeNote(t, info, youtube.ErrVideoAgeRestricted, "Geblokkeerd", TextVideoAgeRestricted)
+
+	if _, err := youtubeMediaInfo(nil, youtube.ErrQuotaExceeded); err != youtube.ErrQuotaExceeded {
+		t.Fatalf("error mismatch;\nwant: %v\nhave: %v", youtube.ErrQuotaExceeded, err)
+	}
+
+	// The page title is kept for removed videos.
+	yt := &mockProvider{Provider: &youtubeProvider{}, info: &MediaInfo{Note: TextVideoUnavailable}}
+	want := "YouTube [video verwijderd of privé]"
+	have, _ := enrichTitle([]Provider{yt}, http.DefaultClient, "https://youtu.be/dQw4w9WgXcQ", "YouTube", 300)
+	if want != have {
+		t.Fatalf("title mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
+
+func testYoutubeNote(t *testing.T, info *youtube.VideoInfo, err error, title, note string) {
+	mi, err := youtubeMediaInfo(info, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mi.Title != title || mi.Note != note {
+		t.Fatalf("info mismatch;\nwant: %q, %q\nhave: %q, %q", title, note, mi.Title, mi.Note)
+	}
+}
+
+func testProviderMatch(t *testing.T, p Provider, in, want string) {
+	have := p.Match(in)
+	if want != have {
+		t.Fatalf("id mismatch for %q;\nwant: %q\nhave: %q", in, want, have)
+	}
+}
+
+func TestTruncateTitle(t *testing.T) {
+	testTruncate(t, "kort", 10, "kort")
+	testTruncate(t, "precies tien", 12, "precies tien")
+	testTruncate(t, "een te lange titel", 10, "een te la…")
+	testTruncate(t, "één tweeëntwintig", 8, "één twe…")
+	testTruncate(t, "日本語のタイトル", 4, "日本語…")
+}
+
+func testTruncate(t *testing.T, in string, n int, want string) {
+	have := truncate(in, n)
+	if want != have {
+		t.Fatalf("truncate mismatch for %q, %d;\nwant: %q\nhave: %q", in, n, want, have)
+	}
+}
+
+func TestTruncateWithDuration(t *testing.T) {
+	yt := &mockProvider{Provider: &youtubeProvider{}, info: &MediaInfo{Duration: time.Minute * 4}}
+	title := strings.Repeat("lang ", 100)
+
+	have, _ := enrichTitle([]Provider{yt}, http.DefaultClient,
+		"https://youtube.com?v=HKNXXpqareI", title, 60)
+
+	suffix := " (speelduur: 4m0s)"
+	if !strings.HasSuffix(have, "…"+suffix) {
+		t.Fatalf("title %q does not end with truncated duration suffix", have)
+	}
+
+	if n := utf8.RuneCountInString(have); n > 60 {
+		t.Fatalf("title too long;\nwant: <= 60\nhave: %d", n)
+	}
+
+	// Titles without provider information are truncated as well.
+	have, _ = enrichTitle(nil, http.DefaultClient, "https://example.com", title, 60)
+	if n := utf8.RuneCountInString(have); n != 60 || !strings.HasSuffix(have, "…") {
+		t.Fatalf("title mismatch: %q", have)
+	}
+}
+
+// matchAll is a provider which handles every URL.
+type matchAll struct {
+	Provider
+}
+
+func (matchAll) Match(url string) string { return url }
+
+func TestNotConfiguredNotice(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "<html><head><title>Video</title></head></html>")
+	}))
+
+	defer srv.Close()
+
+	p := &plugin{
+		notices: util.NewThrottle(NoticeInterval),
+		lookup: lookup{
+			client:   http.DefaultClient,
+			cache:    newTitleCache(time.Minute, 10),
+			maxTitle: DefaultMaxTitleLength,
+			providers: []Provider{&mockProvider{
+				Provider: matchAll{},
+				err:      &util.NotConfiguredError{Feature: "YouTube"},
+			}},
+		},
+	}
+
+	title := "PRIVMSG #test :De link van steve toont: Video\r\n"
+	notice := "PRIVMSG #test :Extra informatie over YouTube-links is niet " +
+		"beschikbaar: er is geen API-sleutel ingesteld.\r\n"
+
+	// The notice is sent once, along with the first title.
+	for i, want := range []string{title + notice, title, title} {
+		var w mockWriter
+		url := fmt.Sprintf("%s/%d", srv.URL, i)
+		p.fetchTitle(&w, &irc.Request{SenderName: "steve", Target: "#test"}, url)
+
+		if have := w.String(); want != have {
+			t.Fatalf("output mismatch for lookup %d;\nwant: %q\nhave: %q", i+1, want, have)
+		}
+	}
+
+	// Other channels are told separately.
+	var w mockWriter
+	p.fetchTitle(&w, &irc.Request{SenderName: "steve", Target: "#other"}, srv.URL+"/other")
+
+	if have := w.String(); !strings.Contains(have, "PRIVMSG #other :Extra informatie") {
+		t.Fatalf("notice missing for #other; have: %q", have)
+	}
+}
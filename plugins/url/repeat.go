@@ -0,0 +1,88 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRepeatWindow defines the default time during which a URL is not
+// previewed again, when it is posted more than once in the same channel.
+const DefaultRepeatWindow = time.Minute
+
+// repeatFilter remembers which URLs were recently previewed in each
+// channel, so the same link pasted twice in quick succession is only
+// previewed once.
+type repeatFilter struct {
+	m        sync.Mutex
+	window   time.Duration
+	longest  time.Duration // Longest window of all channels.
+	channels map[string]time.Duration
+	seen     map[string]time.Time
+}
+
+// newRepeatFilter creates a filter with the given window. A window of 0
+// selects DefaultRepeatWindow. A negative window disables the filter.
+// The window can be overridden for individual channels, in seconds. For
+// these, a value of 0 or less disables the filter in that channel.
+func newRepeatFilter(window time.Duration, channels map[string]int) *repeatFilter {
+	if window == 0 {
+		window = DefaultRepeatWindow
+	}
+
+	f := &repeatFilter{
+		window:   window,
+		longest:  window,
+		channels: make(map[string]time.Duration, len(channels)),
+		seen:     make(map[string]time.Time),
+	}
+
+	for name, secs := range channels {
+		w := time.Duration(secs) * time.Second
+		f.channels[strings.ToLower(name)] = w
+
+		if w > f.longest {
+			f.longest = w
+		}
+	}
+
+	return f
+}
+
+// Repeated returns true if the given url was previewed in the channel
+// within the channel's window. If not, the url is recorded as previewed
+// at the given time.
+func (f *repeatFilter) Repeated(channel, url string, now time.Time) bool {
+	channel = strings.ToLower(channel)
+
+	window, ok := f.channels[channel]
+	if !ok {
+		window = f.window
+	}
+
+	if window <= 0 {
+		return false
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	key := channel + " " + url
+	if last, ok := f.seen[key]; ok && now.Sub(last) < window {
+		return true
+	}
+
+	// Forget URLs which can no longer be repeated, so the map does not
+	// keep growing.
+	for k, last := range f.seen {
+		if now.Sub(last) >= f.longest {
+			delete(f.seen, k)
+		}
+	}
+
+	f.seen[key] = now
+	return false
+}
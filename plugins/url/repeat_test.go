@@ -0,0 +1,140 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package url
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc"
+)
+
+func TestRepeatFilter(t *testing.T) {
+	now := time.Now()
+	f := newRepeatFilter(0, map[string]int{"#Snel": 10, "#altijd": 0})
+
+	const url = "https://example.com/a"
+
+	// Pasted twice in quick succession.
+	testRepeated(t, f, "#test", url, now, false)
+	testRepeated(t, f, "#test", url, now.Add(time.Second*5), true)
+
+	// Other channels and URLs are not affected.
+	testRepeated(t, f, "#other", url, now.Add(time.Second*5), false)
+	testRepeated(t, f, "#test", url+"b", now.Add(time.Second*5), false)
+
+	// Pasted again after the window.
+	testRepeated(t, f, "#test", url, now.Add(DefaultRepeatWindow), false)
+	testRepeated(t, f, "#test", url, now.Add(DefaultRepeatWindow+time.Second), true)
+
+	// Channels with their own window.
+	testRepeated(t, f, "#snel", url, now, false)
+	testRepeated(t, f, "#SNEL", url, now.Add(time.Second*9), true)
+	testRepeated(t, f, "#snel", url, now.Add(time.Second*10), false)
+
+	testRepeated(t, f, "#altijd", url, now, false)
+	testRepeated(t, f, "#altijd", url, now, false)
+
+	// Disabled everywhere.
+	f = newRepeatFilter(-1, nil)
+	testRepeated(t, f, "#test", url, now, false)
+	testRepeated(t, f, "#test", url, now, false)
+}
+
+func testRepeated(t *testing.T, f *repeatFilter, channel, url string, now time.Time, want bool) {
+	if have := f.Repeated(channel, url, now); have != want {
+		t.Fatalf("repeat mismatch for %s in %s;\nwant: %v\nhave: %v", url, channel, want, have)
+	}
+}
+
+// syncWriter records all data written to it. It is safe for concurrent use.
+type syncWriter struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (sw *syncWriter) Write(p []byte) (int, error) {
+	sw.m.Lock()
+	defer sw.m.Unlock()
+	return sw.buf.Write(p)
+}
+
+func (sw *syncWriter) Close() error { return nil }
+
+func (sw *syncWriter) String() string {
+	sw.m.Lock()
+	defer sw.m.Unlock()
+	return sw.buf.String()
+}
+
+func TestRepeatedPreview(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "<html><head><title>Populaire link</title></head></html>")
+	}))
+
+	defer srv.Close()
+
+	// Links have to look like real ones, so have them all lead to the
+	// test server.
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, srv.Listener.Addr().String())
+		},
+	}}
+
+	p := &plugin{
+		lookup: lookup{
+			client:  client,
+			cache:   newTitleCache(time.Minute, 10),
+			maxURLs: DefaultMaxURLs,
+			repeats: newRepeatFilter(time.Second, nil),
+			sem:     make(chan struct{}, 1),
+		},
+	}
+
+	var w syncWriter
+	paste := func(sender string) {
+		p.Dispatch(&w, &irc.Request{
+			SenderName: sender,
+			Type:       "PRIVMSG",
+			Target:     "#test",
+			Data:       "kijk: http://example.com/populair",
+		})
+	}
+
+	// Two people paste the same link, one right after the other.
+	paste("steve")
+	paste("bob")
+	testPreviews(t, &w, 1)
+
+	// After the window, it is previewed again.
+	time.Sleep(time.Second)
+	paste("bob")
+	testPreviews(t, &w, 2)
+}
+
+// testPreviews waits until the writer holds the given number of previews
+// and ensures no more follow.
+func testPreviews(t *testing.T, w *syncWriter, want int) {
+	deadline := time.Now().Add(time.Second * 5)
+	for strings.Count(w.String(), "PRIVMSG") < want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+
+	if have := strings.Count(w.String(), "PRIVMSG"); have != want {
+		t.Fatalf("preview count mismatch;\nwant: %d\nhave: %d\n%s", want, have, w.String())
+	}
+}
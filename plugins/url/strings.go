@@ -4,8 +4,18 @@
 package url
 
 const (
-	TextDisplay         = "De link van %s toont: %s"
-	TextYoutubeDuration = " (speelduur: %s)"
+	TextDisplay  = "De link van %s toont: %s"
+	TextDuration = " (speelduur: %s)"
+	TextUploader = " (door %s)"
+	TextViews    = " (%s keer bekeken)"
+	TextNote     = " [%s]"
+
+	TextNotConfigured = "Extra informatie over %s-links is niet beschikbaar: er is geen API-sleutel ingesteld."
+
+	TextVideoUnavailable   = "video verwijderd of privé"
+	TextVideoPrivate       = "privévideo"
+	TextVideoRegionBlocked = "niet beschikbaar in Nederland"
+	TextVideoAgeRestricted = "leeftijdsbeperking"
 )
 
 // Ignore is a map of title strings to ignore. Only exact matches will
@@ -16,6 +16,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -28,13 +29,29 @@ var (
 	ErrNoSuchVideo   = errors.New("no such video")
 	ErrInvalidAPIKey = errors.New("invalid or missing API key")
 	ErrInvalidID     = errors.New("invalid or missing video ID")
+	ErrQuotaExceeded = errors.New("API quota exceeded")
+
+	// These are returned by GetVideoInfo for videos which exist, but
+	// can not be watched by everyone. They are returned along with
+	// whatever information is available for the video.
+	ErrVideoPrivate       = errors.New("video is private")
+	ErrVideoRegionBlocked = errors.New("video is not available in this region")
+	ErrVideoAgeRestricted = errors.New("video is age restricted")
 )
 
+// Region defines the ISO 3166-1 alpha-2 code of the country for which
+// region restrictions are checked.
+var Region = "NL"
+
 // VideoInfo defines some detailed properties for a specific
-// youtube video.
+// youtube video. Fields the API did not supply, are left empty.
 type VideoInfo struct {
-	ID       string        // The video's ID.
-	Duration time.Duration // Duration of the video.
+	ID           string        // The video's ID.
+	Title        string        // The video's title.
+	ChannelTitle string        // Name of the channel which posted the video.
+	Duration     time.Duration // Duration of the video.
+	ViewCount    uint64        // Number of times the video has been viewed.
+	PublishedAt  time.Time     // Time at which the video was published.
 }
 
 // GetVideoInfo returns details about a specific video, identified by
@@ -43,10 +60,17 @@ type VideoInfo struct {
 //    URL: https://www.youtube.com/watch?v=dQw4w9WgXcQ
 //    ID: dQw4w9WgXcQ
 //
-// This returns nil and an error if the query failed.
-func GetVideoInfo(apiKey, id string) (*VideoInfo, error) {
-	const videoURL = "https://www.googleapis.com/youtube/v3/videos?id=%s&part=contentDetails&key=%s"
-
+// This returns nil and an error if the query failed. Note that the API
+// does not list videos which have been removed, nor private videos from
+// other channels. Both yield ErrNoSuchVideo.
+//
+// If the video exists, but can not be watched by everyone, the video info
+// is returned along with ErrVideoPrivate, ErrVideoRegionBlocked or
+// ErrVideoAgeRestricted.
+//
+// The query is performed with the given client. If it is nil,
+// http.DefaultClient is used.
+func GetVideoInfo(client *http.Client, apiKey, id string) (*VideoInfo, error) {
 	apiKey = strings.TrimSpace(apiKey)
 	apiKey = url.QueryEscape(apiKey)
 
@@ -63,39 +87,136 @@ func GetVideoInfo(apiKey, id string) (*VideoInfo, error) {
 
 	var resp videoListResponse
 	url := fmt.Sprintf(videoURL, id, apiKey)
-	err := fetch(url, &resp)
+	err := fetch(client, url, &resp)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resp.Items) == 0 {
-		return nil, ErrNoSuchVideo
-	}
-
-	item := resp.Items[0]
-
-	return &VideoInfo{
-		ID:       item.ID,
-		Duration: parseISO8601(item.ContentDetails.Duration),
-	}, nil
+	return resp.videoInfo()
 }
 
+// videoURL defines the API endpoint for video queries.
+var videoURL = "https://www.googleapis.com/youtube/v3/videos?id=%s&part=contentDetails,snippet,statistics,status&key=%s"
+
 // videoListResponse defines response data for a videoList request.
 type videoListResponse struct {
 	Items []struct {
 		ID             string `json:"id"`
 		ContentDetails struct {
-			Duration string `json:"duration"` // ISO 8601 timestamp (e.g.: "PT4M13S")
+			Duration          string `json:"duration"` // ISO 8601 timestamp (e.g.: "PT4M13S")
+			RegionRestriction struct {
+				Allowed []string `json:"allowed"`
+				Blocked []string `json:"blocked"`
+			} `json:"regionRestriction"`
+			ContentRating struct {
+				YtRating string `json:"ytRating"`
+			} `json:"contentRating"`
 		} `json:"contentDetails"`
+		Snippet struct {
+			Title        string `json:"title"`
+			ChannelTitle string `json:"channelTitle"`
+			PublishedAt  string `json:"publishedAt"` // RFC 3339 timestamp.
+		} `json:"snippet"`
+		Statistics struct {
+			ViewCount string `json:"viewCount"`
+		} `json:"statistics"`
+		Status struct {
+			PrivacyStatus string `json:"privacyStatus"`
+		} `json:"status"`
 	} `json:"items"`
 }
 
+// videoInfo returns the info for the first video in the response.
+func (vr *videoListResponse) videoInfo() (*VideoInfo, error) {
+	if len(vr.Items) == 0 {
+		return nil, ErrNoSuchVideo
+	}
+
+	item := vr.Items[0]
+	views, _ := strconv.ParseUint(item.Statistics.ViewCount, 10, 64)
+	published, _ := time.Parse(time.RFC3339, item.Snippet.PublishedAt)
+
+	info := &VideoInfo{
+		ID:           item.ID,
+		Title:        item.Snippet.Title,
+		ChannelTitle: item.Snippet.ChannelTitle,
+		Duration:     parseISO8601(item.ContentDetails.Duration),
+		ViewCount:    views,
+		PublishedAt:  published,
+	}
+
+	rr := item.ContentDetails.RegionRestriction
+
+	switch {
+	case item.Status.PrivacyStatus == "private":
+		return info, ErrVideoPrivate
+	case hasRegion(rr.Blocked, Region),
+		rr.Allowed != nil && !hasRegion(rr.Allowed, Region):
+		return info, ErrVideoRegionBlocked
+	case item.ContentDetails.ContentRating.YtRating == "ytAgeRestricted":
+		return info, ErrVideoAgeRestricted
+	}
+
+	return info, nil
+}
+
+// hasRegion returns true if list contains the given region code.
+func hasRegion(list []string, region string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, region) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorResponse defines the error data returned by the API for
+// failed requests.
+type errorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Errors  []struct {
+			Reason string `json:"reason"`
+		} `json:"errors"`
+	} `json:"error"`
+}
+
+// apiError returns an error for the given failed API response.
+func apiError(status string, data []byte) error {
+	var resp errorResponse
+	if json.Unmarshal(data, &resp) != nil || len(resp.Error.Message) == 0 {
+		return fmt.Errorf("youtube: %s", status)
+	}
+
+	for _, e := range resp.Error.Errors {
+		switch e.Reason {
+		case "keyInvalid", "keyExpired":
+			return ErrInvalidAPIKey
+		case "quotaExceeded", "dailyLimitExceeded", "rateLimitExceeded":
+			return ErrQuotaExceeded
+		case "videoNotFound":
+			return ErrNoSuchVideo
+		}
+	}
+
+	return fmt.Errorf("youtube: %s: %s", status, resp.Error.Message)
+}
+
 // fetch performs an API query and unmarshals the result into the
 // given value. Returns an error if something went booboo.
-func fetch(url string, v interface{}) error {
-	resp, err := http.Get(url)
+func fetch(client *http.Client, query string, v interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(query)
 	if err != nil {
+		// The error includes the request URL, which holds our API key.
+		if uerr, ok := err.(*url.Error); ok {
+			return uerr.Err
+		}
 		return err
 	}
 
@@ -106,11 +227,16 @@ func fetch(url string, v interface{}) error {
 		return err
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		return apiError(resp.Status, data)
+	}
+
 	return json.Unmarshal(data, v)
 }
 
 // parseISO8601 parses the given ISO 8601 value into a time.Duration value.
-// Example value: "PT4M13S"
+// Example value: "PT4M13S". Components may contain a decimal fraction,
+// like "PT1M30.5S".
 //
 // ref: https://en.wikipedia.org/wiki/ISO_8601#Durations
 func parseISO8601(v string) time.Duration {
@@ -124,7 +250,7 @@ func parseISO8601(v string) time.Duration {
 	var err error
 	var sum time.Duration
 	var inDate bool
-	var n int64
+	var n time.Duration
 
 	digits := make([]rune, 0, len(v)/2)
 	for _, r := range v {
@@ -136,41 +262,43 @@ func parseISO8601(v string) time.Duration {
 			inDate = false
 
 		case 'Y':
-			n, err = strconv.ParseInt(string(digits), 10, 32)
-			sum += time.Duration(n) * time.Hour * 8760
+			n, err = parseComponent(digits, time.Hour*8760)
+			sum += n
 			digits = digits[:0]
 
 		case 'M':
 			if inDate { // M == month
-				n, err = strconv.ParseInt(string(digits), 10, 32)
-				sum += time.Duration(n) * time.Hour * 730
-				digits = digits[:0]
+				n, err = parseComponent(digits, time.Hour*730)
 			} else { // M = minutes
-				n, err = strconv.ParseInt(string(digits), 10, 32)
-				sum += time.Duration(n) * time.Minute
-				digits = digits[:0]
+				n, err = parseComponent(digits, time.Minute)
 			}
+			sum += n
+			digits = digits[:0]
 
 		case 'W':
-			n, err = strconv.ParseInt(string(digits), 10, 32)
-			sum += time.Duration(n) * time.Hour * 168
+			n, err = parseComponent(digits, time.Hour*168)
+			sum += n
 			digits = digits[:0]
 
 		case 'D':
-			n, err = strconv.ParseInt(string(digits), 10, 32)
-			sum += time.Duration(n) * time.Hour * 24
+			n, err = parseComponent(digits, time.Hour*24)
+			sum += n
 			digits = digits[:0]
 
 		case 'H':
-			n, err = strconv.ParseInt(string(digits), 10, 32)
-			sum += time.Duration(n) * time.Hour
+			n, err = parseComponent(digits, time.Hour)
+			sum += n
 			digits = digits[:0]
 
 		case 'S':
-			n, err = strconv.ParseInt(string(digits), 10, 32)
-			sum += time.Duration(n) * time.Second
+			n, err = parseComponent(digits, time.Second)
+			sum += n
 			digits = digits[:0]
 
+		case '.', ',':
+			// ISO 8601 allows both as the decimal separator.
+			digits = append(digits, '.')
+
 		default:
 			if unicode.IsDigit(r) {
 				digits = append(digits, r)
@@ -186,3 +314,21 @@ func parseISO8601(v string) time.Duration {
 
 	return sum
 }
+
+// parseComponent parses the number in the given digits and returns it
+// as a multiple of unit. The number may have a decimal fraction.
+func parseComponent(digits []rune, unit time.Duration) (time.Duration, error) {
+	v := string(digits)
+
+	if !strings.ContainsRune(v, '.') {
+		n, err := strconv.ParseInt(v, 10, 32)
+		return time.Duration(n) * unit, err
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(math.Round(f * float64(unit))), nil
+}
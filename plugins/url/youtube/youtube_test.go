@@ -4,6 +4,9 @@
 package youtube
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -22,6 +25,14 @@ func TestParseISO8601(t *testing.T) {
 	testISO8601(t, "PTz1H", 0)
 	testISO8601(t, "P 1H", 0)
 	testISO8601(t, "P2MT2M33S", 2*time.Hour*730+2*time.Minute+33*time.Second)
+	testISO8601(t, "PT4M13S", 4*time.Minute+13*time.Second)
+	testISO8601(t, "PT1M30.5S", time.Minute+30*time.Second+500*time.Millisecond)
+	testISO8601(t, "PT0.5S", 500*time.Millisecond)
+	testISO8601(t, "PT0,25S", 250*time.Millisecond)
+	testISO8601(t, "PT1.5M", time.Minute+30*time.Second)
+	testISO8601(t, "PT1H2M3.125S", time.Hour+2*time.Minute+3125*time.Millisecond)
+	testISO8601(t, "PT.S", 0)
+	testISO8601(t, "PT1.2.3S", 0)
 }
 
 func testISO8601(t *testing.T, in string, want time.Duration) {
@@ -31,6 +42,96 @@ func testISO8601(t *testing.T, in string, want time.Duration) {
 	}
 }
 
+func TestVideoInfo(t *testing.T) {
+	info, err := testVideoInfo(t, "video.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := VideoInfo{
+		ID:           "dQw4w9WgXcQ",
+		Title:        "Rick Astley - Never Gonna Give You Up (Official Music Video)",
+		ChannelTitle: "Rick Astley",
+		Duration:     3*time.Minute + 33*time.Second,
+		ViewCount:    1234567890,
+		PublishedAt:  time.Date(2009, 10, 25, 6, 57, 33, 0, time.UTC),
+	}
+
+	if *info != want {
+		t.Fatalf("info mismatch;\nwant: %+v\nhave: %+v", want, *info)
+	}
+
+	// Parts which are missing from the response are left empty.
+	info, err = testVideoInfo(t, "video_details.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = VideoInfo{ID: "HKNXXpqareI", Duration: 4*time.Minute + 13*time.Second}
+	if *info != want {
+		t.Fatalf("info mismatch;\nwant: %+v\nhave: %+v", want, *info)
+	}
+
+	_, err = testVideoInfo(t, "empty.json")
+	if err != ErrNoSuchVideo {
+		t.Fatalf("error mismatch;\nwant: %v\nhave: %v", ErrNoSuchVideo, err)
+	}
+}
+
+func TestVideoRestrictions(t *testing.T) {
+	testRestriction(t, "private.json", "Privévideo", ErrVideoPrivate)
+	testRestriction(t, "blocked.json", "Geblokkeerde video", ErrVideoRegionBlocked)
+	testRestriction(t, "allowed.json", "Alleen in Amerika", ErrVideoRegionBlocked)
+	testRestriction(t, "age.json", "Niet voor kinderen", ErrVideoAgeRestricted)
+	testRestriction(t, "video.json", "Rick Astley - Never Gonna Give You Up (Official Music Video)", nil)
+}
+
+func testRestriction(t *testing.T, file, title string, want error) {
+	info, err := testVideoInfo(t, file)
+	if err != want {
+		t.Fatalf("error mismatch for %q;\nwant: %v\nhave: %v", file, want, err)
+	}
+
+	// Restricted videos still yield their information.
+	if info == nil || info.Title != title {
+		t.Fatalf("info mismatch for %q;\nwant title: %q\nhave: %+v", file, title, info)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	testAPIError(t, "error_key.json", "400 Bad Request", ErrInvalidAPIKey.Error())
+	testAPIError(t, "error_quota.json", "403 Forbidden", ErrQuotaExceeded.Error())
+	testAPIError(t, "error_other.json", "500 Internal Server Error",
+		"youtube: 500 Internal Server Error: Backend Error")
+	testAPIError(t, "empty.json", "502 Bad Gateway", "youtube: 502 Bad Gateway")
+}
+
+func testAPIError(t *testing.T, file, status, want string) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	have := apiError(status, data).Error()
+	if want != have {
+		t.Fatalf("error mismatch for %q;\nwant: %q\nhave: %q", file, want, have)
+	}
+}
+
+func testVideoInfo(t *testing.T, file string) (*VideoInfo, error) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resp videoListResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.videoInfo()
+}
+
 func TestGetVideoInfo(t *testing.T) {
 	if len(ApiKey) == 0 {
 		return
@@ -38,7 +139,7 @@ func TestGetVideoInfo(t *testing.T) {
 
 	const videoID = "dQw4w9WgXcQ"
 
-	info, err := GetVideoInfo(ApiKey, videoID)
+	info, err := GetVideoInfo(nil, ApiKey, videoID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -5,122 +5,158 @@ package weather
 
 import (
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/monkeybird/autimaat/app/util"
 	"github.com/monkeybird/autimaat/irc"
 	"github.com/monkeybird/autimaat/irc/cmd"
-	"github.com/monkeybird/autimaat/irc/proto"
 )
 
-const CurrentWeatherURL = "https://api.wunderground.com/api/%s/conditions/lang:%s/q/%s.json"
+const CurrentWeatherURL = "https://api.openweathermap.org/data/2.5/weather?lat=%f&lon=%f&units=metric&lang=%s&appid=%s"
 
 // cmdCurrentWeather yields current weather data for a given location.
 func (p *plugin) cmdCurrentWeather(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
 	p.m.Lock()
-	defer p.m.Unlock()
+	ok := p.configured(w, r)
+	loc, u, _ := p.parseRequest(params.Words(0))
+	p.m.Unlock()
 
-	if len(p.config.WundergroundApiKey) == 0 {
-		proto.PrivMsg(w, r.Target, TextNoWeather)
+	if !ok {
 		return
 	}
 
-	loc := newLocation(r)
-	key := strings.ToLower(loc.String())
-
-	if resp, ok := p.currentWeatherCache[key]; ok {
-		// If the cached result is younger than the timeout, print its
-		// contents for the user and exit. Otherwise, consider it stale,
-		// delete it and re-fetch.
-		if time.Since(resp.Timestamp) <= CacheTimeout {
-			sendCurrentWeather(w, r, resp)
-			return
-		}
-
-		delete(p.currentWeatherCache, key)
-	}
-
-	// Fetch new response.
-	var resp currentWeatherResponse
-	resp.Timestamp = time.Now()
-
-	if !p.fetch(CurrentWeatherURL, key, &resp) {
+	// Find the exact location. If the name is ambiguous, the user is
+	// presented with suggestions instead.
+	loc, ok = p.resolve(w, r, loc)
+	if !ok {
 		return
 	}
 
-	// It is possible we received location suggestions, instead of weather
-	// data. Present these suggestions to the user and exit. Do not cache
-	// the response.
-	if len(resp.Response.Results) > 0 {
-		sendLocations(w, r, resp.Response.Results)
+	resp, ok := p.currentWeather(loc)
+	if !ok {
+		r.Reply(w, TextNoWeather, r.SenderName)
 		return
 	}
 
-	sendCurrentWeather(w, r, &resp)
-	p.currentWeatherCache[key] = &resp
+	sendCurrentWeather(w, r, resp, u)
 }
 
-// sendCurrentWeather formats a response for the user who invoked the
-// weather request and sends it back to them.
-func sendCurrentWeather(w irc.ResponseWriter, r *irc.Request, cwr *currentWeatherResponse) {
-	co := &cwr.CurrentObservation
+// currentWeather returns the current weather for the given, resolved
+// location. The weather is cached by the location it resolves to, so
+// different names for the same place share their results. Concurrent
+// requests for the same place share a single lookup.
+func (p *plugin) currentWeather(loc *location) (*currentWeatherResponse, bool) {
+	key := loc.key()
+
+	// cached returns the cached result, if it is younger than the
+	// timeout. Otherwise, it is considered stale and must be re-fetched.
+	cached := func() (*currentWeatherResponse, bool) {
+		p.m.Lock()
+		defer p.m.Unlock()
+
+		resp, ok := p.currentWeatherCache[key]
+		return resp, ok && time.Since(resp.Timestamp) <= CacheTimeout
+	}
 
-	if strings.TrimSpace(co.DisplayLocation.City) == "" {
-		proto.PrivMsg(w, r.Target, TextNoResult, r.SenderName)
-		return
+	if resp, ok := cached(); ok {
+		return resp, true
 	}
 
-	location := util.Bold(co.DisplayLocation.City)
+	v, ok := p.flight.Do("weather/"+key, func() (interface{}, bool) {
+		// Another lookup may have completed while we got here.
+		if resp, ok := cached(); ok {
+			return resp, true
+		}
+
+		var resp currentWeatherResponse
+		resp.Timestamp = time.Now()
+		resp.Location = *loc
 
-	if len(co.DisplayLocation.Country) > 0 {
-		if len(co.DisplayLocation.State) > 0 {
-			location += fmt.Sprintf(" (%s, %s)",
-				co.DisplayLocation.State, co.DisplayLocation.Country)
-		} else {
-			location += fmt.Sprintf(" (%s)", co.DisplayLocation.Country)
+		if !p.fetch(CurrentWeatherURL, &resp, loc.Lat, loc.Lon,
+			TextLanguageISO, p.apiKey()) {
+			return nil, false
 		}
+
+		p.m.Lock()
+		p.currentWeatherCache[key] = &resp
+		p.m.Unlock()
+		return &resp, true
+	})
+
+	if !ok {
+		return nil, false
 	}
 
-	proto.PrivMsg(w, r.Target, TextCurrentWeatherDisplay,
+	return v.(*currentWeatherResponse), true
+}
+
+// sendCurrentWeather formats a response for the user who invoked the
+// weather request and sends it back to them, in the given units.
+func sendCurrentWeather(w irc.ResponseWriter, r *irc.Request, cwr *currentWeatherResponse, u units) {
+	if len(cwr.Weather) == 0 {
+		r.Reply(w, TextNoResult, r.SenderName)
+		return
+	}
+
+	msg := fmt.Sprintf(TextCurrentWeatherDisplay,
 		r.SenderName,
 
-		location,
+		util.Bold("%s", cwr.Location.Display()),
 
-		int(co.TempC),
-		co.Weather,
-		co.PressureMB,
-		co.RelativeHumidity,
-		co.WindKPH,
-		co.WindDir,
+		u.Temp(cwr.Main.Temp),
+		u.TempLabel(),
+		cwr.Weather[0].Description,
+		cwr.Main.Pressure,
+		cwr.Main.Humidity,
+		u.Speed(cwr.Wind.Speed),
+		u.SpeedLabel(),
+		windDirection(cwr.Wind.Deg),
 	)
+
+	// The weather service may omit these.
+	if cwr.Main.FeelsLike != nil {
+		msg += fmt.Sprintf(TextFeelsLikeDisplay, u.Temp(*cwr.Main.FeelsLike), u.TempLabel())
+	}
+
+	if cwr.Sys.Sunrise > 0 && cwr.Sys.Sunset > 0 {
+		zone := time.FixedZone("", cwr.Timezone)
+		msg += fmt.Sprintf(TextSunDisplay,
+			time.Unix(cwr.Sys.Sunrise, 0).In(zone).Format(TextTimeFormat),
+			time.Unix(cwr.Sys.Sunset, 0).In(zone).Format(TextTimeFormat))
+	}
+
+	r.Reply(w, "%s", msg)
 }
 
 // currentWeatherResponse defines an API response.
 type currentWeatherResponse struct {
 	Timestamp time.Time
-
-	// This is filled if an ambiguous location name is provided to
-	// the API. It will contain location suggestions for specific
-	// places.
-	Response struct {
-		Results []location `json:"results"`
-
-		Error struct {
-			Description string `json:"description"`
-		} `json:"error"`
-	} `json:"response"`
-
-	// This is filled with actual weather data for a specific location.
-	// It is only filled if the Response.Results field is empty.
-	CurrentObservation struct {
-		DisplayLocation  location `json:"display_location"`
-		Weather          string   `json:"weather"`
-		TempC            float32  `json:"temp_c"`
-		RelativeHumidity string   `json:"relative_humidity"`
-		WindDir          string   `json:"wind_dir"`
-		WindKPH          float32  `json:"wind_kph"`
-		PressureMB       string   `json:"pressure_mb"`
-		FeelslikeC       string   `json:"feelslike_c"`
-	} `json:"current_observation"`
+	Location  location
+
+	Weather []struct {
+		Description string `json:"description"`
+	} `json:"weather"`
+
+	Main struct {
+		Temp      float64  `json:"temp"`
+		FeelsLike *float64 `json:"feels_like"`
+		Pressure  int      `json:"pressure"`
+		Humidity  int      `json:"humidity"`
+	} `json:"main"`
+
+	// Speed is in meters per second. Deg is the direction the
+	// wind is coming from, in degrees.
+	Wind struct {
+		Speed float64 `json:"speed"`
+		Deg   float64 `json:"deg"`
+	} `json:"wind"`
+
+	// Sunrise and Sunset are unix timestamps.
+	Sys struct {
+		Sunrise int64 `json:"sunrise"`
+		Sunset  int64 `json:"sunset"`
+	} `json:"sys"`
+
+	// Timezone is the offset from UTC in seconds.
+	Timezone int `json:"timezone"`
 }
@@ -0,0 +1,52 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package weather
+
+import "sync"
+
+// flightCall is a lookup which is in progress, or has completed.
+type flightCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+	ok  bool
+}
+
+// flight coalesces concurrent lookups with the same key, so only one of
+// them goes out to the weather service. The zero value is ready for use.
+type flight struct {
+	m     sync.Mutex
+	calls map[string]*flightCall
+}
+
+// Do runs fn and returns its results, unless a call with the same key is
+// already in progress. In that case, it waits for that call to complete
+// and returns its results instead.
+func (f *flight) Do(key string, fn func() (interface{}, bool)) (interface{}, bool) {
+	f.m.Lock()
+
+	if c, ok := f.calls[key]; ok {
+		f.m.Unlock()
+		c.wg.Wait()
+		return c.val, c.ok
+	}
+
+	if f.calls == nil {
+		f.calls = make(map[string]*flightCall)
+	}
+
+	c := new(flightCall)
+	c.wg.Add(1)
+	f.calls[key] = c
+	f.m.Unlock()
+
+	defer func() {
+		f.m.Lock()
+		delete(f.calls, key)
+		f.m.Unlock()
+		c.wg.Done()
+	}()
+
+	c.val, c.ok = fn()
+	return c.val, c.ok
+}
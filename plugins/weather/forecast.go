@@ -5,105 +5,216 @@ package weather
 
 import (
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/monkeybird/autimaat/app/util"
 	"github.com/monkeybird/autimaat/irc"
 	"github.com/monkeybird/autimaat/irc/cmd"
-	"github.com/monkeybird/autimaat/irc/proto"
 )
 
-const ForecastURL = "https://api.wunderground.com/api/%s/forecast/lang:%s/q/%s.json"
+const ForecastURL = "https://api.openweathermap.org/data/2.5/forecast?lat=%f&lon=%f&units=metric&lang=%s&appid=%s"
 
-// cmdCurrentWeather yields weather forecast data for a given location.
+const (
+	// ForecastDays defines the number of days covered by a forecast,
+	// unless the user asks for another number.
+	ForecastDays = 3
+
+	// MaxForecastDays defines the maximum number of days covered by a
+	// forecast. The weather service does not provide more.
+	MaxForecastDays = 5
+)
+
+// cmdForecast yields weather forecast data for a given location.
 func (p *plugin) cmdForecast(w irc.ResponseWriter, r *irc.Request, params cmd.ParamList) {
 	p.m.Lock()
-	defer p.m.Unlock()
+	ok := p.configured(w, r)
+	loc, u, days := p.parseRequest(params.Words(0))
+	p.m.Unlock()
 
-	if len(p.config.WundergroundApiKey) == 0 {
-		proto.PrivMsg(w, r.Target, TextNoWeather)
+	if !ok {
 		return
 	}
 
-	loc := newLocation(r)
-	key := strings.ToLower(loc.String())
-
-	if fr, ok := p.forecastCache[key]; ok {
-		// If the cached result is younger than the timeout, print its
-		// contents for the user and exit. Otherwise, consider it stale,
-		// delete it and re-fetch.
-		if time.Since(fr.Timestamp) <= CacheTimeout {
-			sendForecast(w, r, fr, loc)
-			return
-		}
+	// Find the exact location. If the name is ambiguous, the user is
+	// presented with suggestions instead.
+	loc, ok = p.resolve(w, r, loc)
+	if !ok {
+		return
+	}
 
-		delete(p.currentWeatherCache, key)
+	resp, ok := p.forecast(loc)
+	if !ok {
+		r.Reply(w, TextNoWeather, r.SenderName)
+		return
 	}
 
-	var resp forecastResponse
-	resp.Timestamp = time.Now()
+	sendForecast(w, r, resp, u, days)
+}
 
-	if !p.fetch(ForecastURL, key, &resp) {
-		return
+// forecast returns the forecast for the given, resolved location. It is
+// cached and shared the same way as the results of currentWeather.
+func (p *plugin) forecast(loc *location) (*forecastResponse, bool) {
+	key := loc.key()
+
+	cached := func() (*forecastResponse, bool) {
+		p.m.Lock()
+		defer p.m.Unlock()
+
+		fr, ok := p.forecastCache[key]
+		return fr, ok && time.Since(fr.Timestamp) <= CacheTimeout
 	}
 
-	// It is possible we received location suggestions, instead of weather
-	// data. Present these suggestions to the user and exit. Do not cache
-	// the response.
-	if len(resp.Response.Results) > 0 {
-		sendLocations(w, r, resp.Response.Results)
-		return
+	if fr, ok := cached(); ok {
+		return fr, true
 	}
 
-	sendForecast(w, r, &resp, loc)
-	p.forecastCache[key] = &resp
-}
+	v, ok := p.flight.Do("forecast/"+key, func() (interface{}, bool) {
+		if fr, ok := cached(); ok {
+			return fr, true
+		}
 
-// sendCurrentWeather formats a response for the user who invoked the
-// weather request and sends it back to them.
-func sendForecast(w irc.ResponseWriter, r *irc.Request, fr *forecastResponse, loc *location) {
-	location := util.Bold(loc.City)
+		var resp forecastResponse
+		resp.Timestamp = time.Now()
+		resp.Location = *loc
 
-	if len(loc.Country) > 0 {
-		if len(loc.State) > 0 {
-			location += fmt.Sprintf(" (%s, %s)", loc.Country, loc.State)
-		} else {
-			location += fmt.Sprintf(" (%s)", loc.Country)
+		if !p.fetch(ForecastURL, &resp, loc.Lat, loc.Lon,
+			TextLanguageISO, p.apiKey()) {
+			return nil, false
 		}
+
+		p.m.Lock()
+		p.forecastCache[key] = &resp
+		p.m.Unlock()
+		return &resp, true
+	})
+
+	if !ok {
+		return nil, false
 	}
 
-	if len(fr.Forecast.TextForecast.ForecastDay) == 0 {
-		proto.PrivMsg(w, r.SenderName, TextNoResult, r.SenderName)
+	return v.(*forecastResponse), true
+}
+
+// sendForecast formats a response for the user who invoked the
+// weather request and sends it back to them. It covers at most n
+// days, in the given units.
+func sendForecast(w irc.ResponseWriter, r *irc.Request, fr *forecastResponse, u units, n int) {
+	days := fr.Days(n, u)
+
+	if len(days) == 0 {
+		r.ReplyPrivate(w, TextNoResult, r.SenderName)
 		return
 	}
 
-	proto.PrivMsg(w, r.SenderName, TextForecastDisplay, location)
+	r.ReplyPrivate(w, TextForecastDisplay, util.Bold("%s", fr.Location.Display()))
 
-	for _, v := range fr.Forecast.TextForecast.ForecastDay {
-		proto.PrivMsg(w, r.SenderName, "%s: %s", util.Bold(v.Title), v.Text)
+	for _, v := range days {
+		r.ReplyPrivate(w, "%s: %s", util.Bold("%s", v.Title), v.Text)
 	}
 }
 
+// forecastDay defines the forecast for a single day.
+type forecastDay struct {
+	Title string
+	Text  string
+}
+
 // forecastResponse defines an API response.
 type forecastResponse struct {
 	Timestamp time.Time
+	Location  location
+
+	// List holds forecasts in 3 hour intervals.
+	List []struct {
+		Time int64 `json:"dt"`
+
+		Main struct {
+			TempMin float64 `json:"temp_min"`
+			TempMax float64 `json:"temp_max"`
+		} `json:"main"`
+
+		Weather []struct {
+			Description string `json:"description"`
+		} `json:"weather"`
+
+		// Speed is in meters per second.
+		Wind struct {
+			Speed float64 `json:"speed"`
+		} `json:"wind"`
+	} `json:"list"`
+
+	City struct {
+		// Timezone is the offset from UTC in seconds.
+		Timezone int `json:"timezone"`
+	} `json:"city"`
+}
+
+// Days summarizes the forecast for at most n days, in the location's
+// local time. Each day lists the expected weather around midday, the
+// minimum and maximum temperature and the maximum wind speed, in the
+// given units.
+func (fr *forecastResponse) Days(n int, u units) []forecastDay {
+	zone := time.FixedZone("", fr.City.Timezone)
+
+	var out []forecastDay
+	var date string
+	var min, max, wind float64
+	var desc string
+	var offset time.Duration
+
+	flush := func(t time.Time) {
+		text := fmt.Sprintf(TextForecastDayDisplay, desc, u.Temp(min), u.Temp(max),
+			u.TempLabel(), u.Speed(wind), u.SpeedLabel())
+		out = append(out, forecastDay{
+			Title: TextWeekdays[t.Weekday()],
+			Text:  text,
+		})
+	}
+
+	var last time.Time
+	for _, v := range fr.List {
+		t := time.Unix(v.Time, 0).In(zone)
+
+		if d := t.Format("2006-01-02"); d != date {
+			if len(date) > 0 {
+				flush(last)
+				if len(out) >= n {
+					return out
+				}
+			}
+
+			date = d
+			min, max, wind = v.Main.TempMin, v.Main.TempMax, v.Wind.Speed
+			desc, offset = "", -1
+		}
+
+		last = t
+		if v.Main.TempMin < min {
+			min = v.Main.TempMin
+		}
+
+		if v.Main.TempMax > max {
+			max = v.Main.TempMax
+		}
+
+		if v.Wind.Speed > wind {
+			wind = v.Wind.Speed
+		}
+
+		// Use the description closest to midday.
+		dist := time.Duration(t.Hour()-12) * time.Hour
+		if dist < 0 {
+			dist = -dist
+		}
+
+		if len(v.Weather) > 0 && (offset < 0 || dist < offset) {
+			desc, offset = v.Weather[0].Description, dist
+		}
+	}
+
+	if len(date) > 0 && len(out) < n {
+		flush(last)
+	}
 
-	// This is filled if an ambiguous location name is provided to
-	// the API. It will contain location suggestions for specific
-	// places.
-	Response struct {
-		Results []location `json:"results"`
-	} `json:"response"`
-
-	// This defines actual forecast data for a specific location.
-	// It will be empty if the Response.Results field is not.
-	Forecast struct {
-		TextForecast struct {
-			ForecastDay []struct {
-				Title string `json:"title"`
-				Text  string `json:"fcttext_metric"`
-			} `json:"forecastday"`
-		} `json:"txt_forecast"`
-	} `json:"forecast"`
+	return out
 }
@@ -6,34 +6,101 @@ package weather
 import (
 	"fmt"
 	"net/url"
-
-	"github.com/monkeybird/autimaat/irc"
+	"strings"
 )
 
+// GeocodeURL defines the service used to find the coordinates of
+// a location by name.
+const GeocodeURL = "https://api.openweathermap.org/geo/1.0/direct?q=%s&limit=5&appid=%s"
+
 type location struct {
-	City    string `json:"city"`
-	State   string `json:"state"`
-	Country string `json:"country_iso3166"`
+	City       string            `json:"name"`
+	State      string            `json:"state"`
+	Country    string            `json:"country"`
+	LocalNames map[string]string `json:"local_names"`
+	Lat        float64           `json:"lat"`
+	Lon        float64           `json:"lon"`
 }
 
-// newLocation creates a new location from the given command request data.
-func newLocation(r *irc.Request) *location {
+// newLocation creates a new location from the given command parameters.
+// These are the city, followed by an optional country and state. The
+// country is an ISO 3166 code, so if only the state has two letters,
+// the two are assumed to be given in the wrong order and are swapped.
+// Commas between the parameters are treated as spaces.
+func newLocation(fields []string) *location {
 	var l location
 
-	fields := r.Fields(1)
-	l.City = url.QueryEscape(fields[0])
+	words := make([]string, 0, len(fields))
+	for _, v := range fields {
+		for _, w := range strings.Split(v, ",") {
+			if len(w) > 0 {
+				words = append(words, w)
+			}
+		}
+	}
+
+	if len(words) > 0 {
+		l.City = words[0]
+	}
 
-	if len(fields) > 1 {
-		l.Country = url.QueryEscape(fields[1])
+	if len(words) > 1 {
+		l.Country = words[1]
 	}
 
-	if len(fields) > 2 {
-		l.State = url.QueryEscape(fields[2])
+	if len(words) > 2 {
+		l.State = words[2]
+
+		if len(l.Country) != 2 && len(l.State) == 2 {
+			l.Country, l.State = l.State, l.Country
+		}
 	}
 
 	return &l
 }
 
+// Name returns the name of the location in the bot's language, if known.
+func (l *location) Name() string {
+	if name, ok := l.LocalNames[strings.ToLower(TextLanguageISO)]; ok {
+		return name
+	}
+	return l.City
+}
+
+// Query returns the location as a query for the geocoding service.
+func (l *location) Query() string {
+	set := []string{l.City}
+
+	if len(l.State) > 0 {
+		set = append(set, l.State)
+	}
+
+	if len(l.Country) > 0 {
+		set = append(set, l.Country)
+	}
+
+	return url.QueryEscape(strings.Join(set, ","))
+}
+
+// Display returns the location name, formatted for display.
+func (l *location) Display() string {
+	name := l.Name()
+
+	if len(l.Country) > 0 {
+		if len(l.State) > 0 {
+			name += fmt.Sprintf(" (%s, %s)", l.State, l.Country)
+		} else {
+			name += fmt.Sprintf(" (%s)", l.Country)
+		}
+	}
+
+	return name
+}
+
+// key returns the normalized location, for use as a cache key.
+func (l *location) key() string {
+	return strings.ToLower(l.String())
+}
+
 func (l *location) String() string {
 	if len(l.Country) == 0 {
 		return l.City
@@ -45,3 +112,25 @@ func (l *location) String() string {
 
 	return fmt.Sprintf("%s/%s/%s", l.Country, l.State, l.City)
 }
+
+// uniqueLocations returns the given locations, minus those which share
+// a name, state and country with an earlier one.
+func uniqueLocations(locs []location) []location {
+	out := make([]location, 0, len(locs))
+
+	for _, l := range locs {
+		found := false
+		for _, v := range out {
+			if strings.EqualFold(v.String(), l.String()) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			out = append(out, l)
+		}
+	}
+
+	return out
+}
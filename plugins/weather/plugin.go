@@ -10,9 +10,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
-	"path/filepath"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,7 +22,6 @@ import (
 	"github.com/monkeybird/autimaat/app/util"
 	"github.com/monkeybird/autimaat/irc"
 	"github.com/monkeybird/autimaat/irc/cmd"
-	"github.com/monkeybird/autimaat/irc/proto"
 	"github.com/monkeybird/autimaat/plugins"
 )
 
@@ -30,17 +31,29 @@ func init() { plugins.Register(&plugin{}) }
 // considered stale and it must be re-fetched.
 const CacheTimeout = time.Minute * 10
 
+// GeocodeCacheTimeout defines the time after which the coordinates of
+// a location are looked up again.
+const GeocodeCacheTimeout = time.Hour * 24
+
 // LookupTimeout defines the timeout after which a service request
 // is considered failed.
 const LookupTimeout = time.Second * 5
 
+// NoticeInterval defines how often a channel is told that the weather
+// commands have not been configured.
+const NoticeInterval = time.Hour
+
 type plugin struct {
 	m                   sync.Mutex
 	cmd                 *cmd.Set
 	currentWeatherCache map[string]*currentWeatherResponse
 	forecastCache       map[string]*forecastResponse
+	geocodeCache        map[string]*geocodeEntry
+	flight              flight
+	notices             *util.Throttle
+	units               units
 	config              struct {
-		WundergroundApiKey string
+		OpenWeatherMapApiKey string
 	}
 }
 
@@ -49,29 +62,189 @@ type plugin struct {
 func (p *plugin) Load(prof irc.Profile) error {
 	p.currentWeatherCache = make(map[string]*currentWeatherResponse)
 	p.forecastCache = make(map[string]*forecastResponse)
+	p.geocodeCache = make(map[string]*geocodeEntry)
+	p.notices = util.NewThrottle(NoticeInterval)
 
-	p.cmd = cmd.New(prof.CommandPrefix(), nil)
+	p.cmd = cmd.New(prof.CommandPrefixes(), nil)
+	p.cmd.SetAcceptNotice(prof.NoticeCommands())
+	plugins.Track(p, p.cmd)
 	p.cmd.Bind(TextCurrentWeatherName, false, p.cmdCurrentWeather).
 		Add(TextLocation, true, cmd.RegAny)
 	p.cmd.Bind(TextForecastName, false, p.cmdForecast).
 		Add(TextLocation, true, cmd.RegAny)
 
-	file := filepath.Join(prof.Root(), "weather.cfg")
-	return util.ReadFile(file, &p.config, false)
+	return p.loadConfig(prof)
+}
+
+// Reload reloads the plugin's configuration.
+func (p *plugin) Reload(prof irc.Profile) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.cmd.SetPrefixes(prof.CommandPrefixes())
+	return p.loadConfig(prof)
+}
+
+// loadConfig reads the plugin configuration from the profile. The API
+// key may refer to an environment variable, as ${VAR} or $VAR.
+func (p *plugin) loadConfig(prof irc.Profile) error {
+	err := prof.PluginConfig("weather", &p.config)
+	p.config.OpenWeatherMapApiKey = util.ExpandEnv(p.config.OpenWeatherMapApiKey)
+
+	u, ok := parseUnits(prof.WeatherUnits())
+	if !ok {
+		log.Printf("[weather] Unknown units %q; using metric units", prof.WeatherUnits())
+	}
+
+	p.units = u
+	return err
 }
 
 // Unload cleans the module up and unloads any internal resources.
 func (p *plugin) Unload(prof irc.Profile) error {
-	p.config.WundergroundApiKey = ""
+	p.cmd.Close()
+	p.config.OpenWeatherMapApiKey = ""
 	return nil
 }
 
 // Dispatch sends the given, incoming IRC message to the plugin for
 // processing as it sees fit.
 func (p *plugin) Dispatch(w irc.ResponseWriter, r *irc.Request) {
-	if len(p.config.WundergroundApiKey) > 0 {
-		p.cmd.Dispatch(w, r)
+	p.cmd.Dispatch(w, r)
+}
+
+// configured returns true if an API key has been set. If not, the user
+// is told that the weather commands are not available. This happens no
+// more than once per NoticeInterval, for each channel, after which the
+// commands are silently ignored. The caller must hold the lock.
+func (p *plugin) configured(w irc.ResponseWriter, r *irc.Request) bool {
+	if len(p.config.OpenWeatherMapApiKey) > 0 {
+		return true
+	}
+
+	if p.notices.Allow(r.Target) {
+		r.Reply(w, TextNotConfigured, r.SenderName)
+	}
+
+	return false
+}
+
+// parseRequest returns the location, units and number of forecast days
+// for the given command parameters. The units and number of days may follow
+// the location, in any order. If they are not given, the profile's default
+// units and ForecastDays are used. The number of days is clamped to
+// MaxForecastDays. The caller must hold the lock.
+func (p *plugin) parseRequest(fields []string) (*location, units, int) {
+	u := p.units
+	days := ForecastDays
+
+	for n := len(fields); n > 1; n = len(fields) {
+		if v, ok := parseUnits(fields[n-1]); ok {
+			u = v
+		} else if cmd.RegUint.MatchString(fields[n-1]) {
+			days, _ = strconv.Atoi(strings.TrimPrefix(fields[n-1], "+"))
+		} else {
+			break
+		}
+
+		fields = fields[:n-1]
+	}
+
+	if days < 1 {
+		days = 1
+	} else if days > MaxForecastDays {
+		days = MaxForecastDays
 	}
+
+	return newLocation(fields), u, days
+}
+
+// geocodeEntry holds a resolved location in the geocode cache.
+type geocodeEntry struct {
+	Timestamp time.Time
+	Location  location
+}
+
+// resolve finds the coordinates of the given location. If the location
+// can not be found, or if its name is ambiguous, the user is informed
+// and this returns false.
+func (p *plugin) resolve(w irc.ResponseWriter, r *irc.Request, loc *location) (*location, bool) {
+	locs, ok := p.geocode(loc)
+	if !ok {
+		r.Reply(w, TextNoWeather, r.SenderName)
+		return nil, false
+	}
+
+	switch len(locs) {
+	case 0:
+		r.Reply(w, TextNoResult, r.SenderName)
+		return nil, false
+	case 1:
+		return &locs[0], true
+	}
+
+	sendLocations(w, r, locs)
+	return nil, false
+}
+
+// geocode returns the locations which match the given one. Unambiguous
+// results are cached, so asking for the same place again does not require
+// another lookup. Concurrent lookups for the same place are shared. The
+// returned slice must not be modified.
+func (p *plugin) geocode(loc *location) ([]location, bool) {
+	key := loc.key()
+
+	cached := func() ([]location, bool) {
+		p.m.Lock()
+		defer p.m.Unlock()
+
+		e, ok := p.geocodeCache[key]
+		if !ok || time.Since(e.Timestamp) > GeocodeCacheTimeout {
+			return nil, false
+		}
+		return []location{e.Location}, true
+	}
+
+	if locs, ok := cached(); ok {
+		return locs, true
+	}
+
+	v, ok := p.flight.Do("geocode/"+key, func() (interface{}, bool) {
+		if locs, ok := cached(); ok {
+			return locs, true
+		}
+
+		var locs []location
+		if !p.fetch(GeocodeURL, &locs, loc.Query(), p.apiKey()) {
+			return nil, false
+		}
+
+		locs = uniqueLocations(locs)
+
+		if len(locs) == 1 {
+			p.m.Lock()
+			p.geocodeCache[key] = &geocodeEntry{
+				Timestamp: time.Now(),
+				Location:  locs[0],
+			}
+			p.m.Unlock()
+		}
+
+		return locs, true
+	})
+
+	if !ok {
+		return nil, false
+	}
+
+	return v.([]location), true
+}
+
+// apiKey returns the configured API key.
+func (p *plugin) apiKey() string {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.config.OpenWeatherMapApiKey
 }
 
 // sendLocations sends location suggestions to the request's sender.
@@ -80,7 +253,7 @@ func sendLocations(w irc.ResponseWriter, r *irc.Request, locs []location) {
 
 	// Add location descriptors to the set, provided they are unique.
 	for _, l := range locs {
-		value := fmt.Sprintf("%s %s %s", l.City, l.Country, l.State)
+		value := strings.TrimSpace(fmt.Sprintf("%s %s %s", l.City, l.Country, l.State))
 		if !hasString(set, value) {
 			set = append(set, value)
 		}
@@ -88,7 +261,7 @@ func sendLocations(w irc.ResponseWriter, r *irc.Request, locs []location) {
 
 	sort.Strings(set)
 
-	proto.PrivMsg(w, r.Target, TextLocationsText,
+	r.Reply(w, TextLocationsText,
 		r.SenderName, strings.Join(set, ", "))
 }
 
@@ -102,19 +275,36 @@ func hasString(p []string, v string) bool {
 	return false
 }
 
-// fetch fetches the given URL contents and unmarshals them into the
-// specified struct. This returns false if the fetch failed.
-func (p *plugin) fetch(serviceURL, query string, v interface{}) bool {
-	// Fetch new response.
-	url := fmt.Sprintf(
-		serviceURL,
-		p.config.WundergroundApiKey,
-		TextLanguageISO,
-		query,
-	)
+// round rounds v to the nearest integer.
+func round(v float64) int {
+	return int(math.Floor(v + 0.5))
+}
 
-	resp, err := http.Get(url)
+// windDirection returns the compass direction for the given angle
+// in degrees.
+func windDirection(deg float64) string {
+	n := len(TextWindDirections)
+	idx := int(math.Floor(deg/(360/float64(n))+0.5)) % n
+	if idx < 0 {
+		idx += n
+	}
+	return TextWindDirections[idx]
+}
+
+// client is used for all service requests.
+var client = &http.Client{Timeout: LookupTimeout}
+
+// fetch fetches the contents of the given URL and unmarshals them into
+// the specified value. The URL is formatted with the given arguments.
+// This returns false if the fetch failed.
+func (p *plugin) fetch(serviceURL string, v interface{}, argv ...interface{}) bool {
+	resp, err := client.Get(fmt.Sprintf(serviceURL, argv...))
 	if err != nil {
+		// The error includes the request URL, which holds our API key.
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+
 		log.Println("[weather] fetch: http.Get:", err)
 		return false
 	}
@@ -126,7 +316,10 @@ func (p *plugin) fetch(serviceURL, query string, v interface{}) bool {
 		return false
 	}
 
-	//log.Println(string(data))
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("[weather] fetch: %s: %s", resp.Status, data)
+		return false
+	}
 
 	err = json.Unmarshal(data, v)
 	if err != nil {
@@ -9,8 +9,29 @@ const (
 	TextForecastName          = "weerfc"
 	TextLocation              = "lokatie"
 	TextNoWeather             = "%s, het weerbericht is momenteel niet beschikbaar."
-	TextNoResult              = "%s, de weerserver (http://wunderground.com) heeft momenteel geen data beschikbaar voor deze lokatie."
-	TextLocationsText         = "%s: de weerserver (http://wunderground.com) heeft meerdere lokaties met deze naam: %s"
-	TextCurrentWeatherDisplay = "%s, in %s is het %d°C, %s, luchtdruk: %s hPa, luchtvochtigheid: %s, wind: %.1f km/u uit richting: %s."
+	TextNotConfigured         = "%s, het weerbericht is niet ingesteld: er is geen API-sleutel opgegeven."
+	TextNoResult              = "%s, de weerserver (https://openweathermap.org) heeft momenteel geen data beschikbaar voor deze lokatie."
+	TextLocationsText         = "%s: de weerserver (https://openweathermap.org) heeft meerdere lokaties met deze naam: %s"
+	TextCurrentWeatherDisplay = "%s, in %s is het %d%s, %s, luchtdruk: %d hPa, luchtvochtigheid: %d%%, wind: %.1f %s uit richting: %s."
+	TextFeelsLikeDisplay      = " Gevoelstemperatuur: %d%s."
+	TextSunDisplay            = " Zon op: %s, zon onder: %s."
+	TextTimeFormat            = "15:04"
 	TextForecastDisplay       = "Weersvoorspelling voor %s:"
+	TextForecastDayDisplay    = "%s, %d tot %d%s, wind: %.1f %s."
+	TextCelsius               = "°C"
+	TextFahrenheit            = "°F"
+	TextKilometersPerHour     = "km/u"
+	TextMilesPerHour          = "mph"
 )
+
+var TextMetricNames = []string{"metric", "metrisch"}
+var TextImperialNames = []string{"imperial", "imperiaal"}
+
+var TextWeekdays = [...]string{
+	"Zondag", "Maandag", "Dinsdag", "Woensdag", "Donderdag", "Vrijdag", "Zaterdag",
+}
+
+var TextWindDirections = [...]string{
+	"N", "NNO", "NO", "ONO", "O", "OZO", "ZO", "ZZO",
+	"Z", "ZZW", "ZW", "WZW", "W", "WNW", "NW", "NNW",
+}
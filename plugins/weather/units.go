@@ -0,0 +1,69 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package weather
+
+import "strings"
+
+// units defines the unit system used to display weather data.
+// The weather service is always queried for metric units. They
+// are converted when displayed, so cached data can serve both.
+type units int
+
+// Known unit systems.
+const (
+	metric units = iota
+	imperial
+)
+
+// parseUnits returns the unit system with the given name.
+// Returns false if the name is not known.
+func parseUnits(v string) (units, bool) {
+	v = strings.ToLower(v)
+
+	for _, name := range TextMetricNames {
+		if v == name {
+			return metric, true
+		}
+	}
+
+	for _, name := range TextImperialNames {
+		if v == name {
+			return imperial, true
+		}
+	}
+
+	return metric, false
+}
+
+// Temp converts the given temperature in degrees Celsius and rounds it.
+func (u units) Temp(c float64) int {
+	if u == imperial {
+		c = c*9/5 + 32
+	}
+	return round(c)
+}
+
+// Speed converts the given speed in meters per second.
+func (u units) Speed(ms float64) float64 {
+	if u == imperial {
+		return ms * 3600 / 1609.344
+	}
+	return ms * 3.6
+}
+
+// TempLabel returns the label for temperatures.
+func (u units) TempLabel() string {
+	if u == imperial {
+		return TextFahrenheit
+	}
+	return TextCelsius
+}
+
+// SpeedLabel returns the label for speeds.
+func (u units) SpeedLabel() string {
+	if u == imperial {
+		return TextMilesPerHour
+	}
+	return TextKilometersPerHour
+}
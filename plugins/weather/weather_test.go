@@ -0,0 +1,406 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package weather
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/app/util"
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/irc/cmd"
+	"github.com/monkeybird/autimaat/irc/cmd/cmdtest"
+)
+
+type mockWriter struct {
+	bytes.Buffer
+}
+
+func (mw *mockWriter) Close() error { return nil }
+
+// eindhoven is the location used in the fixtures.
+var eindhoven = location{
+	City:    "Eindhoven",
+	Country: "NL",
+	Lat:     51.4416,
+	Lon:     5.4697,
+}
+
+func TestCurrentWeather(t *testing.T) {
+	var resp currentWeatherResponse
+	readFixture(t, "current.json", &resp)
+	resp.Location = eindhoven
+
+	testOutput(t, func(w *mockWriter, r *irc.Request) {
+		sendCurrentWeather(w, r, &resp, metric)
+	}, "PRIVMSG #test :steve, in \x02Eindhoven (NL)\x02 is het 8°C, zwaar bewolkt, "+
+		"luchtdruk: 1014 hPa, luchtvochtigheid: 87%, wind: 14.8 km/u uit richting: ZW. "+
+		"Gevoelstemperatuur: 5°C. Zon op: 08:46, zon onder: 16:41.\r\n")
+
+	testOutput(t, func(w *mockWriter, r *irc.Request) {
+		sendCurrentWeather(w, r, &resp, imperial)
+	}, "PRIVMSG #test :steve, in \x02Eindhoven (NL)\x02 is het 46°F, zwaar bewolkt, "+
+		"luchtdruk: 1014 hPa, luchtvochtigheid: 87%, wind: 9.2 mph uit richting: ZW. "+
+		"Gevoelstemperatuur: 41°F. Zon op: 08:46, zon onder: 16:41.\r\n")
+
+	// Without feels like and sun times.
+	var bare currentWeatherResponse
+	readFixture(t, "current_nosun.json", &bare)
+	bare.Location = eindhoven
+
+	testOutput(t, func(w *mockWriter, r *irc.Request) {
+		sendCurrentWeather(w, r, &bare, metric)
+	}, "PRIVMSG #test :steve, in \x02Eindhoven (NL)\x02 is het 8°C, zwaar bewolkt, "+
+		"luchtdruk: 1014 hPa, luchtvochtigheid: 87%, wind: 14.8 km/u uit richting: ZW.\r\n")
+
+	// No weather data.
+	resp.Weather = nil
+	testOutput(t, func(w *mockWriter, r *irc.Request) {
+		sendCurrentWeather(w, r, &resp, metric)
+	}, "PRIVMSG #test :steve, de weerserver (https://openweathermap.org) heeft momenteel "+
+		"geen data beschikbaar voor deze lokatie.\r\n")
+}
+
+func TestForecast(t *testing.T) {
+	var resp forecastResponse
+	readFixture(t, "forecast.json", &resp)
+	resp.Location = eindhoven
+
+	testOutput(t, func(w *mockWriter, r *irc.Request) {
+		sendForecast(w, r, &resp, metric, ForecastDays)
+	}, "PRIVMSG steve :Weersvoorspelling voor \x02Eindhoven (NL)\x02:\r\n"+
+		"PRIVMSG steve :\x02Maandag\x02: lichte regen, 5 tot 11°C, wind: 14.4 km/u.\r\n"+
+		"PRIVMSG steve :\x02Dinsdag\x02: bewolkt, 5 tot 11°C, wind: 14.4 km/u.\r\n"+
+		"PRIVMSG steve :\x02Woensdag\x02: onbewolkt, 5 tot 11°C, wind: 14.4 km/u.\r\n")
+
+	testOutput(t, func(w *mockWriter, r *irc.Request) {
+		sendForecast(w, r, &resp, imperial, ForecastDays)
+	}, "PRIVMSG steve :Weersvoorspelling voor \x02Eindhoven (NL)\x02:\r\n"+
+		"PRIVMSG steve :\x02Maandag\x02: lichte regen, 41 tot 52°F, wind: 8.9 mph.\r\n"+
+		"PRIVMSG steve :\x02Dinsdag\x02: bewolkt, 41 tot 52°F, wind: 8.9 mph.\r\n"+
+		"PRIVMSG steve :\x02Woensdag\x02: onbewolkt, 41 tot 52°F, wind: 8.9 mph.\r\n")
+}
+
+func TestForecastDays(t *testing.T) {
+	var resp forecastResponse
+	readFixture(t, "forecast.json", &resp)
+	resp.Location = eindhoven
+
+	// The fixture covers 4 days, so asking for more yields 4.
+	for n, want := range map[int]int{1: 1, 2: 2, 3: 3, 4: 4, 5: 4} {
+		var w mockWriter
+		sendForecast(&w, &irc.Request{SenderName: "steve", Target: "#test"}, &resp, metric, n)
+
+		// One line for the header, one for each day.
+		if have := strings.Count(w.String(), "\r\n") - 1; have != want {
+			t.Fatalf("forecast day count mismatch for %d;\nwant: %d\nhave: %d", n, want, have)
+		}
+	}
+}
+
+func TestUnits(t *testing.T) {
+	for _, tt := range []struct {
+		u     units
+		c, ms float64
+		temp  int
+		speed string
+		label string
+	}{
+		{metric, 0, 10, 0, "36.0", "°C km/u"},
+		{metric, -12.6, 1, -13, "3.6", "°C km/u"},
+		{imperial, 0, 10, 32, "22.4", "°F mph"},
+		{imperial, 100, 1, 212, "2.2", "°F mph"},
+		{imperial, -40, 0, -40, "0.0", "°F mph"},
+	} {
+		temp := tt.u.Temp(tt.c)
+		speed := fmt.Sprintf("%.1f", tt.u.Speed(tt.ms))
+		label := tt.u.TempLabel() + " " + tt.u.SpeedLabel()
+
+		if temp != tt.temp || speed != tt.speed || label != tt.label {
+			t.Fatalf("conversion mismatch for %v;\nwant: %d %s %s\nhave: %d %s %s",
+				tt.u, tt.temp, tt.speed, tt.label, temp, speed, label)
+		}
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	p := plugin{units: metric}
+
+	var fields []string
+	set := cmd.New([]string{"!"}, nil)
+	set.Bind("weer", false, func(_ irc.ResponseWriter, _ *irc.Request, params cmd.ParamList) {
+		fields = params.Words(0)
+	}).Alias("weerfc").Add(TextLocation, true, cmd.RegAny)
+
+	for _, tt := range []struct {
+		data string
+		loc  string
+		u    units
+		days int
+	}{
+		{"!weer Londen", "londen", metric, 3},
+		{"!weer Londen imperial", "londen", imperial, 3},
+		{"!weer Londen GB IMPERIAAL", "gb/londen", imperial, 3},
+		{"!weer Londen GB England metrisch", "gb/england/londen", metric, 3},
+		{"!weer Londen England GB", "gb/england/londen", metric, 3},
+		{"!weer  Londen,  GB ", "gb/londen", metric, 3},
+		{"!weer Londen,GB", "gb/londen", metric, 3},
+		{"!weer imperial", "imperial", metric, 3},
+		{"!weerfc Eindhoven 5", "eindhoven", metric, 5},
+		{"!weerfc Eindhoven NL 1 imperial", "nl/eindhoven", imperial, 1},
+		{"!weerfc Eindhoven imperial 2", "eindhoven", imperial, 2},
+		{"!weerfc Eindhoven 14", "eindhoven", metric, MaxForecastDays},
+		{"!weerfc Eindhoven 0", "eindhoven", metric, 1},
+		{`!weer "Den Haag" NL`, "nl/den haag", metric, 3},
+		{`!weerfc "New York" US "New York" 2`, "us/new york/new york", metric, 2},
+	} {
+		cmdtest.Run(t, set, cmdtest.NewRequest(cmdtest.Mask, "#test", tt.data))
+
+		loc, u, days := p.parseRequest(fields)
+		if have := strings.ToLower(loc.String()); have != tt.loc || u != tt.u || days != tt.days {
+			t.Fatalf("request mismatch for %q;\nwant: %q %v %d\nhave: %q %v %d",
+				tt.data, tt.loc, tt.u, tt.days, have, u, days)
+		}
+	}
+}
+
+func TestLocationCache(t *testing.T) {
+	var geocodes, forecasts int
+
+	setService(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/geo/1.0/direct":
+			geocodes++
+			json.NewEncoder(w).Encode([]location{eindhoven})
+		case "/data/2.5/forecast":
+			forecasts++
+			http.ServeFile(w, r, filepath.Join("testdata", "forecast.json"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	p := newTestPlugin(t, "sleutel")
+
+	for _, tt := range []struct {
+		data                string
+		geocodes, forecasts int
+	}{
+		{"!weerfc Eindhoven", 1, 1},
+		{"!weerfc eindhoven ", 1, 1},
+		{"!weerfc  EINDHOVEN 2", 1, 1},
+		{"!weerfc Eindhoven NL", 2, 1},
+		{"!weerfc eindhoven, nl", 2, 1},
+	} {
+		have := cmdtest.Run(t, p.cmd, cmdtest.NewRequest(cmdtest.Mask, "#test", tt.data))
+		if !strings.Contains(have, "Eindhoven (NL)") {
+			t.Fatalf("output mismatch for %q:\n%s", tt.data, have)
+		}
+
+		if geocodes != tt.geocodes || forecasts != tt.forecasts {
+			t.Fatalf("lookup count mismatch for %q;\nwant: %d %d\nhave: %d %d",
+				tt.data, tt.geocodes, tt.forecasts, geocodes, forecasts)
+		}
+	}
+
+	if len(p.geocodeCache) != 2 || len(p.forecastCache) != 1 {
+		t.Fatalf("cache size mismatch;\nwant: 2 1\nhave: %d %d",
+			len(p.geocodeCache), len(p.forecastCache))
+	}
+}
+
+func TestConcurrentLookups(t *testing.T) {
+	var m sync.Mutex
+	calls := make(map[string]int)
+	release := make(chan struct{})
+
+	setService(t, func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		calls[r.URL.Path]++
+		m.Unlock()
+
+		// Hold on to the request until all lookups have started.
+		<-release
+
+		switch r.URL.Path {
+		case "/geo/1.0/direct":
+			json.NewEncoder(w).Encode([]location{eindhoven})
+		case "/data/2.5/weather":
+			http.ServeFile(w, r, filepath.Join("testdata", "current.json"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	p := newTestPlugin(t, "sleutel")
+	out := make([]cmdtest.Writer, 10)
+
+	// Each call runs its handler in a separate goroutine.
+	for i := range out {
+		p.cmd.Dispatch(&out[i], cmdtest.NewRequest(cmdtest.Mask, "#test", "!weer Eindhoven"))
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	p.cmd.Wait(cmdtest.Timeout)
+
+	for i := range out {
+		if have := out[i].String(); !strings.Contains(have, "Eindhoven (NL)") {
+			t.Fatalf("output mismatch:\n%s", have)
+		}
+	}
+
+	want := map[string]int{"/geo/1.0/direct": 1, "/data/2.5/weather": 1}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("lookup count mismatch;\nwant: %v\nhave: %v", want, calls)
+	}
+}
+
+// newTestPlugin returns a loaded plugin, which uses the given API key.
+func newTestPlugin(t *testing.T, key string) *plugin {
+	prof := irc.NewProfile(t.TempDir())
+	prof.SetPluginConfig("weather", map[string]string{"OpenWeatherMapApiKey": key})
+
+	var p plugin
+	if err := p.Load(prof); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { p.Unload(prof) })
+	return &p
+}
+
+// setService sends all service requests to a test server with the given
+// handler, for the duration of the test.
+func setService(t *testing.T, handler http.HandlerFunc) {
+	srv := httptest.NewServer(handler)
+
+	c := client
+	client = &http.Client{Transport: roundTripper(func(r *http.Request) (*http.Response, error) {
+		r.URL.Scheme = "http"
+		r.URL.Host = srv.Listener.Addr().String()
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	t.Cleanup(func() {
+		client = c
+		srv.Close()
+	})
+}
+
+// roundTripper turns a function into a http.RoundTripper.
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestFetchError(t *testing.T) {
+	c := client
+	client = &http.Client{Transport: roundTripper(func(r *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})}
+	defer func() { client = c }()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	var v interface{}
+	if (&plugin{}).fetch("https://api.example.com/data?appid=%s", &v, "hunter2") {
+		t.Fatalf("expected fetch to fail")
+	}
+
+	// The API key must not end up in the log.
+	if have := buf.String(); strings.Contains(have, "hunter2") || !strings.Contains(have, "connection refused") {
+		t.Fatalf("unexpected log output: %q", have)
+	}
+}
+
+func TestLocations(t *testing.T) {
+	var locs []location
+	readFixture(t, "geocode.json", &locs)
+
+	locs = uniqueLocations(locs)
+	if len(locs) != 3 {
+		t.Fatalf("location count mismatch;\nwant: 3\nhave: %d", len(locs))
+	}
+
+	if have := locs[0].Display(); have != "Londen (England, GB)" {
+		t.Fatalf("location mismatch;\nwant: %q\nhave: %q", "Londen (England, GB)", have)
+	}
+
+	testOutput(t, func(w *mockWriter, r *irc.Request) {
+		sendLocations(w, r, locs)
+	}, "PRIVMSG #test :steve: de weerserver (https://openweathermap.org) heeft meerdere "+
+		"lokaties met deze naam: London CA Ontario, London GB England, London US Ohio\r\n")
+}
+
+func TestNotConfigured(t *testing.T) {
+	p := &plugin{notices: util.NewThrottle(NoticeInterval)}
+	want := "PRIVMSG #test :steve, het weerbericht is niet ingesteld: " +
+		"er is geen API-sleutel opgegeven.\r\n"
+
+	testOutput(t, func(w *mockWriter, r *irc.Request) {
+		p.cmdCurrentWeather(w, r, nil)
+	}, want)
+
+	testOutput(t, func(w *mockWriter, r *irc.Request) {
+		p.cmdCurrentWeather(w, r, nil)
+	}, "")
+
+	testOutput(t, func(w *mockWriter, r *irc.Request) {
+		p.cmdForecast(w, r, nil)
+	}, "")
+}
+
+func TestWindDirection(t *testing.T) {
+	for deg, want := range map[float64]string{
+		0: "N", 11: "N", 12: "NNO", 90: "O", 180: "Z", 230: "ZW", 350: "N", 360: "N",
+	} {
+		if have := windDirection(deg); have != want {
+			t.Fatalf("direction mismatch for %v;\nwant: %q\nhave: %q", deg, want, have)
+		}
+	}
+}
+
+// readFixture unmarshals the given file from the testdata directory into v.
+func readFixture(t *testing.T, name string, v interface{}) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testOutput runs f for a request from steve in #test and ensures it
+// yields the expected output.
+func testOutput(t *testing.T, f func(*mockWriter, *irc.Request), want string) {
+	var w mockWriter
+
+	f(&w, &irc.Request{
+		SenderName: "steve",
+		SenderMask: "~steve@example.com",
+		Type:       "PRIVMSG",
+		Target:     "#test",
+	})
+
+	if have := w.String(); have != want {
+		t.Fatalf("output mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+}
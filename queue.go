@@ -0,0 +1,224 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/monkeybird/autimaat/app/metrics"
+)
+
+// errDiscarded is reported for queued messages which are dropped before
+// they could be sent.
+var errDiscarded = errors.New("message discarded")
+
+// clock provides the current time and a way to wait for it to pass.
+// It allows tests to control the passing of time.
+type clock interface {
+	Now() time.Time
+	Sleep(time.Duration)
+}
+
+// realClock implements clock using the system time.
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// SendQueue is a rate limited writer. It keeps the bot from flooding the
+// server with outgoing messages, which gets it disconnected for
+// "excess flood".
+//
+// Each call to Write is expected to hold a single protocol message. It is
+// queued and returns immediately, so callers are never blocked. A separate
+// goroutine sends queued messages in order. Rate limiting is done with
+// a token bucket: up to burst messages are sent immediately, after which
+// one message is sent per interval.
+type SendQueue struct {
+	m        sync.Mutex
+	cond     *sync.Cond
+	w        io.WriteCloser
+	clock    clock
+	burst    int
+	interval time.Duration
+	tokens   float64
+	last     time.Time
+	lines    []queuedLine
+	closed   bool
+}
+
+// queuedLine is a message waiting to be sent.
+type queuedLine struct {
+	data []byte
+	sent func(error) // Called once the message has been handled. May be nil.
+}
+
+// NewSendQueue creates a new queue which writes to w. It allows a burst of
+// messages before limiting output to one message per interval.
+func NewSendQueue(w io.WriteCloser, burst int, interval time.Duration) *SendQueue {
+	return newSendQueue(w, burst, interval, realClock{})
+}
+
+// newSendQueue creates a new queue using the given clock.
+func newSendQueue(w io.WriteCloser, burst int, interval time.Duration, c clock) *SendQueue {
+	if burst < 1 {
+		burst = 1
+	}
+
+	q := &SendQueue{
+		w:        w,
+		clock:    c,
+		burst:    burst,
+		interval: interval,
+		tokens:   float64(burst),
+		last:     c.Now(),
+	}
+
+	q.cond = sync.NewCond(&q.m)
+	go q.run()
+	return q
+}
+
+// Write queues a copy of the given message for sending.
+func (q *SendQueue) Write(p []byte) (int, error) {
+	return q.WriteNotify(p, nil)
+}
+
+// WriteNotify works like Write, but calls sent once the message has
+// been handled. The error is nil if the message was written to the
+// underlying writer. Otherwise it tells why it was not. sent is not called
+// if WriteNotify itself returns an error.
+func (q *SendQueue) WriteNotify(p []byte, sent func(error)) (int, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	if q.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	q.lines = append(q.lines, queuedLine{
+		data: append([]byte(nil), p...),
+		sent: sent,
+	})
+
+	q.cond.Signal()
+	return len(p), nil
+}
+
+// Close discards any pending messages, stops the queue and closes the
+// underlying writer.
+func (q *SendQueue) Close() error {
+	q.m.Lock()
+	lines := q.lines
+	q.closed = true
+	q.lines = nil
+	q.cond.Signal()
+	q.m.Unlock()
+
+	discard(lines)
+	return q.w.Close()
+}
+
+// Reset discards any pending messages and refills the token bucket.
+// This is used when a new connection is established, as messages meant
+// for the old one are no longer relevant.
+func (q *SendQueue) Reset() {
+	q.m.Lock()
+	lines := q.lines
+	q.lines = nil
+	q.tokens = float64(q.burst)
+	q.last = q.clock.Now()
+	q.m.Unlock()
+
+	discard(lines)
+}
+
+// discard notifies the senders of the given messages that they were
+// dropped.
+func discard(lines []queuedLine) {
+	for _, line := range lines {
+		if line.sent != nil {
+			line.sent(errDiscarded)
+		}
+	}
+}
+
+// run sends queued messages until the queue is closed.
+func (q *SendQueue) run() {
+	for {
+		q.m.Lock()
+		for len(q.lines) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+
+		if q.closed {
+			q.m.Unlock()
+			return
+		}
+
+		// Wait for a token to become available. The lock is released
+		// while waiting, so the queue may have been reset or closed
+		// in the mean time.
+		q.wait()
+		if q.closed || len(q.lines) == 0 {
+			q.m.Unlock()
+			continue
+		}
+
+		q.tokens--
+		line := q.lines[0]
+		q.lines[0] = queuedLine{}
+		q.lines = q.lines[1:]
+		q.m.Unlock()
+
+		_, err := q.w.Write(line.data)
+		if err != nil {
+			log.Println("[bot] Send failed:", err)
+		} else {
+			metrics.MessageOut()
+		}
+
+		if line.sent != nil {
+			line.sent(err)
+		}
+	}
+}
+
+// wait blocks until the token bucket holds at least one token. This is
+// called with the lock held. The lock is released while sleeping, so new
+// messages can be queued in the mean time.
+func (q *SendQueue) wait() {
+	q.refill()
+
+	for q.tokens < 1 {
+		d := time.Duration((1 - q.tokens) * float64(q.interval))
+
+		q.m.Unlock()
+		q.clock.Sleep(d)
+		q.m.Lock()
+
+		q.refill()
+	}
+}
+
+// refill adds the tokens which have become available since the last call.
+func (q *SendQueue) refill() {
+	now := q.clock.Now()
+
+	if q.interval > 0 {
+		q.tokens += float64(now.Sub(q.last)) / float64(q.interval)
+	} else {
+		q.tokens = float64(q.burst)
+	}
+
+	if q.tokens > float64(q.burst) {
+		q.tokens = float64(q.burst)
+	}
+
+	q.last = now
+}
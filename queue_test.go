@@ -0,0 +1,146 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock which only advances when Sleep is called.
+type fakeClock struct {
+	m   sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.m.Lock()
+	c.now = c.now.Add(d)
+	c.m.Unlock()
+}
+
+// sentLine records a message and the time at which it was written.
+type sentLine struct {
+	data string
+	at   time.Time
+}
+
+// recorder records all messages written to it.
+type recorder struct {
+	clock *fakeClock
+	lines chan sentLine
+	block chan struct{}
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	if r.block != nil {
+		<-r.block
+	}
+
+	r.lines <- sentLine{string(p), r.clock.Now()}
+	return len(p), nil
+}
+
+func (r *recorder) Close() error { return nil }
+
+func TestSendQueue(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rec := &recorder{clock: clock, lines: make(chan sentLine, 16)}
+	q := newSendQueue(rec, 3, time.Second*2, clock)
+	defer q.Close()
+
+	start := clock.Now()
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(q, "PRIVMSG #test :%d\r\n", i)
+	}
+
+	want := []time.Duration{0, 0, 0, time.Second * 2, time.Second * 4, time.Second * 6}
+
+	for i, offset := range want {
+		line := testSent(t, rec)
+
+		data := fmt.Sprintf("PRIVMSG #test :%d\r\n", i)
+		if line.data != data {
+			t.Fatalf("message %d mismatch;\nwant: %q\nhave: %q", i, data, line.data)
+		}
+
+		if have := line.at.Sub(start); have != offset {
+			t.Fatalf("message %d timing mismatch;\nwant: %s\nhave: %s", i, offset, have)
+		}
+	}
+
+	// After some idle time, the bucket is refilled. But never beyond
+	// the burst size.
+	clock.Sleep(time.Minute)
+	start = clock.Now()
+
+	for i := 0; i < 4; i++ {
+		fmt.Fprintf(q, "PRIVMSG #test :%d\r\n", i)
+	}
+
+	want = []time.Duration{0, 0, 0, time.Second * 2}
+
+	for i, offset := range want {
+		line := testSent(t, rec)
+		if have := line.at.Sub(start); have != offset {
+			t.Fatalf("message %d timing mismatch;\nwant: %s\nhave: %s", i, offset, have)
+		}
+	}
+}
+
+func TestSendQueueNonBlocking(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	rec := &recorder{
+		clock: clock,
+		lines: make(chan sentLine, 128),
+		block: make(chan struct{}),
+	}
+
+	q := newSendQueue(rec, 1, time.Second, clock)
+	defer q.Close()
+
+	// The underlying writer blocks, yet queueing messages should not.
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(q, "PRIVMSG #test :%d\r\n", i)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Write blocked on a busy connection")
+	}
+
+	close(rec.block)
+
+	for i := 0; i < 100; i++ {
+		data := fmt.Sprintf("PRIVMSG #test :%d\r\n", i)
+		if line := testSent(t, rec); line.data != data {
+			t.Fatalf("message %d mismatch;\nwant: %q\nhave: %q", i, data, line.data)
+		}
+	}
+}
+
+// testSent waits for the next message written to the recorder.
+func testSent(t *testing.T, rec *recorder) sentLine {
+	select {
+	case line := <-rec.lines:
+		return line
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for message")
+	}
+
+	return sentLine{}
+}
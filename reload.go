@@ -0,0 +1,67 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/monkeybird/autimaat/irc"
+	"github.com/monkeybird/autimaat/plugins"
+)
+
+// restartSettings lists the profile settings which are only used when the
+// bot starts or connects. Changing them while the bot is running has no
+// immediate effect.
+var restartSettings = []struct {
+	name  string
+	value func(irc.Profile) interface{}
+}{
+	{"Address", func(p irc.Profile) interface{} { return p.Address() }},
+	{"UseTLS", func(p irc.Profile) interface{} { return p.UseTLS() }},
+	{"TLSKey", func(p irc.Profile) interface{} { return p.TLSKey() }},
+	{"TLSCert", func(p irc.Profile) interface{} { return p.TLSCert() }},
+	{"CAPemData", func(p irc.Profile) interface{} { return p.CAPemData() }},
+	{"TLSSkipVerify", func(p irc.Profile) interface{} { return p.TLSSkipVerify() }},
+	{"Username", func(p irc.Profile) interface{} { return p.Username() }},
+	{"Realname", func(p irc.Profile) interface{} { return p.Realname() }},
+	{"UserModes", func(p irc.Profile) interface{} { return p.UserModes() }},
+	{"NoticeCommands", func(p irc.Profile) interface{} { return p.NoticeCommands() }},
+	{"AuditAllCommands", func(p irc.Profile) interface{} { return p.AuditAllCommands() }},
+	{"FloodBurst", func(p irc.Profile) interface{} { return p.FloodBurst() }},
+	{"FloodInterval", func(p irc.Profile) interface{} { return p.FloodInterval() }},
+	{"PingInterval", func(p irc.Profile) interface{} { return p.PingInterval() }},
+	{"PingTimeout", func(p irc.Profile) interface{} { return p.PingTimeout() }},
+	{"LogRetention", func(p irc.Profile) interface{} { return p.LogRetention() }},
+	{"LogPurgeInterval", func(p irc.Profile) interface{} { return p.LogPurgeInterval() }},
+	{"LogRefreshInterval", func(p irc.Profile) interface{} { return p.LogRefreshInterval() }},
+	{"LogMaxSize", func(p irc.Profile) interface{} { return p.LogMaxSize() }},
+	{"MetricsAddr", func(p irc.Profile) interface{} { return p.MetricsAddr() }},
+}
+
+// reload re-reads the profile from disk and has plugins reload their
+// configuration. This is triggered by SIGHUP. Settings like the whitelist,
+// logging flag and command prefixes take effect immediately. Changes to settings which
+// need a restart are logged as such.
+func reload(p irc.Profile) error {
+	before := make([]string, len(restartSettings))
+	for i, s := range restartSettings {
+		before[i] = fmt.Sprint(s.value(p))
+	}
+
+	err := p.Load()
+	if err != nil {
+		return err
+	}
+
+	for i, s := range restartSettings {
+		if fmt.Sprint(s.value(p)) != before[i] {
+			log.Printf("[bot] Profile setting %s changed: requires restart", s.name)
+		}
+	}
+
+	plugins.Reload(p)
+	log.Println("[bot] Profile reloaded")
+	return nil
+}
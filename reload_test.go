@@ -0,0 +1,111 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/monkeybird/autimaat/irc"
+)
+
+func TestReload(t *testing.T) {
+	root := t.TempDir()
+	prof := irc.NewProfile(root)
+
+	if err := prof.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep reading the profile while it is being reloaded.
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				prof.IsWhitelisted("~user@server.com")
+				prof.Channels()
+			}
+		}
+	}()
+
+	want := []string{"~admin@example.com", "~other@example.com"}
+	testEditProfile(t, root, func(data map[string]interface{}) {
+		data["Whitelist"] = want
+		data["Logging"] = true
+	})
+
+	err := reload(prof)
+	close(done)
+	wg.Wait()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have := prof.Whitelist(); !reflect.DeepEqual(want, have) {
+		t.Fatalf("whitelist mismatch;\nwant: %q\nhave: %q", want, have)
+	}
+
+	if prof.IsWhitelisted("~user@server.com") {
+		t.Fatalf("old whitelist entry still present")
+	}
+
+	if !prof.Logging() {
+		t.Fatalf("logging flag not reloaded")
+	}
+
+	// Settings removed from the file revert to their defaults.
+	testEditProfile(t, root, func(data map[string]interface{}) {
+		delete(data, "Logging")
+		delete(data, "Whitelist")
+	})
+
+	if err := reload(prof); err != nil {
+		t.Fatal(err)
+	}
+
+	if prof.Logging() {
+		t.Fatalf("logging flag not reset to its default")
+	}
+
+	if !prof.IsWhitelisted("~user@server.com") {
+		t.Fatalf("whitelist not reset to its default")
+	}
+}
+
+// testEditProfile modifies the profile file in the given directory.
+func testEditProfile(t *testing.T, root string, edit func(map[string]interface{})) {
+	file := filepath.Join(root, "profile.cfg")
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v map[string]interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	edit(v)
+
+	if data, err = json.Marshal(v); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -11,16 +11,31 @@ import (
 
 var (
 	bNameSplitter = []byte{'!'}
+	bTagSplitter  = []byte{';'}
 	bSpace        = []byte{' '}
 	bPING         = []byte("PING")
 	bERROR        = []byte("ERROR")
+	bAUTHENTICATE = []byte("AUTHENTICATE")
 	bQUIT         = []byte("QUIT")
+	bAWAY         = []byte("AWAY")
 )
 
 // parseRequest reads the given message payload and parses it into the
 // specified request structure. Returns false if the payload is not a valid
 // protocol message.
 func parseRequest(r *irc.Request, data []byte) bool {
+	// Strip IRCv3 message tags, if present.
+	r.Tags = nil
+	if len(data) > 0 && data[0] == '@' {
+		idx := bytes.IndexByte(data, ' ')
+		if idx == -1 {
+			return false
+		}
+
+		r.Tags = parseTags(data[1:idx])
+		data = bytes.TrimSpace(data[idx+1:])
+	}
+
 	fields := bytes.Fields(data)
 	if len(fields) == 0 {
 		return false
@@ -28,9 +43,6 @@ func parseRequest(r *irc.Request, data []byte) bool {
 
 	// We may be dealing with utility messages like ERROR or PING.
 	switch {
-	case bytes.Index(data, bQUIT) > -1:
-		return false
-
 	case bytes.HasPrefix(data, bPING):
 		r.Type = "PING"
 		r.Data = string(fields[1][1:])
@@ -40,14 +52,48 @@ func parseRequest(r *irc.Request, data []byte) bool {
 		return true
 
 	case bytes.HasPrefix(data, bERROR):
+		// The reason is a trailing parameter, spanning all fields.
 		r.Type = "ERROR"
-		r.Data = string(fields[1][1:])
+		r.Data = ""
+		if len(fields) > 1 {
+			fields[1] = bytes.TrimPrefix(fields[1], []byte{':'})
+			r.Data = string(bytes.Join(fields[1:], bSpace))
+		}
+		r.SenderMask = ""
+		r.SenderName = ""
+		r.Target = ""
+		return true
+
+	case bytes.HasPrefix(data, bAUTHENTICATE):
+		r.Type = "AUTHENTICATE"
+		r.Data = string(bytes.Join(fields[1:], bSpace))
 		r.SenderMask = ""
 		r.SenderName = ""
 		r.Target = ""
 		return true
 	}
 
+	// QUIT and AWAY have no target. Their only parameter is an optional
+	// message.
+	if len(fields) > 1 && (bytes.Equal(fields[1], bQUIT) || bytes.Equal(fields[1], bAWAY)) {
+		parseSender(r, bytes.TrimPrefix(fields[0], []byte{':'}))
+		r.Type = string(fields[1])
+		r.Target = ""
+
+		if len(fields) > 2 {
+			fields[2] = bytes.TrimPrefix(fields[2], []byte{':'})
+			r.Data = string(bytes.Join(fields[2:], bSpace))
+		} else {
+			r.Data = ""
+		}
+
+		return true
+	}
+
+	if len(fields) < 3 {
+		return false
+	}
+
 	// Strip leading ':' characters from all fields, except the actual
 	// message contents.
 	for i := 0; i < 4 && i < len(fields); i++ {
@@ -56,15 +102,7 @@ func parseRequest(r *irc.Request, data []byte) bool {
 		}
 	}
 
-	idx := bytes.Index(fields[0], bNameSplitter)
-	if idx > -1 {
-		r.SenderName = string(fields[0][:idx])
-		r.SenderMask = string(fields[0][idx+1:])
-	} else {
-		r.SenderName = string(fields[0])
-		r.SenderMask = r.SenderName
-	}
-
+	parseSender(r, fields[0])
 	r.Type = string(fields[1])
 	r.Target = string(fields[2])
 
@@ -76,3 +114,82 @@ func parseRequest(r *irc.Request, data []byte) bool {
 
 	return true
 }
+
+// parseSender sets the sender name and mask from the given message
+// prefix. For servers, both are set to the server name.
+func parseSender(r *irc.Request, prefix []byte) {
+	idx := bytes.Index(prefix, bNameSplitter)
+	if idx > -1 {
+		r.SenderName = string(prefix[:idx])
+		r.SenderMask = string(prefix[idx+1:])
+	} else {
+		r.SenderName = string(prefix)
+		r.SenderMask = r.SenderName
+	}
+}
+
+// parseTags parses a set of IRCv3 message tags. These have the form:
+//
+//	key1=value1;key2;key3=value3
+//
+// The leading '@' is expected to have been stripped already. Tags without
+// a value are assigned an empty string.
+//
+// ref: https://ircv3.net/specs/extensions/message-tags
+func parseTags(data []byte) map[string]string {
+	tags := make(map[string]string)
+
+	for _, tag := range bytes.Split(data, bTagSplitter) {
+		if len(tag) == 0 {
+			continue
+		}
+
+		key, value := tag, []byte(nil)
+		if idx := bytes.IndexByte(tag, '='); idx > -1 {
+			key, value = tag[:idx], tag[idx+1:]
+		}
+
+		if len(key) > 0 {
+			tags[string(key)] = unescapeTag(value)
+		}
+	}
+
+	return tags
+}
+
+// unescapeTag unescapes the given tag value.
+func unescapeTag(v []byte) string {
+	if bytes.IndexByte(v, '\\') == -1 {
+		return string(v)
+	}
+
+	out := make([]byte, 0, len(v))
+
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' {
+			out = append(out, v[i])
+			continue
+		}
+
+		// A trailing backslash is dropped.
+		i++
+		if i == len(v) {
+			break
+		}
+
+		switch v[i] {
+		case ':':
+			out = append(out, ';')
+		case 's':
+			out = append(out, ' ')
+		case 'r':
+			out = append(out, '\r')
+		case 'n':
+			out = append(out, '\n')
+		default:
+			out = append(out, v[i])
+		}
+	}
+
+	return string(out)
+}
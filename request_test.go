@@ -0,0 +1,125 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/monkeybird/autimaat/irc"
+)
+
+func TestParseRequest(t *testing.T) {
+	testParseRequest(t, ":steve!~steve@example.com PRIVMSG #test :hello world", irc.Request{
+		SenderName: "steve",
+		SenderMask: "~steve@example.com",
+		Type:       "PRIVMSG",
+		Target:     "#test",
+		Data:       "hello world",
+	})
+
+	testParseRequest(t, "@time=2017-01-01T12:00:00.000Z;account=steve :steve!~steve@example.com PRIVMSG #test :hello world", irc.Request{
+		SenderName: "steve",
+		SenderMask: "~steve@example.com",
+		Type:       "PRIVMSG",
+		Target:     "#test",
+		Data:       "hello world",
+		Tags: map[string]string{
+			"time":    "2017-01-01T12:00:00.000Z",
+			"account": "steve",
+		},
+	})
+
+	testParseRequest(t, `@msg=a\:b\sc\\d\xe\;f=;+draft/reply=42;g :irc.example.com 001 bot :Welcome`, irc.Request{
+		SenderName: "irc.example.com",
+		SenderMask: "irc.example.com",
+		Type:       "001",
+		Target:     "bot",
+		Data:       "Welcome",
+		Tags: map[string]string{
+			"msg":          `a;b c\dxe`,
+			"f":            "",
+			"+draft/reply": "42",
+			"g":            "",
+		},
+	})
+
+	testParseRequest(t, "@time=2017-01-01T12:00:00.000Z PING :irc.example.com", irc.Request{
+		Type: "PING",
+		Data: "irc.example.com",
+		Tags: map[string]string{
+			"time": "2017-01-01T12:00:00.000Z",
+		},
+	})
+}
+
+func TestParseQuitAway(t *testing.T) {
+	testParseRequest(t, ":steve!~steve@example.com QUIT :Quit: tot ziens", irc.Request{
+		SenderName: "steve",
+		SenderMask: "~steve@example.com",
+		Type:       "QUIT",
+		Data:       "Quit: tot ziens",
+	})
+
+	testParseRequest(t, ":steve!~steve@example.com QUIT", irc.Request{
+		SenderName: "steve",
+		SenderMask: "~steve@example.com",
+		Type:       "QUIT",
+	})
+
+	// With away-notify, AWAY is sent when others go away or come back.
+	testParseRequest(t, ":steve!~steve@example.com AWAY :even koffie halen", irc.Request{
+		SenderName: "steve",
+		SenderMask: "~steve@example.com",
+		Type:       "AWAY",
+		Data:       "even koffie halen",
+	})
+
+	testParseRequest(t, ":steve!~steve@example.com AWAY", irc.Request{
+		SenderName: "steve",
+		SenderMask: "~steve@example.com",
+		Type:       "AWAY",
+	})
+
+	// Mentioning QUIT in a message does not make it one.
+	testParseRequest(t, ":steve!~steve@example.com PRIVMSG #test :QUIT is een commando", irc.Request{
+		SenderName: "steve",
+		SenderMask: "~steve@example.com",
+		Type:       "PRIVMSG",
+		Target:     "#test",
+		Data:       "QUIT is een commando",
+	})
+}
+
+func TestParseShortRequest(t *testing.T) {
+	testParseRequest(t, "AUTHENTICATE +", irc.Request{
+		Type: "AUTHENTICATE",
+		Data: "+",
+	})
+
+	testParseRequest(t, "ERROR :Closing Link: bot[example.com] (Ping timeout: 240 seconds)", irc.Request{
+		Type: "ERROR",
+		Data: "Closing Link: bot[example.com] (Ping timeout: 240 seconds)",
+	})
+
+	testParseRequest(t, "ERROR", irc.Request{
+		Type: "ERROR",
+	})
+
+	var r irc.Request
+	if parseRequest(&r, []byte(":irc.example.com 001")) {
+		t.Fatalf("expected short request to be rejected")
+	}
+}
+
+func testParseRequest(t *testing.T, in string, want irc.Request) {
+	var have irc.Request
+	if !parseRequest(&have, []byte(in)) {
+		t.Fatalf("parseRequest failed for %q", in)
+	}
+
+	if !reflect.DeepEqual(want, have) {
+		t.Fatalf("request mismatch for %q;\nwant: %#v\nhave: %#v", in, want, have)
+	}
+}
@@ -0,0 +1,124 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/monkeybird/autimaat/irc"
+)
+
+// tlsProfile overrides the TLS settings of a profile.
+type tlsProfile struct {
+	irc.Profile
+	useTLS bool
+	cert   string
+	key    string
+}
+
+func (p *tlsProfile) Address() string { return "irc.example.com:6697" }
+func (p *tlsProfile) UseTLS() bool    { return p.useTLS }
+func (p *tlsProfile) TLSCert() string { return p.cert }
+func (p *tlsProfile) TLSKey() string  { return p.key }
+
+// writeKeyPair writes a self-signed certificate and its key to the given
+// directory. It returns the names of both files.
+func writeKeyPair(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "autimaat"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	base := irc.NewProfile(dir)
+	cert, key := writeKeyPair(t, dir)
+
+	// No TLS at all.
+	config, err := tlsConfig(&tlsProfile{Profile: base})
+	if err != nil || config != nil {
+		t.Fatalf("expected no TLS config; have: %v, %v", config, err)
+	}
+
+	// Encrypted connection without a client certificate.
+	config, err = tlsConfig(&tlsProfile{Profile: base, useTLS: true})
+	if err != nil || config == nil {
+		t.Fatalf("expected TLS config; have: %v, %v", config, err)
+	}
+
+	if len(config.Certificates) != 0 {
+		t.Fatalf("expected no client certificates; have: %d", len(config.Certificates))
+	}
+
+	if config.ServerName != "irc.example.com" {
+		t.Fatalf("server name mismatch;\nwant: %q\nhave: %q", "irc.example.com", config.ServerName)
+	}
+
+	// Encrypted connection with a client certificate. This implies UseTLS.
+	for _, useTLS := range []bool{false, true} {
+		config, err = tlsConfig(&tlsProfile{Profile: base, useTLS: useTLS, cert: cert, key: key})
+		if err != nil || config == nil {
+			t.Fatalf("expected TLS config; have: %v, %v", config, err)
+		}
+
+		if len(config.Certificates) != 1 {
+			t.Fatalf("expected 1 client certificate; have: %d", len(config.Certificates))
+		}
+	}
+
+	// A certificate without a key is not used.
+	config, err = tlsConfig(&tlsProfile{Profile: base, cert: cert})
+	if err != nil || config != nil {
+		t.Fatalf("expected no TLS config; have: %v, %v", config, err)
+	}
+
+	// A broken key pair is an error.
+	_, err = tlsConfig(&tlsProfile{Profile: base, cert: cert, key: cert})
+	if err == nil {
+		t.Fatalf("expected error for invalid key pair")
+	}
+}